@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/server"
+	"github.com/abaxxtech/abaxx-id-go/pkg/store/config"
+)
+
+type dwnServeCMD struct {
+	Listen             string  `help:"Address to listen on." default:":3000"`
+	Store              string  `help:"Where to store messages and data: memory, level or sql." enum:"memory,level,sql" default:"level"`
+	DataDir            string  `help:"Directory of the LevelDB databases." type:"path" default:"data"`
+	BlockstoreLocation string  `help:"Location of the blockstore. Defaults to a blockstore directory under --data-dir." type:"path"`
+	PrefixPartitions   bool    `help:"Keep the messages of all tenants in one LevelDB rather than one per tenant."`
+	MaxFileSize        int64   `help:"Largest record data accepted, in bytes." default:"1073741824"`
+	MaxSubscriptions   int     `help:"Subscriptions a WebSocket connection may hold open." default:"100"`
+	MaxMessageSize     int     `help:"Largest WebSocket message accepted, in bytes." default:"10485760"`
+	ManualMigrations   bool    `help:"Fail to start unless the SQL schema is current, rather than migrating it; see abaxx-id store migrate." group:"SQL store"`
+	DB                 dbFlags `embed:"" prefix:"db-" group:"SQL store"`
+}
+
+type dbFlags struct {
+	Driver   string `help:"Database driver: postgres or sqlite." enum:"postgres,sqlite" default:"postgres" env:"DWN_DB_DRIVER"`
+	Path     string `help:"SQLite database file." type:"path" default:"data/dwn.db" env:"DWN_DB_PATH"`
+	Host     string `help:"Database host." default:"localhost" env:"DWN_DB_HOST"`
+	Port     string `help:"Database port." default:"5432" env:"DWN_DB_PORT"`
+	User     string `help:"Database user." default:"postgres" env:"DWN_DB_USER"`
+	Password string `help:"Database password." default:"postgres" env:"DWN_DB_PASSWORD"`
+	Name     string `help:"Database name." default:"dwn" env:"DWN_DB_NAME"`
+	SSLMode  string `help:"Database SSL mode." default:"disable" env:"DWN_DB_SSLMODE"`
+	DSN      string `help:"Database connection string or URL, in place of the flags above." env:"DWN_DB_DSN"`
+
+	MaxOpenConns    int           `help:"Most open database connections; 0 for no limit, or one with SQLite." env:"DWN_DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `help:"Most idle database connections; 0 for the default." env:"DWN_DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `help:"Longest a database connection is reused; 0 for no limit." env:"DWN_DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `help:"Longest a database connection stays idle; 0 for no limit." env:"DWN_DB_CONN_MAX_IDLE_TIME"`
+}
+
+func (f dbFlags) config() config.DBConfig {
+	return config.DBConfig{
+		Driver:   f.Driver,
+		Path:     f.Path,
+		Host:     f.Host,
+		Port:     f.Port,
+		User:     f.User,
+		Password: f.Password,
+		DBName:   f.Name,
+		SSLMode:  f.SSLMode,
+		DSN:      f.DSN,
+
+		MaxOpenConns:    f.MaxOpenConns,
+		MaxIdleConns:    f.MaxIdleConns,
+		ConnMaxLifetime: f.ConnMaxLifetime,
+		ConnMaxIdleTime: f.ConnMaxIdleTime,
+	}
+}
+
+func (c *dwnServeCMD) Run() error {
+	dbConfig := c.DB.config()
+	dbConfig.ManualMigrations = c.ManualMigrations
+	node, err := server.OpenDwn(server.StoreConfig{
+		Backend:            server.StoreBackend(c.Store),
+		DataDir:            c.DataDir,
+		BlockstoreLocation: c.BlockstoreLocation,
+		PrefixPartitions:   c.PrefixPartitions,
+		DB:                 dbConfig,
+	})
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	httpServer := &http.Server{
+		Addr: c.Listen,
+		Handler: server.New(node, server.Config{
+			MaxFileSize:      c.MaxFileSize,
+			MaxSubscriptions: c.MaxSubscriptions,
+			MaxMessageSize:   c.MaxMessageSize,
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "DWN listening on %s with %s store\n", c.Listen, c.Store)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/store/models"
+)
+
+type storeMigrateCMD struct {
+	To     int     `help:"Schema version to migrate to, up or down; -1 for the latest." default:"-1"`
+	Status bool    `help:"Print the schema version without migrating."`
+	DB     dbFlags `embed:"" prefix:"db-" group:"SQL store"`
+}
+
+func (c *storeMigrateCMD) Run() error {
+	db, err := models.ConnectDB(c.DB.config())
+	if err != nil {
+		return err
+	}
+	defer models.CloseDB(db)
+
+	latest, err := models.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	version, err := models.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if c.Status {
+		fmt.Printf("schema at version %d of %d\n", version, latest)
+		return nil
+	}
+
+	to := c.To
+	if to < 0 {
+		to = latest
+	}
+	applied, err := models.Migrate(db, to)
+	for _, migration := range applied {
+		if migration.Version > version {
+			fmt.Printf("migrated up to %d: %s\n", migration.Version, migration.Name)
+		} else {
+			fmt.Printf("migrated down from %d: %s\n", migration.Version, migration.Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema at version %d of %d\n", to, latest)
+	return nil
+}
@@ -28,6 +28,12 @@ type CLI struct {
 		Verify vcjwtVerifyCMD `cmd:"" help:"Verify a VC-JWT."`
 		Decode vcjwtDecodeCMD `cmd:"" help:"Decode a VC-JWT."`
 	} `cmd:"" help:"Interface with VC-JWT's."`
+	DWN struct {
+		Serve dwnServeCMD `cmd:"" help:"Run a DWN node."`
+	} `cmd:"" help:"Interface with DWN's."`
+	Store struct {
+		Migrate storeMigrateCMD `cmd:"" help:"Migrate the schema of the SQL stores."`
+	} `cmd:"" help:"Interface with the SQL stores."`
 }
 
 func main() {
@@ -0,0 +1,11 @@
+// Package jsonschemas embeds the JSON schemas of DWN messages, so that they
+// ship with the binaries that validate against them.
+package jsonschemas
+
+import "embed"
+
+// FS holds the schemas, keyed by their path in this directory.  Each schema
+// is identified by its $id, which need not match its path.
+//
+//go:embed *.json interface-methods jwk permissions signature-payloads
+var FS embed.FS
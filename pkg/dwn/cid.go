@@ -0,0 +1,26 @@
+package dwn
+
+import (
+	"io"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
+)
+
+// computeCid returns the CID of the canonical DAG-CBOR encoding of v.
+func computeCid(v interface{}) (string, error) {
+	return cid.Compute(v)
+}
+
+// computeMessageCid returns the CID of a DWN message.  `encodedData` is a
+// transport detail and is not part of the message proper, so it is excluded.
+func computeMessageCid(message map[string]interface{}) (MessageCid, error) {
+	c, err := cid.ComputeMessage(message)
+	return MessageCid(c), err
+}
+
+// computeDataCid returns the CID of data as it is given in the dataCid of a
+// RecordsWrite, along with the data size.
+func computeDataCid(data io.Reader) (DataCid, int64, error) {
+	c, n, err := cid.ComputeData(data)
+	return DataCid(c), n, err
+}
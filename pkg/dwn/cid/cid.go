@@ -0,0 +1,230 @@
+// Package cid computes the content identifiers of DWN messages and data the
+// way the reference implementation does, so that a message has the same CID
+// in every store and on every node.
+//
+// Messages are hashed as canonical DAG-CBOR: map keys sorted length first,
+// integers in their shortest form and other numbers as 64-bit floats.  Data
+// is chunked into a UnixFS DAG with raw leaves.
+package cid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	chunker "github.com/ipfs/boxo/chunker"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	gocid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// maxSafeInteger is the largest integer a JavaScript number holds exactly.
+// The reference implementation encodes integral numbers up to it as CBOR
+// integers.
+const maxSafeInteger = 1<<53 - 1
+
+var dagCbor cbor.EncMode
+
+func init() {
+	var err error
+	dagCbor, err = cbor.EncOptions{
+		Sort:          cbor.SortCanonical,
+		ShortestFloat: cbor.ShortestFloatNone,
+		NaNConvert:    cbor.NaNConvertNone,
+		InfConvert:    cbor.InfConvertNone,
+		IndefLength:   cbor.IndefLengthForbidden,
+		TagsMd:        cbor.TagsForbidden,
+	}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Encode returns the canonical DAG-CBOR encoding of v and its CID.  v is
+// encoded as its JSON form, so structs and maps holding the same JSON encode
+// alike.
+func Encode(v interface{}) (gocid.Cid, []byte, error) {
+	value, err := normalize(v)
+	if err != nil {
+		return gocid.Undef, nil, err
+	}
+	return encode(value)
+}
+
+// Compute returns the CID of the canonical DAG-CBOR encoding of v, as used
+// for descriptor CIDs and record IDs.
+func Compute(v interface{}) (string, error) {
+	c, _, err := Encode(v)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// EncodeMessage returns the canonical DAG-CBOR encoding of a message and its
+// CID.  `encodedData` is a transport detail and not part of the message
+// proper, so it is left out of both.
+func EncodeMessage(message interface{}) (gocid.Cid, []byte, error) {
+	value, err := normalize(message)
+	if err != nil {
+		return gocid.Undef, nil, err
+	}
+	if m, ok := value.(map[string]interface{}); ok {
+		delete(m, "encodedData")
+	}
+	return encode(value)
+}
+
+// ComputeMessage returns the CID of a message, without its `encodedData`.
+func ComputeMessage(message interface{}) (string, error) {
+	c, _, err := EncodeMessage(message)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// ComputeData chunks data into a UnixFS DAG, using CIDv1 with raw leaves
+// like the reference implementation, and returns the root CID along with the
+// number of bytes read.  Data that fits in one chunk is its own raw leaf.
+func ComputeData(data io.Reader) (string, int64, error) {
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	dagService := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+
+	counter := &countingReader{r: data}
+	params := helpers.DagBuilderParams{
+		Dagserv:    dagService,
+		RawLeaves:  true,
+		Maxlinks:   helpers.DefaultLinksPerBlock,
+		CidBuilder: gocid.V1Builder{Codec: gocid.DagProtobuf, MhType: mh.SHA2_256},
+	}
+	builder, err := params.New(chunker.NewSizeSplitter(counter, chunker.DefaultBlockSize))
+	if err != nil {
+		return "", 0, err
+	}
+
+	root, err := balanced.Layout(builder)
+	if err != nil {
+		return "", 0, err
+	}
+	return root.Cid().String(), counter.n, nil
+}
+
+// ValidateMessageCid checks that s is a CIDv1 of DAG-CBOR hashed with
+// SHA2-256, as message CIDs are.
+func ValidateMessageCid(s string) error {
+	return validate(s, gocid.DagCBOR)
+}
+
+// ValidateDataCid checks that s is a CIDv1 hashed with SHA2-256 of a UnixFS
+// DAG, or of the raw leaf that holds data fitting in one chunk.
+func ValidateDataCid(s string) error {
+	return validate(s, gocid.Raw, gocid.DagProtobuf)
+}
+
+func validate(s string, codecs ...uint64) error {
+	c, err := gocid.Decode(s)
+	if err != nil {
+		return fmt.Errorf("invalid CID %s: %w", s, err)
+	}
+	if c.Version() != 1 {
+		return fmt.Errorf("invalid CID %s: only CIDv1 is supported", s)
+	}
+	supported := false
+	for _, codec := range codecs {
+		supported = supported || c.Type() == codec
+	}
+	if !supported {
+		return fmt.Errorf("invalid CID %s: unexpected codec %#x", s, c.Type())
+	}
+	if c.Prefix().MhType != mh.SHA2_256 {
+		return fmt.Errorf("invalid CID %s: only sha2-256 is supported", s)
+	}
+	return nil
+}
+
+func encode(value interface{}) (gocid.Cid, []byte, error) {
+	encoded, err := dagCbor.Marshal(value)
+	if err != nil {
+		return gocid.Undef, nil, fmt.Errorf("failed to encode object: %w", err)
+	}
+	c, err := gocid.V1Builder{Codec: gocid.DagCBOR, MhType: mh.SHA2_256}.Sum(encoded)
+	if err != nil {
+		return gocid.Undef, nil, err
+	}
+	return c, encoded, nil
+}
+
+// normalize returns the JSON form of v, with numbers converted to the types
+// they are encoded as.
+func normalize(v interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode object: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to encode object: %w", err)
+	}
+	return normalizeNumbers(value)
+}
+
+func normalizeNumbers(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			normalized, err := normalizeNumbers(v)
+			if err != nil {
+				return nil, err
+			}
+			value[k] = normalized
+		}
+		return value, nil
+	case []interface{}:
+		for i, v := range value {
+			normalized, err := normalizeNumbers(v)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = normalized
+		}
+		return value, nil
+	case json.Number:
+		if i, err := value.Int64(); err == nil && i >= -maxSafeInteger && i <= maxSafeInteger {
+			return i, nil
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s: %w", value, err)
+		}
+		if f == math.Trunc(f) && math.Abs(f) <= maxSafeInteger {
+			return int64(f), nil
+		}
+		return f, nil
+	default:
+		return value, nil
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,111 @@
+package cid
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	gocid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	t.Run("is canonical DAG-CBOR", func(t *testing.T) {
+		_, encoded, err := Encode(map[string]interface{}{"bb": 1, "a": 1.5, "c": []interface{}{true, nil}})
+		require.NoError(t, err)
+		// Keys sorted length first, 1 as an integer and 1.5 as a 64-bit
+		// float.
+		assert.Equal(t, "a3"+"6161"+"fb3ff8000000000000"+"6163"+"82f5f6"+"626262"+"01",
+			hex.EncodeToString(encoded))
+	})
+
+	t.Run("hashes the empty map like the reference implementation", func(t *testing.T) {
+		c, err := Compute(map[string]interface{}{})
+		require.NoError(t, err)
+		assert.Equal(t, "bafyreigbtj4x7ip5legnfznufuopl4sg4knzc2cof6duas4b3q2fy6swua", c)
+	})
+
+	t.Run("encodes the JSON form of values", func(t *testing.T) {
+		type descriptor struct {
+			DataSize  int64  `json:"dataSize"`
+			Published bool   `json:"published,omitempty"`
+			Schema    string `json:"schema"`
+		}
+		fromStruct, err := Compute(descriptor{DataSize: 5, Schema: "post"})
+		require.NoError(t, err)
+		fromJson, err := Compute(map[string]interface{}{"schema": "post", "dataSize": float64(5)})
+		require.NoError(t, err)
+		assert.Equal(t, fromStruct, fromJson)
+	})
+
+	t.Run("keeps fractions and unsafe integers as floats", func(t *testing.T) {
+		for _, n := range []float64{0.5, 1 << 60} {
+			_, encoded, err := Encode(n)
+			require.NoError(t, err)
+			assert.Equal(t, byte(0xfb), encoded[0])
+		}
+	})
+}
+
+func TestComputeMessage(t *testing.T) {
+	message := map[string]interface{}{
+		"descriptor": map[string]interface{}{"interface": "Records", "method": "Write"},
+	}
+	expected, err := ComputeMessage(message)
+	require.NoError(t, err)
+	assert.NoError(t, ValidateMessageCid(expected))
+
+	withData := map[string]interface{}{"descriptor": message["descriptor"], "encodedData": "aGVsbG8"}
+	actual, err := ComputeMessage(withData)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	assert.Contains(t, withData, "encodedData")
+}
+
+func TestComputeData(t *testing.T) {
+	t.Run("small data is a raw leaf", func(t *testing.T) {
+		data := []byte("hello")
+		dataCid, dataSize, err := ComputeData(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), dataSize)
+		assert.NoError(t, ValidateDataCid(dataCid))
+
+		hash, err := mh.Sum(data, mh.SHA2_256, -1)
+		require.NoError(t, err)
+		assert.Equal(t, gocid.NewCidV1(gocid.Raw, hash).String(), dataCid)
+	})
+
+	t.Run("large data is a UnixFS DAG", func(t *testing.T) {
+		data := bytes.Repeat([]byte("0123456789"), 100000)
+		dataCid, dataSize, err := ComputeData(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), dataSize)
+		assert.NoError(t, ValidateDataCid(dataCid))
+
+		decoded, err := gocid.Decode(dataCid)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(gocid.DagProtobuf), decoded.Type())
+	})
+}
+
+func TestValidate(t *testing.T) {
+	messageCid, err := Compute(map[string]interface{}{})
+	require.NoError(t, err)
+	dataCid, _, err := ComputeData(bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	hash, err := mh.Sum([]byte("hello"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	sha512, err := mh.Sum([]byte("hello"), mh.SHA2_512, -1)
+	require.NoError(t, err)
+
+	assert.NoError(t, ValidateMessageCid(messageCid))
+	assert.Error(t, ValidateMessageCid(dataCid))
+	assert.Error(t, ValidateMessageCid(gocid.NewCidV0(hash).String()))
+	assert.Error(t, ValidateMessageCid(gocid.NewCidV1(gocid.DagCBOR, sha512).String()))
+	assert.Error(t, ValidateMessageCid("bafyunknown"))
+
+	assert.NoError(t, ValidateDataCid(dataCid))
+	assert.Error(t, ValidateDataCid(messageCid))
+}
@@ -0,0 +1,244 @@
+// Package client talks to remote DWNs.  It builds and signs messages on
+// behalf of a BearerDID, finds the DWN endpoints of their targets in their
+// DID documents and sends the messages over the JSON-RPC protocol served by
+// pkg/dwn/server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/didcore"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/jsonrpc"
+	"github.com/google/uuid"
+)
+
+// ServiceType is the type of the DID document service listing the DWN
+// endpoints of a DID.
+const ServiceType = "DecentralizedWebNode"
+
+// maxResponseSize bounds a JSON-RPC response read from the HTTP body.
+const maxResponseSize = 64 << 20
+
+// ErrNoEndpoint is returned when the DID document of a target lists no DWN
+// endpoint.
+var ErrNoEndpoint = errors.New("no DWN endpoint in DID document")
+
+type Config struct {
+	// DidResolver resolves the DID documents of targets.  It defaults to
+	// resolving did:dht, did:jwk and did:web.
+	DidResolver *dwn.DidResolver
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Client sends messages signed by one DID to the DWNs of any target.
+type Client struct {
+	signer _did.BearerDID
+	config Config
+}
+
+func New(signer _did.BearerDID, config Config) *Client {
+	if config.DidResolver == nil {
+		config.DidResolver = dwn.NewDidResolver(nil, nil)
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &Client{signer: signer, config: config}
+}
+
+// StatusError is returned for a reply with an error status.
+type StatusError struct {
+	Status dwn.Status
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("DWN replied %d: %s", e.Status.Code, e.Status.Detail)
+}
+
+// checkStatus returns a StatusError if the reply reports one.
+func checkStatus(reply dwn.UnionMessageReply) error {
+	if reply.Status.Code >= 400 {
+		return &StatusError{Status: reply.Status}
+	}
+	return nil
+}
+
+// Endpoints returns the DWN endpoints listed in the DID document of target.
+func (c *Client) Endpoints(target string) ([]string, error) {
+	resolution, err := c.config.DidResolver.Resolve(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", target, err)
+	}
+	if resolution.DidResolutionMetadata.Error != "" {
+		return nil, fmt.Errorf("failed to resolve %s: %s", target, resolution.DidResolutionMetadata.Error)
+	}
+	document, err := toDidDocument(resolution.DidDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []string
+	for _, service := range document.Service {
+		if service.Type == ServiceType {
+			endpoints = append(endpoints, serviceEndpoints(service.ServiceEndpoint)...)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("%w of %s", ErrNoEndpoint, target)
+	}
+	return endpoints, nil
+}
+
+// serviceEndpoints returns the URLs of a service endpoint, which is a URL, a
+// list of them, or an object listing them as `nodes`.
+func serviceEndpoints(endpoint interface{}) []string {
+	switch e := endpoint.(type) {
+	case string:
+		return []string{e}
+	case []string:
+		return e
+	case []interface{}:
+		var urls []string
+		for _, v := range e {
+			urls = append(urls, serviceEndpoints(v)...)
+		}
+		return urls
+	case map[string]interface{}:
+		return serviceEndpoints(e["nodes"])
+	}
+	return nil
+}
+
+// toDidDocument returns a resolved DID document as a didcore.Document.
+func toDidDocument(document interface{}) (didcore.Document, error) {
+	switch d := document.(type) {
+	case didcore.Document:
+		return d, nil
+	case *didcore.Document:
+		if d != nil {
+			return *d, nil
+		}
+	}
+
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return didcore.Document{}, fmt.Errorf("malformed DID document: %w", err)
+	}
+	var parsed didcore.Document
+	if err := json.Unmarshal(encoded, &parsed); err != nil {
+		return didcore.Document{}, fmt.Errorf("malformed DID document: %w", err)
+	}
+	return parsed, nil
+}
+
+// Send sends a message with its data, if any, to the DWN of target, trying
+// its endpoints in turn until one answers.  The Data of the reply, if not
+// nil, streams record data and must be closed.
+//
+// The status of the reply is left to the caller; JSON-RPC errors are
+// returned as *jsonrpc.Error.
+func (c *Client) Send(ctx context.Context, target string, message map[string]interface{},
+	data []byte) (dwn.UnionMessageReply, error) {
+	endpoints, err := c.Endpoints(target)
+	if err != nil {
+		return dwn.UnionMessageReply{}, err
+	}
+
+	request, err := jsonrpc.NewRequest(uuid.New().String(), jsonrpc.MethodProcessMessage,
+		jsonrpc.ProcessMessageParams{Target: target, Message: message})
+	if err != nil {
+		return dwn.UnionMessageReply{}, err
+	}
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return dwn.UnionMessageReply{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	var errs []error
+	for _, endpoint := range endpoints {
+		reply, err := c.post(ctx, endpoint, encoded, data)
+		if err == nil {
+			return reply, nil
+		}
+		// The DWN answered; another endpoint would not do better.
+		var rpcErr *jsonrpc.Error
+		if errors.As(err, &rpcErr) || ctx.Err() != nil {
+			return dwn.UnionMessageReply{}, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+	}
+	return dwn.UnionMessageReply{}, errors.Join(errs...)
+}
+
+// post sends an encoded JSON-RPC request to endpoint.  Data is sent as the
+// body with the request in the dwn-request header.
+func (c *Client) post(ctx context.Context, endpoint string, request []byte,
+	data []byte) (dwn.UnionMessageReply, error) {
+	body, contentType := request, "application/json"
+	if data != nil {
+		body, contentType = data, "application/octet-stream"
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return dwn.UnionMessageReply{}, err
+	}
+	httpRequest.Header.Set("Content-Type", contentType)
+	if data != nil {
+		httpRequest.Header.Set(jsonrpc.HeaderDwnRequest, string(request))
+	}
+
+	resp, err := c.config.HTTPClient.Do(httpRequest)
+	if err != nil {
+		return dwn.UnionMessageReply{}, err
+	}
+
+	// Record data is streamed as the body, with the response in the
+	// dwn-response header.
+	if header := resp.Header.Get(jsonrpc.HeaderDwnResponse); header != "" {
+		reply, err := decodeResponse([]byte(header))
+		if err != nil {
+			resp.Body.Close()
+			return dwn.UnionMessageReply{}, err
+		}
+		reply.Data = resp.Body
+		return reply, nil
+	}
+
+	defer resp.Body.Close()
+	encoded, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return dwn.UnionMessageReply{}, fmt.Errorf("failed to read response: %w", err)
+	}
+	reply, err := decodeResponse(encoded)
+	if err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return dwn.UnionMessageReply{}, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		}
+		return dwn.UnionMessageReply{}, err
+	}
+	return reply, nil
+}
+
+func decodeResponse(encoded []byte) (dwn.UnionMessageReply, error) {
+	var response jsonrpc.Response
+	if err := json.Unmarshal(encoded, &response); err != nil {
+		return dwn.UnionMessageReply{}, fmt.Errorf("malformed response: %w", err)
+	}
+	if response.Error != nil {
+		return dwn.UnionMessageReply{}, response.Error
+	}
+	var result jsonrpc.ProcessMessageResult
+	if err := json.Unmarshal(response.Result, &result); err != nil {
+		return dwn.UnionMessageReply{}, fmt.Errorf("malformed result: %w", err)
+	}
+	return result.Reply, nil
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/didcore"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/didjwk"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testResolver resolves did:jwk DIDs, adding a DecentralizedWebNode service
+// with the given endpoint to their documents.
+type testResolver struct {
+	endpoint interface{}
+}
+
+func (r testResolver) Method() string {
+	return "jwk"
+}
+
+func (r testResolver) Resolve(did string) (dwn.DidResolutionResult, error) {
+	result, err := didjwk.Resolver{}.Resolve(did)
+	if err != nil {
+		return dwn.DidResolutionResult{}, err
+	}
+	document := result.Document
+	if r.endpoint != nil {
+		document.AddService(didcore.Service{ID: "#dwn", Type: ServiceType, ServiceEndpoint: r.endpoint})
+	}
+	return dwn.DidResolutionResult{DidDocument: document}, nil
+}
+
+func newTestClient(endpoint interface{}, signer _did.BearerDID) *Client {
+	resolver := dwn.NewDidResolver([]dwn.DidMethodResolver{testResolver{endpoint: endpoint}}, nil)
+	return New(signer, Config{DidResolver: resolver})
+}
+
+// startTestDwn serves a DWN with in-memory stores and returns its URL.
+func startTestDwn(t *testing.T) string {
+	t.Helper()
+	node, err := server.OpenDwn(server.StoreConfig{Backend: server.StoreMemory, DataDir: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { node.Close() })
+	httpServer := httptest.NewServer(server.New(node, server.Config{}))
+	t.Cleanup(httpServer.Close)
+	return httpServer.URL
+}
+
+func newTestPersona(t *testing.T) _did.BearerDID {
+	t.Helper()
+	bearerDID, err := didjwk.Create()
+	require.NoError(t, err)
+	return bearerDID
+}
+
+func readTestData(t *testing.T, data io.ReadCloser) string {
+	t.Helper()
+	defer data.Close()
+	content, err := io.ReadAll(data)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestEndpoints(t *testing.T) {
+	alice := newTestPersona(t)
+	tests := []struct {
+		name     string
+		endpoint interface{}
+		expected []string
+	}{
+		{"a URL", "https://dwn.example.com", []string{"https://dwn.example.com"}},
+		{"a list", []string{"https://a.example.com", "https://b.example.com"},
+			[]string{"https://a.example.com", "https://b.example.com"}},
+		{"nodes", map[string]interface{}{"nodes": []interface{}{"https://a.example.com"}},
+			[]string{"https://a.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoints, err := newTestClient(tt.endpoint, alice).Endpoints(alice.URI)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, endpoints)
+		})
+	}
+
+	_, err := newTestClient(nil, alice).Endpoints(alice.URI)
+	assert.ErrorIs(t, err, ErrNoEndpoint)
+}
+
+func TestSendTriesEveryEndpoint(t *testing.T) {
+	alice := newTestPersona(t)
+	endpoint := startTestDwn(t)
+	client := newTestClient([]string{"http://127.0.0.1:1", endpoint}, alice)
+
+	reply, err := client.ProtocolsQuery(context.Background(), alice.URI, ProtocolsQueryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 200, reply.Status.Code)
+}
+
+func TestRecords(t *testing.T) {
+	ctx := context.Background()
+	alice := newTestPersona(t)
+	client := newTestClient(startTestDwn(t), alice)
+
+	written, err := client.RecordsWrite(ctx, alice.URI, RecordsWriteOptions{
+		Data:       []byte("hello"),
+		DataFormat: "text/plain",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 202, written.Status.Code)
+	recordId := written.Message["recordId"].(string)
+
+	updated, err := client.RecordsWrite(ctx, alice.URI, RecordsWriteOptions{
+		Data:       []byte("hello again"),
+		DataFormat: "text/plain",
+		Update:     written.Message,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, recordId, updated.Message["recordId"])
+
+	read, err := client.RecordsRead(ctx, alice.URI, RecordsReadOptions{Filter: dwn.RecordsFilter{RecordId: recordId}})
+	require.NoError(t, err)
+	assert.Equal(t, recordId, read.Record.RecordId)
+	assert.Equal(t, "text/plain", read.Record.Descriptor.DataFormat)
+	assert.Equal(t, "hello again", readTestData(t, read.Data))
+
+	query, err := client.RecordsQuery(ctx, alice.URI, RecordsQueryOptions{
+		Filter: dwn.RecordsFilter{DataFormat: "text/plain"},
+	})
+	require.NoError(t, err)
+	require.Len(t, query.Entries, 1)
+	assert.Equal(t, recordId, query.Entries[0].RecordId)
+	assert.NotNil(t, query.Entries[0].InitialWrite)
+
+	deleted, err := client.RecordsDelete(ctx, alice.URI, RecordsDeleteOptions{RecordId: recordId})
+	require.NoError(t, err)
+	assert.Equal(t, 202, deleted.Status.Code)
+
+	_, err = client.RecordsRead(ctx, alice.URI, RecordsReadOptions{Filter: dwn.RecordsFilter{RecordId: recordId}})
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, 404, statusErr.Status.Code)
+}
+
+func TestProtocols(t *testing.T) {
+	ctx := context.Background()
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	endpoint := startTestDwn(t)
+	aliceClient := newTestClient(endpoint, alice)
+	bobClient := newTestClient(endpoint, bob)
+
+	definition := dwn.ProtocolDefinition{
+		Protocol:  "http://example.com/guestbook",
+		Published: true,
+		Types:     map[string]dwn.ProtocolType{"entry": {DataFormats: []string{"text/plain"}}},
+		Structure: map[string]dwn.ProtocolRuleSet{"entry": {
+			Actions: []dwn.ProtocolAction{{Who: "anyone", Can: []string{dwn.ActionCreate, dwn.ActionRead}}},
+		}},
+	}
+	configured, err := aliceClient.ProtocolsConfigure(ctx, alice.URI, ProtocolsConfigureOptions{Definition: definition})
+	require.NoError(t, err)
+	assert.Equal(t, 202, configured.Status.Code)
+
+	protocols, err := bobClient.ProtocolsQuery(ctx, alice.URI, ProtocolsQueryOptions{Protocol: definition.Protocol})
+	require.NoError(t, err)
+	require.Len(t, protocols.Entries, 1)
+	assert.Equal(t, definition.Protocol, protocols.Entries[0].Descriptor.Definition.Protocol)
+
+	entry, err := bobClient.RecordsWrite(ctx, alice.URI, RecordsWriteOptions{
+		Data:         []byte("bob was here"),
+		DataFormat:   "text/plain",
+		Protocol:     definition.Protocol,
+		ProtocolPath: "entry",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, entry.Message["recordId"], entry.Message["contextId"])
+
+	read, err := aliceClient.RecordsRead(ctx, alice.URI, RecordsReadOptions{
+		Filter: dwn.RecordsFilter{RecordId: entry.Message["recordId"].(string)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "bob was here", readTestData(t, read.Data))
+}
+
+func TestPermissions(t *testing.T) {
+	ctx := context.Background()
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	endpoint := startTestDwn(t)
+	aliceClient := newTestClient(endpoint, alice)
+	bobClient := newTestClient(endpoint, bob)
+	scope := dwn.PermissionScope{Interface: dwn.InterfaceRecords, Method: dwn.MethodWrite}
+
+	request, err := bobClient.PermissionsRequest(ctx, alice.URI, PermissionsRequestOptions{
+		GrantedBy: alice.URI,
+		Scope:     scope,
+	})
+	require.NoError(t, err)
+	requestId, err := request.MessageCid()
+	require.NoError(t, err)
+
+	grant, err := aliceClient.PermissionsGrant(ctx, alice.URI, PermissionsGrantOptions{
+		GrantedTo:            bob.URI,
+		DateExpires:          time.Now().Add(time.Hour),
+		PermissionsRequestId: requestId,
+		Scope:                scope,
+	})
+	require.NoError(t, err)
+	grantId, err := grant.MessageCid()
+	require.NoError(t, err)
+
+	write := RecordsWriteOptions{Data: []byte("granted"), Authorization: AuthorizationOptions{PermissionGrantId: grantId}}
+	_, err = bobClient.RecordsWrite(ctx, alice.URI, write)
+	require.NoError(t, err)
+
+	_, err = aliceClient.PermissionsRevoke(ctx, alice.URI, grantId)
+	require.NoError(t, err)
+	_, err = bobClient.RecordsWrite(ctx, alice.URI, write)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, 401, statusErr.Status.Code)
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
+)
+
+// Options of the messages sent by the client; see the builders of pkg/dwn.
+// The signer of their Authorization defaults to the signer of the client.
+type (
+	AuthorizationOptions      = dwn.AuthorizationOptions
+	RecordsWriteOptions       = dwn.RecordsWriteOptions
+	RecordsReadOptions        = dwn.RecordsReadOptions
+	RecordsQueryOptions       = dwn.RecordsQueryOptions
+	RecordsDeleteOptions      = dwn.RecordsDeleteOptions
+	ProtocolsConfigureOptions = dwn.ProtocolsConfigureOptions
+	ProtocolsQueryOptions     = dwn.ProtocolsQueryOptions
+	PermissionsRequestOptions = dwn.PermissionsRequestOptions
+	PermissionsGrantOptions   = dwn.PermissionsGrantOptions
+)
+
+// authorize makes the client sign with authorization unless it names
+// another signer.
+func (c *Client) authorize(authorization *AuthorizationOptions) {
+	if authorization.Signer == nil {
+		authorization.Signer = &c.signer
+	}
+}
+
+// MessageReply is the reply to a message that the DWN stores.
+type MessageReply struct {
+	Status dwn.Status
+	// Message is the message sent.
+	Message map[string]interface{}
+}
+
+// MessageCid returns the CID of the message sent, by which later messages
+// refer to it.
+func (r *MessageReply) MessageCid() (string, error) {
+	return cid.ComputeMessage(r.Message)
+}
+
+// sendMessage sends message to target, returning a StatusError unless it is
+// accepted.
+func (c *Client) sendMessage(ctx context.Context, target string, message map[string]interface{},
+	data []byte) (*MessageReply, error) {
+	reply, err := c.Send(ctx, target, message, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(reply); err != nil {
+		return nil, err
+	}
+	return &MessageReply{Status: reply.Status, Message: message}, nil
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+)
+
+// PermissionsRequest asks for a grant to the signer, storing the request in
+// the DWN of target.
+func (c *Client) PermissionsRequest(ctx context.Context, target string,
+	opts PermissionsRequestOptions) (*MessageReply, error) {
+	c.authorize(&opts.Authorization)
+	message, err := dwn.NewPermissionsRequest(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMessage(ctx, target, message, nil)
+}
+
+// PermissionsGrant grants permissions from the signer, storing the grant in
+// the DWN of target.  The MessageCid of the reply is the ID of the grant.
+func (c *Client) PermissionsGrant(ctx context.Context, target string,
+	opts PermissionsGrantOptions) (*MessageReply, error) {
+	c.authorize(&opts.Authorization)
+	message, err := dwn.NewPermissionsGrant(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMessage(ctx, target, message, nil)
+}
+
+// PermissionsRevoke revokes a grant given by the signer, from now on, in the
+// DWN of target.
+func (c *Client) PermissionsRevoke(ctx context.Context, target string, permissionsGrantId string) (*MessageReply, error) {
+	message, err := dwn.NewPermissionsRevoke(dwn.PermissionsRevokeOptions{
+		PermissionsGrantId: permissionsGrantId,
+		Authorization:      AuthorizationOptions{Signer: &c.signer},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMessage(ctx, target, message, nil)
+}
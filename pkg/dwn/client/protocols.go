@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+)
+
+// ProtocolsConfigure installs a protocol on the DWN of target.
+func (c *Client) ProtocolsConfigure(ctx context.Context, target string,
+	opts ProtocolsConfigureOptions) (*MessageReply, error) {
+	c.authorize(&opts.Authorization)
+	message, err := dwn.NewProtocolsConfigure(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMessage(ctx, target, message, nil)
+}
+
+type ProtocolsQueryReply struct {
+	Status  dwn.Status
+	Entries []dwn.ProtocolsConfigure
+}
+
+// ProtocolsQuery queries the protocols installed on the DWN of target.
+// Only published protocols are returned unless the signer owns the DWN.
+func (c *Client) ProtocolsQuery(ctx context.Context, target string,
+	opts ProtocolsQueryOptions) (*ProtocolsQueryReply, error) {
+	c.authorize(&opts.Authorization)
+	message, err := dwn.NewProtocolsQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.Send(ctx, target, message, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(reply); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(reply.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("malformed entries: %w", err)
+	}
+	entries := []dwn.ProtocolsConfigure{}
+	if err := json.Unmarshal(encoded, &entries); err != nil {
+		return nil, fmt.Errorf("malformed entries: %w", err)
+	}
+	return &ProtocolsQueryReply{Status: reply.Status, Entries: entries}, nil
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+)
+
+// RecordsWrite writes a record to the DWN of target.  The Message of the
+// reply is the RecordsWrite, to pass as the Parent or Update of later
+// writes.
+func (c *Client) RecordsWrite(ctx context.Context, target string, opts RecordsWriteOptions) (*MessageReply, error) {
+	c.authorize(&opts.Authorization)
+	message, err := dwn.NewRecordsWrite(opts)
+	if err != nil {
+		return nil, err
+	}
+	data := opts.Data
+	if data == nil {
+		data = []byte{}
+	}
+	return c.sendMessage(ctx, target, message, data)
+}
+
+// Record is a RecordsWrite returned by RecordsRead or RecordsQuery.
+type Record struct {
+	RecordId      string                 `json:"recordId"`
+	ContextId     string                 `json:"contextId,omitempty"`
+	Descriptor    dwn.Descriptor         `json:"descriptor"`
+	Authorization dwn.AuthorizationOwner `json:"authorization"`
+
+	// EncodedData is the base64url encoded data of a RecordsQuery entry,
+	// when it is small enough to be returned inline.
+	EncodedData string `json:"encodedData,omitempty"`
+	// InitialWrite is the initial write of the record, if this is a later
+	// write to it.
+	InitialWrite map[string]interface{} `json:"initialWrite,omitempty"`
+}
+
+func decodeRecord(message map[string]interface{}) (Record, error) {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return Record{}, fmt.Errorf("malformed record: %w", err)
+	}
+	var record Record
+	if err := json.Unmarshal(encoded, &record); err != nil {
+		return Record{}, fmt.Errorf("malformed record: %w", err)
+	}
+	return record, nil
+}
+
+type RecordsReadReply struct {
+	Status dwn.Status
+	Record Record
+	// Data streams the data of the record and must be closed.
+	Data io.ReadCloser
+}
+
+// RecordsRead reads the record matching the filter from the DWN of target.
+func (c *Client) RecordsRead(ctx context.Context, target string, opts RecordsReadOptions) (*RecordsReadReply, error) {
+	c.authorize(&opts.Authorization)
+	message, err := dwn.NewRecordsRead(opts)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.Send(ctx, target, message, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := reply.Data.(io.ReadCloser)
+	if err := checkStatus(reply); err != nil {
+		if data != nil {
+			data.Close()
+		}
+		return nil, err
+	}
+
+	record, err := decodeRecord(reply.Record)
+	if err != nil {
+		if data != nil {
+			data.Close()
+		}
+		return nil, err
+	}
+	if data == nil {
+		data = io.NopCloser(bytes.NewReader(nil))
+	}
+	return &RecordsReadReply{Status: reply.Status, Record: record, Data: data}, nil
+}
+
+type RecordsQueryReply struct {
+	Status  dwn.Status
+	Entries []Record
+	// Cursor, if not nil, continues the query in the Pagination of the next.
+	Cursor *dwn.PaginationCursor
+}
+
+// RecordsQuery queries the records matching the filter in the DWN of target.
+func (c *Client) RecordsQuery(ctx context.Context, target string, opts RecordsQueryOptions) (*RecordsQueryReply, error) {
+	c.authorize(&opts.Authorization)
+	message, err := dwn.NewRecordsQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.Send(ctx, target, message, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(reply); err != nil {
+		return nil, err
+	}
+
+	entries := make([]Record, 0, len(reply.Entries))
+	for _, entry := range reply.Entries {
+		record, err := decodeRecord(entry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, record)
+	}
+	return &RecordsQueryReply{Status: reply.Status, Entries: entries, Cursor: reply.Cursor}, nil
+}
+
+// RecordsDelete deletes a record from the DWN of target.
+func (c *Client) RecordsDelete(ctx context.Context, target string, opts RecordsDeleteOptions) (*MessageReply, error) {
+	c.authorize(&opts.Authorization)
+	message, err := dwn.NewRecordsDelete(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendMessage(ctx, target, message, nil)
+}
@@ -1,27 +1,39 @@
 package dwn
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
-	"time"
+	"sync"
 )
 
 // Blob represents a binary large object
 type Blob []byte
 
+type memoryDataKey struct {
+	tenant  Tenant
+	dataCid DataCid
+}
+
 // DataStore
-// MemoryDatastore implements the DataStore interface using in-memory storage
+// MemoryDatastore implements the DataStore interface using in-memory storage.
+// Data is reference counted per tenant: the blob for a dataCid is only
+// freed once no message refers to it.
 type MemoryDatastore struct {
-	data map[DataCid]Blob
+	mu   sync.RWMutex
+	data map[memoryDataKey]Blob
 
-	associated map[MessageCid]DataCid
+	associated map[memoryDataKey]map[MessageCid]struct{}
 }
 
 func NewMemoryDatastore() DataStore {
 	return &MemoryDatastore{
-		data:       map[DataCid]Blob{},
-		associated: map[MessageCid]DataCid{},
+		data:       map[memoryDataKey]Blob{},
+		associated: map[memoryDataKey]map[MessageCid]struct{}{},
 	}
 }
 
@@ -35,44 +47,111 @@ func (*MemoryDatastore) Close() error {
 
 func (m *MemoryDatastore) Put(tenant Tenant, messageCid MessageCid, dataCid DataCid,
 	dataStream io.Reader) (resultCid DataCid, dataSize int64, err error) {
-	return "", 0, nil
+	data, err := io.ReadAll(dataStream)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read data stream: %w", err)
+	}
+
+	resultCid, dataSize, err = computeDataCid(bytes.NewReader(data))
+	if err != nil {
+		return "", 0, err
+	}
+	if dataCid != "" && dataCid != resultCid {
+		return "", 0, fmt.Errorf("computed data CID %s does not match expected %s", resultCid, dataCid)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryDataKey{tenant, resultCid}
+	m.data[key] = data
+	m.addReference(key, messageCid)
+
+	return resultCid, dataSize, nil
 }
 
-func (m *MemoryDatastore) Get(Tenant, MessageCid, DataCid) (dataCid DataCid,
-	dataSize int64, dataStream io.Reader,
-	err error) {
-	return "", 0, nil, nil
+func (m *MemoryDatastore) Get(tenant Tenant, messageCid MessageCid, dataCid DataCid) (DataCid,
+	int64, io.Reader, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key := memoryDataKey{tenant, dataCid}
+	if _, ok := m.associated[key][messageCid]; !ok {
+		return "", 0, nil, nil
+	}
+	data, ok := m.data[key]
+	if !ok {
+		return "", 0, nil, nil
+	}
+
+	return dataCid, int64(len(data)), bytes.NewReader(data), nil
 }
 
-func (m *MemoryDatastore) Associate(Tenant, MessageCid, DataCid) (dataCid DataCid,
-	dataSize int64, err error) {
-	return "", 0, nil
+func (m *MemoryDatastore) Associate(tenant Tenant, messageCid MessageCid, dataCid DataCid) (DataCid,
+	int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryDataKey{tenant, dataCid}
+	data, ok := m.data[key]
+	if !ok {
+		return "", 0, nil
+	}
+	m.addReference(key, messageCid)
+
+	return dataCid, int64(len(data)), nil
 }
 
-func (m *MemoryDatastore) Delete(Tenant, MessageCid, DataCid) (err error) {
-	return nil
+func (m *MemoryDatastore) Delete(tenant Tenant, messageCid MessageCid, dataCid DataCid) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryDataKey{tenant, dataCid}
+	delete(m.associated[key], messageCid)
+	if len(m.associated[key]) == 0 {
+		delete(m.associated, key)
+		delete(m.data, key)
+	}
 
+	return nil
 }
 
 func (m *MemoryDatastore) Clear() (err error) {
-	m.associated = make(map[MessageCid]DataCid)
-	m.data = make(map[DataCid]Blob)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.associated = make(map[memoryDataKey]map[MessageCid]struct{})
+	m.data = make(map[memoryDataKey]Blob)
 
 	return nil
 }
 
+func (m *MemoryDatastore) addReference(key memoryDataKey, messageCid MessageCid) {
+	refs, ok := m.associated[key]
+	if !ok {
+		refs = map[MessageCid]struct{}{}
+		m.associated[key] = refs
+	}
+	refs[messageCid] = struct{}{}
+}
+
 // MessageStore
 type Event struct {
 	cid       MessageCid
+	watermark EventLogCursor
 	indexable map[string]IndexableValue
 }
 
+// MemoryEventLog keeps an ordered, per-tenant list of events.
 type MemoryEventLog struct {
-	events []Event
+	mu     sync.RWMutex
+	events map[Tenant][]Event
+	// appended counts the events ever appended, to derive watermarks from.
+	appended uint64
 }
 
 func NewMemoryEventLog() EventLog {
-	return &MemoryEventLog{[]Event{}}
+	return &MemoryEventLog{events: map[Tenant][]Event{}}
 }
 
 func (*MemoryEventLog) Open() error {
@@ -83,26 +162,166 @@ func (*MemoryEventLog) Close() error {
 	return nil
 }
 
-func (*MemoryEventLog) Append(Tenant, MessageCid, IndexableKeyValues) (err error) {
+func (l *MemoryEventLog) Append(tenant Tenant, messageCid MessageCid, indexes IndexableKeyValues) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Zero-padded so that watermarks sort like the counter.
+	l.appended++
+	watermark := EventLogCursor(fmt.Sprintf("%020d", l.appended))
+	l.events[tenant] = append(l.events[tenant], Event{cid: messageCid, watermark: watermark, indexable: indexes})
 	return nil
 }
 
-func (*MemoryEventLog) GetEvents(Tenant) ([]string, error) {
-	return []string{}, nil
+func (l *MemoryEventLog) GetEvents(tenant Tenant) ([]string, error) {
+	entries, err := l.QueryEvents(tenant, nil, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	cids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		cids = append(cids, string(entry.MessageCid))
+	}
+	return cids, nil
 }
 
-func (*MemoryEventLog) QueryEvents(Tenant, []Filter, EventLogCursor) ([]string, error) {
-	return []string{}, nil
+// QueryEvents returns the tenant's events matching the filters, in the order
+// they were appended.  If cursor is set, only events with a greater
+// watermark are returned, and if limit is positive, at most limit of them.
+func (l *MemoryEventLog) QueryEvents(tenant Tenant, filters []Filter, cursor EventLogCursor,
+	limit int) ([]EventLogEntry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	entries := []EventLogEntry{}
+	for _, event := range l.events[tenant] {
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+		if cursor != "" && event.watermark <= cursor {
+			continue
+		}
+		if matchFilters(event.indexable, filters) {
+			entries = append(entries, EventLogEntry{MessageCid: event.cid, Watermark: event.watermark})
+		}
+	}
+	return entries, nil
 }
 
-func (*MemoryEventLog) DeleteEventsByCid(Tenant, []MessageCid) error {
+func (l *MemoryEventLog) DeleteEventsByCid(tenant Tenant, cids []MessageCid) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	remove := make(map[MessageCid]struct{}, len(cids))
+	for _, c := range cids {
+		remove[c] = struct{}{}
+	}
+
+	kept := l.events[tenant][:0]
+	for _, event := range l.events[tenant] {
+		if _, ok := remove[event.cid]; !ok {
+			kept = append(kept, event)
+		}
+	}
+	l.events[tenant] = kept
 	return nil
 }
 
 // Test purposes
 func (l *MemoryEventLog) Clear() error {
-	l.events = make([]Event, 10)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = make(map[Tenant][]Event)
+
+	return nil
+}
+
+// MemoryEventStream delivers events to in-process subscribers.  Listeners
+// are called synchronously, one event at a time, so every subscriber sees
+// the events of a tenant in the order they were emitted.
+type MemoryEventStream struct {
+	mu        sync.RWMutex
+	listeners map[Tenant]map[string]EventListener
+	// emitting serializes Emit, so that events are delivered in order.
+	emitting sync.Mutex
+	open     bool
+}
+
+func NewMemoryEventStream() EventStream {
+	return &MemoryEventStream{listeners: map[Tenant]map[string]EventListener{}}
+}
+
+func (s *MemoryEventStream) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.open = true
+	return nil
+}
+
+// Close drops all subscriptions.
+func (s *MemoryEventStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.open = false
+	s.listeners = map[Tenant]map[string]EventListener{}
+	return nil
+}
+
+func (s *MemoryEventStream) Subscribe(tenant Tenant, id string, listener EventListener) (EventSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.open {
+		return nil, errors.New("event stream is not open")
+	}
+	listeners, ok := s.listeners[tenant]
+	if !ok {
+		listeners = map[string]EventListener{}
+		s.listeners[tenant] = listeners
+	}
+	if _, ok := listeners[id]; ok {
+		return nil, fmt.Errorf("subscription %s already exists", id)
+	}
+	listeners[id] = listener
+	return &memoryEventSubscription{stream: s, tenant: tenant, id: id}, nil
+}
+
+func (s *MemoryEventStream) Emit(tenant Tenant, event MessageEvent, indexes IndexableKeyValues) {
+	s.emitting.Lock()
+	defer s.emitting.Unlock()
+
+	// Listeners are called without holding mu, so that they may close
+	// their subscription.
+	s.mu.RLock()
+	listeners := make([]EventListener, 0, len(s.listeners[tenant]))
+	for _, listener := range s.listeners[tenant] {
+		listeners = append(listeners, listener)
+	}
+	s.mu.RUnlock()
 
+	for _, listener := range listeners {
+		listener(tenant, event, indexes)
+	}
+}
+
+type memoryEventSubscription struct {
+	stream *MemoryEventStream
+	tenant Tenant
+	id     string
+}
+
+func (s *memoryEventSubscription) Id() string {
+	return s.id
+}
+
+func (s *memoryEventSubscription) Close() error {
+	s.stream.mu.Lock()
+	defer s.stream.mu.Unlock()
+
+	delete(s.stream.listeners[s.tenant], s.id)
 	return nil
 }
 
@@ -114,59 +333,53 @@ type GenericMessage struct {
 // MessageStore
 type Message struct{}
 
+type memoryMessage struct {
+	tenant    Tenant
+	cid       MessageCid
+	message   interface{}
+	indexable IndexableKeyValues
+}
+
 type MemoryMessageStore struct {
-	messages map[string]struct {
-		message   interface{}
-		indexable IndexableKeyValues
-	}
+	mu       sync.RWMutex
+	messages map[string]memoryMessage
 }
 
 func NewMemoryMessageStore() MessageStore {
 	return &MemoryMessageStore{
-		messages: make(map[string]struct {
-			message   interface{}
-			indexable IndexableKeyValues
-		}),
+		messages: make(map[string]memoryMessage),
 	}
 }
 
+func memoryMessageKey(tenant Tenant, messageCid MessageCid) string {
+	return string(tenant) + ":" + string(messageCid)
+}
+
+// Put stores a message under its message CID.  Putting the same message
+// again replaces its indexes.
 func (m *MemoryMessageStore) Put(tenant Tenant, message interface{}, indexes IndexableKeyValues) (err error) {
+	var messageCid MessageCid
+
 	// For GenericMessage, use the DataCid from the descriptor as the key
 	if genericMsg, ok := message.(*GenericMessage); ok {
-		key := string(tenant) + ":" + string(genericMsg.descriptor.DataCid)
-		m.messages[key] = struct {
-			message   interface{}
-			indexable IndexableKeyValues
-		}{
-			message:   genericMsg,
-			indexable: indexes,
+		messageCid = MessageCid(genericMsg.descriptor.DataCid)
+	} else {
+		rawMessage, err := toRawMessage(message)
+		if err != nil {
+			return err
 		}
-		return nil
-	}
-
-	// For map[string]interface{}, try to use "id" field as key
-	if msgMap, ok := message.(map[string]interface{}); ok {
-		if id, ok := msgMap["id"].(string); ok {
-			key := string(tenant) + ":" + id
-			m.messages[key] = struct {
-				message   interface{}
-				indexable IndexableKeyValues
-			}{
-				message:   msgMap,
-				indexable: indexes,
-			}
-			return nil
+		messageCid, err = computeMessageCid(rawMessage)
+		if err != nil {
+			return err
 		}
 	}
 
-	// If we can't extract a proper key, generate a random one
-	randomID := fmt.Sprintf("msg-%d", time.Now().UnixNano())
-	key := string(tenant) + ":" + randomID
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	m.messages[key] = struct {
-		message   interface{}
-		indexable IndexableKeyValues
-	}{
+	m.messages[memoryMessageKey(tenant, messageCid)] = memoryMessage{
+		tenant:    tenant,
+		cid:       messageCid,
 		message:   message,
 		indexable: indexes,
 	}
@@ -175,41 +388,81 @@ func (m *MemoryMessageStore) Put(tenant Tenant, message interface{}, indexes Ind
 }
 
 func (m *MemoryMessageStore) Get(tenant Tenant, messageCid MessageCid) (msg interface{}, err error) {
-	key := string(tenant) + ":" + string(messageCid)
-	if stored, ok := m.messages[key]; ok {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if stored, ok := m.messages[memoryMessageKey(tenant, messageCid)]; ok {
 		return stored.message, nil
 	}
 
-	// If not found with direct key, try scanning all messages for matching DataCid
-	for k, v := range m.messages {
-		if strings.HasPrefix(k, string(tenant)+":") {
-			if genericMsg, ok := v.message.(*GenericMessage); ok {
-				if string(genericMsg.descriptor.DataCid) == string(messageCid) {
-					return genericMsg, nil
-				}
-			}
+	return nil, nil // Not found
+}
+
+func (m *MemoryMessageStore) Query(tenant Tenant, filters []Filter,
+	messageSort MessageSort,
+	pagination Pagination) ([]interface{}, *PaginationCursor, error) {
+	m.mu.RLock()
+	matches := []memoryMessage{}
+	for _, stored := range m.messages {
+		if stored.tenant == tenant && matchFilters(stored.indexable, filters) {
+			matches = append(matches, stored)
 		}
 	}
+	m.mu.RUnlock()
 
-	return nil, nil // Not found
-}
+	property, direction := sortProperty(messageSort)
+	order := func(aValue IndexableValue, aCid MessageCid, bValue IndexableValue, bCid MessageCid) int {
+		cmp := compareSortValues(aValue, bValue)
+		if cmp == 0 {
+			cmp = strings.Compare(string(aCid), string(bCid))
+		}
+		if direction == Descending {
+			return -cmp
+		}
+		return cmp
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return order(matches[i].indexable[property], matches[i].cid, matches[j].indexable[property], matches[j].cid) < 0
+	})
 
-func (*MemoryMessageStore) Query(tenant Tenant, filters []Filter,
-	sort MessageSort,
-	pagination Pagination) (err error) {
-	return nil
+	if cursor := pagination.Cursor; cursor != nil {
+		value := cursorIndexableValue(cursor.Value)
+		matches = matches[sort.Search(len(matches), func(i int) bool {
+			return order(matches[i].indexable[property], matches[i].cid, value, MessageCid(cursor.MessageCid)) > 0
+		}):]
+	}
+	if pagination.Offset > 0 {
+		matches = matches[min(pagination.Offset, len(matches)):]
+	}
+
+	var cursor *PaginationCursor
+	if pagination.Limit > 0 && len(matches) > pagination.Limit {
+		matches = matches[:pagination.Limit]
+		last := matches[len(matches)-1]
+		cursor = &PaginationCursor{MessageCid: string(last.cid), Value: last.indexable[property]}
+	}
+
+	messages := make([]interface{}, len(matches))
+	for i, stored := range matches {
+		messages[i] = stored.message
+	}
+	return messages, cursor, nil
 }
 
-func (*MemoryMessageStore) Delete(Tenant, MessageCid) (err error) {
+func (m *MemoryMessageStore) Delete(tenant Tenant, messageCid MessageCid) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.messages, memoryMessageKey(tenant, messageCid))
 	return nil
 }
 
 // Test purposes
 func (m *MemoryMessageStore) Clear() (err error) {
-	m.messages = make(map[string]struct {
-		message   interface{}
-		indexable IndexableKeyValues
-	})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = make(map[string]memoryMessage)
 
 	return nil
 }
@@ -221,3 +474,81 @@ func (*MemoryMessageStore) Open() error {
 func (*MemoryMessageStore) Close() error {
 	return nil
 }
+
+// sortProperty picks the index property and direction a MessageSort asks
+// for, defaulting to ascending messageTimestamp.
+func sortProperty(messageSort MessageSort) (string, SortDirection) {
+	switch {
+	case messageSort.Property != "":
+		if messageSort.Direction == 0 {
+			return messageSort.Property, Ascending
+		}
+		return messageSort.Property, messageSort.Direction
+	case messageSort.DateCreated != 0:
+		return "dateCreated", messageSort.DateCreated
+	case messageSort.DatePublished != 0:
+		return "datePublished", messageSort.DatePublished
+	case messageSort.MessageTimestamp != 0:
+		return "messageTimestamp", messageSort.MessageTimestamp
+	}
+	return "messageTimestamp", Ascending
+}
+
+// compareSortValues orders index values for sorting; a missing value sorts
+// before any present one.
+func compareSortValues(a, b IndexableValue) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if cmp, ok := compareIndexable(a, b); ok {
+		return cmp
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// cursorIndexableValue returns the value of a cursor as the index value it
+// was taken from.  Cursors passed through JSON hold plain values.
+func cursorIndexableValue(value interface{}) IndexableValue {
+	switch v := value.(type) {
+	case IndexableValue:
+		return v
+	case string:
+		return S(v)
+	case float64:
+		return F(v)
+	case int64:
+		return I(v)
+	case int:
+		return I(v)
+	case bool:
+		return B(v)
+	}
+	return nil
+}
+
+// toRawMessage returns a message in its generic JSON object form.
+func toRawMessage(message interface{}) (map[string]interface{}, error) {
+	switch m := message.(type) {
+	case map[string]interface{}:
+		return m, nil
+	case RawDwnMessage:
+		return m, nil
+	case nil:
+		return nil, errors.New("message is nil")
+	}
+
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize message: %w", err)
+	}
+	var rawMessage map[string]interface{}
+	if err := json.Unmarshal(encoded, &rawMessage); err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+	return rawMessage, nil
+}
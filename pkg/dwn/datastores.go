@@ -27,8 +27,17 @@ type DataStore interface {
 	Clear() (err error)
 }
 
+// EventLogCursor is the watermark of an event.  Events appended later have
+// greater watermarks, so a client can resume after the last event it saw
+// even if that event has since been deleted.
 type EventLogCursor string
 
+// EventLogEntry is an event returned by QueryEvents.
+type EventLogEntry struct {
+	MessageCid MessageCid
+	Watermark  EventLogCursor
+}
+
 type EventLog interface {
 	Open() error
 	Close() error
@@ -37,7 +46,10 @@ type EventLog interface {
 
 	GetEvents(Tenant) ([]string, error)
 
-	QueryEvents(Tenant, []Filter, EventLogCursor) ([]string, error)
+	// QueryEvents returns the events matching all of the filters in the
+	// order they were appended, only those after the cursor if it is set,
+	// and at most limit of them if limit is positive.
+	QueryEvents(tenant Tenant, filters []Filter, cursor EventLogCursor, limit int) ([]EventLogEntry, error)
 
 	DeleteEventsByCid(Tenant, []MessageCid) error
 
@@ -45,6 +57,35 @@ type EventLog interface {
 	Clear() error
 }
 
+// MessageEvent is a message emitted to an EventStream once it is stored.
+// Updates and deletes of a record carry the record's initial write, whose
+// properties they are matched against.
+type MessageEvent struct {
+	Message      map[string]interface{} `json:"message"`
+	InitialWrite map[string]interface{} `json:"initialWrite,omitempty"`
+}
+
+// EventListener receives the events a tenant's EventStream emits, with the
+// indexes the message was stored under.
+type EventListener func(tenant Tenant, event MessageEvent, indexes IndexableKeyValues)
+
+// EventSubscription is a listener subscribed to an EventStream.
+type EventSubscription interface {
+	Id() string
+	Close() error
+}
+
+// EventStream delivers stored messages to live subscribers, in the order
+// they were emitted.
+type EventStream interface {
+	Open() error
+	Close() error
+
+	Subscribe(tenant Tenant, id string, listener EventListener) (EventSubscription, error)
+
+	Emit(tenant Tenant, event MessageEvent, indexes IndexableKeyValues)
+}
+
 // What are we storing in the MessageStore? What's in the DwnMessage?
 type StoredMessage struct {
 	Authorization map[string]interface{}
@@ -63,9 +104,14 @@ type MessageStore interface {
 
 	Get(Tenant, MessageCid) (msg interface{}, err error)
 
+	// Query returns the messages matching all of the given filters, ordered
+	// by sort.  When pagination has a limit and more messages remain, the
+	// returned cursor can be passed back to resume after the last message.
+	// It holds the value the last message was sorted by, so the query
+	// resumes at the same place even if that message is gone.
 	Query(tenant Tenant, filters []Filter,
 		sort MessageSort,
-		pagination Pagination) (err error)
+		pagination Pagination) (messages []interface{}, cursor *PaginationCursor, err error)
 
 	Delete(Tenant, MessageCid) (err error)
 
@@ -117,6 +163,46 @@ type FilterValue interface {
 	isFilterValue()
 }
 
+// PropertyFilter is the basic Filter: it applies a FilterValue to a single
+// indexed property.
+type PropertyFilter struct {
+	Name   string
+	Filter FilterValue
+}
+
+func (p PropertyFilter) Property() string   { return p.Name }
+func (p PropertyFilter) Value() FilterValue { return p.Filter }
+
+// NewEqualFilter returns a Filter matching property == value.
+func NewEqualFilter(property string, value IndexableValue) Filter {
+	return PropertyFilter{Name: property, Filter: EqualFilter{EqualTo: value}}
+}
+
+// NewRangeFilter returns a Filter applying a range comparison to property.
+func NewRangeFilter(property string, value RangeFilter) Filter {
+	return PropertyFilter{Name: property, Filter: value}
+}
+
+// OrFilter matches when any of its alternatives does; each alternative is a
+// list of filters that must all match.  It is not tied to a single property,
+// so Property returns "".
+type OrFilter struct {
+	AnyOf [][]Filter
+}
+
+func (o OrFilter) Property() string   { return "" }
+func (o OrFilter) Value() FilterValue { return o }
+func (o OrFilter) isFilterValue()     {}
+
+// NewPrefixFilter returns the Filters matching string values of property
+// that start with prefix.
+func NewPrefixFilter(property string, prefix string) []Filter {
+	return []Filter{
+		NewRangeFilter(property, GTE{GTE: S(prefix)}),
+		NewRangeFilter(property, LT{LT: S(prefix + "\uffff")}),
+	}
+}
+
 type EqualFilter struct {
 	EqualTo IndexableValue
 }
@@ -166,6 +252,11 @@ func (o LT) isFilterValue()  {}
 func (o LTE) isRangeFilter() {}
 func (o LTE) isFilterValue() {}
 
+func (o GT) RangeValue() RangeValue  { return o.GT }
+func (o GTE) RangeValue() RangeValue { return o.GTE }
+func (o LT) RangeValue() RangeValue  { return o.LT }
+func (o LTE) RangeValue() RangeValue { return o.LTE }
+
 // A range value is:
 // `string | number` numbers are either float64 or int64.
 type RangeValue interface {
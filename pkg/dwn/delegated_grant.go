@@ -0,0 +1,233 @@
+package dwn
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/utils"
+)
+
+// Permission grant records are written to PermissionGrantPath of the
+// permissions protocol, which every DWN defines itself.
+const (
+	PermissionsProtocolUri = "https://tbd.website/dwn/permissions"
+	PermissionGrantPath    = "grant"
+)
+
+// permissionsProtocolDefinition allows no actions, so only the tenant
+// writes grant records, to keep the grants it issued where they can be
+// revoked.
+var permissionsProtocolDefinition = ProtocolDefinition{
+	Protocol: PermissionsProtocolUri,
+	Types: map[string]ProtocolType{
+		PermissionGrantPath: {DataFormats: []string{"application/json"}},
+	},
+	Structure: map[string]ProtocolRuleSet{PermissionGrantPath: {}},
+}
+
+// grantedAction describes what a message does, to be checked against the
+// scope and conditions of a permission grant.
+type grantedAction struct {
+	Interface        string
+	Method           string
+	MessageTimestamp string
+	Protocol         string
+	ContextId        string
+	ProtocolPath     string
+	// Published is set for writes, which publication conditions apply to.
+	Published *bool
+}
+
+// messageAuthor returns the author of a message: the signer of its
+// signature or, if the signer acts under a delegated grant, the grantor.
+func messageAuthor(signature GeneralJws, delegatedGrant *DelegatedGrant) (string, error) {
+	if delegatedGrant != nil {
+		return getSigner(delegatedGrant.Authorization.Signature)
+	}
+	return getSigner(signature)
+}
+
+// rawDelegatedGrant returns the delegated grant stored under key in the
+// authorization of a message, or nil if there is none.
+func rawDelegatedGrant(rawMessage map[string]interface{}, key string) map[string]interface{} {
+	authorization, _ := rawMessage["authorization"].(map[string]interface{})
+	grant, _ := authorization[key].(map[string]interface{})
+	return grant
+}
+
+// verifyDelegatedGrant checks that the signer of signature may act for the
+// grantor of rawGrant: the signature payload must name the grant by its
+// delegatedGrantId, and the grant must be delegated to the signer and allow
+// the action, and tenant must hold no revocation of the grant.  The
+// signatures themselves are verified by Dwn.authenticate.
+func verifyDelegatedGrant(messageStore MessageStore, tenant Tenant, signature GeneralJws,
+	rawGrant map[string]interface{}, action grantedAction) error {
+	grant, err := parseGrantRecord(rawGrant)
+	if err != nil {
+		return &statusError{Code: 400, Err: fmt.Errorf("delegated grant: %w", err)}
+	}
+	grantId, _ := rawGrant["recordId"].(string)
+
+	var payload utils.GenericSignaturePayload
+	if err := decodeSignaturePayload(signature, &payload); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	if payload.DelegatedGrantId != grantId {
+		return newStatusError(400, "delegatedGrantId %s does not match the delegated grant %s",
+			payload.DelegatedGrantId, grantId)
+	}
+	if !grant.Descriptor.Delegated {
+		return newStatusError(401, "grant %s is not a delegated grant", grantId)
+	}
+
+	signer, err := getSigner(signature)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	if err := verifyGrant(grant, signer, action); err != nil {
+		return err
+	}
+	return verifyGrantNotRevoked(messageStore, tenant, grantId)
+}
+
+// parseGrantRecord checks that rawGrant is a well-formed permission grant
+// record and returns the grant it carries, as a PermissionsGrant from the
+// author of the record, for their own DWN, to its recipient.
+func parseGrantRecord(rawGrant map[string]interface{}) (*PermissionsGrant, error) {
+	var record DelegatedGrant
+	if err := parseMessage(rawGrant, &record); err != nil {
+		return nil, err
+	}
+	descriptor := record.Descriptor
+	if descriptor.Protocol != PermissionsProtocolUri || descriptor.ProtocolPath != PermissionGrantPath {
+		return nil, fmt.Errorf("grant records are written to %s of protocol %s",
+			PermissionGrantPath, PermissionsProtocolUri)
+	}
+	if record.Authorization.AuthorDelegatedGrant != nil {
+		return nil, errors.New("grant records cannot be written under a delegated grant")
+	}
+	grantor, err := getSigner(record.Authorization.Signature)
+	if err != nil {
+		return nil, err
+	}
+	entryId, err := recordsWriteEntryId(rawGrant, grantor)
+	if err != nil {
+		return nil, err
+	}
+	if entryId != record.RecordId {
+		return nil, fmt.Errorf("grant record %s is not an initial write", record.RecordId)
+	}
+	if err := record.validateIntegrity(entryId); err != nil {
+		return nil, err
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(record.EncodedData)
+	if err != nil {
+		return nil, fmt.Errorf("malformed encodedData: %w", err)
+	}
+	dataCid, dataSize, err := computeDataCid(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if dataCid != descriptor.DataCid || dataSize != descriptor.DataSize {
+		return nil, fmt.Errorf("encodedData does not match dataCid %s", descriptor.DataCid)
+	}
+	var grantData PermissionGrantData
+	if err := validateGrantData(data, &grantData); err != nil {
+		return nil, err
+	}
+
+	grant := PermissionsGrant{Authorization: PlainAuthorization{Signature: record.Authorization.Signature}}
+	grant.Descriptor.Interface = InterfacePermissions
+	grant.Descriptor.Method = MethodGrant
+	grant.Descriptor.MessageTimestamp = descriptor.MessageTimestamp
+	grant.Descriptor.DateExpires = grantData.DateExpires
+	grant.Descriptor.Description = grantData.Description
+	grant.Descriptor.Delegated = grantData.Delegated
+	grant.Descriptor.GrantedTo = string(descriptor.Recipient)
+	grant.Descriptor.GrantedBy = grantor
+	grant.Descriptor.GrantedFor = grantor
+	grant.Descriptor.PermissionsRequestId = grantData.RequestId
+	grant.Descriptor.Scope = grantData.Scope
+	grant.Descriptor.Conditions = grantData.Conditions
+	return &grant, nil
+}
+
+// verifyGrant checks that grant allows grantee to perform action: the grant
+// was issued by its signer to grantee, is active at the time of the action,
+// and its scope and conditions cover the action.
+func verifyGrant(grant *PermissionsGrant, grantee string, action grantedAction) error {
+	descriptor := grant.Descriptor
+	if descriptor.Interface != InterfacePermissions || descriptor.Method != MethodGrant {
+		return newStatusError(400, "expected %s%s grant, got %s%s",
+			InterfacePermissions, MethodGrant, descriptor.Interface, descriptor.Method)
+	}
+	grantor, err := getSigner(grant.Authorization.Signature)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	if grantor != descriptor.GrantedBy {
+		return newStatusError(401, "grant signed by %s is not granted by them", grantor)
+	}
+	if descriptor.GrantedTo != grantee {
+		return newStatusError(401, "grant is not granted to %s", grantee)
+	}
+
+	if err := verifyGrantActive(descriptor.MessageTimestamp, descriptor.DateExpires, action.MessageTimestamp); err != nil {
+		return err
+	}
+
+	scope := descriptor.Scope
+	if scope.Interface != action.Interface || scope.Method != action.Method {
+		return newStatusError(401, "grant scope %s%s does not cover %s%s",
+			scope.Interface, scope.Method, action.Interface, action.Method)
+	}
+	if scope.Protocol != "" && scope.Protocol != action.Protocol {
+		return newStatusError(401, "grant is limited to protocol %s", scope.Protocol)
+	}
+	if scope.ContextId != "" && action.ContextId != scope.ContextId &&
+		!strings.HasPrefix(action.ContextId, scope.ContextId+"/") {
+		return newStatusError(401, "grant is limited to context %s", scope.ContextId)
+	}
+	if scope.ProtocolPath != "" && scope.ProtocolPath != action.ProtocolPath {
+		return newStatusError(401, "grant is limited to protocolPath %s", scope.ProtocolPath)
+	}
+
+	if conditions := descriptor.Conditions; conditions != nil && action.Published != nil {
+		switch {
+		case conditions.Publication == PublicationRequired && !*action.Published:
+			return newStatusError(401, "grant requires records to be published")
+		case conditions.Publication == PublicationProhibited && *action.Published:
+			return newStatusError(401, "grant prohibits publishing records")
+		}
+	}
+	return nil
+}
+
+// verifyGrantActive checks that a grant issued at grantTimestamp and expiring
+// at dateExpires is active at messageTimestamp.
+func verifyGrantActive(grantTimestamp, dateExpires, messageTimestamp string) error {
+	at, err := time.Parse(time.RFC3339Nano, messageTimestamp)
+	if err != nil {
+		return newStatusError(400, "malformed messageTimestamp: %w", err)
+	}
+	issued, err := time.Parse(time.RFC3339Nano, grantTimestamp)
+	if err != nil {
+		return newStatusError(400, "malformed grant messageTimestamp: %w", err)
+	}
+	expires, err := time.Parse(time.RFC3339Nano, dateExpires)
+	if err != nil {
+		return newStatusError(400, "malformed grant dateExpires: %w", err)
+	}
+	if at.Before(issued) {
+		return newStatusError(401, "grant is not active yet at %s", messageTimestamp)
+	}
+	if !at.Before(expires) {
+		return newStatusError(401, "grant expired at %s", dateExpires)
+	}
+	return nil
+}
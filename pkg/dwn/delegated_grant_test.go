@@ -0,0 +1,168 @@
+package dwn
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegatedGrant(t *testing.T) {
+	alice := newTestPersona(t)
+	app := newTestPersona(t)
+	carol := newTestPersona(t)
+
+	writeScope := map[string]interface{}{"interface": InterfaceRecords, "method": MethodWrite}
+
+	t.Run("app writes records as the grantor", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grant := newTestDelegatedGrant(t, alice, app, writeScope, nil)
+		message, code := writeToTenant(t, dwn, alice.URI, app, testRecordsWrite{delegatedGrant: grant})
+		require.Equal(t, 202, code)
+
+		entries, err := queryMessageEntries(dwn.messageStore, Tenant(alice.URI), []Filter{
+			NewEqualFilter("recordId", S(message["recordId"].(string))),
+			NewEqualFilter("author", S(alice.URI)),
+		})
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		// Updates by alice herself continue the record.
+		_, code = writeToTenant(t, dwn, alice.URI, alice, testRecordsWrite{update: message})
+		assert.Equal(t, 202, code)
+	})
+
+	t.Run("rejects grants that do not cover the write", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		expired := time.Now().Add(-time.Hour).UTC().Format(TimestampFormat)
+		tests := []struct {
+			name  string
+			grant map[string]interface{}
+		}{
+			{"expired", newTestDelegatedGrant(t, alice, app, writeScope, map[string]interface{}{
+				"dateExpires": expired,
+			})},
+			{"other method", newTestDelegatedGrant(t, alice, app, map[string]interface{}{
+				"interface": InterfaceRecords, "method": MethodQuery,
+			}, nil)},
+			{"other protocol", newTestDelegatedGrant(t, alice, app, map[string]interface{}{
+				"interface": InterfaceRecords, "method": MethodWrite, "protocol": "http://chat-protocol.xyz",
+			}, nil)},
+			{"not delegated", newTestDelegatedGrant(t, alice, app, writeScope, map[string]interface{}{
+				"delegated": false,
+			})},
+			{"publication required", newTestDelegatedGrant(t, alice, app, writeScope, map[string]interface{}{
+				"conditions": map[string]interface{}{"publication": PublicationRequired},
+			})},
+			{"granted to someone else", newTestDelegatedGrant(t, alice, carol, writeScope, nil)},
+			{"granted by someone else", newTestDelegatedGrant(t, carol, app, writeScope, nil)},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				_, code := writeToTenant(t, dwn, alice.URI, app, testRecordsWrite{delegatedGrant: tc.grant})
+				assert.Equal(t, 401, code)
+			})
+		}
+	})
+
+	t.Run("rejects a tampered grant", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grant := newTestDelegatedGrant(t, alice, app, writeScope, nil)
+		message, data := newTestRecordsWrite(t, app, testRecordsWrite{delegatedGrant: grant})
+		getPathedMap(t, message, "authorization", "authorDelegatedGrant", "descriptor")["recipient"] = carol.URI
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 401, reply.Status.Code)
+
+		// The grant data is bound to the signed descriptor by its dataCid.
+		message, data = newTestRecordsWrite(t, app, testRecordsWrite{delegatedGrant: grant})
+		getPathedMap(t, message, "authorization")["authorDelegatedGrant"].(map[string]interface{})["encodedData"] =
+			newTestDelegatedGrant(t, alice, app, map[string]interface{}{
+				"interface": InterfaceRecords, "method": MethodDelete,
+			}, nil)["encodedData"]
+
+		reply, err = dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+		assert.Contains(t, reply.Status.Detail, "dataCid")
+	})
+
+	t.Run("app reads and queries records as the grantor", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		record := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		filter := map[string]interface{}{"recordId": record["recordId"]}
+
+		readGrant := newTestDelegatedGrant(t, alice, app, map[string]interface{}{
+			"interface": InterfaceRecords, "method": MethodRead,
+		}, nil)
+		read := withTestDelegatedGrant(t, app, newTestRecordsRead(t, &app, filter), readGrant)
+		assert.Equal(t, 200, processStatus(t, dwn, alice.URI, read))
+
+		query := withTestDelegatedGrant(t, app, newTestRecordsQuery(t, &app, filter, nil), readGrant)
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, query))
+
+		queryGrant := newTestDelegatedGrant(t, alice, app, map[string]interface{}{
+			"interface": InterfaceRecords, "method": MethodQuery,
+		}, nil)
+		query = withTestDelegatedGrant(t, app, newTestRecordsQuery(t, &app, filter, nil), queryGrant)
+		reply, err := dwn.ProcessMessage(alice.URI, query, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Len(t, reply.Entries, 1)
+	})
+}
+
+func TestOwnerSignature(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	carol := newTestPersona(t)
+
+	t.Run("owner retains a record authored by someone else", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		message, data := newTestRecordsWrite(t, bob, testRecordsWrite{})
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 401, reply.Status.Code)
+
+		reply, err = dwn.ProcessMessage(alice.URI, withTestOwnerSignature(t, carol, message), bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 401, reply.Status.Code)
+
+		reply, err = dwn.ProcessMessage(alice.URI, withTestOwnerSignature(t, alice, message), bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		entries := queryRecord(t, dwn, alice.URI, message["recordId"].(string))
+		require.Len(t, entries, 1)
+		author, err := entries[0].author()
+		require.NoError(t, err)
+		assert.Equal(t, bob.URI, author)
+	})
+
+	t.Run("owner signature must cover the descriptor", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		message, data := newTestRecordsWrite(t, bob, testRecordsWrite{})
+		other, _ := newTestRecordsWrite(t, bob, testRecordsWrite{})
+		owned := withTestOwnerSignature(t, alice, other)
+		message["authorization"].(map[string]interface{})["ownerSignature"] =
+			getPathedMap(t, owned, "authorization")["ownerSignature"]
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 401, reply.Status.Code)
+	})
+}
+
+func getPathedMap(t *testing.T, v map[string]interface{}, path ...string) map[string]interface{} {
+	t.Helper()
+	for _, key := range path {
+		next, ok := v[key].(map[string]interface{})
+		require.True(t, ok, "%s is not an object", key)
+		v = next
+	}
+	return v
+}
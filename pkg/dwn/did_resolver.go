@@ -7,7 +7,13 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/didcore"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/diddht"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/didjwk"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/didweb"
 )
 
 // Cache interface
@@ -30,8 +36,9 @@ type DidResolutionResult struct {
 	}
 }
 
-// MemoryCache struct
+// MemoryCache struct, safe for concurrent use
 type MemoryCache struct {
+	mu        sync.RWMutex
 	data      map[string]DidResolutionResult
 	expiry    time.Duration
 	timestamp map[string]time.Time
@@ -46,17 +53,28 @@ func NewMemoryCache(expiry time.Duration) *MemoryCache {
 }
 
 func (c *MemoryCache) Get(key string) (DidResolutionResult, bool) {
-	if val, found := c.data[key]; found {
-		if time.Since(c.timestamp[key]) < c.expiry {
-			return val, true
+	c.mu.RLock()
+	val, found := c.data[key]
+	fresh := found && time.Since(c.timestamp[key]) < c.expiry
+	c.mu.RUnlock()
+	if fresh {
+		return val, true
+	}
+	if found {
+		c.mu.Lock()
+		// Another goroutine may have refreshed the entry meanwhile
+		if time.Since(c.timestamp[key]) >= c.expiry {
+			delete(c.data, key)
+			delete(c.timestamp, key)
 		}
-		delete(c.data, key)
-		delete(c.timestamp, key)
+		c.mu.Unlock()
 	}
 	return DidResolutionResult{}, false
 }
 
 func (c *MemoryCache) Set(key string, value DidResolutionResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.data[key] = value
 	c.timestamp[key] = time.Now()
 }
@@ -74,8 +92,9 @@ func NewDidResolver(resolvers []DidMethodResolver, cache Cache) *DidResolver {
 
 	if resolvers == nil || len(resolvers) == 0 {
 		resolvers = []DidMethodResolver{
-			// NewDidIonResolver(),
-			// NewDidKeyResolver(),
+			NewDidMethodResolver("dht", diddht.DefaultResolver()),
+			NewDidMethodResolver("jwk", didjwk.Resolver{}),
+			NewDidMethodResolver("web", didweb.Resolver{}),
 		}
 	}
 
@@ -90,6 +109,31 @@ func NewDidResolver(resolvers []DidMethodResolver, cache Cache) *DidResolver {
 	}
 }
 
+// didcoreMethodResolver adapts a resolver of the dids packages to
+// DidMethodResolver.  The DidDocument of its results is a didcore.Document.
+type didcoreMethodResolver struct {
+	method   string
+	resolver didcore.MethodResolver
+}
+
+func NewDidMethodResolver(method string, resolver didcore.MethodResolver) DidMethodResolver {
+	return didcoreMethodResolver{method: method, resolver: resolver}
+}
+
+func (r didcoreMethodResolver) Method() string {
+	return r.method
+}
+
+func (r didcoreMethodResolver) Resolve(did string) (DidResolutionResult, error) {
+	result, err := r.resolver.Resolve(did)
+	if err != nil {
+		return DidResolutionResult{}, err
+	}
+	resolved := DidResolutionResult{DidDocument: result.Document}
+	resolved.DidResolutionMetadata.Error = result.GetError()
+	return resolved, nil
+}
+
 // TODO implement/remove this
 func Validate(did string) error {
 	return nil
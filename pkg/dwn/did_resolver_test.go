@@ -0,0 +1,46 @@
+package dwn
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCache(t *testing.T) {
+	t.Run("expires entries", func(t *testing.T) {
+		cache := NewMemoryCache(time.Millisecond)
+		cache.Set("did:example:alice", DidResolutionResult{DidDocument: "alice"})
+		result, found := cache.Get("did:example:alice")
+		assert.True(t, found)
+		assert.Equal(t, "alice", result.DidDocument)
+
+		time.Sleep(2 * time.Millisecond)
+		_, found = cache.Get("did:example:alice")
+		assert.False(t, found)
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		// Expiring half the entries at once exercises the deletes of Get
+		// alongside Set under -race
+		cache := NewMemoryCache(time.Microsecond)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					key := fmt.Sprintf("did:example:%d", j%10)
+					if (i+j)%2 == 0 {
+						cache.Set(key, DidResolutionResult{DidDocument: key})
+					} else if result, found := cache.Get(key); found {
+						assert.Equal(t, key, result.DidDocument)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+}
@@ -1,7 +1,6 @@
 package dwn
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -37,19 +36,25 @@ func (a PlainAuthorization) signature() GeneralJws {
 // - Signature, AuthorDelegatedGrant, OwnerSignature, OwnerDelegatedGrant
 // AuthDelegatedGrant
 // - Signature, AuthorDelegatedGrant
+//
+// A delegated grant is a permission grant record with `delegated` set,
+// which lets the grantee sign messages on behalf of the grantor.  The
+// grantor is then the author of the message.
 
 type AuthorizationDelegatedGrant struct {
 	Signature            GeneralJws      `json:"signature"`
-	AuthorDelegatedGrant *DelegatedGrant `json:"authorDelegatedGrant"`
+	AuthorDelegatedGrant *DelegatedGrant `json:"authorDelegatedGrant,omitempty"`
 }
 
 func (a *AuthorizationDelegatedGrant) signature() GeneralJws {
 	return a.Signature
 }
 
+// AuthorizationOwner additionally lets the owner of a DWN sign a RecordsWrite
+// authored by someone else, so that they can keep the record in their DWN.
 type AuthorizationOwner struct {
-	Signature      GeneralJws `json:"signature"`
-	OwnerSignature GeneralJws `json:"ownerSignature"`
+	Signature      GeneralJws  `json:"signature"`
+	OwnerSignature *GeneralJws `json:"ownerSignature,omitempty"`
 
 	AuthorDelegatedGrant *DelegatedGrant `json:"authorDelegatedGrant,omitempty"`
 	OwnerDelegatedGrant  *DelegatedGrant `json:"ownerDelegatedGrant,omitempty"`
@@ -59,47 +64,112 @@ func (a *AuthorizationOwner) signature() GeneralJws {
 	return a.Signature
 }
 
-type DelegatedGrantDescriptor struct {
-	RecordId    string `json:"recordId"`
+// DelegatedGrant is a permission grant record: a RecordsWrite of the
+// permissions protocol, signed by the grantor and addressed to the grantee,
+// that carries its PermissionGrantData inline.  Its recordId is the id of
+// the grant.
+type DelegatedGrant struct {
+	RecordsWrite
 	EncodedData string `json:"encodedData"`
 }
 
-type DelegatedGrant struct {
-	// Authorization -> Signature --- ??
-	Authorization PlainAuthorization       `json:"authorization"`
-	Descriptor    DelegatedGrantDescriptor `json:"descriptor"`
+// PermissionGrantData is the data of a permission grant record.  See
+// permission-grant-data.json.
+type PermissionGrantData struct {
+	Description string                `json:"description,omitempty"`
+	DateExpires string                `json:"dateExpires"`
+	RequestId   string                `json:"requestId,omitempty"`
+	Delegated   bool                  `json:"delegated,omitempty"`
+	Scope       PermissionScope       `json:"scope"`
+	Conditions  *PermissionConditions `json:"conditions,omitempty"`
 }
 
 type RecordsRead struct {
-	Authorization AuthorizationDelegatedGrant `json:"authorization"`
+	Authorization *AuthorizationDelegatedGrant `json:"authorization,omitempty"`
 	Descriptor    struct {
-		Interface string
-		Method    string
+		Interface string `json:"interface"`
+		Method    string `json:"method"`
 		// iso timestamp
-		MessageTimestamp string
-		// TODO make this properly typed.
-		Filter map[string]interface{}
+		MessageTimestamp string        `json:"messageTimestamp"`
+		Filter           RecordsFilter `json:"filter"`
+	} `json:"descriptor"`
+}
+
+type ProtocolsConfigure struct {
+	Authorization AuthorizationDelegatedGrant `json:"authorization"`
+	Descriptor    struct {
+		Interface        string             `json:"interface"`
+		Method           string             `json:"method"`
+		MessageTimestamp string             `json:"messageTimestamp"`
+		Definition       ProtocolDefinition `json:"definition"`
+	} `json:"descriptor"`
+}
+
+type ProtocolsQuery struct {
+	Authorization *AuthorizationDelegatedGrant `json:"authorization,omitempty"`
+	Descriptor    struct {
+		Interface        string `json:"interface"`
+		Method           string `json:"method"`
+		MessageTimestamp string `json:"messageTimestamp"`
+		Filter           *struct {
+			Protocol string `json:"protocol,omitempty"`
+		} `json:"filter,omitempty"`
+	} `json:"descriptor"`
+}
+
+type RecordsDelete struct {
+	Authorization AuthorizationDelegatedGrant `json:"authorization"`
+	Descriptor    struct {
+		Interface        string `json:"interface"`
+		Method           string `json:"method"`
+		MessageTimestamp string `json:"messageTimestamp"`
+		RecordId         string `json:"recordId"`
+		// Prune also purges the descendants of the record in its protocol.
+		Prune bool `json:"prune"`
+	} `json:"descriptor"`
+}
+
+type RecordsQuery struct {
+	Authorization *AuthorizationDelegatedGrant `json:"authorization,omitempty"`
+	Descriptor    struct {
+		Interface        string           `json:"interface"`
+		Method           string           `json:"method"`
+		MessageTimestamp string           `json:"messageTimestamp"`
+		Filter           RecordsFilter    `json:"filter"`
+		Pagination       *QueryPagination `json:"pagination,omitempty"`
+		// createdAscending | createdDescending | publishedAscending | publishedDescending
+		DateSort string `json:"dateSort,omitempty"`
+	} `json:"descriptor"`
+}
+
+type RecordsSubscribe struct {
+	Authorization *AuthorizationDelegatedGrant `json:"authorization,omitempty"`
+	Descriptor    struct {
+		Interface        string        `json:"interface"`
+		Method           string        `json:"method"`
+		MessageTimestamp string        `json:"messageTimestamp"`
+		Filter           RecordsFilter `json:"filter"`
 	} `json:"descriptor"`
 }
 
 type Descriptor struct {
 	// Required
-	Interface        string
-	Method           string
-	DataCid          DataCid
-	DataSize         int64
-	DateCreated      string
-	MessageTimestamp string
-	DataFormat       string
-
-	Recipient     DID
-	Protocol      string
-	ProtocolPath  string
-	Schema        string
-	Tags          map[string]interface{}
-	ParentId      MessageCid
-	Published     bool
-	DatePublished string
+	Interface        string  `json:"interface"`
+	Method           string  `json:"method"`
+	DataCid          DataCid `json:"dataCid"`
+	DataSize         int64   `json:"dataSize"`
+	DateCreated      string  `json:"dateCreated"`
+	MessageTimestamp string  `json:"messageTimestamp"`
+	DataFormat       string  `json:"dataFormat"`
+
+	Recipient     DID                    `json:"recipient,omitempty"`
+	Protocol      string                 `json:"protocol,omitempty"`
+	ProtocolPath  string                 `json:"protocolPath,omitempty"`
+	Schema        string                 `json:"schema,omitempty"`
+	Tags          map[string]interface{} `json:"tags,omitempty"`
+	ParentId      MessageCid             `json:"parentId,omitempty"`
+	Published     bool                   `json:"published,omitempty"`
+	DatePublished string                 `json:"datePublished,omitempty"`
 }
 
 type RecordsWrite struct {
@@ -131,38 +201,140 @@ type RecordsWrite struct {
 type MessagesGet struct {
 	Authorization PlainAuthorization `json:"authorization"`
 	Descriptor    struct {
-		Interface        string // const==Messages
-		Method           string // const==Get
-		MessageTimestamp string
+		Interface        string   `json:"interface"` // const==Messages
+		Method           string   `json:"method"`    // const==Get
+		MessageTimestamp string   `json:"messageTimestamp"`
 		MessageCids      []string `json:"messageCids,omitempty"`
 	} `json:"descriptor"`
 }
 
+// Author returns the author of the message, or "" if its signature names no
+// signer.  The signature is verified when the message is processed.
 func (m *AuthorizationDelegatedGrant) Author() string {
-
-	return "none"
+	author, _ := messageAuthor(m.Signature, m.AuthorDelegatedGrant)
+	return author
 }
 
+// Author returns the DID that signed the message, or "" if the signature
+// names no signer.  The signature is verified when the message is processed.
 func (m *PlainAuthorization) Author() string {
-	// if authorDelegatedGrant != nil
-	//   Author = GetSigner(message.authorization.authorDelegatedGrant)
-	// else
-	//  Author = getSigner(m)
+	author, _ := getSigner(m.Signature)
+	return author
+}
 
-	// if m.Signature == nil {
-	// 	return nil
-	// }
+type PermissionsGrant struct {
+	Authorization PlainAuthorization `json:"authorization"`
+	Descriptor    struct {
+		Interface        string `json:"interface"`
+		Method           string `json:"method"`
+		MessageTimestamp string `json:"messageTimestamp"`
+		DateExpires      string `json:"dateExpires"`
+		Description      string `json:"description,omitempty"`
+		// Delegated is set on the grants of delegated grant records, which
+		// let the grantee sign messages as the grantor.
+		Delegated            bool                  `json:"delegated,omitempty"`
+		GrantedTo            string                `json:"grantedTo"`
+		GrantedBy            string                `json:"grantedBy"`
+		GrantedFor           string                `json:"grantedFor"`
+		PermissionsRequestId string                `json:"permissionsRequestId,omitempty"`
+		Scope                PermissionScope       `json:"scope"`
+		Conditions           *PermissionConditions `json:"conditions,omitempty"`
+	} `json:"descriptor"`
+}
 
-	// TODO Utility functions for handling signatures
+// MessagesQuery asks for the CIDs of the messages matching any of its
+// filters, in the order the DWN received them.
+type MessagesQuery struct {
+	Authorization PlainAuthorization `json:"authorization"`
+	Descriptor    struct {
+		Interface        string            `json:"interface"`
+		Method           string            `json:"method"`
+		MessageTimestamp string            `json:"messageTimestamp"`
+		Filters          []MessagesFilter  `json:"filters"`
+		Cursor           *PaginationCursor `json:"cursor,omitempty"`
+	} `json:"descriptor"`
+}
+
+// MessagesSubscribe subscribes to the messages matching any of its filters
+// as the DWN stores them.
+type MessagesSubscribe struct {
+	Authorization PlainAuthorization `json:"authorization"`
+	Descriptor    struct {
+		Interface        string           `json:"interface"`
+		Method           string           `json:"method"`
+		MessageTimestamp string           `json:"messageTimestamp"`
+		Filters          []MessagesFilter `json:"filters"`
+	} `json:"descriptor"`
+}
 
-	// path:
-	//  := m.Signature.Signatures[0]
-	// extractDid( getKid ( checkThis ) )
+// EventsGet is the legacy form of MessagesQuery without filters.
+type EventsGet struct {
+	Authorization PlainAuthorization `json:"authorization"`
+	Descriptor    struct {
+		Interface        string `json:"interface"`
+		Method           string `json:"method"`
+		MessageTimestamp string `json:"messageTimestamp"`
+		Cursor           string `json:"cursor,omitempty"`
+	} `json:"descriptor"`
+}
 
-	return "none"
+// EventsQuery is the legacy form of MessagesQuery.
+type EventsQuery struct {
+	Authorization PlainAuthorization `json:"authorization"`
+	Descriptor    struct {
+		Interface        string         `json:"interface"`
+		Method           string         `json:"method"`
+		MessageTimestamp string         `json:"messageTimestamp"`
+		Filters          []EventsFilter `json:"filters"`
+		Cursor           string         `json:"cursor,omitempty"`
+	} `json:"descriptor"`
 }
 
-type PermissionsGrant struct {
+// PermissionsRequest asks the owner of a DWN for a PermissionsGrant.
+type PermissionsRequest struct {
+	Authorization PlainAuthorization `json:"authorization"`
+	Descriptor    struct {
+		Interface        string                `json:"interface"`
+		Method           string                `json:"method"`
+		MessageTimestamp string                `json:"messageTimestamp"`
+		Description      string                `json:"description,omitempty"`
+		GrantedTo        string                `json:"grantedTo"`
+		GrantedBy        string                `json:"grantedBy"`
+		GrantedFor       string                `json:"grantedFor"`
+		Scope            PermissionScope       `json:"scope"`
+		Conditions       *PermissionConditions `json:"conditions,omitempty"`
+	} `json:"descriptor"`
+}
+
+// PermissionsRevoke revokes a PermissionsGrant from its messageTimestamp on.
+type PermissionsRevoke struct {
+	Authorization PlainAuthorization `json:"authorization"`
+	Descriptor    struct {
+		Interface          string `json:"interface"`
+		Method             string `json:"method"`
+		MessageTimestamp   string `json:"messageTimestamp"`
+		PermissionsGrantId string `json:"permissionsGrantId"`
+	} `json:"descriptor"`
+}
+
+// PermissionScope limits a grant to one interface method and, optionally, to
+// the records of a protocol, context or protocol path.
+type PermissionScope struct {
+	Interface    string `json:"interface"`
+	Method       string `json:"method"`
+	Protocol     string `json:"protocol,omitempty"`
+	ContextId    string `json:"contextId,omitempty"`
+	ProtocolPath string `json:"protocolPath,omitempty"`
+}
+
+// Values of the publication condition of a grant.
+const (
+	PublicationRequired   = "Required"
+	PublicationProhibited = "Prohibited"
+)
+
+type PermissionConditions struct {
+	Publication string `json:"publication,omitempty"`
 }
 
 // TODO beef this up
@@ -189,7 +361,22 @@ func NewAllowAllTenantGate() TenantGate {
 }
 
 type UnionMessageReply struct {
-	Status Status
+	Status  Status                   `json:"status"`
+	Entries []map[string]interface{} `json:"entries,omitempty"`
+	Cursor  *PaginationCursor        `json:"cursor,omitempty"`
+
+	// Record is the RecordsWrite returned by RecordsRead, and Data streams
+	// its data.
+	Record map[string]interface{} `json:"record,omitempty"`
+	Data   io.Reader              `json:"-"`
+
+	// EntryData streams the data of the RecordsWrite entries returned by
+	// MessagesGet that is too large to be encoded inline, by message CID.
+	EntryData map[string]io.Reader `json:"-"`
+
+	// Subscription is the subscription opened by RecordsSubscribe or
+	// MessagesSubscribe.
+	Subscription EventSubscription `json:"-"`
 }
 
 type Dwn struct {
@@ -198,6 +385,7 @@ type Dwn struct {
 	messageStore   MessageStore
 	dataStore      DataStore
 	eventLog       EventLog
+	eventStream    EventStream
 	tenantGate     TenantGate
 	blockstore     *store.BlockstoreLevel
 }
@@ -217,25 +405,29 @@ func NewDwn(config DwnConfig) (*Dwn, error) {
 	}
 
 	dwn := &Dwn{
-		didResolver:    config.DidResolver,
-		tenantGate:     config.TenantGate,
-		messageStore:   config.MessageStore,
-		dataStore:      config.DataStore,
-		eventLog:       config.EventLog,
-		blockstore:     blockstore,
+		didResolver:  config.DidResolver,
+		tenantGate:   config.TenantGate,
+		messageStore: config.MessageStore,
+		dataStore:    config.DataStore,
+		eventLog:     config.EventLog,
+		eventStream:  config.EventStream,
+		blockstore:   blockstore,
 		methodHandlers: map[string]MethodHandler{
-			// "EventsGet":          NewEventsGetHandler(config.DidResolver, config.EventLog),
-			// "EventsQuery":        NewEventsQueryHandler(config.DidResolver, config.EventLog),
-			// "MessagesGet":        NewMessagesGetHandler(config.DidResolver, config.MessageStore, config.DataStore),
-			// "PermissionsGrant":   NewPermissionsGrantHandler(config.DidResolver, config.MessageStore, config.EventLog),
-			// "PermissionsRequest": NewPermissionsRequestHandler(config.DidResolver, config.MessageStore, config.EventLog),
-			// "PermissionsRevoke":  NewPermissionsRevokeHandler(config.DidResolver, config.MessageStore, config.EventLog),
-			// "ProtocolsConfigure": NewProtocolsConfigureHandler(config.DidResolver, config.MessageStore, config.DataStore, config.EventLog),
-			// "ProtocolsQuery":     NewProtocolsQueryHandler(config.DidResolver, config.MessageStore, config.DataStore),
-			// "RecordsDelete":      NewRecordsDeleteHandler(config.DidResolver, config.MessageStore, config.DataStore, config.EventLog),
-			// "RecordsQuery":       NewRecordsQueryHandler(config.DidResolver, config.MessageStore, config.DataStore),
-			// "RecordsRead":        NewRecordsReadHandler(config.DidResolver, config.MessageStore, config.DataStore),
-			// "RecordsWrite":       NewRecordsWriteHandler(config.DidResolver, config.MessageStore, config.DataStore, config.EventLog),
+			"EventsGet":          NewEventsGetHandler(config.DidResolver, config.EventLog),
+			"EventsQuery":        NewEventsQueryHandler(config.DidResolver, config.EventLog),
+			"MessagesGet":        NewMessagesGetHandler(config.DidResolver, config.MessageStore, config.DataStore),
+			"MessagesQuery":      NewMessagesQueryHandler(config.DidResolver, config.MessageStore, config.EventLog),
+			"MessagesSubscribe":  NewMessagesSubscribeHandler(config.DidResolver, config.MessageStore, config.EventStream),
+			"PermissionsGrant":   NewPermissionsGrantHandler(config.DidResolver, config.MessageStore, config.EventLog),
+			"PermissionsRequest": NewPermissionsRequestHandler(config.DidResolver, config.MessageStore, config.EventLog),
+			"PermissionsRevoke":  NewPermissionsRevokeHandler(config.DidResolver, config.MessageStore, config.EventLog),
+			"ProtocolsConfigure": NewProtocolsConfigureHandler(config.DidResolver, config.MessageStore, config.DataStore, config.EventLog, config.EventStream),
+			"ProtocolsQuery":     NewProtocolsQueryHandler(config.DidResolver, config.MessageStore, config.DataStore),
+			"RecordsDelete":      NewRecordsDeleteHandler(config.DidResolver, config.MessageStore, config.DataStore, config.EventLog, config.EventStream),
+			"RecordsQuery":       NewRecordsQueryHandler(config.DidResolver, config.MessageStore, config.DataStore),
+			"RecordsRead":        NewRecordsReadHandler(config.DidResolver, config.MessageStore, config.DataStore),
+			"RecordsSubscribe":   NewRecordsSubscribeHandler(config.DidResolver, config.MessageStore, config.EventStream),
+			"RecordsWrite":       NewRecordsWriteHandler(config.DidResolver, config.MessageStore, config.DataStore, config.EventLog, config.EventStream),
 		},
 	}
 
@@ -256,6 +448,11 @@ func (d *Dwn) Open() error {
 	if err := d.eventLog.Open(); err != nil {
 		return err
 	}
+	if d.eventStream != nil {
+		if err := d.eventStream.Open(); err != nil {
+			return err
+		}
+	}
 	if err := d.blockstore.Open(); err != nil {
 		return err
 	}
@@ -272,6 +469,11 @@ func (d *Dwn) Close() error {
 	if err := d.eventLog.Close(); err != nil {
 		return err
 	}
+	if d.eventStream != nil {
+		if err := d.eventStream.Close(); err != nil {
+			return err
+		}
+	}
 	if err := d.blockstore.Close(); err != nil {
 		return err
 	}
@@ -302,26 +504,46 @@ func getPathedStrNoErr(json map[string]interface{}, paths ...string) string {
 }
 
 func (d *Dwn) ProcessMessage(tenant string, rawMessage map[string]interface{}, dataStream io.Reader) (UnionMessageReply, error) {
-	if err := d.validateTenant(tenant); err != nil {
+	return d.process(&HandlerRequest{
+		Tenant:     tenant,
+		Message:    rawMessage,
+		DataStream: dataStream,
+	})
+}
+
+// ProcessSubscription processes a RecordsSubscribe or MessagesSubscribe
+// message.  Once the subscription is accepted, handler receives every
+// matching event until the subscription in the reply is closed.
+func (d *Dwn) ProcessSubscription(tenant string, rawMessage map[string]interface{},
+	handler SubscriptionHandler) (UnionMessageReply, error) {
+	return d.process(&HandlerRequest{
+		Tenant:              tenant,
+		Message:             rawMessage,
+		SubscriptionHandler: handler,
+	})
+}
+
+func (d *Dwn) process(request *HandlerRequest) (UnionMessageReply, error) {
+	if err := d.validateTenant(request.Tenant); err != nil {
 		return UnionMessageReply{Status: Status{Code: 401, Detail: err.Error()}}, nil
 	}
 
-	if err := d.validateMessageIntegrity(rawMessage); err != nil {
+	if err := d.validateMessageIntegrity(request.Message); err != nil {
 		return UnionMessageReply{Status: Status{Code: 400, Detail: err.Error()}}, nil
 	}
 
-	//
-	handlerKey := getPathedStrNoErr(rawMessage, "Descriptor", "Interface") + getPathedStrNoErr(rawMessage, "Descriptor", "Method")
+	if err := d.authenticate(request.Message); err != nil {
+		return UnionMessageReply{Status: Status{Code: 401, Detail: err.Error()}}, nil
+	}
+
+	handlerKey := getPathedStrNoErr(request.Message, "descriptor", "interface") +
+		getPathedStrNoErr(request.Message, "descriptor", "method")
 	methodHandler, exists := d.methodHandlers[handlerKey]
 	if !exists {
 		return UnionMessageReply{}, errors.New("handler not found")
 	}
 
-	return methodHandler.Handle(&HandlerRequest{
-		Tenant:     tenant,
-		Message:    rawMessage,
-		DataStream: dataStream,
-	})
+	return methodHandler.Handle(request)
 }
 
 func (d *Dwn) validateTenant(tenant string) error {
@@ -336,43 +558,72 @@ func (d *Dwn) validateTenant(tenant string) error {
 }
 
 func (d *Dwn) validateMessageIntegrity(rawMessage map[string]interface{}) error {
-	if getPathedStrNoErr(rawMessage, "Descriptor", "Interface") == "" ||
-		getPathedStrNoErr(rawMessage, "Descriptor", "Method") == "" {
+	if getPathedStrNoErr(rawMessage, "descriptor", "interface") == "" ||
+		getPathedStrNoErr(rawMessage, "descriptor", "method") == "" {
 		return errors.New("both interface and method must be present")
 	}
 
-	// if err := ValidateJsonSchema(rawMessage); err != nil {
-	// 	return err
-	// }
+	if err := ValidateJsonSchema(rawMessage); err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func (dwn *Dwn) authenticate(auth Authorization) error {
-	_, err := json.Marshal(auth.signature())
-	if err != nil {
+// authenticate verifies the signatures of a message, if it has any: its
+// signature, the owner signature of a RecordsWrite, and the signatures of the
+// delegated grants they act under.  Messages without an authorization are
+// anonymous; the handlers decide whether they accept them.
+func (dwn *Dwn) authenticate(rawMessage map[string]interface{}) error {
+	if _, ok := rawMessage["authorization"]; !ok {
+		return nil
+	}
+	var message struct {
+		Authorization AuthorizationOwner `json:"authorization"`
+	}
+	if err := parseMessage(rawMessage, &message); err != nil {
 		return err
 	}
 
-	// sig, err := jose.ParseSigned(string(reser),
-	// 	[]jose.SignatureAlgorithm{jose.EdDSA, jose.HS256, jose.HS384})
-	//if err != nil {
-	//return err
-	//}
-	//fmt.Println("sig", sig)
-	// for i, s := range sig.Signatures {
-	// 	fmt.Println(i, "keyid", s.Header.KeyID)
-	// 	// didResult, err := dwn.didResolver.Resolve(s.Header.KeyID)
-	// 	// if err != nil {
-	// 	// 	return err
-	// 	// }
-	// 	//fmt.Println(i, "result", didResult)
-	// }
-
-	// TODO implement authentication logic
+	descriptor := rawMessage["descriptor"]
+	if _, err := authenticate(dwn.didResolver, message.Authorization.Signature, descriptor); err != nil {
+		return err
+	}
+	if ownerSignature := message.Authorization.OwnerSignature; ownerSignature != nil {
+		if _, err := authenticate(dwn.didResolver, *ownerSignature, descriptor); err != nil {
+			return fmt.Errorf("ownerSignature: %w", err)
+		}
+	}
+
+	grants := []struct {
+		key   string
+		grant *DelegatedGrant
+	}{
+		{"authorDelegatedGrant", message.Authorization.AuthorDelegatedGrant},
+		{"ownerDelegatedGrant", message.Authorization.OwnerDelegatedGrant},
+	}
+	for _, g := range grants {
+		if g.grant == nil {
+			continue
+		}
+		grantDescriptor := rawDelegatedGrant(rawMessage, g.key)["descriptor"]
+		if _, err := authenticate(dwn.didResolver, g.grant.Authorization.Signature, grantDescriptor); err != nil {
+			return fmt.Errorf("%s: %w", g.key, err)
+		}
+	}
 	return nil
 }
 
-func (dwn *Dwn) authorize(tenant Tenant, auth Authorization) error {
+// authorizeTenant allows only the tenant to use the interfaces that neither
+// protocol rules nor grants apply to, such as the legacy Events interface.
+// Other messages are authorized by their handlers.
+func authorizeTenant(tenant Tenant, auth Authorization) error {
+	signer, err := getSigner(auth.signature())
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	if signer != string(tenant) {
+		return newStatusError(401, "%s is not authorized to act for tenant %s", signer, tenant)
+	}
 	return nil
 }
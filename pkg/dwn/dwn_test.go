@@ -64,6 +64,7 @@ func NewTestDwn(t *testing.T) *Dwn {
 		MessageStore:       NewMemoryMessageStore(),
 		DataStore:          NewMemoryDatastore(),
 		EventLog:           NewMemoryEventLog(),
+		EventStream:        NewMemoryEventStream(),
 		BlockstoreLocation: blockstoreDir,
 	})
 
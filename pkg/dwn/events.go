@@ -0,0 +1,158 @@
+package dwn
+
+// EventsFilter selects events in EventsQuery.  See events-filter.json.
+type EventsFilter struct {
+	Interface    string `json:"interface,omitempty"`
+	Method       string `json:"method,omitempty"`
+	Protocol     string `json:"protocol,omitempty"`
+	ProtocolPath string `json:"protocolPath,omitempty"`
+	Recipient    string `json:"recipient,omitempty"`
+	ContextId    string `json:"contextId,omitempty"`
+	Schema       string `json:"schema,omitempty"`
+	RecordId     string `json:"recordId,omitempty"`
+	ParentId     string `json:"parentId,omitempty"`
+	DataFormat   string `json:"dataFormat,omitempty"`
+
+	DataSize      *NumberRangeFilter `json:"dataSize,omitempty"`
+	DateCreated   *DateRangeFilter   `json:"dateCreated,omitempty"`
+	DatePublished *DateRangeFilter   `json:"datePublished,omitempty"`
+	DateUpdated   *DateRangeFilter   `json:"dateUpdated,omitempty"`
+}
+
+// ToFilters translates the events filter into EventLog filters.  Apart from
+// interface and method, its properties are those of a RecordsFilter.
+func (f EventsFilter) ToFilters() ([]Filter, error) {
+	filters, err := RecordsFilter{
+		Protocol:      f.Protocol,
+		ProtocolPath:  f.ProtocolPath,
+		Recipient:     f.Recipient,
+		ContextId:     f.ContextId,
+		Schema:        f.Schema,
+		RecordId:      f.RecordId,
+		ParentId:      f.ParentId,
+		DataFormat:    f.DataFormat,
+		DataSize:      f.DataSize,
+		DateCreated:   f.DateCreated,
+		DatePublished: f.DatePublished,
+		DateUpdated:   f.DateUpdated,
+	}.ToFilters()
+	if err != nil {
+		return nil, err
+	}
+	if f.Interface != "" {
+		filters = append(filters, NewEqualFilter("interface", S(f.Interface)))
+	}
+	if f.Method != "" {
+		filters = append(filters, NewEqualFilter("method", S(f.Method)))
+	}
+	return filters, nil
+}
+
+type EventsGetHandler struct {
+	didResolver *DidResolver
+	eventLog    EventLog
+}
+
+func NewEventsGetHandler(didResolver *DidResolver, eventLog EventLog) MethodHandler {
+	return &EventsGetHandler{
+		didResolver: didResolver,
+		eventLog:    eventLog,
+	}
+}
+
+func (h *EventsGetHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	reply, err := h.get(Tenant(request.Tenant), request.Message)
+	if err != nil {
+		return replyFromError(err)
+	}
+	return reply, nil
+}
+
+func (h *EventsGetHandler) get(tenant Tenant, rawMessage map[string]interface{}) (UnionMessageReply, error) {
+	var message EventsGet
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceEvents || descriptor.Method != MethodGet {
+		return UnionMessageReply{}, newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceEvents, MethodGet, descriptor.Interface, descriptor.Method)
+	}
+	if err := authorizeTenant(tenant, message.Authorization); err != nil {
+		return UnionMessageReply{}, err
+	}
+
+	events, err := queryEvents(h.eventLog, tenant, nil, EventLogCursor(descriptor.Cursor), 0)
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+	return eventsReply(events), nil
+}
+
+type EventsQueryHandler struct {
+	didResolver *DidResolver
+	eventLog    EventLog
+}
+
+func NewEventsQueryHandler(didResolver *DidResolver, eventLog EventLog) MethodHandler {
+	return &EventsQueryHandler{
+		didResolver: didResolver,
+		eventLog:    eventLog,
+	}
+}
+
+func (h *EventsQueryHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	reply, err := h.query(Tenant(request.Tenant), request.Message)
+	if err != nil {
+		return replyFromError(err)
+	}
+	return reply, nil
+}
+
+func (h *EventsQueryHandler) query(tenant Tenant, rawMessage map[string]interface{}) (UnionMessageReply, error) {
+	var message EventsQuery
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceEvents || descriptor.Method != MethodQuery {
+		return UnionMessageReply{}, newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceEvents, MethodQuery, descriptor.Interface, descriptor.Method)
+	}
+	if len(descriptor.Filters) == 0 {
+		return UnionMessageReply{}, newStatusError(400, "at least one filter is required")
+	}
+	if err := authorizeTenant(tenant, message.Authorization); err != nil {
+		return UnionMessageReply{}, err
+	}
+
+	filterSets := make([][]Filter, 0, len(descriptor.Filters))
+	for _, filter := range descriptor.Filters {
+		filters, err := filter.ToFilters()
+		if err != nil {
+			return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+		}
+		filterSets = append(filterSets, filters)
+	}
+	events, err := queryEvents(h.eventLog, tenant, filterSets, EventLogCursor(descriptor.Cursor), 0)
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+	return eventsReply(events), nil
+}
+
+// eventsReply lists events in the legacy shape, each with the watermark to
+// resume after it.
+func eventsReply(events []EventLogEntry) UnionMessageReply {
+	reply := UnionMessageReply{
+		Status:  Status{Code: 200},
+		Entries: make([]map[string]interface{}, 0, len(events)),
+	}
+	for _, event := range events {
+		reply.Entries = append(reply.Entries, map[string]interface{}{
+			"messageCid": string(event.MessageCid),
+			"watermark":  string(event.Watermark),
+		})
+	}
+	return reply
+}
@@ -0,0 +1,54 @@
+package dwn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	first := writeTestRecord(t, dwn, alice, testRecordsWrite{schema: "first"})
+	second := writeTestRecord(t, dwn, alice, testRecordsWrite{schema: "second"})
+	firstCid, secondCid := testMessageCid(t, first), testMessageCid(t, second)
+
+	t.Run("EventsGet returns events after the cursor", func(t *testing.T) {
+		get := newTestMessage(t, &alice, InterfaceEvents, MethodGet, nil)
+		reply, err := dwn.ProcessMessage(alice.URI, get, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Equal(t, []string{firstCid, secondCid}, replyMessageCids(t, reply))
+
+		get = newTestMessage(t, &alice, InterfaceEvents, MethodGet, map[string]interface{}{
+			"cursor": reply.Entries[0]["watermark"],
+		})
+		reply, err = dwn.ProcessMessage(alice.URI, get, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Equal(t, []string{secondCid}, replyMessageCids(t, reply))
+	})
+
+	t.Run("EventsQuery matches filters", func(t *testing.T) {
+		query := newTestMessage(t, &alice, InterfaceEvents, MethodQuery, map[string]interface{}{
+			"filters": []map[string]interface{}{{"schema": "second"}},
+		})
+		reply, err := dwn.ProcessMessage(alice.URI, query, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Equal(t, []string{secondCid}, replyMessageCids(t, reply))
+
+		query = newTestMessage(t, &alice, InterfaceEvents, MethodQuery, map[string]interface{}{
+			"filters": []map[string]interface{}{},
+		})
+		assert.Equal(t, 400, processStatus(t, dwn, alice.URI, query))
+	})
+
+	t.Run("only the tenant can read events", func(t *testing.T) {
+		get := newTestMessage(t, &bob, InterfaceEvents, MethodGet, nil)
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, get))
+	})
+}
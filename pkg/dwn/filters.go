@@ -0,0 +1,108 @@
+package dwn
+
+import (
+	"strings"
+)
+
+// matchFilters reports whether a message's indexes satisfy every filter.
+// An empty filter list matches everything.
+func matchFilters(indexes IndexableKeyValues, filters []Filter) bool {
+	for _, filter := range filters {
+		if !matchFilter(indexes, filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchFilter(indexes IndexableKeyValues, filter Filter) bool {
+	if or, ok := filter.(OrFilter); ok {
+		for _, alternative := range or.AnyOf {
+			if matchFilters(indexes, alternative) {
+				return true
+			}
+		}
+		return false
+	}
+
+	value, ok := indexes[filter.Property()]
+	if !ok {
+		return false
+	}
+
+	switch f := filter.Value().(type) {
+	case EqualFilter:
+		return indexableEqual(value, f.EqualTo)
+	case OneOfFilter:
+		for _, option := range f.OneOf {
+			if indexableEqual(value, option.EqualTo) {
+				return true
+			}
+		}
+		return false
+	case RangeFilter:
+		bound, ok := f.RangeValue().(IndexableValue)
+		if !ok {
+			return false
+		}
+		cmp, ok := compareIndexable(value, bound)
+		if !ok {
+			return false
+		}
+		switch f.(type) {
+		case GT:
+			return cmp > 0
+		case GTE:
+			return cmp >= 0
+		case LT:
+			return cmp < 0
+		case LTE:
+			return cmp <= 0
+		}
+	}
+	return false
+}
+
+func indexableEqual(a, b IndexableValue) bool {
+	if ab, ok := a.(B); ok {
+		bb, ok := b.(B)
+		return ok && ab == bb
+	}
+	cmp, ok := compareIndexable(a, b)
+	return ok && cmp == 0
+}
+
+// compareIndexable orders two indexable values.  Numbers compare with
+// numbers and strings with strings; any other pairing is not comparable.
+func compareIndexable(a, b IndexableValue) (int, bool) {
+	if as, ok := a.(S); ok {
+		bs, ok := b.(S)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(string(as), string(bs)), true
+	}
+
+	af, aok := indexableNumber(a)
+	bf, bok := indexableNumber(b)
+	if !aok || !bok {
+		return 0, false
+	}
+	switch {
+	case af < bf:
+		return -1, true
+	case af > bf:
+		return 1, true
+	}
+	return 0, true
+}
+
+func indexableNumber(v IndexableValue) (float64, bool) {
+	switch n := v.(type) {
+	case I:
+		return float64(n), true
+	case F:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,159 @@
+package dwn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/crypto/dsa"
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/didcore"
+	"github.com/abaxxtech/abaxx-id-go/pkg/jws"
+	"github.com/abaxxtech/abaxx-id-go/pkg/utils"
+)
+
+// getSigner returns the DID of the first signer of a General JWS, taken from
+// the `kid` of its protected header.
+func getSigner(signature GeneralJws) (string, error) {
+	if len(signature.Signatures) == 0 {
+		return "", errors.New("signature is missing")
+	}
+
+	header, err := jws.DecodeHeader(signature.Signatures[0].Protected)
+	if err != nil {
+		return "", fmt.Errorf("malformed protected header: %w", err)
+	}
+
+	signer, err := _did.Parse(header.KID)
+	if err != nil {
+		return "", fmt.Errorf("kid must be a DID URL: %w", err)
+	}
+
+	return signer.URI, nil
+}
+
+// decodeSignaturePayload decodes the base64url JSON payload of a General JWS
+// into v.
+func decodeSignaturePayload(signature GeneralJws, v interface{}) error {
+	payload, err := base64.RawURLEncoding.DecodeString(signature.Payload)
+	if err != nil {
+		return fmt.Errorf("malformed signature payload: %w", err)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("malformed signature payload: %w", err)
+	}
+	return nil
+}
+
+// authenticate verifies a message signature and checks that its payload
+// commits to the message descriptor.  It returns the verified signer.
+func authenticate(didResolver *DidResolver, signature GeneralJws, descriptor interface{}) (string, error) {
+	if err := verifyGeneralJws(didResolver, signature); err != nil {
+		return "", err
+	}
+
+	var payload utils.GenericSignaturePayload
+	if err := decodeSignaturePayload(signature, &payload); err != nil {
+		return "", err
+	}
+	descriptorCid, err := computeCid(descriptor)
+	if err != nil {
+		return "", err
+	}
+	if payload.DescriptorCid != descriptorCid {
+		return "", fmt.Errorf("descriptorCid %s in signature payload does not match descriptor CID %s",
+			payload.DescriptorCid, descriptorCid)
+	}
+
+	return getSigner(signature)
+}
+
+// verifyGeneralJws verifies every signature of a General JWS with the key
+// its `kid` refers to in the signer's DID document.
+func verifyGeneralJws(didResolver *DidResolver, signature GeneralJws) error {
+	if len(signature.Signatures) == 0 {
+		return errors.New("signature is missing")
+	}
+
+	for _, sig := range signature.Signatures {
+		header, err := jws.DecodeHeader(sig.Protected)
+		if err != nil {
+			return fmt.Errorf("malformed protected header: %w", err)
+		}
+		if header.ALG == "" || header.KID == "" {
+			return errors.New("protected header requires alg and kid")
+		}
+		signer, err := _did.Parse(header.KID)
+		if err != nil {
+			return fmt.Errorf("kid must be a DID URL: %w", err)
+		}
+
+		resolution, err := didResolver.Resolve(signer.URI)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", signer.URI, err)
+		}
+		if resolution.DidResolutionMetadata.Error != "" {
+			return fmt.Errorf("failed to resolve %s: %s", signer.URI, resolution.DidResolutionMetadata.Error)
+		}
+		document, err := toDidDocument(resolution.DidDocument)
+		if err != nil {
+			return err
+		}
+		method, err := selectVerificationMethod(document, signer.URL())
+		if err != nil {
+			return err
+		}
+
+		signatureBytes, err := jws.DecodeSignature(sig.Signature)
+		if err != nil {
+			return err
+		}
+		verified, err := dsa.Verify([]byte(sig.Protected+"."+signature.Payload), signatureBytes, *method.PublicKeyJwk)
+		if err != nil {
+			return fmt.Errorf("failed to verify signature of %s: %w", header.KID, err)
+		}
+		if !verified {
+			return fmt.Errorf("invalid signature of %s", header.KID)
+		}
+	}
+	return nil
+}
+
+// toDidDocument returns a resolved DID document as a didcore.Document.
+// Documents read from files or URLs arrive as plain JSON values.
+func toDidDocument(document interface{}) (didcore.Document, error) {
+	switch d := document.(type) {
+	case didcore.Document:
+		return d, nil
+	case *didcore.Document:
+		if d != nil {
+			return *d, nil
+		}
+	}
+
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return didcore.Document{}, fmt.Errorf("malformed DID document: %w", err)
+	}
+	var parsed didcore.Document
+	if err := json.Unmarshal(encoded, &parsed); err != nil {
+		return didcore.Document{}, fmt.Errorf("malformed DID document: %w", err)
+	}
+	return parsed, nil
+}
+
+// selectVerificationMethod returns the verification method of document with
+// the given DID URL, which the document may list by a relative ID.
+func selectVerificationMethod(document didcore.Document, url string) (didcore.VerificationMethod, error) {
+	for _, method := range document.VerificationMethod {
+		if method.ID == "" || document.GetAbsoluteResourceID(method.ID) != url {
+			continue
+		}
+		if method.PublicKeyJwk == nil {
+			return didcore.VerificationMethod{}, fmt.Errorf("verification method %s has no publicKeyJwk", url)
+		}
+		return method, nil
+	}
+	return didcore.VerificationMethod{}, fmt.Errorf("no verification method %s in DID document", url)
+}
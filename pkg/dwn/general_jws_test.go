@@ -0,0 +1,88 @@
+package dwn
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	didResolver := NewDidResolver(nil, nil)
+
+	descriptor := roundTrip(t, map[string]interface{}{
+		"interface":        InterfaceRecords,
+		"method":           MethodQuery,
+		"messageTimestamp": newMessageTimestamp(),
+	})
+	signature := signTestPayload(t, alice, descriptor, map[string]interface{}{})
+
+	t.Run("returns the verified signer", func(t *testing.T) {
+		signer, err := authenticate(didResolver, signature, descriptor)
+		require.NoError(t, err)
+		assert.Equal(t, alice.URI, signer)
+	})
+
+	t.Run("rejects a signature over another descriptor", func(t *testing.T) {
+		other := roundTrip(t, map[string]interface{}{
+			"interface":        InterfaceRecords,
+			"method":           MethodQuery,
+			"messageTimestamp": newMessageTimestamp(),
+		})
+		_, err := authenticate(didResolver, signature, other)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects a signature by a key other than the kid", func(t *testing.T) {
+		bobs := signTestPayload(t, bob, descriptor, map[string]interface{}{})
+		forged := GeneralJws{
+			Payload:    bobs.Payload,
+			Signatures: []Signature{{Protected: signature.Signatures[0].Protected, Signature: bobs.Signatures[0].Signature}},
+		}
+		_, err := authenticate(didResolver, forged, descriptor)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects a changed payload", func(t *testing.T) {
+		tampered := signTestPayload(t, alice, descriptor, map[string]interface{}{"protocolRole": "admin"})
+		tampered.Signatures = signature.Signatures
+		_, err := authenticate(didResolver, tampered, descriptor)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects signers that cannot be resolved", func(t *testing.T) {
+		ionOnly := NewDidResolver([]DidMethodResolver{StaticDidResolver{method: "ion"}}, nil)
+		_, err := authenticate(ionOnly, signature, descriptor)
+		assert.Error(t, err)
+	})
+}
+
+func TestProcessMessageAuthentication(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	dwn := NewTestDwn(t)
+
+	t.Run("rejects forged messages", func(t *testing.T) {
+		message, data := newTestRecordsWrite(t, bob, testRecordsWrite{})
+		signature := getTestSignature(t, message)
+		signature.Signatures[0].Protected = getTestSignature(t,
+			newTestMessage(t, &alice, InterfaceRecords, MethodQuery, nil)).Signatures[0].Protected
+		message["authorization"] = map[string]interface{}{"signature": signature}
+
+		reply, err := dwn.ProcessMessage(alice.URI, roundTrip(t, message), bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 401, reply.Status.Code)
+	})
+
+	t.Run("rejects messages whose descriptor changed after signing", func(t *testing.T) {
+		message := newTestRecordsQuery(t, &alice, map[string]interface{}{}, nil)
+		message["descriptor"].(map[string]interface{})["dateSort"] = DateSortCreatedDescending
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 401, reply.Status.Code)
+	})
+}
@@ -6,89 +6,208 @@ import (
 	"fmt"
 	"io"
 
-	cid "github.com/ipfs/go-cid"
-	mh "github.com/multiformats/go-multihash"
-)
-
-const (
-	expectedCidType    = 85
-	expectedCidVersion = 1
-	expectedHashCode   = 18
-	expectedHashName   = "sha2-256"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
 )
 
 type HandlerRequest struct {
 	Tenant     string
 	Message    map[string]interface{}
 	DataStream io.Reader
+	// SubscriptionHandler receives the events of a subscription.
+	SubscriptionHandler SubscriptionHandler
 }
 
-func (message *RecordsWrite) Handle(dwn *Dwn) error {
+// SubscriptionHandler receives the events matching a subscription, in the
+// order they were emitted.
+type SubscriptionHandler func(event MessageEvent)
+
+// parseMessage decodes a raw message into its typed form.
+func parseMessage(rawMessage map[string]interface{}, v interface{}) error {
+	encoded, err := json.Marshal(rawMessage)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(encoded, v); err != nil {
+		return fmt.Errorf("malformed message: %w", err)
+	}
 	return nil
 }
 
-func validateCids(cids []string) error {
+// statusError is a handler failure reported to the client as a reply with
+// the given status code, rather than as an internal error.
+type statusError struct {
+	Code int
+	Err  error
+}
 
-	for _, cidStr := range cids {
-		cid, err := cid.Decode(cidStr)
-		if err != nil {
+func (e *statusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.Err
+}
+
+func newStatusError(code int, format string, a ...interface{}) error {
+	return &statusError{Code: code, Err: fmt.Errorf(format, a...)}
+}
+
+// replyFromError turns a handler failure into its reply.  Errors that carry
+// no status are internal and are passed through unchanged.
+func replyFromError(err error) (UnionMessageReply, error) {
+	var se *statusError
+	if errors.As(err, &se) {
+		return UnionMessageReply{Status: Status{Code: se.Code, Detail: se.Error()}}, nil
+	}
+	return UnionMessageReply{}, err
+}
+
+func validateCids(cids []string) error {
+	for _, messageCid := range cids {
+		if err := cid.ValidateMessageCid(messageCid); err != nil {
 			return err
 		}
+	}
+	return nil
+}
+
+type MessagesGetHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	dataStore    DataStore
+}
+
+func NewMessagesGetHandler(didResolver *DidResolver, messageStore MessageStore, dataStore DataStore) MethodHandler {
+	return &MessagesGetHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		dataStore:    dataStore,
+	}
+}
+
+func (h *MessagesGetHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	reply, err := h.get(Tenant(request.Tenant), request.Message)
+	if err != nil {
+		return replyFromError(err)
+	}
+	return reply, nil
+}
 
-		if cid.Type() != expectedCidType {
-			return errors.New("invalid CID type")
+// get returns an entry for every requested CID: the message, with small
+// RecordsWrite data inline as encodedData and larger data streamed in
+// EntryData, or the reason it could not be returned.
+func (h *MessagesGetHandler) get(tenant Tenant, rawMessage map[string]interface{}) (UnionMessageReply, error) {
+	var message MessagesGet
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceMessages || descriptor.Method != MethodGet {
+		return UnionMessageReply{}, newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceMessages, MethodGet, descriptor.Interface, descriptor.Method)
+	}
+	if err := validateCids(descriptor.MessageCids); err != nil {
+		return UnionMessageReply{}, newStatusError(400, "invalid messageCids: %w", err)
+	}
+	protocol, err := h.authorize(tenant, &message)
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+
+	reply := UnionMessageReply{
+		Status:  Status{Code: 200},
+		Entries: make([]map[string]interface{}, 0, len(descriptor.MessageCids)),
+	}
+	for _, messageCid := range descriptor.MessageCids {
+		entry := map[string]interface{}{"messageCid": messageCid}
+		reply.Entries = append(reply.Entries, entry)
+
+		stored, err := h.messageStore.Get(tenant, MessageCid(messageCid))
+		if err != nil {
+			return UnionMessageReply{}, err
+		}
+		if stored == nil {
+			entry["error"] = "message not found"
+			continue
+		}
+		storedMessage, err := toRawMessage(stored)
+		if err != nil {
+			return UnionMessageReply{}, err
 		}
-		if cid.Version() != expectedCidVersion {
-			return errors.New("only support v1 for CIDs")
+		if protocol != "" && messageProtocol(storedMessage) != protocol {
+			entry["error"] = fmt.Sprintf("grant does not cover messages outside protocol %s", protocol)
+			continue
 		}
+		entry["message"] = storedMessage
 
-		de, err := mh.Decode(cid.Hash())
+		if getPathedStrNoErr(storedMessage, "descriptor", "interface")+
+			getPathedStrNoErr(storedMessage, "descriptor", "method") != InterfaceRecords+MethodWrite {
+			continue
+		}
+		if _, ok := storedMessage["encodedData"]; ok {
+			continue
+		}
+		dataCid := DataCid(getPathedStrNoErr(storedMessage, "descriptor", "dataCid"))
+		_, _, dataStream, err := h.dataStore.Get(tenant, MessageCid(messageCid), dataCid)
 		if err != nil {
-			return err
+			return UnionMessageReply{}, err
 		}
-		if de.Code != expectedHashCode {
-			return errors.New("only support sha2-256")
+		// The data of superseded writes is not kept.
+		if dataStream == nil {
+			continue
 		}
-		if de.Name != expectedHashName {
-			return errors.New("only support sha2-256")
+		if reply.EntryData == nil {
+			reply.EntryData = map[string]io.Reader{}
 		}
+		reply.EntryData[messageCid] = dataStream
 	}
-
-	return nil
+	return reply, nil
 }
 
-func (message *MessagesGet) Handle(tenant Tenant, dwn *Dwn) error {
-	// Already done.
-	// messagesGet = await MessagesGet.parse(message)
+// authorize allows the tenant to get any message, and holders of a
+// MessagesGet grant the messages it covers.  It returns the protocol a
+// grant limits the requester to, or "" if there is no such limit.
+func (h *MessagesGetHandler) authorize(tenant Tenant, message *MessagesGet) (string, error) {
+	requester, err := getSigner(message.Authorization.Signature)
+	if err != nil {
+		return "", &statusError{Code: 400, Err: err}
+	}
+	if requester == string(tenant) {
+		return "", nil
+	}
 
-	// validateMessageCids
-	err := validateCids(message.Descriptor.MessageCids)
+	grantId, err := signaturePermissionGrantId(message.Authorization.Signature)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if grantId == "" {
+		return "", newStatusError(401, "%s is not authorized to get messages of tenant %s", requester, tenant)
 	}
-	err = dwn.authenticate(message.Authorization)
+	grant, err := fetchPermissionGrant(h.messageStore, tenant, grantId)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if grant == nil {
+		return "", newStatusError(401, "grant %s does not exist", grantId)
 	}
-	err = dwn.authorize(tenant, message.Authorization)
+	protocol := grant.Descriptor.Scope.Protocol
+	err = verifyPermissionGrant(h.messageStore, tenant, requester, grantId, grantedAction{
+		Interface:        InterfaceMessages,
+		Method:           MethodGet,
+		MessageTimestamp: message.Descriptor.MessageTimestamp,
+		Protocol:         protocol,
+	})
 	if err != nil {
-		return err
+		return "", err
 	}
+	return protocol, nil
+}
 
-	// set of message cids....
-	results := make([]interface{}, len(message.Descriptor.MessageCids))
-	for i, cid := range message.Descriptor.MessageCids {
-		res, err := dwn.messageStore.Get(tenant, MessageCid(cid))
-		if err != nil {
-			return err
-		}
-		// Serialize the message to JSON
-		serializedMessage, err := json.Marshal(res)
-		if err != nil {
-			return fmt.Errorf("failed to serialize message: %w", err)
-		}
-		results[i] = json.RawMessage(serializedMessage)
+// messageProtocol returns the protocol a message belongs to, or "" if it
+// belongs to none.
+func messageProtocol(message map[string]interface{}) string {
+	if protocol := getPathedStrNoErr(message, "descriptor", "protocol"); protocol != "" {
+		return protocol
 	}
-	// TODO return results here.
-	return nil
+	return getPathedStrNoErr(message, "descriptor", "definition", "protocol")
 }
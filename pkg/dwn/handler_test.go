@@ -0,0 +1,106 @@
+package dwn
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMessagesGet(t *testing.T, author _did.BearerDID, messageCids ...string) map[string]interface{} {
+	t.Helper()
+	return newTestMessage(t, &author, InterfaceMessages, MethodGet, map[string]interface{}{
+		"messageCids": messageCids,
+	})
+}
+
+func testMessageCid(t *testing.T, message map[string]interface{}) string {
+	t.Helper()
+	messageCid, err := computeMessageCid(message)
+	require.NoError(t, err)
+	return string(messageCid)
+}
+
+func TestMessagesGet(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	definition := loadTestProtocolDefinition(t, "chat.json")
+	configureTestProtocol(t, dwn, alice, definition)
+	protocol := definition["protocol"].(string)
+
+	small := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+	largeData := bytes.Repeat([]byte("a"), MaxEncodedDataSize+1)
+	large := writeTestRecord(t, dwn, alice, testRecordsWrite{data: largeData})
+	thread := writeTestRecord(t, dwn, alice, testRecordsWrite{
+		protocol: protocol, protocolPath: "thread", schema: "thread",
+	})
+	unknown, _ := newTestRecordsWrite(t, alice, testRecordsWrite{})
+
+	smallCid, largeCid, threadCid := testMessageCid(t, small), testMessageCid(t, large), testMessageCid(t, thread)
+	unknownCid := testMessageCid(t, unknown)
+
+	t.Run("returns messages and their data", func(t *testing.T) {
+		reply, err := dwn.ProcessMessage(alice.URI, newTestMessagesGet(t, alice, smallCid, largeCid, unknownCid), nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		require.Len(t, reply.Entries, 3)
+
+		assert.Equal(t, smallCid, reply.Entries[0]["messageCid"])
+		message := reply.Entries[0]["message"].(map[string]interface{})
+		assert.Contains(t, message, "encodedData")
+		assert.NotContains(t, reply.EntryData, smallCid)
+
+		assert.Equal(t, largeCid, reply.Entries[1]["messageCid"])
+		require.Contains(t, reply.EntryData, largeCid)
+		data, err := io.ReadAll(reply.EntryData[largeCid])
+		require.NoError(t, err)
+		assert.Equal(t, largeData, data)
+
+		assert.Equal(t, unknownCid, reply.Entries[2]["messageCid"])
+		assert.NotContains(t, reply.Entries[2], "message")
+		assert.Contains(t, reply.Entries[2], "error")
+	})
+
+	t.Run("rejects malformed CIDs", func(t *testing.T) {
+		reply, err := dwn.ProcessMessage(alice.URI, newTestMessagesGet(t, alice, "not-a-cid"), nil)
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+
+	t.Run("requires a grant for anyone but the tenant", func(t *testing.T) {
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, newTestMessagesGet(t, bob, smallCid)))
+
+		grantId := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceMessages, "method": MethodGet,
+		}, nil)
+		get := withTestPermissionGrant(t, bob, newTestMessagesGet(t, bob, smallCid, threadCid), grantId)
+		reply, err := dwn.ProcessMessage(alice.URI, get, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Contains(t, reply.Entries[0], "message")
+		assert.Contains(t, reply.Entries[1], "message")
+	})
+
+	t.Run("limits grants to their protocol", func(t *testing.T) {
+		grantId := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceMessages, "method": MethodGet, "protocol": protocol,
+		}, nil)
+		get := withTestPermissionGrant(t, bob, newTestMessagesGet(t, bob, smallCid, threadCid), grantId)
+		reply, err := dwn.ProcessMessage(alice.URI, get, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Contains(t, reply.Entries[0], "error")
+		assert.Contains(t, reply.Entries[1], "message")
+
+		readGrantId := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceRecords, "method": MethodRead,
+		}, nil)
+		get = withTestPermissionGrant(t, bob, newTestMessagesGet(t, bob, smallCid), readGrantId)
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, get))
+	})
+}
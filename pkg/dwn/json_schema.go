@@ -0,0 +1,266 @@
+package dwn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"strings"
+	"sync"
+
+	jsonschemas "github.com/abaxxtech/abaxx-id-go/json-schemas"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const schemaBaseUrl = "https://identity.foundation/dwn/json-schemas/"
+
+// messageSchemas names the schema of each interface and method, relative to
+// schemaBaseUrl.
+var messageSchemas = map[string]string{
+	"EventsGet":          "events-get.json",
+	"EventsQuery":        "events-query.json",
+	"MessagesGet":        "messages-get.json",
+	"MessagesQuery":      "messages-query.json",
+	"MessagesSubscribe":  "messages-subscribe.json",
+	"PermissionsGrant":   "permissions-grant.json",
+	"PermissionsRequest": "permissions-request.json",
+	"PermissionsRevoke":  "permissions-revoke.json",
+	"ProtocolsConfigure": "protocols-configure.json",
+	"ProtocolsQuery":     "protocols-query.json",
+	"RecordsDelete":      "records-delete.json",
+	"RecordsQuery":       "records-query.json",
+	"RecordsRead":        "records-read.json",
+	"RecordsSubscribe":   "records-subscribe.json",
+	"RecordsWrite":       "records-write.json",
+}
+
+var (
+	compileSchemasOnce sync.Once
+	compiledSchemas    map[string]*jsonschema.Schema
+	compileSchemasErr  error
+)
+
+// compileSchemas compiles the embedded schemas, once.  The schemas refer to
+// each other by $id rather than by path, so every schema is added to the
+// compiler under its $id before any is compiled, as adaptSchema leaves it.
+func compileSchemas() (map[string]*jsonschema.Schema, error) {
+	compileSchemasOnce.Do(func() {
+		compiler := jsonschema.NewCompiler()
+		compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+			return nil, fmt.Errorf("unknown schema %s", url)
+		}
+		err := fs.WalkDir(jsonschemas.FS, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json") {
+				return err
+			}
+			content, err := jsonschemas.FS.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var schema struct {
+				Id string `json:"$id"`
+			}
+			if err := json.Unmarshal(content, &schema); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if schema.Id == "" {
+				return nil
+			}
+			content, err = adaptSchema(content)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			return compiler.AddResource(schema.Id, bytes.NewReader(content))
+		})
+		if err != nil {
+			compileSchemasErr = fmt.Errorf("failed to load schemas: %w", err)
+			return
+		}
+
+		schemas := make(map[string]*jsonschema.Schema, len(messageSchemas)+2)
+		names := []string{"records-write-data-encoded.json", "permission-grant-data.json"}
+		for _, name := range messageSchemas {
+			names = append(names, name)
+		}
+		for _, name := range names {
+			schema, err := compiler.Compile(schemaBaseUrl + name)
+			if err != nil {
+				compileSchemasErr = fmt.Errorf("failed to compile schema %s: %w", name, err)
+				return
+			}
+			schemas[name] = schema
+		}
+		compiledSchemas = schemas
+	})
+	return compiledSchemas, compileSchemasErr
+}
+
+// negativeLookahead matches the one form of lookahead the schemas use, a
+// pattern matching any name other than those listed.
+var negativeLookahead = regexp.MustCompile(`^\^\(\?!((?:[^()|]+\$\|)*[^()|]+\$)\)\.\*\$$`)
+
+// adaptSchema rewrites the parts of a schema written for the reference
+// implementation that the compiler cannot take as they are:
+//   - references into `definitions`, which the definition files keep under
+//     `$defs`, refer to `$defs`
+//   - a pattern property whose pattern matches any name other than the
+//     declared properties, a lookahead Go regular expressions lack, becomes
+//     the additionalProperties it amounts to
+func adaptSchema(content []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var schema interface{}
+	if err := decoder.Decode(&schema); err != nil {
+		return nil, err
+	}
+	if err := adaptSchemaValue(schema); err != nil {
+		return nil, err
+	}
+	return json.Marshal(schema)
+}
+
+func adaptSchemaValue(value interface{}) error {
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			if err := adaptSchemaValue(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if ref, ok := value["$ref"].(string); ok {
+			value["$ref"] = strings.Replace(ref, "#/definitions/", "#/$defs/", 1)
+		}
+		if patternProperties, ok := value["patternProperties"].(map[string]interface{}); ok {
+			for pattern, schema := range patternProperties {
+				match := negativeLookahead.FindStringSubmatch(pattern)
+				if match == nil {
+					continue
+				}
+				if err := checkExcludedProperties(value, match[1]); err != nil {
+					return fmt.Errorf("pattern %s: %w", pattern, err)
+				}
+				if _, ok := value["additionalProperties"]; ok {
+					return fmt.Errorf("pattern %s: additionalProperties is already set", pattern)
+				}
+				value["additionalProperties"] = schema
+				delete(patternProperties, pattern)
+			}
+			if len(patternProperties) == 0 {
+				delete(value, "patternProperties")
+			}
+		}
+		for _, item := range value {
+			if err := adaptSchemaValue(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkExcludedProperties checks that the names a negative lookahead
+// excludes, such as `\$a$|\$b$`, are exactly the properties schema declares,
+// so that the pattern matches the names additionalProperties applies to.
+func checkExcludedProperties(schema map[string]interface{}, excluded string) error {
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := strings.Split(excluded, "|")
+	if len(names) != len(properties) {
+		return errors.New("excluded names differ from the properties")
+	}
+	for _, name := range names {
+		name = strings.ReplaceAll(strings.TrimSuffix(name, "$"), `\$`, "$")
+		if _, ok := properties[name]; !ok {
+			return fmt.Errorf("excluded name %s is not a property", name)
+		}
+	}
+	return nil
+}
+
+// ValidateJsonSchema validates a message against the schema of its interface
+// and method.  The error of an invalid message points at the offending value
+// with a JSON pointer in URI fragment form, such as #/descriptor/dataCid.
+func ValidateJsonSchema(rawMessage map[string]interface{}) error {
+	handlerKey := getPathedStrNoErr(rawMessage, "descriptor", "interface") +
+		getPathedStrNoErr(rawMessage, "descriptor", "method")
+	name, ok := messageSchemas[handlerKey]
+	if !ok {
+		return fmt.Errorf("unsupported interface and method %s", handlerKey)
+	}
+	if _, ok := rawMessage["encodedData"]; ok && handlerKey == "RecordsWrite" {
+		name = "records-write-data-encoded.json"
+	}
+
+	// Messages built in process may hold Go values other than those JSON
+	// decodes to, so validate the JSON form of the message.
+	encoded, err := json.Marshal(rawMessage)
+	if err != nil {
+		return fmt.Errorf("malformed message: %w", err)
+	}
+	instance, err := decodeInstance(encoded)
+	if err != nil {
+		return fmt.Errorf("malformed message: %w", err)
+	}
+	return validateInstance(name, instance)
+}
+
+// validateGrantData validates the data of a permission grant record against
+// permission-grant-data.json, and decodes it into grantData.
+func validateGrantData(data []byte, grantData *PermissionGrantData) error {
+	instance, err := decodeInstance(data)
+	if err != nil {
+		return fmt.Errorf("malformed grant data: %w", err)
+	}
+	if err := validateInstance("permission-grant-data.json", instance); err != nil {
+		return fmt.Errorf("grant data %w", err)
+	}
+	return json.Unmarshal(data, grantData)
+}
+
+// decodeInstance decodes JSON the way the validator expects, with numbers
+// kept as json.Number.
+func decodeInstance(encoded []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var instance interface{}
+	if err := decoder.Decode(&instance); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+// validateInstance validates instance against the compiled schema name.
+func validateInstance(name string, instance interface{}) error {
+	schemas, err := compileSchemas()
+	if err != nil {
+		return err
+	}
+	err = schemas[name].Validate(instance)
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		leaf := deepestCause(validationErr)
+		return fmt.Errorf("#%s: %s", leaf.InstanceLocation, leaf.Message)
+	}
+	return err
+}
+
+// deepestCause returns the cause of a validation error nested deepest in the
+// message, which is the most precise one.  Of causes at the same depth, the
+// first wins.
+func deepestCause(err *jsonschema.ValidationError) *jsonschema.ValidationError {
+	deepest := err
+	for _, cause := range err.Causes {
+		if leaf := deepestCause(cause); pointerDepth(leaf) > pointerDepth(deepest) ||
+			deepest == err && pointerDepth(leaf) == pointerDepth(deepest) {
+			deepest = leaf
+		}
+	}
+	return deepest
+}
+
+func pointerDepth(err *jsonschema.ValidationError) int {
+	return strings.Count(err.InstanceLocation, "/")
+}
@@ -0,0 +1,108 @@
+package dwn
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateJsonSchema(t *testing.T) {
+	alice := newTestPersona(t)
+
+	t.Run("accepts the protocol definition fixtures", func(t *testing.T) {
+		files, err := os.ReadDir(filepath.Join("..", "..", "json-schemas", "protocol-definitions"))
+		require.NoError(t, err)
+		for _, file := range files {
+			message := newTestProtocolsConfigure(t, alice, loadTestProtocolDefinition(t, file.Name()))
+			assert.NoError(t, ValidateJsonSchema(message), file.Name())
+		}
+	})
+
+	t.Run("rejects the older form of protocol definitions", func(t *testing.T) {
+		content, err := os.ReadFile(filepath.Join("..", "..", "json-schemas", "protocol-definitions", "chat.json"))
+		require.NoError(t, err)
+		var definition map[string]interface{}
+		require.NoError(t, json.Unmarshal(content, &definition))
+
+		err = ValidateJsonSchema(newTestProtocolsConfigure(t, alice, definition))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "/can: ")
+	})
+
+	t.Run("accepts delegated grants", func(t *testing.T) {
+		bob := newTestPersona(t)
+		grant := newTestDelegatedGrant(t, alice, bob, map[string]interface{}{
+			"interface": InterfaceRecords, "method": MethodWrite,
+		}, nil)
+		message, _ := newTestRecordsWrite(t, alice, testRecordsWrite{})
+		assert.NoError(t, ValidateJsonSchema(withTestDelegatedGrant(t, bob, message, grant)))
+	})
+
+	tests := []struct {
+		name    string
+		mutate  func(message map[string]interface{})
+		pointer string
+	}{
+		{"missing property", func(message map[string]interface{}) {
+			delete(message["descriptor"].(map[string]interface{}), "dataCid")
+		}, "#/descriptor"},
+		{"unknown property", func(message map[string]interface{}) {
+			message["descriptor"].(map[string]interface{})["color"] = "blue"
+		}, "#/descriptor"},
+		{"malformed timestamp", func(message map[string]interface{}) {
+			message["descriptor"].(map[string]interface{})["messageTimestamp"] = "yesterday"
+		}, "#/descriptor/messageTimestamp"},
+		{"malformed signature", func(message map[string]interface{}) {
+			signature := message["authorization"].(map[string]interface{})["signature"].(map[string]interface{})
+			signature["payload"] = "not base64url!"
+		}, "#/authorization/signature/payload"},
+		{"too many tags", func(message map[string]interface{}) {
+			tags := map[string]interface{}{}
+			for _, tag := range "abcdefghijk" {
+				tags[string(tag)] = true
+			}
+			message["descriptor"].(map[string]interface{})["tags"] = tags
+		}, "#/descriptor/tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, _ := newTestRecordsWrite(t, alice, testRecordsWrite{})
+			message = roundTrip(t, message)
+			tt.mutate(message)
+			err := ValidateJsonSchema(message)
+			require.Error(t, err)
+			assert.Regexp(t, "^"+tt.pointer+": ", err.Error())
+		})
+	}
+
+	t.Run("replies 400", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		message := newTestRecordsQuery(t, &alice, map[string]interface{}{"author": "alice"}, nil)
+		reply, err := dwn.ProcessMessage(alice.URI, message, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+		assert.Contains(t, reply.Status.Detail, "#/descriptor/filter/author")
+	})
+}
+
+func TestAdaptSchema(t *testing.T) {
+	adapted, err := adaptSchema([]byte(`{
+		"properties": {"$a": {"$ref": "https://example.com/defs.json#/definitions/a"}, "$b": {}},
+		"patternProperties": {"^(?!\\$a$|\\$b$).*$": {"type": "string"}}
+	}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"properties": {"$a": {"$ref": "https://example.com/defs.json#/$defs/a"}, "$b": {}},
+		"additionalProperties": {"type": "string"}
+	}`, string(adapted))
+
+	_, err = adaptSchema([]byte(`{
+		"properties": {"$a": {}},
+		"patternProperties": {"^(?!\\$a$|\\$b$).*$": {"type": "string"}}
+	}`))
+	assert.Error(t, err)
+}
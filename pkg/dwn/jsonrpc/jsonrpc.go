@@ -0,0 +1,127 @@
+// Package jsonrpc holds the JSON-RPC 2.0 messages exchanged between DWN
+// servers and their clients, as defined by the reference dwn-server.
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+)
+
+const Version = "2.0"
+
+const (
+	// MethodProcessMessage processes a DWN message on behalf of its target.
+	MethodProcessMessage = "dwn.processMessage"
+	// MethodSubscribeClose closes the subscription of the request.
+	MethodSubscribeClose = "rpc.subscribe.close"
+	// MethodSubscribeEvent notifies the client of an event of the
+	// subscription in its params.
+	MethodSubscribeEvent = "rpc.subscribe.event"
+)
+
+// HTTP headers carrying a request or response whose body is record data.
+const (
+	HeaderDwnRequest  = "dwn-request"
+	HeaderDwnResponse = "dwn-response"
+)
+
+type ErrorCode int
+
+const (
+	ParseError     ErrorCode = -32700
+	InvalidRequest ErrorCode = -32600
+	MethodNotFound ErrorCode = -32601
+	InvalidParams  ErrorCode = -32602
+	InternalError  ErrorCode = -32603
+)
+
+// Request is a request, or a notification if it has no id.
+type Request struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      string          `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// Subscription names the subscription a subscribe message opens, or
+	// rpc.subscribe.close closes.
+	Subscription *Subscription `json:"subscription,omitempty"`
+}
+
+type Subscription struct {
+	Id string `json:"id"`
+}
+
+type Response struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      string          `json:"id,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    ErrorCode   `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// ProcessMessageParams are the params of dwn.processMessage.  The data of
+// the message, if any, travels as the HTTP body, or as encodedData over
+// transports without one.
+type ProcessMessageParams struct {
+	Target  string                 `json:"target"`
+	Message map[string]interface{} `json:"message"`
+	// EncodedData is the base64url encoded data of the message.
+	EncodedData string `json:"encodedData,omitempty"`
+}
+
+// ProcessMessageResult is the result of dwn.processMessage.  Record data
+// returned by RecordsRead travels as the HTTP body, or as encodedData over
+// transports without one.
+type ProcessMessageResult struct {
+	Reply dwn.UnionMessageReply `json:"reply"`
+	// EncodedData is the base64url encoded data of the reply.
+	EncodedData string `json:"encodedData,omitempty"`
+}
+
+// SubscribeEventParams are the params of rpc.subscribe.event.
+type SubscribeEventParams struct {
+	Subscription Subscription     `json:"subscription"`
+	Event        dwn.MessageEvent `json:"event"`
+}
+
+// NewRequest returns a request calling method with params.
+func NewRequest(id string, method string, params interface{}) (*Request, error) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode params: %w", err)
+	}
+	return &Request{JsonRpc: Version, Id: id, Method: method, Params: encoded}, nil
+}
+
+// NewNotification returns a notification calling method with params.
+func NewNotification(method string, params interface{}) (*Request, error) {
+	return NewRequest("", method, params)
+}
+
+// NewResult returns a successful response to request id.
+func NewResult(id string, result interface{}) (*Response, error) {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode result: %w", err)
+	}
+	return &Response{JsonRpc: Version, Id: id, Result: encoded}, nil
+}
+
+// NewError returns an error response to request id.
+func NewError(id string, code ErrorCode, format string, args ...interface{}) *Response {
+	return &Response{
+		JsonRpc: Version,
+		Id:      id,
+		Error:   &Error{Code: code, Message: fmt.Sprintf(format, args...)},
+	}
+}
@@ -0,0 +1,136 @@
+package dwn
+
+import (
+	"strings"
+)
+
+// messageEntry pairs a message from the MessageStore with its CID.
+type messageEntry struct {
+	Cid     MessageCid
+	Message map[string]interface{}
+}
+
+func (e messageEntry) descriptorStr(key string) string {
+	return getPathedStrNoErr(e.Message, "descriptor", key)
+}
+
+func (e messageEntry) descriptorValue(key string) interface{} {
+	descriptor, _ := e.Message["descriptor"].(map[string]interface{})
+	return descriptor[key]
+}
+
+func (e messageEntry) interfaceMethod() string {
+	return e.descriptorStr("interface") + e.descriptorStr("method")
+}
+
+// author returns the author of the message.
+func (e messageEntry) author() (string, error) {
+	var message struct {
+		Authorization AuthorizationDelegatedGrant `json:"authorization"`
+	}
+	if err := parseMessage(e.Message, &message); err != nil {
+		return "", err
+	}
+	return messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+}
+
+// isNewerThan reports whether e supersedes other: the later
+// messageTimestamp wins, and ties are broken by the larger message CID.
+func (e messageEntry) isNewerThan(other messageEntry) bool {
+	a, b := e.descriptorStr("messageTimestamp"), other.descriptorStr("messageTimestamp")
+	if a != b {
+		return a > b
+	}
+	return strings.Compare(string(e.Cid), string(other.Cid)) > 0
+}
+
+// newestMessage returns the newest of entries, or nil if there are none.
+func newestMessage(entries []messageEntry) *messageEntry {
+	var newest *messageEntry
+	for i := range entries {
+		if newest == nil || entries[i].isNewerThan(*newest) {
+			newest = &entries[i]
+		}
+	}
+	return newest
+}
+
+// queryMessageEntries runs a MessageStore query and pairs every result with
+// its message CID.
+func queryMessageEntries(messageStore MessageStore, tenant Tenant, filters []Filter) ([]messageEntry, error) {
+	messages, _, err := messageStore.Query(tenant, filters, MessageSort{}, Pagination{})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]messageEntry, 0, len(messages))
+	for _, message := range messages {
+		rawMessage, err := toRawMessage(message)
+		if err != nil {
+			return nil, err
+		}
+		messageCid, err := computeMessageCid(rawMessage)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, messageEntry{Cid: messageCid, Message: rawMessage})
+	}
+	return entries, nil
+}
+
+// withoutEncodedData returns the message without its inline data.
+func withoutEncodedData(message map[string]interface{}) map[string]interface{} {
+	if _, ok := message["encodedData"]; !ok {
+		return message
+	}
+	stripped := make(map[string]interface{}, len(message))
+	for k, v := range message {
+		if k != "encodedData" {
+			stripped[k] = v
+		}
+	}
+	return stripped
+}
+
+// withEncodedData returns a copy of the message carrying inline data.
+func withEncodedData(message map[string]interface{}, encodedData interface{}) map[string]interface{} {
+	withData := make(map[string]interface{}, len(message)+1)
+	for k, v := range message {
+		withData[k] = v
+	}
+	withData["encodedData"] = encodedData
+	return withData
+}
+
+// withInitialWrite returns a copy of a RecordsWrite that also carries the
+// initial write of its record, as `initialWrite`, if it is a later write.
+func withInitialWrite(messageStore MessageStore, tenant Tenant,
+	message map[string]interface{}) (map[string]interface{}, error) {
+	entry := make(map[string]interface{}, len(message)+1)
+	for k, v := range message {
+		entry[k] = v
+	}
+
+	// Only the initial write is kept once it stops being the latest state.
+	initialWrites, err := queryMessageEntries(messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("method", S(MethodWrite)),
+		NewEqualFilter("recordId", S(getPathedStrNoErr(message, "recordId"))),
+		NewEqualFilter("isLatestBaseState", B(false)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(initialWrites) > 0 {
+		entry["initialWrite"] = withoutEncodedData(initialWrites[0].Message)
+	}
+
+	return entry, nil
+}
+
+// emitEvent emits a stored message to eventStream, if the DWN has one.
+func emitEvent(eventStream EventStream, tenant Tenant, event MessageEvent, indexes IndexableKeyValues) {
+	if eventStream != nil {
+		eventStream.Emit(tenant, event, indexes)
+	}
+}
@@ -0,0 +1,550 @@
+package dwn
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/abaxxtech/abaxx-id-go/pkg/jws"
+	"github.com/abaxxtech/abaxx-id-go/pkg/utils"
+)
+
+// TimestampFormat is the format of messageTimestamp and the other dates of
+// messages: RFC 3339 in UTC, with microseconds.
+const TimestampFormat = "2006-01-02T15:04:05.000000Z"
+
+var (
+	timestampMu   sync.Mutex
+	lastTimestamp time.Time
+)
+
+// newMessageTimestamp returns the current time as a message timestamp,
+// later than any returned before so that messages built in a row, such as a
+// write and its update, are ordered.
+func newMessageTimestamp() string {
+	timestampMu.Lock()
+	defer timestampMu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if !now.After(lastTimestamp) {
+		now = lastTimestamp.Add(time.Microsecond)
+	}
+	lastTimestamp = now
+	return now.Format(TimestampFormat)
+}
+
+// AuthorizationOptions says who signs a message and what they invoke.
+type AuthorizationOptions struct {
+	// Signer signs the message.  Messages that may be anonymous are left
+	// unsigned without one.
+	Signer *_did.BearerDID
+	// ProtocolRole is the protocol path of a role record of the signer.
+	ProtocolRole string
+	// PermissionGrantId is the CID of a PermissionsGrant given to the
+	// signer.
+	PermissionGrantId string
+	// DelegatedGrant is a grant record of NewDelegatedGrant under which the
+	// signer acts for its grantor, who is then the author of the message.
+	DelegatedGrant map[string]interface{}
+}
+
+// author returns the logical author of messages signed with a.
+func (a AuthorizationOptions) author() (string, error) {
+	if a.DelegatedGrant != nil {
+		var grant DelegatedGrant
+		if err := parseMessage(a.DelegatedGrant, &grant); err != nil {
+			return "", fmt.Errorf("delegated grant: %w", err)
+		}
+		return getSigner(grant.Authorization.Signature)
+	}
+	return a.Signer.URI, nil
+}
+
+// payload returns the signature payload invoking what a names, without its
+// descriptorCid.
+func (a AuthorizationOptions) payload() (utils.GenericSignaturePayload, error) {
+	payload := utils.GenericSignaturePayload{
+		ProtocolRole:      a.ProtocolRole,
+		PermissionGrantId: a.PermissionGrantId,
+	}
+	if a.DelegatedGrant != nil {
+		grantId, _ := a.DelegatedGrant["recordId"].(string)
+		if grantId == "" {
+			return utils.GenericSignaturePayload{}, errors.New("delegated grant has no recordId")
+		}
+		payload.DelegatedGrantId = grantId
+	}
+	return payload, nil
+}
+
+// authorization signs payload for the message with descriptor, returning
+// the authorization of the message.
+func (a AuthorizationOptions) authorization(descriptor map[string]interface{},
+	payload interface{}) (map[string]interface{}, error) {
+	properties, err := toJsonMap(payload)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signGeneralJws(*a.Signer, descriptor, properties)
+	if err != nil {
+		return nil, err
+	}
+
+	authorization := map[string]interface{}{"signature": signature}
+	if a.DelegatedGrant != nil {
+		authorization["authorDelegatedGrant"] = a.DelegatedGrant
+	}
+	return authorization, nil
+}
+
+// signGeneralJws signs payload, adding the descriptorCid of descriptor to
+// it, as a General JWS with a single signature.
+func signGeneralJws(signer _did.BearerDID, descriptor map[string]interface{},
+	payload map[string]interface{}) (GeneralJws, error) {
+	descriptorCid, err := computeCid(descriptor)
+	if err != nil {
+		return GeneralJws{}, err
+	}
+	payload["descriptorCid"] = descriptorCid
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return GeneralJws{}, fmt.Errorf("failed to encode signature payload: %w", err)
+	}
+	compact, err := jws.Sign(encoded, signer)
+	if err != nil {
+		return GeneralJws{}, fmt.Errorf("failed to sign message: %w", err)
+	}
+	parts := strings.Split(compact, ".")
+	return GeneralJws{
+		Payload:    parts[1],
+		Signatures: []Signature{{Protected: parts[0], Signature: parts[2]}},
+	}, nil
+}
+
+// toJsonMap passes v through JSON, so that CIDs are computed over the
+// message as it is received.
+func toJsonMap(v interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return decoded, nil
+}
+
+// newMessage builds a message of the given interface and method, with the
+// rest of its descriptor in properties, signed as authorization says.
+// anonymous messages are left unsigned without a signer.
+func newMessage(iface, method, messageTimestamp string, properties interface{},
+	authorization AuthorizationOptions, anonymous bool) (map[string]interface{}, error) {
+	descriptor, err := toJsonMap(properties)
+	if err != nil {
+		return nil, err
+	}
+	descriptor["interface"] = iface
+	descriptor["method"] = method
+	if messageTimestamp == "" {
+		messageTimestamp = newMessageTimestamp()
+	}
+	descriptor["messageTimestamp"] = messageTimestamp
+
+	message := map[string]interface{}{"descriptor": descriptor}
+	if authorization.Signer == nil {
+		if !anonymous {
+			return nil, fmt.Errorf("%s%s must be signed", iface, method)
+		}
+		return message, nil
+	}
+
+	payload, err := authorization.payload()
+	if err != nil {
+		return nil, err
+	}
+	if message["authorization"], err = authorization.authorization(descriptor, payload); err != nil {
+		return nil, err
+	}
+	return toJsonMap(message)
+}
+
+type RecordsWriteOptions struct {
+	// Data is the data of the record.  Without it, DataCid and DataSize
+	// give the data, as for an update that does not change it.
+	Data     []byte
+	DataCid  DataCid
+	DataSize int64
+	// DataFormat defaults to application/octet-stream.
+	DataFormat   string
+	Schema       string
+	Protocol     string
+	ProtocolPath string
+	Recipient    string
+	Published    bool
+	Tags         map[string]interface{}
+
+	// Parent is the RecordsWrite of the parent record in a protocol.
+	Parent map[string]interface{}
+	// Update is a previous RecordsWrite of the record being written to.
+	Update map[string]interface{}
+
+	// MessageTimestamp defaults to now; it is also the dateCreated of the
+	// initial write and the datePublished of published records.
+	MessageTimestamp string
+
+	Authorization AuthorizationOptions
+}
+
+// NewRecordsWrite builds a signed RecordsWrite.  Its dataCid is computed
+// from the data the way the DataStore chunks it, and its recordId and
+// contextId are derived from the descriptor and author of the initial
+// write, and from the parent record.
+func NewRecordsWrite(opts RecordsWriteOptions) (map[string]interface{}, error) {
+	if opts.Authorization.Signer == nil {
+		return nil, errors.New("RecordsWrite must be signed")
+	}
+
+	dataCid, dataSize := opts.DataCid, opts.DataSize
+	if opts.Data != nil || dataCid == "" {
+		var err error
+		if dataCid, dataSize, err = computeDataCid(bytes.NewReader(opts.Data)); err != nil {
+			return nil, err
+		}
+	}
+
+	timestamp := opts.MessageTimestamp
+	if timestamp == "" {
+		timestamp = newMessageTimestamp()
+	}
+	dataFormat := opts.DataFormat
+	if dataFormat == "" {
+		dataFormat = "application/octet-stream"
+	}
+	descriptor := map[string]interface{}{
+		"interface":        InterfaceRecords,
+		"method":           MethodWrite,
+		"dataCid":          string(dataCid),
+		"dataSize":         dataSize,
+		"dateCreated":      timestamp,
+		"messageTimestamp": timestamp,
+		"dataFormat":       dataFormat,
+	}
+	for property, value := range map[string]string{
+		"schema":       opts.Schema,
+		"protocol":     opts.Protocol,
+		"protocolPath": opts.ProtocolPath,
+		"recipient":    opts.Recipient,
+	} {
+		if value != "" {
+			descriptor[property] = value
+		}
+	}
+	if opts.Parent != nil {
+		descriptor["parentId"] = opts.Parent["recordId"]
+	}
+	if opts.Published {
+		descriptor["published"] = true
+		descriptor["datePublished"] = timestamp
+	}
+	if opts.Tags != nil {
+		descriptor["tags"] = opts.Tags
+	}
+
+	var recordId, contextId string
+	if opts.Update != nil {
+		previous, ok := opts.Update["descriptor"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("updated RecordsWrite has no descriptor")
+		}
+		for _, property := range immutableDescriptorProperties {
+			if value, ok := previous[property]; ok {
+				descriptor[property] = value
+			} else {
+				delete(descriptor, property)
+			}
+		}
+		recordId, _ = opts.Update["recordId"].(string)
+		contextId, _ = opts.Update["contextId"].(string)
+	}
+	descriptor, err := toJsonMap(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	if recordId == "" {
+		author, err := opts.Authorization.author()
+		if err != nil {
+			return nil, err
+		}
+		recordId, err = recordsWriteEntryId(map[string]interface{}{"descriptor": descriptor}, author)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Parent != nil {
+			parentContextId, _ := opts.Parent["contextId"].(string)
+			contextId = parentContextId + "/" + recordId
+		} else if opts.Protocol != "" {
+			contextId = recordId
+		}
+	}
+
+	payload, err := opts.Authorization.payload()
+	if err != nil {
+		return nil, err
+	}
+	authorization, err := opts.Authorization.authorization(descriptor, utils.RecordsWriteSignaturePayload{
+		GenericSignaturePayload: payload,
+		RecordId:                recordId,
+		ContextId:               contextId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	message := map[string]interface{}{
+		"recordId":      recordId,
+		"descriptor":    descriptor,
+		"authorization": authorization,
+	}
+	if contextId != "" {
+		message["contextId"] = contextId
+	}
+	return toJsonMap(message)
+}
+
+type RecordsReadOptions struct {
+	Filter           RecordsFilter
+	MessageTimestamp string
+	Authorization    AuthorizationOptions
+}
+
+// NewRecordsRead builds a RecordsRead, which is anonymous without a signer.
+func NewRecordsRead(opts RecordsReadOptions) (map[string]interface{}, error) {
+	return newMessage(InterfaceRecords, MethodRead, opts.MessageTimestamp, struct {
+		Filter RecordsFilter `json:"filter"`
+	}{opts.Filter}, opts.Authorization, true)
+}
+
+type RecordsQueryOptions struct {
+	Filter RecordsFilter
+	// DateSort is one of createdAscending, createdDescending,
+	// publishedAscending or publishedDescending.
+	DateSort         string
+	Pagination       *QueryPagination
+	MessageTimestamp string
+	Authorization    AuthorizationOptions
+}
+
+// NewRecordsQuery builds a RecordsQuery, which is anonymous without a
+// signer.
+func NewRecordsQuery(opts RecordsQueryOptions) (map[string]interface{}, error) {
+	return newMessage(InterfaceRecords, MethodQuery, opts.MessageTimestamp, struct {
+		Filter     RecordsFilter    `json:"filter"`
+		DateSort   string           `json:"dateSort,omitempty"`
+		Pagination *QueryPagination `json:"pagination,omitempty"`
+	}{opts.Filter, opts.DateSort, opts.Pagination}, opts.Authorization, true)
+}
+
+type RecordsSubscribeOptions struct {
+	Filter           RecordsFilter
+	MessageTimestamp string
+	Authorization    AuthorizationOptions
+}
+
+// NewRecordsSubscribe builds a RecordsSubscribe, which is anonymous without
+// a signer.
+func NewRecordsSubscribe(opts RecordsSubscribeOptions) (map[string]interface{}, error) {
+	return newMessage(InterfaceRecords, MethodSubscribe, opts.MessageTimestamp, struct {
+		Filter RecordsFilter `json:"filter"`
+	}{opts.Filter}, opts.Authorization, true)
+}
+
+type RecordsDeleteOptions struct {
+	RecordId string
+	// Prune also deletes the descendants of the record in its protocol.
+	Prune            bool
+	MessageTimestamp string
+	Authorization    AuthorizationOptions
+}
+
+func NewRecordsDelete(opts RecordsDeleteOptions) (map[string]interface{}, error) {
+	return newMessage(InterfaceRecords, MethodDelete, opts.MessageTimestamp, struct {
+		RecordId string `json:"recordId"`
+		Prune    bool   `json:"prune"`
+	}{opts.RecordId, opts.Prune}, opts.Authorization, false)
+}
+
+type ProtocolsConfigureOptions struct {
+	Definition       ProtocolDefinition
+	MessageTimestamp string
+	Authorization    AuthorizationOptions
+}
+
+func NewProtocolsConfigure(opts ProtocolsConfigureOptions) (map[string]interface{}, error) {
+	return newMessage(InterfaceProtocols, MethodConfigure, opts.MessageTimestamp, struct {
+		Definition ProtocolDefinition `json:"definition"`
+	}{opts.Definition}, opts.Authorization, false)
+}
+
+type ProtocolsQueryOptions struct {
+	// Protocol, if set, limits the query to one protocol.
+	Protocol         string
+	MessageTimestamp string
+	Authorization    AuthorizationOptions
+}
+
+// NewProtocolsQuery builds a ProtocolsQuery, which is anonymous without a
+// signer.
+func NewProtocolsQuery(opts ProtocolsQueryOptions) (map[string]interface{}, error) {
+	type filter struct {
+		Protocol string `json:"protocol,omitempty"`
+	}
+	properties := struct {
+		Filter *filter `json:"filter,omitempty"`
+	}{}
+	if opts.Protocol != "" {
+		properties.Filter = &filter{Protocol: opts.Protocol}
+	}
+	return newMessage(InterfaceProtocols, MethodQuery, opts.MessageTimestamp, properties, opts.Authorization, true)
+}
+
+type PermissionsRequestOptions struct {
+	// GrantedTo defaults to the signer.
+	GrantedTo string
+	// GrantedBy is the DID asked for the grant; GrantedFor, the DID whose
+	// DWN the grant is for, defaults to it.
+	GrantedBy        string
+	GrantedFor       string
+	Description      string
+	Scope            PermissionScope
+	Conditions       *PermissionConditions
+	MessageTimestamp string
+	Authorization    AuthorizationOptions
+}
+
+func NewPermissionsRequest(opts PermissionsRequestOptions) (map[string]interface{}, error) {
+	if opts.GrantedTo == "" && opts.Authorization.Signer != nil {
+		opts.GrantedTo = opts.Authorization.Signer.URI
+	}
+	if opts.GrantedFor == "" {
+		opts.GrantedFor = opts.GrantedBy
+	}
+	return newMessage(InterfacePermissions, MethodRequest, opts.MessageTimestamp, struct {
+		Description string                `json:"description,omitempty"`
+		GrantedTo   string                `json:"grantedTo"`
+		GrantedBy   string                `json:"grantedBy"`
+		GrantedFor  string                `json:"grantedFor"`
+		Scope       PermissionScope       `json:"scope"`
+		Conditions  *PermissionConditions `json:"conditions,omitempty"`
+	}{opts.Description, opts.GrantedTo, opts.GrantedBy, opts.GrantedFor, opts.Scope, opts.Conditions},
+		opts.Authorization, false)
+}
+
+type PermissionsGrantOptions struct {
+	GrantedTo string
+	// GrantedBy and GrantedFor default to the signer.
+	GrantedBy            string
+	GrantedFor           string
+	DateExpires          time.Time
+	Description          string
+	PermissionsRequestId string
+	Scope                PermissionScope
+	Conditions           *PermissionConditions
+	MessageTimestamp     string
+	Authorization        AuthorizationOptions
+}
+
+func NewPermissionsGrant(opts PermissionsGrantOptions) (map[string]interface{}, error) {
+	if opts.Authorization.Signer != nil {
+		if opts.GrantedBy == "" {
+			opts.GrantedBy = opts.Authorization.Signer.URI
+		}
+		if opts.GrantedFor == "" {
+			opts.GrantedFor = opts.Authorization.Signer.URI
+		}
+	}
+	return newMessage(InterfacePermissions, MethodGrant, opts.MessageTimestamp, struct {
+		DateExpires          string                `json:"dateExpires"`
+		Description          string                `json:"description,omitempty"`
+		GrantedTo            string                `json:"grantedTo"`
+		GrantedBy            string                `json:"grantedBy"`
+		GrantedFor           string                `json:"grantedFor"`
+		PermissionsRequestId string                `json:"permissionsRequestId,omitempty"`
+		Scope                PermissionScope       `json:"scope"`
+		Conditions           *PermissionConditions `json:"conditions,omitempty"`
+	}{
+		DateExpires:          opts.DateExpires.UTC().Format(TimestampFormat),
+		Description:          opts.Description,
+		GrantedTo:            opts.GrantedTo,
+		GrantedBy:            opts.GrantedBy,
+		GrantedFor:           opts.GrantedFor,
+		PermissionsRequestId: opts.PermissionsRequestId,
+		Scope:                opts.Scope,
+		Conditions:           opts.Conditions,
+	}, opts.Authorization, false)
+}
+
+type DelegatedGrantOptions struct {
+	// GrantedTo is the DID that may sign messages as the grantor, the
+	// signer of the grant.
+	GrantedTo   string
+	DateExpires time.Time
+	Description string
+	// RequestId is the CID of the PermissionsRequest granted, if any.
+	RequestId        string
+	Scope            PermissionScope
+	Conditions       *PermissionConditions
+	MessageTimestamp string
+	Authorization    AuthorizationOptions
+}
+
+// NewDelegatedGrant builds a delegated grant record: a RecordsWrite of the
+// permissions protocol carrying the grant inline as encodedData.  The
+// grantee passes it as AuthorizationOptions.DelegatedGrant; the grantor may
+// also write it to their own DWN, with its data, to be able to revoke it.
+func NewDelegatedGrant(opts DelegatedGrantOptions) (map[string]interface{}, error) {
+	data, err := json.Marshal(PermissionGrantData{
+		Description: opts.Description,
+		DateExpires: opts.DateExpires.UTC().Format(TimestampFormat),
+		RequestId:   opts.RequestId,
+		Delegated:   true,
+		Scope:       opts.Scope,
+		Conditions:  opts.Conditions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode grant data: %w", err)
+	}
+	grant, err := NewRecordsWrite(RecordsWriteOptions{
+		Data:             data,
+		DataFormat:       "application/json",
+		Protocol:         PermissionsProtocolUri,
+		ProtocolPath:     PermissionGrantPath,
+		Recipient:        opts.GrantedTo,
+		MessageTimestamp: opts.MessageTimestamp,
+		Authorization:    opts.Authorization,
+	})
+	if err != nil {
+		return nil, err
+	}
+	grant["encodedData"] = base64.RawURLEncoding.EncodeToString(data)
+	return grant, nil
+}
+
+type PermissionsRevokeOptions struct {
+	PermissionsGrantId string
+	MessageTimestamp   string
+	Authorization      AuthorizationOptions
+}
+
+func NewPermissionsRevoke(opts PermissionsRevokeOptions) (map[string]interface{}, error) {
+	return newMessage(InterfacePermissions, MethodRevoke, opts.MessageTimestamp, struct {
+		PermissionsGrantId string `json:"permissionsGrantId"`
+	}{opts.PermissionsGrantId}, opts.Authorization, false)
+}
@@ -0,0 +1,197 @@
+package dwn
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRecordsWrite(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	didResolver := NewDidResolver(nil, nil)
+	data := []byte("hello")
+
+	message, err := NewRecordsWrite(RecordsWriteOptions{
+		Data:          data,
+		Protocol:      "http://example.com/protocol",
+		ProtocolPath:  "post",
+		Authorization: AuthorizationOptions{Signer: &alice},
+	})
+	require.NoError(t, err)
+
+	var parsed RecordsWrite
+	require.NoError(t, parseMessage(message, &parsed))
+	descriptor := parsed.Descriptor
+	assert.Equal(t, InterfaceRecords, descriptor.Interface)
+	assert.Equal(t, MethodWrite, descriptor.Method)
+	assert.Equal(t, "application/octet-stream", descriptor.DataFormat)
+	assert.Equal(t, descriptor.MessageTimestamp, descriptor.DateCreated)
+	_, err = time.Parse(TimestampFormat, descriptor.MessageTimestamp)
+	assert.NoError(t, err)
+
+	dataCid, dataSize, err := computeDataCid(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, dataCid, descriptor.DataCid)
+	assert.Equal(t, dataSize, descriptor.DataSize)
+
+	recordId, err := recordsWriteEntryId(message, alice.URI)
+	require.NoError(t, err)
+	assert.Equal(t, recordId, parsed.RecordId)
+	assert.Equal(t, recordId, parsed.ContextId)
+
+	signer, err := authenticate(didResolver, parsed.Authorization.Signature, message["descriptor"])
+	require.NoError(t, err)
+	assert.Equal(t, alice.URI, signer)
+
+	t.Run("nests the contextId of children under their parent", func(t *testing.T) {
+		child, err := NewRecordsWrite(RecordsWriteOptions{
+			Data:          []byte("reply"),
+			Protocol:      "http://example.com/protocol",
+			ProtocolPath:  "post/reply",
+			Parent:        message,
+			Authorization: AuthorizationOptions{Signer: &bob},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, recordId, child["descriptor"].(map[string]interface{})["parentId"])
+		assert.Equal(t, recordId+"/"+child["recordId"].(string), child["contextId"])
+	})
+
+	t.Run("keeps the record of updates", func(t *testing.T) {
+		update, err := NewRecordsWrite(RecordsWriteOptions{
+			Data:          []byte("hello again"),
+			Update:        message,
+			Authorization: AuthorizationOptions{Signer: &alice},
+		})
+		require.NoError(t, err)
+		updateDescriptor := update["descriptor"].(map[string]interface{})
+		assert.Equal(t, recordId, update["recordId"])
+		assert.Equal(t, recordId, update["contextId"])
+		assert.Equal(t, descriptor.DateCreated, updateDescriptor["dateCreated"])
+		assert.Equal(t, descriptor.Protocol, updateDescriptor["protocol"])
+		assert.Greater(t, updateDescriptor["messageTimestamp"], descriptor.MessageTimestamp)
+	})
+
+	t.Run("is authored by the grantor of a delegated grant", func(t *testing.T) {
+		grant, err := NewDelegatedGrant(DelegatedGrantOptions{
+			GrantedTo:     bob.URI,
+			DateExpires:   time.Now().Add(time.Hour),
+			Scope:         PermissionScope{Interface: InterfaceRecords, Method: MethodWrite},
+			Authorization: AuthorizationOptions{Signer: &alice},
+		})
+		require.NoError(t, err)
+		parsedGrant, err := parseGrantRecord(grant)
+		require.NoError(t, err)
+		assert.True(t, parsedGrant.Descriptor.Delegated)
+		assert.Equal(t, alice.URI, parsedGrant.Descriptor.GrantedBy)
+		assert.Equal(t, bob.URI, parsedGrant.Descriptor.GrantedTo)
+
+		delegated, err := NewRecordsWrite(RecordsWriteOptions{
+			Data:          data,
+			Authorization: AuthorizationOptions{Signer: &bob, DelegatedGrant: grant},
+		})
+		require.NoError(t, err)
+
+		var parsed AuthorizationDelegatedGrant
+		require.NoError(t, parseMessage(delegated["authorization"].(map[string]interface{}), &parsed))
+		assert.Equal(t, alice.URI, parsed.Author())
+		assert.NoError(t, ValidateJsonSchema(delegated))
+		recordId, err := recordsWriteEntryId(delegated, alice.URI)
+		require.NoError(t, err)
+		assert.Equal(t, recordId, delegated["recordId"])
+	})
+
+	_, err = NewRecordsWrite(RecordsWriteOptions{Data: data})
+	assert.Error(t, err)
+}
+
+func TestNewMessages(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	dwn := NewTestDwn(t)
+
+	definition := ProtocolDefinition{
+		Protocol:  "http://example.com/protocol",
+		Published: true,
+		Types:     map[string]ProtocolType{"post": {}},
+		Structure: map[string]ProtocolRuleSet{"post": {
+			Actions: []ProtocolAction{{Who: "anyone", Can: []string{ActionRead}}},
+		}},
+	}
+	configure, err := NewProtocolsConfigure(ProtocolsConfigureOptions{
+		Definition:    definition,
+		Authorization: AuthorizationOptions{Signer: &alice},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 202, processStatus(t, dwn, alice.URI, configure))
+
+	query, err := NewProtocolsQuery(ProtocolsQueryOptions{Protocol: definition.Protocol})
+	require.NoError(t, err)
+	assert.NotContains(t, query, "authorization")
+	reply, err := dwn.ProcessMessage(alice.URI, query, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+	assert.Len(t, reply.Entries, 1)
+
+	write, err := NewRecordsWrite(RecordsWriteOptions{
+		Data:          []byte("hello"),
+		Published:     true,
+		Authorization: AuthorizationOptions{Signer: &alice},
+	})
+	require.NoError(t, err)
+	reply, err = dwn.ProcessMessage(alice.URI, write, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+	recordId := write["recordId"].(string)
+
+	read, err := NewRecordsRead(RecordsReadOptions{Filter: RecordsFilter{RecordId: recordId}})
+	require.NoError(t, err)
+	assert.Equal(t, 200, processStatus(t, dwn, alice.URI, read))
+
+	records, err := NewRecordsQuery(RecordsQueryOptions{
+		Filter:        RecordsFilter{RecordId: recordId},
+		Authorization: AuthorizationOptions{Signer: &bob},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200, processStatus(t, dwn, alice.URI, records))
+
+	request, err := NewPermissionsRequest(PermissionsRequestOptions{
+		GrantedBy:     alice.URI,
+		Scope:         PermissionScope{Interface: InterfaceRecords, Method: MethodDelete},
+		Authorization: AuthorizationOptions{Signer: &bob},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, bob.URI, request["descriptor"].(map[string]interface{})["grantedTo"])
+	assert.Equal(t, 202, processStatus(t, dwn, alice.URI, request))
+
+	grant, err := NewPermissionsGrant(PermissionsGrantOptions{
+		GrantedTo:     bob.URI,
+		DateExpires:   time.Now().Add(time.Hour),
+		Scope:         PermissionScope{Interface: InterfaceRecords, Method: MethodDelete},
+		Authorization: AuthorizationOptions{Signer: &alice},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 202, processStatus(t, dwn, alice.URI, grant))
+	grantId, err := computeMessageCid(grant)
+	require.NoError(t, err)
+
+	revoke, err := NewPermissionsRevoke(PermissionsRevokeOptions{
+		PermissionsGrantId: string(grantId),
+		Authorization:      AuthorizationOptions{Signer: &alice},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 202, processStatus(t, dwn, alice.URI, revoke))
+
+	recordsDelete, err := NewRecordsDelete(RecordsDeleteOptions{
+		RecordId:      recordId,
+		Authorization: AuthorizationOptions{Signer: &alice},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 202, processStatus(t, dwn, alice.URI, recordsDelete))
+
+	_, err = NewRecordsDelete(RecordsDeleteOptions{RecordId: recordId})
+	assert.Error(t, err)
+}
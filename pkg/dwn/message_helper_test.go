@@ -0,0 +1,344 @@
+package dwn
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/didjwk"
+	"github.com/abaxxtech/abaxx-id-go/pkg/jws"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPersona(t *testing.T) _did.BearerDID {
+	t.Helper()
+	bearerDID, err := didjwk.Create()
+	require.NoError(t, err)
+	return bearerDID
+}
+
+// roundTrip passes v through JSON, the way messages arrive over the wire.
+func roundTrip(t *testing.T, v interface{}) map[string]interface{} {
+	t.Helper()
+	encoded, err := json.Marshal(v)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	return decoded
+}
+
+// signTestPayload signs a signature payload as a General JWS, adding the
+// descriptorCid of the given descriptor.
+func signTestPayload(t *testing.T, signer _did.BearerDID, descriptor map[string]interface{},
+	payload map[string]interface{}) GeneralJws {
+	t.Helper()
+	descriptorCid, err := computeCid(descriptor)
+	require.NoError(t, err)
+	payload["descriptorCid"] = descriptorCid
+
+	encoded, err := json.Marshal(payload)
+	require.NoError(t, err)
+	compact, err := jws.Sign(encoded, signer)
+	require.NoError(t, err)
+
+	parts := strings.Split(compact, ".")
+	return GeneralJws{
+		Payload:    parts[1],
+		Signatures: []Signature{{Protected: parts[0], Signature: parts[2]}},
+	}
+}
+
+type testRecordsWrite struct {
+	data         []byte
+	dataFormat   string
+	schema       string
+	protocol     string
+	protocolPath string
+	recipient    string
+	published    bool
+	tags         map[string]interface{}
+	protocolRole string
+	// permissionGrantId names a PermissionsGrant the author writes under.
+	permissionGrantId string
+
+	// delegatedGrant is a delegated PermissionsGrant the author signs under,
+	// on behalf of its grantor.
+	delegatedGrant map[string]interface{}
+	// parent is the RecordsWrite of the parent record in a protocol.
+	parent map[string]interface{}
+	// update is a previous RecordsWrite of the record being written to.
+	update map[string]interface{}
+	// messageTimestamp, when set, backdates the message.
+	messageTimestamp string
+}
+
+// newTestRecordsWrite builds a signed RecordsWrite message and returns it
+// along with its data.
+func newTestRecordsWrite(t *testing.T, author _did.BearerDID, opts testRecordsWrite) (map[string]interface{}, []byte) {
+	t.Helper()
+
+	timestamp := newMessageTimestamp()
+	if opts.messageTimestamp != "" {
+		timestamp = opts.messageTimestamp
+	}
+	data := opts.data
+	if data == nil {
+		data = []byte(`{"message":"hello at ` + timestamp + `"}`)
+	}
+	dataFormat := opts.dataFormat
+	if dataFormat == "" {
+		dataFormat = "application/json"
+	}
+
+	message, err := NewRecordsWrite(RecordsWriteOptions{
+		Data:             data,
+		DataFormat:       dataFormat,
+		Schema:           opts.schema,
+		Protocol:         opts.protocol,
+		ProtocolPath:     opts.protocolPath,
+		Recipient:        opts.recipient,
+		Published:        opts.published,
+		Tags:             opts.tags,
+		Parent:           opts.parent,
+		Update:           opts.update,
+		MessageTimestamp: timestamp,
+		Authorization: AuthorizationOptions{
+			Signer:            &author,
+			ProtocolRole:      opts.protocolRole,
+			PermissionGrantId: opts.permissionGrantId,
+			DelegatedGrant:    opts.delegatedGrant,
+		},
+	})
+	require.NoError(t, err)
+	return message, data
+}
+
+// resignTestRecordsWrite signs a RecordsWrite again after its descriptor has
+// been changed.
+func resignTestRecordsWrite(t *testing.T, author _did.BearerDID, message map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	var payload map[string]interface{}
+	require.NoError(t, decodeSignaturePayload(getTestSignature(t, message), &payload))
+	message["authorization"] = map[string]interface{}{
+		"signature": signTestPayload(t, author, message["descriptor"].(map[string]interface{}), payload),
+	}
+	return roundTrip(t, message)
+}
+
+func getTestSignature(t *testing.T, message map[string]interface{}) GeneralJws {
+	t.Helper()
+	var parsed struct {
+		Authorization PlainAuthorization `json:"authorization"`
+	}
+	require.NoError(t, parseMessage(message, &parsed))
+	return parsed.Authorization.Signature
+}
+
+// writeTestRecord writes a new RecordsWrite to the author's own DWN.
+func writeTestRecord(t *testing.T, dwn *Dwn, author _did.BearerDID, opts testRecordsWrite) map[string]interface{} {
+	t.Helper()
+	message, data := newTestRecordsWrite(t, author, opts)
+	reply, err := dwn.ProcessMessage(author.URI, message, bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+	return message
+}
+
+// newTestMessage builds a message of the given interface and method with
+// the given descriptor properties.  With a nil author the message is
+// unsigned.
+func newTestMessage(t *testing.T, author *_did.BearerDID, iface, method string,
+	descriptorProperties map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	descriptor := map[string]interface{}{
+		"interface":        iface,
+		"method":           method,
+		"messageTimestamp": newMessageTimestamp(),
+	}
+	for k, v := range descriptorProperties {
+		descriptor[k] = v
+	}
+	descriptor = roundTrip(t, descriptor)
+
+	message := map[string]interface{}{"descriptor": descriptor}
+	if author != nil {
+		message["authorization"] = map[string]interface{}{
+			"signature": signTestPayload(t, *author, descriptor, map[string]interface{}{}),
+		}
+	}
+	return roundTrip(t, message)
+}
+
+// withTestProtocolRole re-signs a message built by newTestMessage so that its
+// signature invokes protocolRole.
+func withTestProtocolRole(t *testing.T, author _did.BearerDID, message map[string]interface{},
+	protocolRole string) map[string]interface{} {
+	t.Helper()
+	descriptor := message["descriptor"].(map[string]interface{})
+	message["authorization"] = map[string]interface{}{
+		"signature": signTestPayload(t, author, descriptor, map[string]interface{}{"protocolRole": protocolRole}),
+	}
+	return roundTrip(t, message)
+}
+
+// newTestPermissionsGrant builds a PermissionsGrant from grantor to grantee
+// with the given scope, expiring in an hour.  Extra descriptor properties,
+// such as conditions, can be passed in descriptorProperties.
+func newTestPermissionsGrant(t *testing.T, grantor, grantee _did.BearerDID, scope map[string]interface{},
+	descriptorProperties map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	properties := map[string]interface{}{
+		"dateExpires": time.Now().Add(time.Hour).UTC().Format(TimestampFormat),
+		"grantedBy":   grantor.URI,
+		"grantedTo":   grantee.URI,
+		"grantedFor":  grantor.URI,
+		"scope":       scope,
+	}
+	for k, v := range descriptorProperties {
+		properties[k] = v
+	}
+	return newTestMessage(t, &grantor, InterfacePermissions, MethodGrant, properties)
+}
+
+// newTestDelegatedGrant builds a delegated grant record from grantor to
+// grantee with the given scope, expiring in an hour.  Extra grant data, such
+// as conditions, can be passed in dataProperties.
+func newTestDelegatedGrant(t *testing.T, grantor, grantee _did.BearerDID, scope map[string]interface{},
+	dataProperties map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	grantData := map[string]interface{}{
+		"dateExpires": time.Now().Add(time.Hour).UTC().Format(TimestampFormat),
+		"delegated":   true,
+		"scope":       scope,
+	}
+	for k, v := range dataProperties {
+		grantData[k] = v
+	}
+	data, err := json.Marshal(grantData)
+	require.NoError(t, err)
+	grant, err := NewRecordsWrite(RecordsWriteOptions{
+		Data:          data,
+		DataFormat:    "application/json",
+		Protocol:      PermissionsProtocolUri,
+		ProtocolPath:  PermissionGrantPath,
+		Recipient:     grantee.URI,
+		Authorization: AuthorizationOptions{Signer: &grantor},
+	})
+	require.NoError(t, err)
+	grant["encodedData"] = base64.RawURLEncoding.EncodeToString(data)
+	return grant
+}
+
+// storeTestDelegatedGrant writes a grant record of newTestDelegatedGrant to
+// the DWN of its grantor, where it can be revoked, and returns its id.
+func storeTestDelegatedGrant(t *testing.T, dwn *Dwn, grantor _did.BearerDID, grant map[string]interface{}) string {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(grant["encodedData"].(string))
+	require.NoError(t, err)
+	reply, err := dwn.ProcessMessage(grantor.URI, withoutEncodedData(grant), bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+	return grant["recordId"].(string)
+}
+
+// withTestDelegatedGrant re-signs a message built by newTestMessage so that
+// its signer acts under a delegated grant.
+func withTestDelegatedGrant(t *testing.T, signer _did.BearerDID, message map[string]interface{},
+	grant map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	descriptor := message["descriptor"].(map[string]interface{})
+	message["authorization"] = map[string]interface{}{
+		"signature": signTestPayload(t, signer, descriptor, map[string]interface{}{
+			"delegatedGrantId": grant["recordId"],
+		}),
+		"authorDelegatedGrant": grant,
+	}
+	return roundTrip(t, message)
+}
+
+// withTestPermissionGrant re-signs a message built by newTestMessage so that
+// its signature invokes the PermissionsGrant grantId.
+func withTestPermissionGrant(t *testing.T, author _did.BearerDID, message map[string]interface{},
+	grantId string) map[string]interface{} {
+	t.Helper()
+	descriptor := message["descriptor"].(map[string]interface{})
+	message["authorization"] = map[string]interface{}{
+		"signature": signTestPayload(t, author, descriptor, map[string]interface{}{"permissionGrantId": grantId}),
+	}
+	return roundTrip(t, message)
+}
+
+// withTestOwnerSignature adds the signature of owner to a RecordsWrite.
+func withTestOwnerSignature(t *testing.T, owner _did.BearerDID, message map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	descriptor := message["descriptor"].(map[string]interface{})
+	message["authorization"].(map[string]interface{})["ownerSignature"] =
+		signTestPayload(t, owner, descriptor, map[string]interface{}{})
+	return roundTrip(t, message)
+}
+
+// newTestRecordsQuery builds a RecordsQuery message.  Extra descriptor
+// properties, such as dateSort or pagination, can be passed in
+// descriptorProperties.
+func newTestRecordsQuery(t *testing.T, author *_did.BearerDID, filter map[string]interface{},
+	descriptorProperties map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	properties := map[string]interface{}{"filter": filter}
+	for k, v := range descriptorProperties {
+		properties[k] = v
+	}
+	return newTestMessage(t, author, InterfaceRecords, MethodQuery, properties)
+}
+
+func newTestRecordsRead(t *testing.T, author *_did.BearerDID, filter map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	return newTestMessage(t, author, InterfaceRecords, MethodRead, map[string]interface{}{"filter": filter})
+}
+
+func newTestRecordsDelete(t *testing.T, author _did.BearerDID, recordId interface{}, prune bool) map[string]interface{} {
+	t.Helper()
+	return newTestMessage(t, &author, InterfaceRecords, MethodDelete, map[string]interface{}{
+		"recordId": recordId,
+		"prune":    prune,
+	})
+}
+
+// loadTestProtocolDefinition reads one of the protocol definitions in
+// json-schemas/protocol-definitions, rewritten through ProtocolDefinition in
+// the form protocol-definition.json requires, which the older fixtures are
+// not written in.
+func loadTestProtocolDefinition(t *testing.T, name string) map[string]interface{} {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("..", "..", "json-schemas", "protocol-definitions", name))
+	require.NoError(t, err)
+	var parsed ProtocolDefinition
+	require.NoError(t, json.Unmarshal(content, &parsed))
+	content, err = json.Marshal(parsed)
+	require.NoError(t, err)
+	var definition map[string]interface{}
+	require.NoError(t, json.Unmarshal(content, &definition))
+	return definition
+}
+
+func newTestProtocolsConfigure(t *testing.T, author _did.BearerDID, definition map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	return newTestMessage(t, &author, InterfaceProtocols, MethodConfigure, map[string]interface{}{
+		"definition": definition,
+	})
+}
+
+// configureTestProtocol installs a protocol definition on the author's own
+// DWN.
+func configureTestProtocol(t *testing.T, dwn *Dwn, author _did.BearerDID, definition map[string]interface{}) {
+	t.Helper()
+	reply, err := dwn.ProcessMessage(author.URI, newTestProtocolsConfigure(t, author, definition), nil)
+	require.NoError(t, err)
+	require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+}
@@ -0,0 +1,179 @@
+package dwn
+
+import "fmt"
+
+// MessagesFilter selects messages in MessagesQuery.  See
+// messages-filter.json.
+type MessagesFilter struct {
+	Interface        string           `json:"interface,omitempty"`
+	Method           string           `json:"method,omitempty"`
+	Protocol         string           `json:"protocol,omitempty"`
+	MessageTimestamp *DateRangeFilter `json:"messageTimestamp,omitempty"`
+}
+
+// ToFilters translates the messages filter into EventLog filters.
+func (f MessagesFilter) ToFilters() []Filter {
+	filters := []Filter{}
+	equal := []struct {
+		property string
+		value    string
+	}{
+		{"interface", f.Interface},
+		{"method", f.Method},
+		{"protocol", f.Protocol},
+	}
+	for _, e := range equal {
+		if e.value != "" {
+			filters = append(filters, NewEqualFilter(e.property, S(e.value)))
+		}
+	}
+	return append(filters, f.MessageTimestamp.toFilters("messageTimestamp")...)
+}
+
+// messagesQueryLimit is the most messages a MessagesQuery reply lists.  The
+// client resumes after the reply cursor for the rest.
+var messagesQueryLimit = 100
+
+type MessagesQueryHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	eventLog     EventLog
+}
+
+func NewMessagesQueryHandler(didResolver *DidResolver, messageStore MessageStore, eventLog EventLog) MethodHandler {
+	return &MessagesQueryHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		eventLog:     eventLog,
+	}
+}
+
+func (h *MessagesQueryHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	reply, err := h.query(Tenant(request.Tenant), request.Message)
+	if err != nil {
+		return replyFromError(err)
+	}
+	return reply, nil
+}
+
+// query returns the CIDs of up to messagesQueryLimit messages matching any of
+// the filters, after the watermark held by the cursor.  The reply cursor
+// holds the watermark of the last message returned, so clients can pull
+// incrementally.
+func (h *MessagesQueryHandler) query(tenant Tenant, rawMessage map[string]interface{}) (UnionMessageReply, error) {
+	var message MessagesQuery
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceMessages || descriptor.Method != MethodQuery {
+		return UnionMessageReply{}, newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceMessages, MethodQuery, descriptor.Interface, descriptor.Method)
+	}
+	err := authorizeMessagesFilters(h.messageStore, tenant, message.Authorization.Signature, MethodQuery,
+		descriptor.MessageTimestamp, descriptor.Filters)
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+
+	var watermark EventLogCursor
+	if cursor := descriptor.Cursor; cursor != nil {
+		value, ok := cursor.Value.(string)
+		if !ok {
+			return UnionMessageReply{}, newStatusError(400, "cursor value must be an event watermark")
+		}
+		watermark = EventLogCursor(value)
+	}
+
+	events, err := queryEvents(h.eventLog, tenant, messagesFilterSets(descriptor.Filters), watermark,
+		messagesQueryLimit)
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+
+	reply := UnionMessageReply{
+		Status:  Status{Code: 200},
+		Entries: make([]map[string]interface{}, 0, len(events)),
+	}
+	for _, event := range events {
+		reply.Entries = append(reply.Entries, map[string]interface{}{"messageCid": string(event.MessageCid)})
+	}
+	if len(events) > 0 {
+		last := events[len(events)-1]
+		reply.Cursor = &PaginationCursor{MessageCid: string(last.MessageCid), Value: string(last.Watermark)}
+	}
+	return reply, nil
+}
+
+// authorizeMessagesFilters allows the tenant to query or subscribe to all
+// messages, as method says, and holders of a grant for that method the
+// messages it covers: a grant limited to a protocol requires every filter to
+// be limited to that protocol too.
+func authorizeMessagesFilters(messageStore MessageStore, tenant Tenant, signature GeneralJws, method string,
+	messageTimestamp string, filters []MessagesFilter) error {
+	requester, err := getSigner(signature)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	if requester == string(tenant) {
+		return nil
+	}
+
+	grantId, err := signaturePermissionGrantId(signature)
+	if err != nil {
+		return err
+	}
+	if grantId == "" {
+		return newStatusError(401, "%s is not authorized to access messages of tenant %s", requester, tenant)
+	}
+	grant, err := fetchPermissionGrant(messageStore, tenant, grantId)
+	if err != nil {
+		return err
+	}
+	if grant == nil {
+		return newStatusError(401, "grant %s does not exist", grantId)
+	}
+
+	protocol := grant.Descriptor.Scope.Protocol
+	if protocol != "" {
+		if len(filters) == 0 {
+			return newStatusError(401, "grant is limited to protocol %s", protocol)
+		}
+		for _, filter := range filters {
+			if filter.Protocol != protocol {
+				return newStatusError(401, "grant is limited to protocol %s", protocol)
+			}
+		}
+	}
+	return verifyPermissionGrant(messageStore, tenant, requester, grantId, grantedAction{
+		Interface:        InterfaceMessages,
+		Method:           method,
+		MessageTimestamp: messageTimestamp,
+		Protocol:         protocol,
+	})
+}
+
+// messagesFilterSets translates MessagesFilters, any of which may match.
+func messagesFilterSets(filters []MessagesFilter) [][]Filter {
+	filterSets := make([][]Filter, 0, len(filters))
+	for _, filter := range filters {
+		filterSets = append(filterSets, filter.ToFilters())
+	}
+	return filterSets
+}
+
+// queryEvents returns the tenant's events after watermark that match any of
+// filterSets, or all of them if there are no filter sets, up to limit events
+// if limit is positive.
+func queryEvents(eventLog EventLog, tenant Tenant, filterSets [][]Filter,
+	watermark EventLogCursor, limit int) ([]EventLogEntry, error) {
+	var filters []Filter
+	if len(filterSets) > 0 {
+		filters = []Filter{OrFilter{AnyOf: filterSets}}
+	}
+	events, err := eventLog.QueryEvents(tenant, filters, watermark, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,129 @@
+package dwn
+
+import (
+	"testing"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMessagesQuery(t *testing.T, author _did.BearerDID, filters []map[string]interface{},
+	cursor *PaginationCursor) map[string]interface{} {
+	t.Helper()
+	if filters == nil {
+		filters = []map[string]interface{}{}
+	}
+	properties := map[string]interface{}{"filters": filters}
+	if cursor != nil {
+		properties["cursor"] = cursor
+	}
+	return newTestMessage(t, &author, InterfaceMessages, MethodQuery, properties)
+}
+
+// replyMessageCids returns the messageCid of every entry of a reply.
+func replyMessageCids(t *testing.T, reply UnionMessageReply) []string {
+	t.Helper()
+	cids := make([]string, 0, len(reply.Entries))
+	for _, entry := range reply.Entries {
+		cids = append(cids, entry["messageCid"].(string))
+	}
+	return cids
+}
+
+func TestMessagesQuery(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	definition := loadTestProtocolDefinition(t, "chat.json")
+	configureTestProtocol(t, dwn, alice, definition)
+	protocol := definition["protocol"].(string)
+	configureCid, err := dwn.eventLog.GetEvents(Tenant(alice.URI))
+	require.NoError(t, err)
+
+	record := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+	thread := writeTestRecord(t, dwn, alice, testRecordsWrite{
+		protocol: protocol, protocolPath: "thread", schema: "thread",
+	})
+	recordCid, threadCid := testMessageCid(t, record), testMessageCid(t, thread)
+
+	query := func(author _did.BearerDID, filters []map[string]interface{}, cursor *PaginationCursor) UnionMessageReply {
+		reply, err := dwn.ProcessMessage(alice.URI, newTestMessagesQuery(t, author, filters, cursor), nil)
+		require.NoError(t, err)
+		return reply
+	}
+
+	t.Run("returns all messages in order", func(t *testing.T) {
+		reply := query(alice, nil, nil)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Equal(t, []string{configureCid[0], recordCid, threadCid}, replyMessageCids(t, reply))
+		require.NotNil(t, reply.Cursor)
+		assert.Equal(t, threadCid, reply.Cursor.MessageCid)
+	})
+
+	t.Run("matches any of the filters", func(t *testing.T) {
+		reply := query(alice, []map[string]interface{}{
+			{"interface": InterfaceProtocols},
+			{"interface": InterfaceRecords, "protocol": protocol},
+		}, nil)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Equal(t, []string{configureCid[0], threadCid}, replyMessageCids(t, reply))
+	})
+
+	t.Run("resumes after the cursor", func(t *testing.T) {
+		first := query(alice, []map[string]interface{}{{"interface": InterfaceRecords}}, nil)
+		require.Equal(t, 200, first.Status.Code, first.Status.Detail)
+
+		// A record written after the first pull.
+		later := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		next := query(alice, []map[string]interface{}{{"interface": InterfaceRecords}}, first.Cursor)
+		require.Equal(t, 200, next.Status.Code, next.Status.Detail)
+		assert.Equal(t, []string{testMessageCid(t, later)}, replyMessageCids(t, next))
+
+		// The cursor stays valid after its message is superseded.
+		writeTestRecord(t, dwn, alice, testRecordsWrite{update: later})
+		again := query(alice, []map[string]interface{}{{"interface": InterfaceRecords}}, next.Cursor)
+		require.Equal(t, 200, again.Status.Code, again.Status.Detail)
+		assert.Len(t, again.Entries, 1)
+
+		assert.Equal(t, 400, query(alice, nil, &PaginationCursor{MessageCid: recordCid}).Status.Code)
+	})
+
+	t.Run("pages through the log", func(t *testing.T) {
+		all := replyMessageCids(t, query(alice, nil, nil))
+		require.Greater(t, len(all), 2)
+
+		defer func(limit int) { messagesQueryLimit = limit }(messagesQueryLimit)
+		messagesQueryLimit = 2
+		var paged []string
+		var cursor *PaginationCursor
+		for {
+			reply := query(alice, nil, cursor)
+			require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+			require.LessOrEqual(t, len(reply.Entries), 2)
+			if len(reply.Entries) == 0 {
+				assert.Nil(t, reply.Cursor)
+				break
+			}
+			paged = append(paged, replyMessageCids(t, reply)...)
+			cursor = reply.Cursor
+		}
+		assert.Equal(t, all, paged)
+	})
+
+	t.Run("requires a grant for anyone but the tenant", func(t *testing.T) {
+		assert.Equal(t, 401, query(bob, nil, nil).Status.Code)
+
+		grantId := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceMessages, "method": MethodQuery, "protocol": protocol,
+		}, nil)
+		withGrant := func(filters []map[string]interface{}) int {
+			message := withTestPermissionGrant(t, bob, newTestMessagesQuery(t, bob, filters, nil), grantId)
+			return processStatus(t, dwn, alice.URI, message)
+		}
+		assert.Equal(t, 200, withGrant([]map[string]interface{}{{"protocol": protocol}}))
+		assert.Equal(t, 401, withGrant(nil))
+		assert.Equal(t, 401, withGrant([]map[string]interface{}{{"protocol": protocol}, {"interface": InterfaceRecords}}))
+	})
+}
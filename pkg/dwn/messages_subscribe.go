@@ -0,0 +1,59 @@
+package dwn
+
+type MessagesSubscribeHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	eventStream  EventStream
+}
+
+func NewMessagesSubscribeHandler(didResolver *DidResolver, messageStore MessageStore,
+	eventStream EventStream) MethodHandler {
+	return &MessagesSubscribeHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		eventStream:  eventStream,
+	}
+}
+
+func (h *MessagesSubscribeHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	subscription, err := h.subscribe(Tenant(request.Tenant), request.Message, request.SubscriptionHandler)
+	if err != nil {
+		return replyFromError(err)
+	}
+	return UnionMessageReply{Status: Status{Code: 200}, Subscription: subscription}, nil
+}
+
+// subscribe passes the events matching any of the filters to handler.
+func (h *MessagesSubscribeHandler) subscribe(tenant Tenant, rawMessage map[string]interface{},
+	handler SubscriptionHandler) (EventSubscription, error) {
+	var message MessagesSubscribe
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return nil, &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceMessages || descriptor.Method != MethodSubscribe {
+		return nil, newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceMessages, MethodSubscribe, descriptor.Interface, descriptor.Method)
+	}
+	if h.eventStream == nil {
+		return nil, newStatusError(501, "subscriptions are not supported")
+	}
+	if handler == nil {
+		return nil, newStatusError(400, "subscriptions require a subscription handler")
+	}
+	err := authorizeMessagesFilters(h.messageStore, tenant, message.Authorization.Signature, MethodSubscribe,
+		descriptor.MessageTimestamp, descriptor.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var filters []Filter
+	if filterSets := messagesFilterSets(descriptor.Filters); len(filterSets) > 0 {
+		filters = []Filter{OrFilter{AnyOf: filterSets}}
+	}
+	id, err := computeMessageCid(rawMessage)
+	if err != nil {
+		return nil, &statusError{Code: 400, Err: err}
+	}
+	return subscribeEvents(h.eventStream, tenant, string(id), filters, handler)
+}
@@ -0,0 +1,39 @@
+package dwn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagesSubscribe(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	subscribe := newTestMessage(t, &alice, InterfaceMessages, MethodSubscribe, map[string]interface{}{
+		"filters": []map[string]interface{}{
+			{"interface": InterfaceProtocols},
+			{"interface": InterfaceRecords, "method": MethodDelete},
+		},
+	})
+	subscriber, reply := subscribeTest(t, dwn, alice.URI, subscribe)
+	require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+
+	configure := newTestProtocolsConfigure(t, alice, loadTestProtocolDefinition(t, "chat.json"))
+	require.Equal(t, 202, processStatus(t, dwn, alice.URI, configure))
+	record := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+	remove := newTestRecordsDelete(t, alice, record["recordId"], false)
+	require.Equal(t, 202, processStatus(t, dwn, alice.URI, remove))
+
+	assert.Equal(t, []string{testMessageCid(t, configure), testMessageCid(t, remove)}, subscriber.messageCids(t))
+
+	t.Run("requires a grant for anyone but the tenant", func(t *testing.T) {
+		subscribe := newTestMessage(t, &bob, InterfaceMessages, MethodSubscribe, map[string]interface{}{
+			"filters": []map[string]interface{}{},
+		})
+		_, reply := subscribeTest(t, dwn, alice.URI, subscribe)
+		assert.Equal(t, 401, reply.Status.Code)
+	})
+}
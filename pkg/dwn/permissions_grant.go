@@ -0,0 +1,223 @@
+package dwn
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/utils"
+)
+
+type PermissionsGrantHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	eventLog     EventLog
+}
+
+func NewPermissionsGrantHandler(didResolver *DidResolver, messageStore MessageStore, eventLog EventLog) MethodHandler {
+	return &PermissionsGrantHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		eventLog:     eventLog,
+	}
+}
+
+func (h *PermissionsGrantHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	if err := h.grant(Tenant(request.Tenant), request.Message); err != nil {
+		return replyFromError(err)
+	}
+	return UnionMessageReply{Status: Status{Code: 202}}, nil
+}
+
+func (h *PermissionsGrantHandler) grant(tenant Tenant, rawMessage map[string]interface{}) error {
+	var message PermissionsGrant
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfacePermissions || descriptor.Method != MethodGrant {
+		return newStatusError(400, "expected %s%s message, got %s%s",
+			InterfacePermissions, MethodGrant, descriptor.Interface, descriptor.Method)
+	}
+	author, err := getSigner(message.Authorization.Signature)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	if author != descriptor.GrantedBy {
+		return newStatusError(401, "grant by %s must be signed by its grantor, not %s", descriptor.GrantedBy, author)
+	}
+	if descriptor.GrantedFor != descriptor.GrantedBy {
+		return newStatusError(401, "%s cannot grant access to the DWN of %s", descriptor.GrantedBy, descriptor.GrantedFor)
+	}
+	if string(tenant) != descriptor.GrantedBy && string(tenant) != descriptor.GrantedTo {
+		return newStatusError(400, "grant between %s and %s cannot be stored by tenant %s",
+			descriptor.GrantedBy, descriptor.GrantedTo, tenant)
+	}
+	if err := validatePermissionScope(descriptor.Scope, descriptor.Conditions); err != nil {
+		return err
+	}
+
+	issued, err := time.Parse(time.RFC3339Nano, descriptor.MessageTimestamp)
+	if err != nil {
+		return newStatusError(400, "malformed messageTimestamp: %w", err)
+	}
+	expires, err := time.Parse(time.RFC3339Nano, descriptor.DateExpires)
+	if err != nil {
+		return newStatusError(400, "malformed dateExpires: %w", err)
+	}
+	if !expires.After(issued) {
+		return newStatusError(400, "dateExpires %s must be after messageTimestamp %s",
+			descriptor.DateExpires, descriptor.MessageTimestamp)
+	}
+
+	grantId, err := computeMessageCid(rawMessage)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	existing, err := fetchPermissionGrant(h.messageStore, tenant, string(grantId))
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return newStatusError(409, "grant %s already exists", grantId)
+	}
+
+	// Grants are indexed under their own id so that they and their
+	// revocations are found with a single query.
+	indexes := IndexableKeyValues{
+		"interface":          S(descriptor.Interface),
+		"method":             S(descriptor.Method),
+		"messageTimestamp":   S(descriptor.MessageTimestamp),
+		"author":             S(author),
+		"grantedTo":          S(descriptor.GrantedTo),
+		"grantedBy":          S(descriptor.GrantedBy),
+		"grantedFor":         S(descriptor.GrantedFor),
+		"permissionsGrantId": S(string(grantId)),
+	}
+	if descriptor.Scope.Protocol != "" {
+		indexes["protocol"] = S(descriptor.Scope.Protocol)
+	}
+	if err := h.messageStore.Put(tenant, rawMessage, indexes); err != nil {
+		return err
+	}
+	return h.eventLog.Append(tenant, grantId, indexes)
+}
+
+// validatePermissionScope checks that a requested or granted scope is well
+// formed: contextId and protocolPath narrow the records of a protocol, and
+// the publication condition only applies to RecordsWrite.
+func validatePermissionScope(scope PermissionScope, conditions *PermissionConditions) error {
+	if scope.Interface == "" || scope.Method == "" {
+		return newStatusError(400, "scope must name an interface and method")
+	}
+	if scope.ContextId != "" || scope.ProtocolPath != "" {
+		if scope.Interface != InterfaceRecords {
+			return newStatusError(400, "only %s scopes can be limited to a contextId or protocolPath", InterfaceRecords)
+		}
+		if scope.Protocol == "" {
+			return newStatusError(400, "scopes limited to a contextId or protocolPath must name a protocol")
+		}
+		if scope.ContextId != "" && scope.ProtocolPath != "" {
+			return newStatusError(400, "scope cannot be limited to both a contextId and a protocolPath")
+		}
+	}
+	if conditions == nil || conditions.Publication == "" {
+		return nil
+	}
+	if conditions.Publication != PublicationRequired && conditions.Publication != PublicationProhibited {
+		return newStatusError(400, "unknown publication condition %q", conditions.Publication)
+	}
+	if scope.Interface != InterfaceRecords || scope.Method != MethodWrite {
+		return newStatusError(400, "publication conditions only apply to %s%s scopes", InterfaceRecords, MethodWrite)
+	}
+	return nil
+}
+
+// fetchPermissionGrant returns the grant stored by tenant under grantId,
+// either as a PermissionsGrant or as a grant record, or nil if there is
+// none.
+func fetchPermissionGrant(messageStore MessageStore, tenant Tenant, grantId string) (*PermissionsGrant, error) {
+	entries, err := queryMessageEntries(messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfacePermissions)),
+		NewEqualFilter("method", S(MethodGrant)),
+		NewEqualFilter("permissionsGrantId", S(grantId)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		var grant PermissionsGrant
+		if err := parseMessage(entries[0].Message, &grant); err != nil {
+			return nil, err
+		}
+		return &grant, nil
+	}
+
+	records, err := queryMessageEntries(messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("recordId", S(grantId)),
+		NewEqualFilter("protocol", S(PermissionsProtocolUri)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	newest := newestMessage(records)
+	if newest == nil || newest.interfaceMethod() != InterfaceRecords+MethodWrite {
+		return nil, nil
+	}
+	grant, err := parseGrantRecord(newest.Message)
+	if err != nil {
+		return nil, &statusError{Code: 400, Err: fmt.Errorf("grant record %s: %w", grantId, err)}
+	}
+	return grant, nil
+}
+
+// signaturePermissionGrantId returns the permissionGrantId a signature
+// invokes, or "" if it invokes none.
+func signaturePermissionGrantId(signature GeneralJws) (string, error) {
+	var payload utils.GenericSignaturePayload
+	if err := decodeSignaturePayload(signature, &payload); err != nil {
+		return "", &statusError{Code: 400, Err: err}
+	}
+	return payload.PermissionGrantId, nil
+}
+
+// verifyPermissionGrant checks that the grant tenant stored under grantId
+// allows requester to perform action in the DWN of tenant, and that it has
+// not been revoked.
+func verifyPermissionGrant(messageStore MessageStore, tenant Tenant, requester, grantId string,
+	action grantedAction) error {
+	grant, err := fetchPermissionGrant(messageStore, tenant, grantId)
+	if err != nil {
+		return err
+	}
+	if grant == nil {
+		return newStatusError(401, "grant %s does not exist", grantId)
+	}
+	if grant.Descriptor.GrantedFor != string(tenant) {
+		return newStatusError(401, "grant %s is not for tenant %s", grantId, tenant)
+	}
+	if err := verifyGrant(grant, requester, action); err != nil {
+		return err
+	}
+	return verifyGrantNotRevoked(messageStore, tenant, grantId)
+}
+
+// verifyGrantNotRevoked checks that tenant holds no revocation of grantId.
+// A stored revocation rejects every message processed after it, whatever its
+// messageTimestamp: the signer chooses that timestamp, so a message dated
+// before the revocation may well have been backdated.
+func verifyGrantNotRevoked(messageStore MessageStore, tenant Tenant, grantId string) error {
+	revocations, err := queryMessageEntries(messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfacePermissions)),
+		NewEqualFilter("method", S(MethodRevoke)),
+		NewEqualFilter("permissionsGrantId", S(grantId)),
+	})
+	if err != nil {
+		return err
+	}
+	if len(revocations) > 0 {
+		return newStatusError(401, "grant %s was revoked at %s", grantId,
+			revocations[0].descriptorStr("messageTimestamp"))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package dwn
+
+type PermissionsRequestHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	eventLog     EventLog
+}
+
+func NewPermissionsRequestHandler(didResolver *DidResolver, messageStore MessageStore, eventLog EventLog) MethodHandler {
+	return &PermissionsRequestHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		eventLog:     eventLog,
+	}
+}
+
+func (h *PermissionsRequestHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	if err := h.request(Tenant(request.Tenant), request.Message); err != nil {
+		return replyFromError(err)
+	}
+	return UnionMessageReply{Status: Status{Code: 202}}, nil
+}
+
+func (h *PermissionsRequestHandler) request(tenant Tenant, rawMessage map[string]interface{}) error {
+	var message PermissionsRequest
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfacePermissions || descriptor.Method != MethodRequest {
+		return newStatusError(400, "expected %s%s message, got %s%s",
+			InterfacePermissions, MethodRequest, descriptor.Interface, descriptor.Method)
+	}
+	author, err := getSigner(message.Authorization.Signature)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	if author != descriptor.GrantedTo {
+		return newStatusError(401, "request for %s must be signed by its grantee, not %s", descriptor.GrantedTo, author)
+	}
+	if string(tenant) != descriptor.GrantedBy && string(tenant) != descriptor.GrantedTo {
+		return newStatusError(400, "request between %s and %s cannot be stored by tenant %s",
+			descriptor.GrantedBy, descriptor.GrantedTo, tenant)
+	}
+	if err := validatePermissionScope(descriptor.Scope, descriptor.Conditions); err != nil {
+		return err
+	}
+
+	requestId, err := computeMessageCid(rawMessage)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	existing, err := queryMessageEntries(h.messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfacePermissions)),
+		NewEqualFilter("method", S(MethodRequest)),
+		NewEqualFilter("messageTimestamp", S(descriptor.MessageTimestamp)),
+		NewEqualFilter("author", S(author)),
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range existing {
+		if entry.Cid == requestId {
+			return newStatusError(409, "request %s already exists", requestId)
+		}
+	}
+
+	indexes := IndexableKeyValues{
+		"interface":        S(descriptor.Interface),
+		"method":           S(descriptor.Method),
+		"messageTimestamp": S(descriptor.MessageTimestamp),
+		"author":           S(author),
+		"grantedTo":        S(descriptor.GrantedTo),
+		"grantedBy":        S(descriptor.GrantedBy),
+		"grantedFor":       S(descriptor.GrantedFor),
+	}
+	if descriptor.Scope.Protocol != "" {
+		indexes["protocol"] = S(descriptor.Scope.Protocol)
+	}
+	if err := h.messageStore.Put(tenant, rawMessage, indexes); err != nil {
+		return err
+	}
+	return h.eventLog.Append(tenant, requestId, indexes)
+}
@@ -0,0 +1,104 @@
+package dwn
+
+type PermissionsRevokeHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	eventLog     EventLog
+}
+
+func NewPermissionsRevokeHandler(didResolver *DidResolver, messageStore MessageStore, eventLog EventLog) MethodHandler {
+	return &PermissionsRevokeHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		eventLog:     eventLog,
+	}
+}
+
+func (h *PermissionsRevokeHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	if err := h.revoke(Tenant(request.Tenant), request.Message); err != nil {
+		return replyFromError(err)
+	}
+	return UnionMessageReply{Status: Status{Code: 202}}, nil
+}
+
+func (h *PermissionsRevokeHandler) revoke(tenant Tenant, rawMessage map[string]interface{}) error {
+	var message PermissionsRevoke
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfacePermissions || descriptor.Method != MethodRevoke {
+		return newStatusError(400, "expected %s%s message, got %s%s",
+			InterfacePermissions, MethodRevoke, descriptor.Interface, descriptor.Method)
+	}
+	if descriptor.PermissionsGrantId == "" {
+		return newStatusError(400, "permissionsGrantId is required")
+	}
+	author, err := getSigner(message.Authorization.Signature)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+
+	grant, err := fetchPermissionGrant(h.messageStore, tenant, descriptor.PermissionsGrantId)
+	if err != nil {
+		return err
+	}
+	if grant == nil {
+		return newStatusError(404, "grant %s not found", descriptor.PermissionsGrantId)
+	}
+	if author != grant.Descriptor.GrantedBy {
+		return newStatusError(401, "%s cannot revoke grant %s issued by %s",
+			author, descriptor.PermissionsGrantId, grant.Descriptor.GrantedBy)
+	}
+	if descriptor.MessageTimestamp < grant.Descriptor.MessageTimestamp {
+		return newStatusError(400, "revocation at %s predates grant %s",
+			descriptor.MessageTimestamp, descriptor.PermissionsGrantId)
+	}
+
+	incoming := messageEntry{Message: rawMessage}
+	if incoming.Cid, err = computeMessageCid(rawMessage); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+
+	// The oldest revocation decides from when the grant is invalid, so later
+	// revocations are rejected and earlier ones replace what is stored.
+	existing, err := queryMessageEntries(h.messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfacePermissions)),
+		NewEqualFilter("method", S(MethodRevoke)),
+		NewEqualFilter("permissionsGrantId", S(descriptor.PermissionsGrantId)),
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range existing {
+		if !entry.isNewerThan(incoming) {
+			return newStatusError(409, "grant %s is already revoked", descriptor.PermissionsGrantId)
+		}
+	}
+
+	indexes := IndexableKeyValues{
+		"interface":          S(descriptor.Interface),
+		"method":             S(descriptor.Method),
+		"messageTimestamp":   S(descriptor.MessageTimestamp),
+		"author":             S(author),
+		"permissionsGrantId": S(descriptor.PermissionsGrantId),
+	}
+	if err := h.messageStore.Put(tenant, rawMessage, indexes); err != nil {
+		return err
+	}
+	if err := h.eventLog.Append(tenant, incoming.Cid, indexes); err != nil {
+		return err
+	}
+
+	deleted := make([]MessageCid, 0, len(existing))
+	for _, entry := range existing {
+		if err := h.messageStore.Delete(tenant, entry.Cid); err != nil {
+			return err
+		}
+		deleted = append(deleted, entry.Cid)
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	return h.eventLog.DeleteEventsByCid(tenant, deleted)
+}
@@ -0,0 +1,300 @@
+package dwn
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// grantTestPermission stores a PermissionsGrant from grantor to grantee in
+// the grantor's DWN and returns its id.
+func grantTestPermission(t *testing.T, dwn *Dwn, grantor, grantee _did.BearerDID, scope map[string]interface{},
+	descriptorProperties map[string]interface{}) string {
+	t.Helper()
+	grant := newTestPermissionsGrant(t, grantor, grantee, scope, descriptorProperties)
+	require.Equal(t, 202, processStatus(t, dwn, grantor.URI, grant))
+	grantId, err := computeMessageCid(grant)
+	require.NoError(t, err)
+	return string(grantId)
+}
+
+func newTestPermissionsRevoke(t *testing.T, author _did.BearerDID, grantId string) map[string]interface{} {
+	t.Helper()
+	return newTestMessage(t, &author, InterfacePermissions, MethodRevoke, map[string]interface{}{
+		"permissionsGrantId": grantId,
+	})
+}
+
+func TestPermissionsGrant(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	carol := newTestPersona(t)
+	writeScope := map[string]interface{}{"interface": InterfaceRecords, "method": MethodWrite}
+
+	t.Run("stores grants of the tenant", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grant := newTestPermissionsGrant(t, alice, bob, writeScope, nil)
+		assert.Equal(t, 202, processStatus(t, dwn, alice.URI, grant))
+		assert.Equal(t, 409, processStatus(t, dwn, alice.URI, grant))
+
+		events, err := dwn.eventLog.GetEvents(Tenant(alice.URI))
+		require.NoError(t, err)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("grantees can store their grants", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grant := newTestPermissionsGrant(t, alice, bob, writeScope, nil)
+		assert.Equal(t, 202, processStatus(t, dwn, bob.URI, grant))
+		assert.Equal(t, 400, processStatus(t, dwn, carol.URI, grant))
+	})
+
+	t.Run("rejects grants not signed by the grantor", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grant := newTestPermissionsGrant(t, bob, carol, writeScope, map[string]interface{}{
+			"grantedBy": alice.URI, "grantedFor": alice.URI,
+		})
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, grant))
+
+		grant = newTestPermissionsGrant(t, bob, carol, writeScope, map[string]interface{}{
+			"grantedFor": alice.URI,
+		})
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, grant))
+	})
+
+	t.Run("rejects malformed grants", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		tests := []struct {
+			name       string
+			scope      map[string]interface{}
+			properties map[string]interface{}
+		}{
+			{"expires before issued", writeScope, map[string]interface{}{
+				"dateExpires": time.Now().Add(-time.Hour).UTC().Format(TimestampFormat),
+			}},
+			{"contextId without protocol", map[string]interface{}{
+				"interface": InterfaceRecords, "method": MethodRead, "contextId": "abc",
+			}, nil},
+			{"protocolPath outside records", map[string]interface{}{
+				"interface": InterfaceProtocols, "method": MethodQuery,
+				"protocol": "http://chat-protocol.xyz", "protocolPath": "thread",
+			}, nil},
+			{"contextId and protocolPath", map[string]interface{}{
+				"interface": InterfaceRecords, "method": MethodRead,
+				"protocol": "http://chat-protocol.xyz", "contextId": "abc", "protocolPath": "thread",
+			}, nil},
+			{"publication of reads", map[string]interface{}{
+				"interface": InterfaceRecords, "method": MethodRead,
+			}, map[string]interface{}{"conditions": map[string]interface{}{"publication": PublicationRequired}}},
+			{"unknown publication", writeScope, map[string]interface{}{
+				"conditions": map[string]interface{}{"publication": "Sometimes"},
+			}},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				grant := newTestPermissionsGrant(t, alice, bob, tc.scope, tc.properties)
+				assert.Equal(t, 400, processStatus(t, dwn, alice.URI, grant))
+			})
+		}
+	})
+}
+
+func TestPermissionsRequest(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	carol := newTestPersona(t)
+	properties := map[string]interface{}{
+		"grantedBy":  alice.URI,
+		"grantedTo":  bob.URI,
+		"grantedFor": alice.URI,
+		"scope":      map[string]interface{}{"interface": InterfaceRecords, "method": MethodWrite},
+	}
+
+	dwn := NewTestDwn(t)
+	request := newTestMessage(t, &bob, InterfacePermissions, MethodRequest, properties)
+	assert.Equal(t, 202, processStatus(t, dwn, alice.URI, request))
+	assert.Equal(t, 409, processStatus(t, dwn, alice.URI, request))
+
+	forged := newTestMessage(t, &carol, InterfacePermissions, MethodRequest, properties)
+	assert.Equal(t, 401, processStatus(t, dwn, alice.URI, forged))
+}
+
+func TestPermissionsRevoke(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	writeScope := map[string]interface{}{"interface": InterfaceRecords, "method": MethodWrite}
+
+	t.Run("grantors revoke their grants once", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grantId := grantTestPermission(t, dwn, alice, bob, writeScope, nil)
+
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, newTestPermissionsRevoke(t, bob, grantId)))
+		assert.Equal(t, 202, processStatus(t, dwn, alice.URI, newTestPermissionsRevoke(t, alice, grantId)))
+		assert.Equal(t, 409, processStatus(t, dwn, alice.URI, newTestPermissionsRevoke(t, alice, grantId)))
+	})
+
+	t.Run("rejects revocations of unknown grants", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		assert.Equal(t, 404, processStatus(t, dwn, alice.URI, newTestPermissionsRevoke(t, alice, "bafyunknown")))
+	})
+
+	t.Run("revocation invalidates later messages", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grantId := grantTestPermission(t, dwn, alice, bob, writeScope, nil)
+		_, code := writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{permissionGrantId: grantId})
+		require.Equal(t, 202, code)
+
+		// Signed before the revocation but received after it.
+		late, lateData := newTestRecordsWrite(t, bob, testRecordsWrite{permissionGrantId: grantId})
+		require.Equal(t, 202, processStatus(t, dwn, alice.URI, newTestPermissionsRevoke(t, alice, grantId)))
+
+		_, code = writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{permissionGrantId: grantId})
+		assert.Equal(t, 401, code)
+		reply, err := dwn.ProcessMessage(alice.URI, late, bytes.NewReader(lateData))
+		require.NoError(t, err)
+		assert.Equal(t, 401, reply.Status.Code, reply.Status.Detail)
+	})
+
+	t.Run("backdated messages do not escape revocation", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grantId := grantTestPermission(t, dwn, alice, bob, writeScope, nil)
+		beforeRevocation := newMessageTimestamp()
+		require.Equal(t, 202, processStatus(t, dwn, alice.URI, newTestPermissionsRevoke(t, alice, grantId)))
+
+		_, code := writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{
+			permissionGrantId: grantId, messageTimestamp: beforeRevocation,
+		})
+		assert.Equal(t, 401, code)
+
+		delegated := newTestDelegatedGrant(t, alice, bob, writeScope, nil)
+		delegatedId := storeTestDelegatedGrant(t, dwn, alice, delegated)
+		beforeRevocation = newMessageTimestamp()
+		require.Equal(t, 202, processStatus(t, dwn, alice.URI, newTestPermissionsRevoke(t, alice, delegatedId)))
+		_, code = writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{
+			delegatedGrant: delegated, messageTimestamp: beforeRevocation,
+		})
+		assert.Equal(t, 401, code)
+	})
+
+	t.Run("revocation invalidates delegated grants", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grant := newTestDelegatedGrant(t, alice, bob, writeScope, nil)
+		grantId := storeTestDelegatedGrant(t, dwn, alice, grant)
+
+		_, code := writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{delegatedGrant: grant})
+		require.Equal(t, 202, code)
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, newTestPermissionsRevoke(t, bob, grantId)))
+		require.Equal(t, 202, processStatus(t, dwn, alice.URI, newTestPermissionsRevoke(t, alice, grantId)))
+		_, code = writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{delegatedGrant: grant})
+		assert.Equal(t, 401, code)
+	})
+}
+
+func TestPermissionGrantAuthorization(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	carol := newTestPersona(t)
+	writeScope := map[string]interface{}{"interface": InterfaceRecords, "method": MethodWrite}
+
+	t.Run("grants allow writes", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		_, code := writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{})
+		require.Equal(t, 401, code)
+
+		grantId := grantTestPermission(t, dwn, alice, bob, writeScope, nil)
+		_, code = writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{permissionGrantId: grantId})
+		assert.Equal(t, 202, code)
+		_, code = writeToTenant(t, dwn, alice.URI, carol, testRecordsWrite{permissionGrantId: grantId})
+		assert.Equal(t, 401, code)
+		_, code = writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{permissionGrantId: "bafyunknown"})
+		assert.Equal(t, 401, code)
+	})
+
+	t.Run("rejects expired grants", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grantId := grantTestPermission(t, dwn, alice, bob, writeScope, map[string]interface{}{
+			"messageTimestamp": time.Now().Add(-2 * time.Hour).UTC().Format(TimestampFormat),
+			"dateExpires":      time.Now().Add(-time.Hour).UTC().Format(TimestampFormat),
+		})
+		_, code := writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{permissionGrantId: grantId})
+		assert.Equal(t, 401, code)
+	})
+
+	t.Run("enforces the publication condition", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grantId := grantTestPermission(t, dwn, alice, bob, writeScope, map[string]interface{}{
+			"conditions": map[string]interface{}{"publication": PublicationRequired},
+		})
+		_, code := writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{permissionGrantId: grantId})
+		assert.Equal(t, 401, code)
+		_, code = writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{permissionGrantId: grantId, published: true})
+		assert.Equal(t, 202, code)
+	})
+
+	t.Run("enforces protocol scopes", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		definition := loadTestProtocolDefinition(t, "chat.json")
+		configureTestProtocol(t, dwn, alice, definition)
+		protocol := definition["protocol"].(string)
+		thread := writeTestRecord(t, dwn, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread", schema: "thread",
+		})
+		other := writeTestRecord(t, dwn, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread", schema: "thread",
+		})
+		unrelated := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+
+		readScope := func(extra map[string]interface{}) map[string]interface{} {
+			scope := map[string]interface{}{"interface": InterfaceRecords, "method": MethodRead, "protocol": protocol}
+			for k, v := range extra {
+				scope[k] = v
+			}
+			return scope
+		}
+		read := func(grantId string, record map[string]interface{}) int {
+			message := newTestRecordsRead(t, &bob, map[string]interface{}{"recordId": record["recordId"]})
+			return processStatus(t, dwn, alice.URI, withTestPermissionGrant(t, bob, message, grantId))
+		}
+
+		protocolGrant := grantTestPermission(t, dwn, alice, bob, readScope(nil), nil)
+		assert.Equal(t, 200, read(protocolGrant, thread))
+		assert.Equal(t, 401, read(protocolGrant, unrelated))
+
+		contextGrant := grantTestPermission(t, dwn, alice, bob, readScope(map[string]interface{}{
+			"contextId": thread["contextId"],
+		}), nil)
+		assert.Equal(t, 200, read(contextGrant, thread))
+		assert.Equal(t, 401, read(contextGrant, other))
+
+		pathGrant := grantTestPermission(t, dwn, alice, bob, readScope(map[string]interface{}{
+			"protocolPath": "thread/message",
+		}), nil)
+		assert.Equal(t, 401, read(pathGrant, thread))
+	})
+
+	t.Run("grants allow queries and deletes", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		record := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		filter := map[string]interface{}{"recordId": record["recordId"]}
+
+		queryGrant := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceRecords, "method": MethodQuery,
+		}, nil)
+		query := withTestPermissionGrant(t, bob, newTestRecordsQuery(t, &bob, filter, nil), queryGrant)
+		reply, err := dwn.ProcessMessage(alice.URI, query, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Len(t, reply.Entries, 1)
+
+		deleteGrant := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceRecords, "method": MethodDelete,
+		}, nil)
+		remove := newTestRecordsDelete(t, bob, record["recordId"], false)
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, withTestPermissionGrant(t, bob, remove, queryGrant)))
+		assert.Equal(t, 202, processStatus(t, dwn, alice.URI, withTestPermissionGrant(t, bob, remove, deleteGrant)))
+	})
+}
@@ -0,0 +1,350 @@
+package dwn
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/utils"
+)
+
+// protocolAuthorizer evaluates the rules of an installed protocol definition
+// against the records of one tenant.
+type protocolAuthorizer struct {
+	messageStore MessageStore
+	tenant       Tenant
+	definition   *ProtocolDefinition
+}
+
+// newProtocolAuthorizer returns an authorizer for protocol, or nil if the
+// tenant has not installed it.
+func newProtocolAuthorizer(messageStore MessageStore, tenant Tenant, protocol string) (*protocolAuthorizer, error) {
+	definition, err := fetchProtocolDefinition(messageStore, tenant, protocol)
+	if err != nil || definition == nil {
+		return nil, err
+	}
+	return &protocolAuthorizer{messageStore: messageStore, tenant: tenant, definition: definition}, nil
+}
+
+// protocolRequest describes an action sought on a protocol record.
+type protocolRequest struct {
+	// Requester is the DID asking for the action, or empty if anonymous.
+	Requester string
+	// ProtocolRole is the role the requester invoked in their signature.
+	ProtocolRole string
+	ProtocolPath string
+	// ContextId locates the request in the protocol tree, to find the
+	// context roles the requester holds.
+	ContextId string
+	// Records are the ancestors of the record acted upon, root first,
+	// followed by the record itself if it exists.
+	Records []messageEntry
+	// Actions lists the actions any of which allows the request.
+	Actions []string
+}
+
+// validateStructure checks that a RecordsWrite fits the protocol: its
+// protocolPath exists and sits below its parent's, and its schema,
+// dataFormat, dataSize and tags are allowed at that path.  ancestors are the
+// ancestors of the record, root first.
+func (a *protocolAuthorizer) validateStructure(message *RecordsWrite, ancestors []messageEntry) error {
+	descriptor := message.Descriptor
+	ruleSet := a.definition.RuleSet(descriptor.ProtocolPath)
+	if ruleSet == nil {
+		return newStatusError(400, "protocolPath %s is not part of protocol %s",
+			descriptor.ProtocolPath, descriptor.Protocol)
+	}
+
+	segments := strings.Split(descriptor.ProtocolPath, "/")
+	recordType := a.definition.Types[segments[len(segments)-1]]
+	if recordType.Schema != "" && descriptor.Schema != recordType.Schema {
+		return newStatusError(400, "schema %s is not allowed at %s", descriptor.Schema, descriptor.ProtocolPath)
+	}
+	if len(recordType.DataFormats) > 0 && !slices.Contains(recordType.DataFormats, descriptor.DataFormat) {
+		return newStatusError(400, "dataFormat %s is not allowed at %s", descriptor.DataFormat, descriptor.ProtocolPath)
+	}
+
+	parentPath := strings.Join(segments[:len(segments)-1], "/")
+	var actualParentPath string
+	if len(ancestors) > 0 {
+		actualParentPath = ancestors[len(ancestors)-1].descriptorStr("protocolPath")
+	}
+	if actualParentPath != parentPath {
+		return newStatusError(400, "records at %s require a parent at %q, got %q",
+			descriptor.ProtocolPath, parentPath, actualParentPath)
+	}
+
+	if size := ruleSet.Size; size != nil {
+		if size.Min != nil && descriptor.DataSize < *size.Min {
+			return newStatusError(400, "dataSize %d is below the minimum %d of %s",
+				descriptor.DataSize, *size.Min, descriptor.ProtocolPath)
+		}
+		if size.Max != nil && descriptor.DataSize > *size.Max {
+			return newStatusError(400, "dataSize %d exceeds the maximum %d of %s",
+				descriptor.DataSize, *size.Max, descriptor.ProtocolPath)
+		}
+	}
+
+	if err := validateTags(ruleSet.Tags, descriptor.Tags); err != nil {
+		return &statusError{Code: 400, Err: fmt.Errorf("%s: %w", descriptor.ProtocolPath, err)}
+	}
+
+	if ruleSet.Role && descriptor.Recipient == "" {
+		return newStatusError(400, "role records at %s require a recipient", descriptor.ProtocolPath)
+	}
+	return nil
+}
+
+// validateRoleRecord checks that the recipient of a new role record does not
+// already hold the role, in the same context for context roles.
+func (a *protocolAuthorizer) validateRoleRecord(message *RecordsWrite) error {
+	descriptor := message.Descriptor
+	if ruleSet := a.definition.RuleSet(descriptor.ProtocolPath); ruleSet == nil || !ruleSet.Role {
+		return nil
+	}
+	holders, err := a.roleRecords(string(descriptor.Recipient), descriptor.ProtocolPath, message.ContextId)
+	if err != nil {
+		return err
+	}
+	for _, holder := range holders {
+		if getPathedStrNoErr(holder.Message, "recordId") != message.RecordId {
+			return newStatusError(400, "%s already holds role %s", descriptor.Recipient, descriptor.ProtocolPath)
+		}
+	}
+	return nil
+}
+
+// authorize allows a request if an `$actions` rule at its protocol path
+// grants one of the requested actions to the requester.  A rule for `who:
+// author` or `who: recipient` applies to the record at its `of` path among
+// the request's records, or to the record itself without `of`.  A role rule
+// applies only if the requester invoked that role and holds it.
+func (a *protocolAuthorizer) authorize(request protocolRequest) error {
+	if request.ProtocolRole != "" {
+		if err := a.verifyRole(request.Requester, request.ProtocolRole, request.ContextId); err != nil {
+			return err
+		}
+	}
+
+	denied := newStatusError(401, "%s is not allowed to %s records at %s",
+		request.Requester, strings.Join(request.Actions, " or "), request.ProtocolPath)
+	ruleSet := a.definition.RuleSet(request.ProtocolPath)
+	if ruleSet == nil {
+		return denied
+	}
+
+	for _, rule := range ruleSet.Actions {
+		if !slices.ContainsFunc(rule.Can, func(can string) bool { return slices.Contains(request.Actions, can) }) {
+			continue
+		}
+
+		switch {
+		case rule.Role != "":
+			// The invoked role has been verified above.
+			if rule.Role == request.ProtocolRole {
+				return nil
+			}
+		case rule.Who == ActorAnyone:
+			return nil
+		case request.Requester != "":
+			of := rule.Of
+			if of == "" {
+				of = request.ProtocolPath
+			}
+			record := recordAtPath(request.Records, of)
+			if record == nil {
+				continue
+			}
+			actor := record.descriptorStr("recipient")
+			if rule.Who == ActorAuthor {
+				author, err := record.author()
+				if err != nil {
+					return err
+				}
+				actor = author
+			}
+			if actor == request.Requester {
+				return nil
+			}
+		}
+	}
+	return denied
+}
+
+// verifyRole checks that the requester holds the role they invoked: a role
+// record at the role path with the requester as recipient, within the
+// request's context for context roles.
+func (a *protocolAuthorizer) verifyRole(requester, protocolRole, contextId string) error {
+	if ruleSet := a.definition.RuleSet(protocolRole); ruleSet == nil || !ruleSet.Role {
+		return newStatusError(400, "protocolRole %s is not a role of protocol %s", protocolRole, a.definition.Protocol)
+	}
+	if requester == "" {
+		return newStatusError(401, "anonymous requests cannot invoke protocolRole %s", protocolRole)
+	}
+	holders, err := a.roleRecords(requester, protocolRole, contextId)
+	if err != nil {
+		return err
+	}
+	if len(holders) == 0 {
+		return newStatusError(401, "%s does not hold protocolRole %s", requester, protocolRole)
+	}
+	return nil
+}
+
+// roleRecords returns the role records at rolePath whose recipient is
+// recipient.  Role records nested below other records are context roles and
+// only count within the context of their parent, which contextId must share.
+func (a *protocolAuthorizer) roleRecords(recipient, rolePath, contextId string) ([]messageEntry, error) {
+	filters := []Filter{
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("method", S(MethodWrite)),
+		NewEqualFilter("isLatestBaseState", B(true)),
+		NewEqualFilter("protocol", S(a.definition.Protocol)),
+		NewEqualFilter("protocolPath", S(rolePath)),
+		NewEqualFilter("recipient", S(recipient)),
+	}
+	if depth := strings.Count(rolePath, "/"); depth > 0 {
+		segments := strings.Split(contextId, "/")
+		if contextId == "" || len(segments) < depth {
+			return nil, nil
+		}
+		filters = append(filters, NewPrefixFilter("contextId", strings.Join(segments[:depth], "/")+"/")...)
+	}
+	return queryMessageEntries(a.messageStore, a.tenant, filters)
+}
+
+// recordAtPath returns the record at protocolPath among records, or nil.
+func recordAtPath(records []messageEntry, protocolPath string) *messageEntry {
+	for i := range records {
+		if records[i].descriptorStr("protocolPath") == protocolPath {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// fetchNewestWrite returns the newest RecordsWrite of a record, or nil if
+// there is none.
+func fetchNewestWrite(messageStore MessageStore, tenant Tenant, recordId string) (*messageEntry, error) {
+	writes, err := queryMessageEntries(messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("method", S(MethodWrite)),
+		NewEqualFilter("recordId", S(recordId)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newestMessage(writes), nil
+}
+
+// fetchAncestors returns the record parentId and its ancestors, root first.
+func fetchAncestors(messageStore MessageStore, tenant Tenant, parentId string) ([]messageEntry, error) {
+	var ancestors []messageEntry
+	for parentId != "" {
+		parent, err := fetchNewestWrite(messageStore, tenant, parentId)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, newStatusError(400, "parent record %s not found", parentId)
+		}
+		ancestors = append([]messageEntry{*parent}, ancestors...)
+		parentId = parent.descriptorStr("parentId")
+	}
+	return ancestors, nil
+}
+
+// signatureProtocolRole returns the protocolRole invoked in the payload of a
+// signature.
+func signatureProtocolRole(signature GeneralJws) (string, error) {
+	var payload utils.GenericSignaturePayload
+	if err := decodeSignaturePayload(signature, &payload); err != nil {
+		return "", err
+	}
+	return payload.ProtocolRole, nil
+}
+
+// validateTags checks the tags of a record against the `$tags` rules of its
+// protocol path.
+func validateTags(rules map[string]interface{}, tags map[string]interface{}) error {
+	if rules == nil {
+		return nil
+	}
+
+	required, _ := rules["$requiredTags"].([]interface{})
+	for _, name := range required {
+		if _, ok := tags[fmt.Sprint(name)]; !ok {
+			return fmt.Errorf("tag %v is required", name)
+		}
+	}
+
+	allowUndefined, _ := rules["$allowUndefinedTags"].(bool)
+	for name, value := range tags {
+		rule, ok := rules[name].(map[string]interface{})
+		if !ok {
+			if !allowUndefined {
+				return fmt.Errorf("tag %s is not allowed", name)
+			}
+			continue
+		}
+		if err := validateTagValue(rule, value); err != nil {
+			return fmt.Errorf("tag %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateTagValue(rule map[string]interface{}, value interface{}) error {
+	tagType, _ := rule["type"].(string)
+	switch tagType {
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v is not an array", value)
+		}
+		itemRule, _ := rule["items"].(map[string]interface{})
+		for _, item := range items {
+			if err := validateTagValue(itemRule, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%v is not a string", value)
+		}
+		if n, ok := rule["minLength"].(float64); ok && float64(len(s)) < n {
+			return fmt.Errorf("%q is shorter than %v", s, n)
+		}
+		if n, ok := rule["maxLength"].(float64); ok && float64(len(s)) > n {
+			return fmt.Errorf("%q is longer than %v", s, n)
+		}
+	case "number", "integer":
+		n, ok := value.(float64)
+		if !ok || (tagType == "integer" && n != float64(int64(n))) {
+			return fmt.Errorf("%v is not of type %s", value, tagType)
+		}
+		if min, ok := rule["minimum"].(float64); ok && n < min {
+			return fmt.Errorf("%v is below the minimum %v", n, min)
+		}
+		if max, ok := rule["maximum"].(float64); ok && n > max {
+			return fmt.Errorf("%v exceeds the maximum %v", n, max)
+		}
+		if min, ok := rule["exclusiveMinimum"].(float64); ok && n <= min {
+			return fmt.Errorf("%v must exceed %v", n, min)
+		}
+		if max, ok := rule["exclusiveMaximum"].(float64); ok && n >= max {
+			return fmt.Errorf("%v must be below %v", n, max)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%v is not a boolean", value)
+		}
+	}
+
+	if enum, ok := rule["enum"].([]interface{}); ok && !slices.Contains(enum, value) {
+		return fmt.Errorf("%v is not one of %v", value, enum)
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package dwn
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeToTenant sends a new RecordsWrite by author to the DWN of tenant and
+// returns the message along with the reply status code.
+func writeToTenant(t *testing.T, dwn *Dwn, tenant string, author _did.BearerDID,
+	opts testRecordsWrite) (map[string]interface{}, int) {
+	t.Helper()
+	message, data := newTestRecordsWrite(t, author, opts)
+	reply, err := dwn.ProcessMessage(tenant, message, bytes.NewReader(data))
+	require.NoError(t, err)
+	return message, reply.Status.Code
+}
+
+func processStatus(t *testing.T, dwn *Dwn, tenant string, message map[string]interface{}) int {
+	t.Helper()
+	reply, err := dwn.ProcessMessage(tenant, message, nil)
+	require.NoError(t, err)
+	return reply.Status.Code
+}
+
+func TestProtocolAuthorizationChat(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	carol := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	definition := loadTestProtocolDefinition(t, "chat.json")
+	configureTestProtocol(t, dwn, alice, definition)
+	protocol := definition["protocol"].(string)
+
+	thread, code := writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{
+		protocol: protocol, protocolPath: "thread", schema: "thread",
+	})
+	require.Equal(t, 202, code)
+
+	t.Run("anyone can write messages to a thread", func(t *testing.T) {
+		_, code := writeToTenant(t, dwn, alice.URI, carol, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread/message", schema: "message", parent: thread,
+		})
+		assert.Equal(t, 202, code)
+	})
+
+	t.Run("authors can update but others cannot", func(t *testing.T) {
+		_, code := writeToTenant(t, dwn, alice.URI, carol, testRecordsWrite{update: thread})
+		assert.Equal(t, 401, code)
+
+		_, code = writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{update: thread})
+		assert.Equal(t, 202, code)
+	})
+
+	t.Run("only the author and recipient of a thread can read it", func(t *testing.T) {
+		filter := map[string]interface{}{"recordId": thread["recordId"]}
+		assert.Equal(t, 200, processStatus(t, dwn, alice.URI, newTestRecordsRead(t, &bob, filter)))
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, newTestRecordsRead(t, &carol, filter)))
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, newTestRecordsRead(t, nil, filter)))
+	})
+
+	t.Run("enforces the structure of the protocol", func(t *testing.T) {
+		tests := []struct {
+			name string
+			opts testRecordsWrite
+		}{
+			{"unknown path", testRecordsWrite{protocol: protocol, protocolPath: "post", schema: "thread"}},
+			{"wrong schema", testRecordsWrite{protocol: protocol, protocolPath: "thread", schema: "message"}},
+			{"wrong dataFormat", testRecordsWrite{
+				protocol: protocol, protocolPath: "thread", schema: "thread", dataFormat: "text/plain",
+			}},
+			{"missing parent", testRecordsWrite{protocol: protocol, protocolPath: "thread/message", schema: "message"}},
+			{"wrong parent", testRecordsWrite{
+				protocol: protocol, protocolPath: "thread", schema: "thread", parent: thread,
+			}},
+			{"protocol not installed", testRecordsWrite{
+				protocol: "http://unknown.xyz", protocolPath: "thread", schema: "thread",
+			}},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				// The tenant is bound by the structure as much as anyone.
+				_, code := writeToTenant(t, dwn, alice.URI, alice, tc.opts)
+				assert.Equal(t, 400, code)
+			})
+		}
+	})
+}
+
+func TestProtocolAuthorizationSocialMedia(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	carol := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	definition := loadTestProtocolDefinition(t, "social-media.json")
+	configureTestProtocol(t, dwn, alice, definition)
+	protocol := definition["protocol"].(string)
+
+	t.Run("recipients of a message can reply", func(t *testing.T) {
+		message, code := writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{
+			protocol: protocol, protocolPath: "message", schema: "messageSchema",
+			dataFormat: "text/plain", recipient: carol.URI,
+		})
+		require.Equal(t, 202, code)
+
+		reply := testRecordsWrite{
+			protocol: protocol, protocolPath: "message/reply", schema: "replySchema",
+			dataFormat: "text/plain", parent: message,
+		}
+		_, code = writeToTenant(t, dwn, alice.URI, bob, reply)
+		assert.Equal(t, 401, code)
+		_, code = writeToTenant(t, dwn, alice.URI, carol, reply)
+		assert.Equal(t, 202, code)
+	})
+
+	t.Run("authors of an image can caption it", func(t *testing.T) {
+		image, code := writeToTenant(t, dwn, alice.URI, bob, testRecordsWrite{
+			protocol: protocol, protocolPath: "image", schema: "imageSchema", dataFormat: "image/jpeg",
+		})
+		require.Equal(t, 202, code)
+
+		caption := testRecordsWrite{
+			protocol: protocol, protocolPath: "image/caption", schema: "captionSchema",
+			dataFormat: "text/plain", parent: image,
+		}
+		_, code = writeToTenant(t, dwn, alice.URI, carol, caption)
+		assert.Equal(t, 401, code)
+		_, code = writeToTenant(t, dwn, alice.URI, bob, caption)
+		assert.Equal(t, 202, code)
+
+		// Anyone can read images, published or not.
+		filter := map[string]interface{}{"recordId": image["recordId"]}
+		assert.Equal(t, 200, processStatus(t, dwn, alice.URI, newTestRecordsRead(t, &carol, filter)))
+	})
+}
+
+func TestProtocolAuthorizationThreadRole(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	carol := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	definition := loadTestProtocolDefinition(t, "thread-role.json")
+	configureTestProtocol(t, dwn, alice, definition)
+	protocol := definition["protocol"].(string)
+
+	thread := writeTestRecord(t, dwn, alice, testRecordsWrite{protocol: protocol, protocolPath: "thread"})
+	otherThread := writeTestRecord(t, dwn, alice, testRecordsWrite{protocol: protocol, protocolPath: "thread"})
+	writeTestRecord(t, dwn, alice, testRecordsWrite{
+		protocol: protocol, protocolPath: "thread/participant", recipient: bob.URI, parent: thread,
+	})
+	writeTestRecord(t, dwn, alice, testRecordsWrite{
+		protocol: protocol, protocolPath: "globalAdmin", recipient: carol.URI,
+	})
+
+	chat := func(author _did.BearerDID, parent map[string]interface{}, protocolRole string) (map[string]interface{}, int) {
+		return writeToTenant(t, dwn, alice.URI, author, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread/chat", parent: parent, protocolRole: protocolRole,
+		})
+	}
+
+	bobsChat, code := chat(bob, thread, "thread/participant")
+	require.Equal(t, 202, code)
+
+	t.Run("roles must be invoked and held", func(t *testing.T) {
+		_, code := chat(bob, thread, "")
+		assert.Equal(t, 401, code)
+		_, code = chat(carol, thread, "thread/participant")
+		assert.Equal(t, 401, code)
+		_, code = chat(bob, thread, "thread/chat")
+		assert.Equal(t, 400, code)
+	})
+
+	t.Run("context roles apply only within their context", func(t *testing.T) {
+		_, code := chat(bob, otherThread, "thread/participant")
+		assert.Equal(t, 401, code)
+	})
+
+	t.Run("participants can read and query chats", func(t *testing.T) {
+		aliceChat := writeTestRecord(t, dwn, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread/chat", parent: thread,
+		})
+
+		read := newTestRecordsRead(t, &bob, map[string]interface{}{"recordId": aliceChat["recordId"]})
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, read))
+		read = withTestProtocolRole(t, bob, read, "thread/participant")
+		assert.Equal(t, 200, processStatus(t, dwn, alice.URI, read))
+
+		query := withTestProtocolRole(t, bob, newTestRecordsQuery(t, &bob, map[string]interface{}{
+			"protocol": protocol, "protocolPath": "thread/chat", "contextId": thread["contextId"],
+		}, nil), "thread/participant")
+		reply, err := dwn.ProcessMessage(alice.URI, query, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.ElementsMatch(t, []string{bobsChat["recordId"].(string), aliceChat["recordId"].(string)},
+			entryRecordIds(reply.Entries))
+
+		query = withTestProtocolRole(t, bob, newTestRecordsQuery(t, &bob, map[string]interface{}{
+			"protocol": protocol, "protocolPath": "thread/chat", "contextId": otherThread["contextId"],
+		}, nil), "thread/participant")
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, query))
+	})
+
+	t.Run("global admins can delete chats", func(t *testing.T) {
+		deleteChat := newTestRecordsDelete(t, carol, bobsChat["recordId"], false)
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, deleteChat))
+		deleteChat = withTestProtocolRole(t, carol, deleteChat, "globalAdmin")
+		assert.Equal(t, 202, processStatus(t, dwn, alice.URI, deleteChat))
+	})
+
+	t.Run("a recipient holds a role once per context", func(t *testing.T) {
+		_, code := writeToTenant(t, dwn, alice.URI, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread/participant", recipient: bob.URI, parent: thread,
+		})
+		assert.Equal(t, 400, code)
+		_, code = writeToTenant(t, dwn, alice.URI, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread/participant", recipient: bob.URI, parent: otherThread,
+		})
+		assert.Equal(t, 202, code)
+		_, code = writeToTenant(t, dwn, alice.URI, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread/participant", parent: otherThread,
+		})
+		assert.Equal(t, 400, code)
+	})
+}
+
+func TestProtocolAuthorizationDigitalTitle(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	carol := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	definition := loadTestProtocolDefinition(t, "digital-title.json")
+	configureTestProtocol(t, dwn, alice, definition)
+	protocol := definition["protocol"].(string)
+	schema := func(name string) string {
+		return "https://schemas.abaxx.tech/digital-title/schemas/" + name
+	}
+
+	_, code := writeToTenant(t, dwn, alice.URI, carol, testRecordsWrite{
+		protocol: protocol, protocolPath: "titleRecord", schema: schema("title-record"),
+	})
+	assert.Equal(t, 401, code)
+
+	title := writeTestRecord(t, dwn, alice, testRecordsWrite{
+		protocol: protocol, protocolPath: "titleRecord", schema: schema("title-record"), recipient: bob.URI,
+	})
+	request, code := writeToTenant(t, dwn, alice.URI, carol, testRecordsWrite{
+		protocol: protocol, protocolPath: "titleRecord/transferRequest", schema: schema("transfer-request"),
+		parent: title,
+	})
+	require.Equal(t, 202, code)
+
+	approval := testRecordsWrite{
+		protocol: protocol, protocolPath: "titleRecord/transferRequest/transferApproval",
+		schema: schema("transfer-approval"), parent: request,
+	}
+	_, code = writeToTenant(t, dwn, alice.URI, carol, approval)
+	assert.Equal(t, 401, code)
+	_, code = writeToTenant(t, dwn, alice.URI, bob, approval)
+	assert.Equal(t, 202, code)
+
+	_, code = writeToTenant(t, dwn, alice.URI, alice, testRecordsWrite{
+		protocol: protocol, protocolPath: "titleRecord/supportingDocument", schema: schema("supporting-document"),
+		dataFormat: "application/zip", parent: title,
+	})
+	assert.Equal(t, 400, code)
+}
+
+func TestProtocolAuthorizationSizeAndTags(t *testing.T) {
+	alice := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	var definition map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"protocol": "http://limits.xyz",
+		"published": true,
+		"types": {"note": {}},
+		"structure": {
+			"note": {
+				"$size": {"min": 2, "max": 16},
+				"$tags": {
+					"$requiredTags": ["status"],
+					"status": {"type": "string", "enum": ["draft", "final"]},
+					"priority": {"type": "integer", "minimum": 1}
+				}
+			}
+		}
+	}`), &definition))
+	configureTestProtocol(t, dwn, alice, definition)
+
+	tests := []struct {
+		name string
+		data string
+		tags map[string]interface{}
+		code int
+	}{
+		{"allowed", "a note", map[string]interface{}{"status": "draft", "priority": 2}, 202},
+		{"too small", "a", map[string]interface{}{"status": "draft"}, 400},
+		{"too large", "a note that is far too long", map[string]interface{}{"status": "draft"}, 400},
+		{"missing required tag", "a note", map[string]interface{}{"priority": 2}, 400},
+		{"value not in enum", "a note", map[string]interface{}{"status": "pending"}, 400},
+		{"below minimum", "a note", map[string]interface{}{"status": "final", "priority": 0}, 400},
+		{"not an integer", "a note", map[string]interface{}{"status": "final", "priority": 1.5}, 400},
+		{"undefined tag", "a note", map[string]interface{}{"status": "final", "color": "red"}, 400},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, code := writeToTenant(t, dwn, alice.URI, alice, testRecordsWrite{
+				protocol: "http://limits.xyz", protocolPath: "note", data: []byte(tc.data),
+				dataFormat: "text/plain", tags: tc.tags,
+			})
+			assert.Equal(t, tc.code, code)
+		})
+	}
+}
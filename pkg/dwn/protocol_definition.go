@@ -0,0 +1,328 @@
+package dwn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Actors an `$actions` rule can grant actions to.
+const (
+	ActorAnyone    = "anyone"
+	ActorAuthor    = "author"
+	ActorRecipient = "recipient"
+)
+
+// Actions an `$actions` rule can grant.
+const (
+	ActionCoDelete  = "co-delete"
+	ActionCoPrune   = "co-prune"
+	ActionCoUpdate  = "co-update"
+	ActionCreate    = "create"
+	ActionDelete    = "delete"
+	ActionPrune     = "prune"
+	ActionQuery     = "query"
+	ActionRead      = "read"
+	ActionSubscribe = "subscribe"
+	ActionUpdate    = "update"
+)
+
+// legacyActions maps the single-string `can` values of older protocol
+// definitions to the actions they allowed.
+var legacyActions = map[string][]string{
+	"write":  {ActionCreate, ActionUpdate},
+	"update": {ActionUpdate, ActionCoUpdate},
+	"delete": {ActionDelete, ActionCoDelete},
+}
+
+var actorActions = map[string]bool{
+	ActionCoDelete: true, ActionCoPrune: true, ActionCoUpdate: true, ActionCreate: true,
+	ActionDelete: true, ActionPrune: true, ActionRead: true, ActionUpdate: true,
+}
+
+var roleActions = map[string]bool{
+	ActionCoDelete: true, ActionCoUpdate: true, ActionCreate: true, ActionDelete: true,
+	ActionQuery: true, ActionSubscribe: true, ActionRead: true, ActionUpdate: true,
+}
+
+var tagTypes = map[string]bool{
+	"string": true, "number": true, "integer": true, "boolean": true, "array": true,
+}
+
+// ProtocolDefinition is the definition installed by ProtocolsConfigure.  See
+// protocol-definition.json.
+type ProtocolDefinition struct {
+	Protocol  string                     `json:"protocol"`
+	Published bool                       `json:"published"`
+	Types     map[string]ProtocolType    `json:"types"`
+	Structure map[string]ProtocolRuleSet `json:"structure"`
+}
+
+type ProtocolType struct {
+	Schema      string   `json:"schema,omitempty"`
+	DataFormats []string `json:"dataFormats,omitempty"`
+}
+
+// ProtocolRuleSet holds the rules for records at one protocol path, and the
+// rule sets of the record types nested below it.  See
+// protocol-rule-set.json.
+type ProtocolRuleSet struct {
+	Encryption map[string]interface{} `json:"$encryption,omitempty"`
+	Actions    []ProtocolAction       `json:"$actions,omitempty"`
+	Role       bool                   `json:"$role,omitempty"`
+	Size       *ProtocolSize          `json:"$size,omitempty"`
+	Tags       map[string]interface{} `json:"$tags,omitempty"`
+
+	Children map[string]ProtocolRuleSet `json:"-"`
+}
+
+type ProtocolAction struct {
+	Who  string   `json:"who,omitempty"`
+	Of   string   `json:"of,omitempty"`
+	Role string   `json:"role,omitempty"`
+	Can  []string `json:"can"`
+}
+
+type ProtocolSize struct {
+	Min *int64 `json:"min,omitempty"`
+	Max *int64 `json:"max,omitempty"`
+}
+
+// UnmarshalJSON reads the `$`-prefixed rules of a rule set, and every other
+// key as a nested rule set.  `$globalRole` and `$contextRole` of older
+// definitions are read as `$role`.
+func (r *ProtocolRuleSet) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*r = ProtocolRuleSet{}
+	for key, value := range raw {
+		var err error
+		switch key {
+		case "$encryption":
+			err = json.Unmarshal(value, &r.Encryption)
+		case "$actions":
+			err = json.Unmarshal(value, &r.Actions)
+		case "$role", "$globalRole", "$contextRole":
+			var role bool
+			err = json.Unmarshal(value, &role)
+			r.Role = r.Role || role
+		case "$size":
+			err = json.Unmarshal(value, &r.Size)
+		case "$tags":
+			err = json.Unmarshal(value, &r.Tags)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return fmt.Errorf("unknown rule %s", key)
+			}
+			var child ProtocolRuleSet
+			err = json.Unmarshal(value, &child)
+			if r.Children == nil {
+				r.Children = map[string]ProtocolRuleSet{}
+			}
+			r.Children[key] = child
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (r ProtocolRuleSet) MarshalJSON() ([]byte, error) {
+	type rules ProtocolRuleSet
+	encoded, err := json.Marshal(rules(r))
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(encoded, &raw); err != nil {
+		return nil, err
+	}
+	for key, child := range r.Children {
+		raw[key] = child
+	}
+	return json.Marshal(raw)
+}
+
+// UnmarshalJSON accepts `can` as a list of actions, or as the single action
+// string of older definitions.
+func (a *ProtocolAction) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Who  string          `json:"who"`
+		Of   string          `json:"of"`
+		Role string          `json:"role"`
+		Can  json.RawMessage `json:"can"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*a = ProtocolAction{Who: raw.Who, Of: raw.Of, Role: raw.Role}
+
+	var can string
+	if err := json.Unmarshal(raw.Can, &can); err == nil {
+		if actions, ok := legacyActions[can]; ok {
+			a.Can = append([]string{}, actions...)
+		} else {
+			a.Can = []string{can}
+		}
+		return nil
+	}
+	return json.Unmarshal(raw.Can, &a.Can)
+}
+
+// RuleSet returns the rule set at protocolPath, or nil if the path is not
+// part of the structure.
+func (d *ProtocolDefinition) RuleSet(protocolPath string) *ProtocolRuleSet {
+	ruleSets := d.Structure
+	var ruleSet *ProtocolRuleSet
+	for _, segment := range strings.Split(protocolPath, "/") {
+		next, ok := ruleSets[segment]
+		if !ok {
+			return nil
+		}
+		ruleSet = &next
+		ruleSets = next.Children
+	}
+	return ruleSet
+}
+
+// Validate checks the definition for consistency beyond its JSON schema:
+// every record type in the structure is declared, `$actions` refer to
+// existing protocol paths and roles, and `$size` and `$tags` are sound.
+func (d *ProtocolDefinition) Validate() error {
+	if d.Protocol == "" {
+		return errors.New("protocol is missing")
+	}
+	for name, t := range d.Types {
+		if t.DataFormats != nil && len(t.DataFormats) == 0 {
+			return fmt.Errorf("type %s: dataFormats must not be empty", name)
+		}
+	}
+	return d.validateRuleSets(d.Structure, "")
+}
+
+func (d *ProtocolDefinition) validateRuleSets(ruleSets map[string]ProtocolRuleSet, parentPath string) error {
+	// Validate in a stable order so the same definition always reports the
+	// same error.
+	names := make([]string, 0, len(ruleSets))
+	for name := range ruleSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		protocolPath := name
+		if parentPath != "" {
+			protocolPath = parentPath + "/" + name
+		}
+		if _, ok := d.Types[name]; !ok {
+			return fmt.Errorf("%s: record type %s is not declared in types", protocolPath, name)
+		}
+		ruleSet := ruleSets[name]
+		if err := d.validateRuleSet(ruleSet); err != nil {
+			return fmt.Errorf("%s: %w", protocolPath, err)
+		}
+		if err := d.validateRuleSets(ruleSet.Children, protocolPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *ProtocolDefinition) validateRuleSet(ruleSet ProtocolRuleSet) error {
+	for _, action := range ruleSet.Actions {
+		if err := d.validateAction(action); err != nil {
+			return err
+		}
+	}
+
+	if size := ruleSet.Size; size != nil {
+		if (size.Min != nil && *size.Min < 0) || (size.Max != nil && *size.Max < 0) {
+			return errors.New("$size must not be negative")
+		}
+		if size.Min != nil && size.Max != nil && *size.Min > *size.Max {
+			return errors.New("$size min must not exceed max")
+		}
+	}
+
+	return validateTagRules(ruleSet.Tags)
+}
+
+func (d *ProtocolDefinition) validateAction(action ProtocolAction) error {
+	if len(action.Can) == 0 {
+		return errors.New("$actions rule grants no actions")
+	}
+
+	allowed := actorActions
+	switch {
+	case action.Who != "" && action.Role != "":
+		return errors.New("$actions rule may have either who or role, not both")
+	case action.Role != "":
+		allowed = roleActions
+		ruleSet := d.RuleSet(action.Role)
+		if ruleSet == nil || !ruleSet.Role {
+			return fmt.Errorf("role %s is not a role record", action.Role)
+		}
+	case action.Who == ActorAnyone:
+		if action.Of != "" {
+			return errors.New("`of` is not allowed for who: anyone")
+		}
+	case action.Who == ActorAuthor || action.Who == ActorRecipient:
+		if action.Of != "" && d.RuleSet(action.Of) == nil {
+			return fmt.Errorf("`of` %s is not a protocol path", action.Of)
+		}
+	default:
+		return fmt.Errorf("unknown actor %q", action.Who)
+	}
+
+	for _, can := range action.Can {
+		if !allowed[can] {
+			return fmt.Errorf("action %q is not allowed here", can)
+		}
+	}
+	return nil
+}
+
+func validateTagRules(tags map[string]interface{}) error {
+	if tags == nil {
+		return nil
+	}
+
+	allowUndefined, _ := tags["$allowUndefinedTags"].(bool)
+	if required, ok := tags["$requiredTags"]; ok {
+		names, ok := required.([]interface{})
+		if !ok {
+			return errors.New("$requiredTags must be a list")
+		}
+		for _, name := range names {
+			tagName, ok := name.(string)
+			if !ok {
+				return errors.New("$requiredTags must be a list of tag names")
+			}
+			if _, defined := tags[tagName]; !defined && !allowUndefined {
+				return fmt.Errorf("required tag %s is not defined", tagName)
+			}
+		}
+	}
+
+	for name, rule := range tags {
+		if strings.HasPrefix(name, "$") {
+			continue
+		}
+		tagRule, ok := rule.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("tag %s: rule must be an object", name)
+		}
+		if tagType, ok := tagRule["type"]; ok {
+			if s, _ := tagType.(string); !tagTypes[s] {
+				return fmt.Errorf("tag %s: unknown type %v", name, tagType)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package dwn
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseTestProtocolDefinition(t *testing.T, definition map[string]interface{}) ProtocolDefinition {
+	t.Helper()
+	encoded, err := json.Marshal(definition)
+	require.NoError(t, err)
+	var parsed ProtocolDefinition
+	require.NoError(t, json.Unmarshal(encoded, &parsed))
+	return parsed
+}
+
+func TestProtocolDefinitionFixturesAreValid(t *testing.T) {
+	files, err := os.ReadDir(filepath.Join("..", "..", "json-schemas", "protocol-definitions"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(file.Name(), func(t *testing.T) {
+			definition := parseTestProtocolDefinition(t, loadTestProtocolDefinition(t, file.Name()))
+			if reason, ok := invalidTestProtocolDefinitions[file.Name()]; ok {
+				assert.ErrorContains(t, definition.Validate(), reason)
+				return
+			}
+			assert.NoError(t, definition.Validate())
+		})
+	}
+}
+
+// invalidTestProtocolDefinitions are the fixtures that fail validation as
+// they are published, with the reason.
+var invalidTestProtocolDefinitions = map[string]string{
+	// structure.fan has no entry in types
+	"friend-role.json": "record type fan is not declared",
+}
+
+// friendRoleProtocolDefinition is friend-role.json with the fan type it
+// leaves out declared.
+const friendRoleProtocolDefinition = `{
+	"protocol": "http://minimal.xyz",
+	"published": false,
+	"types": {"friend": {}, "fan": {}, "admin": {}, "chat": {}},
+	"structure": {
+		"admin": {"$globalRole": true},
+		"friend": {"$globalRole": true},
+		"fan": {"$globalRole": true},
+		"chat": {"$actions": [
+			{"role": "fan", "can": "read"},
+			{"role": "friend", "can": "write"},
+			{"role": "friend", "can": "read"},
+			{"role": "friend", "can": "query"},
+			{"role": "admin", "can": "update"},
+			{"role": "admin", "can": "delete"}
+		]}
+	}
+}`
+
+func TestProtocolDefinitionGlobalRoles(t *testing.T) {
+	var definition ProtocolDefinition
+	require.NoError(t, json.Unmarshal([]byte(friendRoleProtocolDefinition), &definition))
+	require.NoError(t, definition.Validate())
+
+	for _, role := range []string{"admin", "friend", "fan"} {
+		assert.True(t, definition.RuleSet(role).Role, role)
+	}
+	chat := definition.RuleSet("chat")
+	require.NotNil(t, chat)
+	assert.Equal(t, ProtocolAction{Role: "fan", Can: []string{ActionRead}}, chat.Actions[0])
+	assert.Equal(t, []string{ActionCreate, ActionUpdate}, chat.Actions[1].Can)
+	assert.Equal(t, []string{ActionUpdate, ActionCoUpdate}, chat.Actions[4].Can)
+}
+
+func TestProtocolDefinitionLegacyRules(t *testing.T) {
+	definition := parseTestProtocolDefinition(t, loadTestProtocolDefinition(t, "thread-role.json"))
+
+	participant := definition.RuleSet("thread/participant")
+	require.NotNil(t, participant)
+	assert.True(t, participant.Role)
+	assert.Equal(t, []string{ActionCreate, ActionUpdate}, participant.Actions[1].Can)
+
+	chat := definition.RuleSet("thread/chat")
+	require.NotNil(t, chat)
+	assert.Equal(t, []string{ActionDelete, ActionCoDelete}, chat.Actions[4].Can)
+
+	assert.True(t, definition.RuleSet("globalAdmin").Role)
+	assert.Nil(t, definition.RuleSet("thread/unknown"))
+}
+
+func TestProtocolDefinitionValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+	}{
+		{"undeclared type", `{"protocol": "p", "published": true, "types": {},
+			"structure": {"post": {}}}`},
+		{"unknown actor", `{"protocol": "p", "published": true, "types": {"post": {}},
+			"structure": {"post": {"$actions": [{"who": "someone", "can": ["read"]}]}}}`},
+		{"anyone of", `{"protocol": "p", "published": true, "types": {"post": {}},
+			"structure": {"post": {"$actions": [{"who": "anyone", "of": "post", "can": ["read"]}]}}}`},
+		{"of unknown path", `{"protocol": "p", "published": true, "types": {"post": {}},
+			"structure": {"post": {"$actions": [{"who": "author", "of": "comment", "can": ["read"]}]}}}`},
+		{"role not a role record", `{"protocol": "p", "published": true, "types": {"post": {}, "friend": {}},
+			"structure": {"friend": {}, "post": {"$actions": [{"role": "friend", "can": ["read"]}]}}}`},
+		{"role only action", `{"protocol": "p", "published": true, "types": {"post": {}},
+			"structure": {"post": {"$actions": [{"who": "anyone", "can": ["query"]}]}}}`},
+		{"size bounds", `{"protocol": "p", "published": true, "types": {"post": {}},
+			"structure": {"post": {"$size": {"min": 10, "max": 1}}}}`},
+		{"required tag undefined", `{"protocol": "p", "published": true, "types": {"post": {}},
+			"structure": {"post": {"$tags": {"$requiredTags": ["status"]}}}}`},
+		{"tag type", `{"protocol": "p", "published": true, "types": {"post": {}},
+			"structure": {"post": {"$tags": {"status": {"type": "date"}}}}}`},
+		{"empty dataFormats", `{"protocol": "p", "published": true, "types": {"post": {"dataFormats": []}},
+			"structure": {"post": {}}}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var definition ProtocolDefinition
+			require.NoError(t, json.Unmarshal([]byte(tc.definition), &definition))
+			assert.Error(t, definition.Validate())
+		})
+	}
+}
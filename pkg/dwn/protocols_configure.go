@@ -0,0 +1,148 @@
+package dwn
+
+type ProtocolsConfigureHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	dataStore    DataStore
+	eventLog     EventLog
+	eventStream  EventStream
+}
+
+func NewProtocolsConfigureHandler(didResolver *DidResolver, messageStore MessageStore,
+	dataStore DataStore, eventLog EventLog, eventStream EventStream) MethodHandler {
+	return &ProtocolsConfigureHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		dataStore:    dataStore,
+		eventLog:     eventLog,
+		eventStream:  eventStream,
+	}
+}
+
+func (h *ProtocolsConfigureHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	if err := h.configure(Tenant(request.Tenant), request.Message); err != nil {
+		return replyFromError(err)
+	}
+	return UnionMessageReply{Status: Status{Code: 202}}, nil
+}
+
+func (h *ProtocolsConfigureHandler) configure(tenant Tenant, rawMessage map[string]interface{}) error {
+	var message ProtocolsConfigure
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceProtocols || descriptor.Method != MethodConfigure {
+		return newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceProtocols, MethodConfigure, descriptor.Interface, descriptor.Method)
+	}
+	author, err := messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	if err := descriptor.Definition.Validate(); err != nil {
+		return newStatusError(400, "invalid protocol definition: %w", err)
+	}
+	if descriptor.Definition.Protocol == PermissionsProtocolUri {
+		return newStatusError(400, "protocol %s is built in", PermissionsProtocolUri)
+	}
+
+	action := grantedAction{
+		Interface:        InterfaceProtocols,
+		Method:           MethodConfigure,
+		MessageTimestamp: descriptor.MessageTimestamp,
+		Protocol:         descriptor.Definition.Protocol,
+	}
+	if grant := rawDelegatedGrant(rawMessage, "authorDelegatedGrant"); grant != nil {
+		if err := verifyDelegatedGrant(h.messageStore, tenant, message.Authorization.Signature, grant, action); err != nil {
+			return err
+		}
+	}
+	if author != string(tenant) {
+		grantId, err := signaturePermissionGrantId(message.Authorization.Signature)
+		if err != nil {
+			return err
+		}
+		if grantId == "" {
+			return newStatusError(401, "%s is not authorized to configure protocols of tenant %s", author, tenant)
+		}
+		if err := verifyPermissionGrant(h.messageStore, tenant, author, grantId, action); err != nil {
+			return err
+		}
+	}
+
+	incoming := messageEntry{Message: rawMessage}
+	if incoming.Cid, err = computeMessageCid(rawMessage); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+
+	existing, err := queryMessageEntries(h.messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfaceProtocols)),
+		NewEqualFilter("method", S(MethodConfigure)),
+		NewEqualFilter("protocol", S(descriptor.Definition.Protocol)),
+	})
+	if err != nil {
+		return err
+	}
+	if newest := newestMessage(existing); newest != nil && !incoming.isNewerThan(*newest) {
+		return newStatusError(409, "a newer or identical configuration of protocol %s already exists",
+			descriptor.Definition.Protocol)
+	}
+
+	indexes := IndexableKeyValues{
+		"interface":        S(descriptor.Interface),
+		"method":           S(descriptor.Method),
+		"protocol":         S(descriptor.Definition.Protocol),
+		"published":        B(descriptor.Definition.Published),
+		"author":           S(author),
+		"messageTimestamp": S(descriptor.MessageTimestamp),
+	}
+	if err := h.messageStore.Put(tenant, rawMessage, indexes); err != nil {
+		return err
+	}
+	if err := h.eventLog.Append(tenant, incoming.Cid, indexes); err != nil {
+		return err
+	}
+	emitEvent(h.eventStream, tenant, MessageEvent{Message: rawMessage}, indexes)
+
+	// Only the newest configuration of a protocol is kept.
+	deleted := make([]MessageCid, 0, len(existing))
+	for _, entry := range existing {
+		if err := h.messageStore.Delete(tenant, entry.Cid); err != nil {
+			return err
+		}
+		deleted = append(deleted, entry.Cid)
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	return h.eventLog.DeleteEventsByCid(tenant, deleted)
+}
+
+// fetchProtocolDefinition returns the installed definition of a protocol, or
+// nil if the tenant has not configured it.  The permissions protocol is
+// always installed.
+func fetchProtocolDefinition(messageStore MessageStore, tenant Tenant, protocol string) (*ProtocolDefinition, error) {
+	if protocol == PermissionsProtocolUri {
+		definition := permissionsProtocolDefinition
+		return &definition, nil
+	}
+	configurations, err := queryMessageEntries(messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfaceProtocols)),
+		NewEqualFilter("method", S(MethodConfigure)),
+		NewEqualFilter("protocol", S(protocol)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	newest := newestMessage(configurations)
+	if newest == nil {
+		return nil, nil
+	}
+
+	var message ProtocolsConfigure
+	if err := parseMessage(newest.Message, &message); err != nil {
+		return nil, err
+	}
+	return &message.Descriptor.Definition, nil
+}
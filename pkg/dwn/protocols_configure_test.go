@@ -0,0 +1,180 @@
+package dwn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocolsConfigure(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+
+	t.Run("installs the digital title protocol", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		definition := loadTestProtocolDefinition(t, "digital-title.json")
+		configureTestProtocol(t, dwn, alice, definition)
+
+		installed, err := fetchProtocolDefinition(dwn.messageStore, Tenant(alice.URI), definition["protocol"].(string))
+		require.NoError(t, err)
+		require.NotNil(t, installed)
+		assert.NotNil(t, installed.RuleSet("titleRecord/transferRequest/transferApproval"))
+	})
+
+	t.Run("newest configuration wins", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		definition := loadTestProtocolDefinition(t, "chat.json")
+		older := newTestProtocolsConfigure(t, alice, definition)
+		definition["published"] = false
+		newer := newTestProtocolsConfigure(t, alice, definition)
+
+		reply, err := dwn.ProcessMessage(alice.URI, newer, nil)
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI, older, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 409, reply.Status.Code)
+
+		newest := newTestProtocolsConfigure(t, alice, loadTestProtocolDefinition(t, "chat.json"))
+		reply, err = dwn.ProcessMessage(alice.URI, newest, nil)
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI, newTestMessage(t, &alice, InterfaceProtocols, MethodQuery, nil), nil)
+		require.NoError(t, err)
+		require.Len(t, reply.Entries, 1)
+		assert.Equal(t, newest["descriptor"], reply.Entries[0]["descriptor"])
+
+		events, err := dwn.eventLog.GetEvents(Tenant(alice.URI))
+		require.NoError(t, err)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("rejects invalid definitions", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		definition := loadTestProtocolDefinition(t, "chat.json")
+		delete(definition["types"].(map[string]interface{}), "message")
+
+		reply, err := dwn.ProcessMessage(alice.URI, newTestProtocolsConfigure(t, alice, definition), nil)
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+
+		definition = loadTestProtocolDefinition(t, "chat.json")
+		definition["protocol"] = PermissionsProtocolUri
+		reply, err = dwn.ProcessMessage(alice.URI, newTestProtocolsConfigure(t, alice, definition), nil)
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+
+	t.Run("rejects configuration by others", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		reply, err := dwn.ProcessMessage(alice.URI,
+			newTestProtocolsConfigure(t, bob, loadTestProtocolDefinition(t, "chat.json")), nil)
+		require.NoError(t, err)
+		assert.Equal(t, 401, reply.Status.Code)
+	})
+
+	t.Run("accepts configuration under a grant", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		definition := loadTestProtocolDefinition(t, "chat.json")
+		grantId := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceProtocols, "method": MethodConfigure, "protocol": definition["protocol"],
+		}, nil)
+		configure := withTestPermissionGrant(t, bob, newTestProtocolsConfigure(t, bob, definition), grantId)
+		assert.Equal(t, 202, processStatus(t, dwn, alice.URI, configure))
+
+		otherGrantId := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceProtocols, "method": MethodConfigure, "protocol": "http://other-protocol.xyz",
+		}, nil)
+		configure = withTestPermissionGrant(t, bob, newTestProtocolsConfigure(t, bob, definition), otherGrantId)
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, configure))
+	})
+
+	t.Run("accepts configuration by a delegate", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		app := newTestPersona(t)
+		definition := loadTestProtocolDefinition(t, "chat.json")
+		grant := newTestDelegatedGrant(t, alice, app, map[string]interface{}{
+			"interface": InterfaceProtocols, "method": MethodConfigure,
+		}, nil)
+		configure := withTestDelegatedGrant(t, app, newTestProtocolsConfigure(t, app, definition), grant)
+		require.Equal(t, 202, processStatus(t, dwn, alice.URI, configure))
+
+		entries, err := queryMessageEntries(dwn.messageStore, Tenant(alice.URI), []Filter{
+			NewEqualFilter("protocol", S(definition["protocol"].(string))),
+			NewEqualFilter("author", S(alice.URI)),
+		})
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		queryGrant := newTestDelegatedGrant(t, alice, app, map[string]interface{}{
+			"interface": InterfaceProtocols, "method": MethodQuery,
+		}, nil)
+		configure = withTestDelegatedGrant(t, app, newTestProtocolsConfigure(t, app, definition), queryGrant)
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI, configure))
+	})
+}
+
+func TestProtocolsQuery(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+
+	dwn := NewTestDwn(t)
+	configureTestProtocol(t, dwn, alice, loadTestProtocolDefinition(t, "chat.json"))
+	configureTestProtocol(t, dwn, alice, loadTestProtocolDefinition(t, "private-protocol.json"))
+
+	protocols := func(t *testing.T, message map[string]interface{}) []string {
+		t.Helper()
+		reply, err := dwn.ProcessMessage(alice.URI, message, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		names := []string{}
+		for _, entry := range reply.Entries {
+			names = append(names, getPathedStrNoErr(entry, "descriptor", "definition", "protocol"))
+		}
+		return names
+	}
+
+	t.Run("owner sees all protocols", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{"http://chat-protocol.xyz", "http://private-protocol.xyz"},
+			protocols(t, newTestMessage(t, &alice, InterfaceProtocols, MethodQuery, nil)))
+	})
+
+	t.Run("others see published protocols", func(t *testing.T) {
+		assert.Equal(t, []string{"http://chat-protocol.xyz"},
+			protocols(t, newTestMessage(t, &bob, InterfaceProtocols, MethodQuery, nil)))
+		assert.Equal(t, []string{"http://chat-protocol.xyz"},
+			protocols(t, newTestMessage(t, nil, InterfaceProtocols, MethodQuery, nil)))
+	})
+
+	t.Run("filters by protocol", func(t *testing.T) {
+		assert.Equal(t, []string{"http://private-protocol.xyz"},
+			protocols(t, newTestMessage(t, &alice, InterfaceProtocols, MethodQuery, map[string]interface{}{
+				"filter": map[string]interface{}{"protocol": "http://private-protocol.xyz"},
+			})))
+	})
+	t.Run("grant holders see unpublished protocols", func(t *testing.T) {
+		grantId := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceProtocols, "method": MethodQuery,
+		}, nil)
+		assert.ElementsMatch(t, []string{"http://chat-protocol.xyz", "http://private-protocol.xyz"},
+			protocols(t, withTestPermissionGrant(t, bob, newTestMessage(t, &bob, InterfaceProtocols, MethodQuery, nil), grantId)))
+
+		configureGrantId := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceProtocols, "method": MethodConfigure,
+		}, nil)
+		assert.Equal(t, 401, processStatus(t, dwn, alice.URI,
+			withTestPermissionGrant(t, bob, newTestMessage(t, &bob, InterfaceProtocols, MethodQuery, nil), configureGrantId)))
+	})
+
+	t.Run("delegates see unpublished protocols", func(t *testing.T) {
+		app := newTestPersona(t)
+		grant := newTestDelegatedGrant(t, alice, app, map[string]interface{}{
+			"interface": InterfaceProtocols, "method": MethodQuery,
+		}, nil)
+		assert.ElementsMatch(t, []string{"http://chat-protocol.xyz", "http://private-protocol.xyz"},
+			protocols(t, withTestDelegatedGrant(t, app, newTestMessage(t, &app, InterfaceProtocols, MethodQuery, nil), grant)))
+	})
+}
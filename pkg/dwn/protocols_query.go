@@ -0,0 +1,105 @@
+package dwn
+
+type ProtocolsQueryHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	dataStore    DataStore
+}
+
+func NewProtocolsQueryHandler(didResolver *DidResolver, messageStore MessageStore, dataStore DataStore) MethodHandler {
+	return &ProtocolsQueryHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		dataStore:    dataStore,
+	}
+}
+
+func (h *ProtocolsQueryHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	reply, err := h.query(Tenant(request.Tenant), request.Message)
+	if err != nil {
+		return replyFromError(err)
+	}
+	return reply, nil
+}
+
+func (h *ProtocolsQueryHandler) query(tenant Tenant, rawMessage map[string]interface{}) (UnionMessageReply, error) {
+	var message ProtocolsQuery
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceProtocols || descriptor.Method != MethodQuery {
+		return UnionMessageReply{}, newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceProtocols, MethodQuery, descriptor.Interface, descriptor.Method)
+	}
+
+	var protocol string
+	if descriptor.Filter != nil {
+		protocol = descriptor.Filter.Protocol
+	}
+
+	// Anyone may query the published protocols of a tenant; only the tenant
+	// and holders of a grant to query them see the unpublished ones.
+	allowed := false
+	if message.Authorization != nil {
+		var err error
+		if allowed, err = h.authorizeQuery(tenant, rawMessage, message, protocol); err != nil {
+			return UnionMessageReply{}, err
+		}
+	}
+
+	filters := []Filter{
+		NewEqualFilter("interface", S(InterfaceProtocols)),
+		NewEqualFilter("method", S(MethodConfigure)),
+	}
+	if protocol != "" {
+		filters = append(filters, NewEqualFilter("protocol", S(protocol)))
+	}
+	if !allowed {
+		filters = append(filters, NewEqualFilter("published", B(true)))
+	}
+
+	entries, err := queryMessageEntries(h.messageStore, tenant, filters)
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+
+	reply := UnionMessageReply{Status: Status{Code: 200}, Entries: make([]map[string]interface{}, 0, len(entries))}
+	for _, entry := range entries {
+		reply.Entries = append(reply.Entries, entry.Message)
+	}
+	return reply, nil
+}
+
+// authorizeQuery reports whether the requester of a signed query may see the
+// unpublished protocols of tenant: the tenant may, directly or through a
+// delegated grant, and so may the holder of a grant for ProtocolsQuery.
+func (h *ProtocolsQueryHandler) authorizeQuery(tenant Tenant, rawMessage map[string]interface{},
+	message ProtocolsQuery, protocol string) (bool, error) {
+	requester, err := messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+	if err != nil {
+		return false, &statusError{Code: 400, Err: err}
+	}
+	action := grantedAction{
+		Interface:        InterfaceProtocols,
+		Method:           MethodQuery,
+		MessageTimestamp: message.Descriptor.MessageTimestamp,
+		Protocol:         protocol,
+	}
+	if grant := rawDelegatedGrant(rawMessage, "authorDelegatedGrant"); grant != nil {
+		if err := verifyDelegatedGrant(h.messageStore, tenant, message.Authorization.Signature, grant, action); err != nil {
+			return false, err
+		}
+	}
+	if requester == string(tenant) {
+		return true, nil
+	}
+	grantId, err := signaturePermissionGrantId(message.Authorization.Signature)
+	if err != nil || grantId == "" {
+		return false, err
+	}
+	if err := verifyPermissionGrant(h.messageStore, tenant, requester, grantId, action); err != nil {
+		return false, err
+	}
+	return true, nil
+}
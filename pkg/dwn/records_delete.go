@@ -0,0 +1,267 @@
+package dwn
+
+import (
+	"fmt"
+)
+
+// recordsDeleteIndexedProperties are copied from the initial write of a
+// record into the indexes of its RecordsDelete, so that the tombstone can be
+// found by the same filters as the record.
+var recordsDeleteIndexedProperties = []string{
+	"protocol", "protocolPath", "recipient", "schema", "parentId", "dataFormat", "dateCreated", "contextId",
+}
+
+type RecordsDeleteHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	dataStore    DataStore
+	eventLog     EventLog
+	eventStream  EventStream
+}
+
+func NewRecordsDeleteHandler(didResolver *DidResolver, messageStore MessageStore,
+	dataStore DataStore, eventLog EventLog, eventStream EventStream) MethodHandler {
+	return &RecordsDeleteHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		dataStore:    dataStore,
+		eventLog:     eventLog,
+		eventStream:  eventStream,
+	}
+}
+
+func (h *RecordsDeleteHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	if err := h.delete(Tenant(request.Tenant), request.Message); err != nil {
+		return replyFromError(err)
+	}
+	return UnionMessageReply{Status: Status{Code: 202}}, nil
+}
+
+func (h *RecordsDeleteHandler) delete(tenant Tenant, rawMessage map[string]interface{}) error {
+	var message RecordsDelete
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceRecords || descriptor.Method != MethodDelete {
+		return newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceRecords, MethodDelete, descriptor.Interface, descriptor.Method)
+	}
+	if descriptor.RecordId == "" {
+		return newStatusError(400, "recordId is missing")
+	}
+	author, err := messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+
+	incoming := messageEntry{Message: rawMessage}
+	if incoming.Cid, err = computeMessageCid(rawMessage); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+
+	existing, err := queryMessageEntries(h.messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("recordId", S(descriptor.RecordId)),
+	})
+	if err != nil {
+		return err
+	}
+	newest := newestMessage(existing)
+	if newest == nil || newest.interfaceMethod() == InterfaceRecords+MethodDelete {
+		return newStatusError(404, "record %s not found", descriptor.RecordId)
+	}
+
+	action := grantedAction{
+		Interface:        InterfaceRecords,
+		Method:           MethodDelete,
+		MessageTimestamp: descriptor.MessageTimestamp,
+		Protocol:         newest.descriptorStr("protocol"),
+		ContextId:        getPathedStrNoErr(newest.Message, "contextId"),
+		ProtocolPath:     newest.descriptorStr("protocolPath"),
+	}
+	if grant := rawDelegatedGrant(rawMessage, "authorDelegatedGrant"); grant != nil {
+		if err := verifyDelegatedGrant(h.messageStore, tenant, message.Authorization.Signature, grant, action); err != nil {
+			return err
+		}
+	}
+	if author != string(tenant) {
+		grantId, err := signaturePermissionGrantId(message.Authorization.Signature)
+		if err != nil {
+			return err
+		}
+		if grantId != "" {
+			err = verifyPermissionGrant(h.messageStore, tenant, author, grantId, action)
+		} else {
+			err = h.authorizeProtocolDelete(tenant, author, &message, *newest)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !incoming.isNewerThan(*newest) {
+		return newStatusError(409, "a newer or identical message for record %s already exists", descriptor.RecordId)
+	}
+
+	initialWrite, err := findInitialWrite(existing)
+	if err != nil {
+		return err
+	}
+	if initialWrite == nil {
+		return fmt.Errorf("initial write for record %s not found", descriptor.RecordId)
+	}
+
+	indexes := IndexableKeyValues{
+		"interface":         S(descriptor.Interface),
+		"method":            S(descriptor.Method),
+		"recordId":          S(descriptor.RecordId),
+		"author":            S(author),
+		"messageTimestamp":  S(descriptor.MessageTimestamp),
+		"isLatestBaseState": B(true),
+	}
+	for _, property := range recordsDeleteIndexedProperties {
+		var value string
+		if property == "contextId" {
+			value = getPathedStrNoErr(initialWrite.Message, property)
+		} else {
+			value = initialWrite.descriptorStr(property)
+		}
+		if value != "" {
+			indexes[property] = S(value)
+		}
+	}
+
+	if err := h.messageStore.Put(tenant, rawMessage, indexes); err != nil {
+		return err
+	}
+	if err := h.eventLog.Append(tenant, incoming.Cid, indexes); err != nil {
+		return err
+	}
+	emitEvent(h.eventStream, tenant, MessageEvent{Message: rawMessage, InitialWrite: initialWrite.Message}, indexes)
+
+	if descriptor.Prune {
+		if err := h.purgeDescendants(tenant, descriptor.RecordId); err != nil {
+			return err
+		}
+	}
+
+	return deleteOlderWrites(h.messageStore, h.dataStore, h.eventLog, tenant, existing)
+}
+
+// authorizeProtocolDelete lets someone other than the tenant delete a
+// protocol record if an `$actions` rule of its protocol allows it: delete or
+// prune for records they wrote, co-delete or co-prune for any record.
+func (h *RecordsDeleteHandler) authorizeProtocolDelete(tenant Tenant, author string, message *RecordsDelete,
+	record messageEntry) error {
+	recordId := message.Descriptor.RecordId
+	denied := newStatusError(401, "%s is not authorized to delete record %s of tenant %s", author, recordId, tenant)
+	protocol := record.descriptorStr("protocol")
+	if protocol == "" {
+		return denied
+	}
+	authorizer, err := newProtocolAuthorizer(h.messageStore, tenant, protocol)
+	if err != nil {
+		return err
+	}
+	if authorizer == nil {
+		return denied
+	}
+
+	protocolRole, err := signatureProtocolRole(message.Authorization.Signature)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	recordAuthor, err := record.author()
+	if err != nil {
+		return err
+	}
+	actions := []string{ActionCoDelete}
+	if recordAuthor == author {
+		actions = append(actions, ActionDelete)
+	}
+	if message.Descriptor.Prune {
+		actions = []string{ActionCoPrune}
+		if recordAuthor == author {
+			actions = append(actions, ActionPrune)
+		}
+	}
+
+	ancestors, err := fetchAncestors(h.messageStore, tenant, record.descriptorStr("parentId"))
+	if err != nil {
+		return err
+	}
+	return authorizer.authorize(protocolRequest{
+		Requester:    author,
+		ProtocolRole: protocolRole,
+		ProtocolPath: record.descriptorStr("protocolPath"),
+		ContextId:    getPathedStrNoErr(record.Message, "contextId"),
+		Records:      append(ancestors, record),
+		Actions:      actions,
+	})
+}
+
+// purgeDescendants removes every record below recordId in its protocol tree,
+// along with their data and events.  Unlike the pruned record itself, no
+// tombstones are kept for them.
+func (h *RecordsDeleteHandler) purgeDescendants(tenant Tenant, recordId string) error {
+	children, err := queryMessageEntries(h.messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("parentId", S(recordId)),
+	})
+	if err != nil {
+		return err
+	}
+
+	purged := map[string]bool{}
+	for _, child := range children {
+		childId := getPathedStrNoErr(child.Message, "recordId")
+		if childId == "" {
+			childId = child.descriptorStr("recordId")
+		}
+		if purged[childId] {
+			continue
+		}
+		purged[childId] = true
+
+		if err := h.purgeDescendants(tenant, childId); err != nil {
+			return err
+		}
+		if err := h.purgeRecord(tenant, childId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeRecord removes all messages of a record, their data and their events.
+func (h *RecordsDeleteHandler) purgeRecord(tenant Tenant, recordId string) error {
+	messages, err := queryMessageEntries(h.messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("recordId", S(recordId)),
+	})
+	if err != nil {
+		return err
+	}
+
+	deleted := make([]MessageCid, 0, len(messages))
+	for _, entry := range messages {
+		if entry.interfaceMethod() == InterfaceRecords+MethodWrite {
+			if _, ok := entry.Message["encodedData"]; !ok {
+				dataCid := DataCid(entry.descriptorStr("dataCid"))
+				if err := h.dataStore.Delete(tenant, entry.Cid, dataCid); err != nil {
+					return err
+				}
+			}
+		}
+		if err := h.messageStore.Delete(tenant, entry.Cid); err != nil {
+			return err
+		}
+		deleted = append(deleted, entry.Cid)
+	}
+
+	if len(deleted) == 0 {
+		return nil
+	}
+	return h.eventLog.DeleteEventsByCid(tenant, deleted)
+}
@@ -0,0 +1,143 @@
+package dwn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordsDelete(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+
+	deleteRecord := func(t *testing.T, dwn *Dwn, message map[string]interface{}) int {
+		t.Helper()
+		reply, err := dwn.ProcessMessage(alice.URI, message, nil)
+		require.NoError(t, err)
+		return reply.Status.Code
+	}
+
+	t.Run("deletes a record and its data", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		data := bytes.Repeat([]byte("d"), MaxEncodedDataSize+1)
+		initial, _ := newTestRecordsWrite(t, alice, testRecordsWrite{data: data})
+		reply, err := dwn.ProcessMessage(alice.URI, initial, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+		update := writeTestRecord(t, dwn, alice, testRecordsWrite{update: initial, data: data})
+
+		assert.Equal(t, 202, deleteRecord(t, dwn, newTestRecordsDelete(t, alice, initial["recordId"], false)))
+
+		entries := queryRecord(t, dwn, alice.URI, initial["recordId"].(string))
+		methods := []string{}
+		for _, entry := range entries {
+			methods = append(methods, entry.descriptorStr("method"))
+		}
+		assert.ElementsMatch(t, []string{MethodWrite, MethodDelete}, methods)
+
+		updateCid, err := computeMessageCid(update)
+		require.NoError(t, err)
+		dataCid := DataCid(update["descriptor"].(map[string]interface{})["dataCid"].(string))
+		_, _, stream, err := dwn.dataStore.Get(Tenant(alice.URI), updateCid, dataCid)
+		require.NoError(t, err)
+		assert.Nil(t, stream)
+		assert.Empty(t, dwn.dataStore.(*MemoryDatastore).data)
+
+		events, err := dwn.eventLog.GetEvents(Tenant(alice.URI))
+		require.NoError(t, err)
+		assert.Len(t, events, 2)
+		assert.NotContains(t, events, string(updateCid))
+
+		reply, err = dwn.ProcessMessage(alice.URI,
+			newTestRecordsRead(t, &alice, map[string]interface{}{"recordId": initial["recordId"]}), nil)
+		require.NoError(t, err)
+		assert.Equal(t, 404, reply.Status.Code)
+	})
+
+	t.Run("rejects writes after a delete", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		initial := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		require.Equal(t, 202, deleteRecord(t, dwn, newTestRecordsDelete(t, alice, initial["recordId"], false)))
+
+		update, data := newTestRecordsWrite(t, alice, testRecordsWrite{update: initial})
+		reply, err := dwn.ProcessMessage(alice.URI, update, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+
+	t.Run("returns 404 for unknown or deleted records", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		assert.Equal(t, 404, deleteRecord(t, dwn, newTestRecordsDelete(t, alice, "unknown", false)))
+
+		initial := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		require.Equal(t, 202, deleteRecord(t, dwn, newTestRecordsDelete(t, alice, initial["recordId"], false)))
+		assert.Equal(t, 404, deleteRecord(t, dwn, newTestRecordsDelete(t, alice, initial["recordId"], false)))
+	})
+
+	t.Run("rejects deletes older than the record", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		initial, data := newTestRecordsWrite(t, alice, testRecordsWrite{})
+		stale := newTestRecordsDelete(t, alice, initial["recordId"], false)
+		update, updateData := newTestRecordsWrite(t, alice, testRecordsWrite{update: initial})
+		reply, err := dwn.ProcessMessage(alice.URI, initial, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+		reply, err = dwn.ProcessMessage(alice.URI, update, bytes.NewReader(updateData))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		assert.Equal(t, 409, deleteRecord(t, dwn, stale))
+	})
+
+	t.Run("rejects deletes by others", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		initial := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		assert.Equal(t, 401, deleteRecord(t, dwn, newTestRecordsDelete(t, bob, initial["recordId"], false)))
+	})
+
+	// nestedRecord builds a write of the nested.json protocol, which has the
+	// record types foo/bar/baz.
+	nested := loadTestProtocolDefinition(t, "nested.json")
+	nestedRecord := func(protocolPath string, parent map[string]interface{}) testRecordsWrite {
+		segments := strings.Split(protocolPath, "/")
+		return testRecordsWrite{
+			protocol:     nested["protocol"].(string),
+			protocolPath: protocolPath,
+			schema:       segments[len(segments)-1],
+			dataFormat:   "text/plain",
+			parent:       parent,
+		}
+	}
+
+	t.Run("prunes descendants", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		configureTestProtocol(t, dwn, alice, nested)
+		foo := writeTestRecord(t, dwn, alice, nestedRecord("foo", nil))
+		bar := writeTestRecord(t, dwn, alice, nestedRecord("foo/bar", foo))
+		baz := writeTestRecord(t, dwn, alice, nestedRecord("foo/bar/baz", bar))
+
+		require.Equal(t, 202, deleteRecord(t, dwn, newTestRecordsDelete(t, alice, foo["recordId"], true)))
+
+		assert.Empty(t, queryRecord(t, dwn, alice.URI, bar["recordId"].(string)))
+		assert.Empty(t, queryRecord(t, dwn, alice.URI, baz["recordId"].(string)))
+		assert.Len(t, queryRecord(t, dwn, alice.URI, foo["recordId"].(string)), 2)
+
+		// The configuration, the initial write of foo and its tombstone.
+		events, err := dwn.eventLog.GetEvents(Tenant(alice.URI))
+		require.NoError(t, err)
+		assert.Len(t, events, 3)
+	})
+
+	t.Run("keeps descendants without prune", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		configureTestProtocol(t, dwn, alice, nested)
+		foo := writeTestRecord(t, dwn, alice, nestedRecord("foo", nil))
+		bar := writeTestRecord(t, dwn, alice, nestedRecord("foo/bar", foo))
+
+		require.Equal(t, 202, deleteRecord(t, dwn, newTestRecordsDelete(t, alice, foo["recordId"], false)))
+		assert.Len(t, queryRecord(t, dwn, alice.URI, bar["recordId"].(string)), 1)
+	})
+}
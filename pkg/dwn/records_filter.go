@@ -0,0 +1,194 @@
+package dwn
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RecordsFilter selects records in RecordsQuery, RecordsSubscribe and
+// RecordsDelete messages.  See records-filter.json.
+type RecordsFilter struct {
+	Protocol     string `json:"protocol,omitempty"`
+	ProtocolPath string `json:"protocolPath,omitempty"`
+	Author       string `json:"author,omitempty"`
+	Attester     string `json:"attester,omitempty"`
+	Recipient    string `json:"recipient,omitempty"`
+	ContextId    string `json:"contextId,omitempty"`
+	Schema       string `json:"schema,omitempty"`
+	RecordId     string `json:"recordId,omitempty"`
+	ParentId     string `json:"parentId,omitempty"`
+	DataFormat   string `json:"dataFormat,omitempty"`
+	DataCid      string `json:"dataCid,omitempty"`
+	Published    *bool  `json:"published,omitempty"`
+
+	// Tag values are a string, number or boolean to match exactly, or an
+	// object holding `startsWith` or a string or number range.
+	Tags map[string]interface{} `json:"tags,omitempty"`
+
+	DataSize      *NumberRangeFilter `json:"dataSize,omitempty"`
+	DateCreated   *DateRangeFilter   `json:"dateCreated,omitempty"`
+	DatePublished *DateRangeFilter   `json:"datePublished,omitempty"`
+	DateUpdated   *DateRangeFilter   `json:"dateUpdated,omitempty"`
+}
+
+type NumberRangeFilter struct {
+	GT  *float64 `json:"gt,omitempty"`
+	GTE *float64 `json:"gte,omitempty"`
+	LT  *float64 `json:"lt,omitempty"`
+	LTE *float64 `json:"lte,omitempty"`
+}
+
+// DateRangeFilter matches timestamps from From, inclusive, up to To,
+// exclusive.
+type DateRangeFilter struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// ToFilters translates the records filter into MessageStore filters.
+func (f RecordsFilter) ToFilters() ([]Filter, error) {
+	filters := []Filter{}
+
+	equal := []struct {
+		property string
+		value    string
+	}{
+		{"protocol", f.Protocol},
+		{"protocolPath", f.ProtocolPath},
+		{"author", f.Author},
+		{"attester", f.Attester},
+		{"recipient", f.Recipient},
+		{"schema", f.Schema},
+		{"recordId", f.RecordId},
+		{"parentId", f.ParentId},
+		{"dataFormat", f.DataFormat},
+		{"dataCid", f.DataCid},
+	}
+	for _, e := range equal {
+		if e.value != "" {
+			filters = append(filters, NewEqualFilter(e.property, S(e.value)))
+		}
+	}
+
+	// A contextId also matches the records nested below it.
+	if f.ContextId != "" {
+		filters = append(filters, NewPrefixFilter("contextId", f.ContextId)...)
+	}
+	if f.Published != nil {
+		filters = append(filters, NewEqualFilter("published", B(*f.Published)))
+	}
+
+	if f.DataSize != nil {
+		filters = append(filters, f.DataSize.toFilters("dataSize")...)
+	}
+	filters = append(filters, f.DateCreated.toFilters("dateCreated")...)
+	filters = append(filters, f.DatePublished.toFilters("datePublished")...)
+	filters = append(filters, f.DateUpdated.toFilters("messageTimestamp")...)
+
+	// Sort the tag names so the same filter always yields the same query.
+	names := make([]string, 0, len(f.Tags))
+	for name := range f.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		forTag, err := tagFilters("tag."+name, f.Tags[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter for tag %s: %w", name, err)
+		}
+		filters = append(filters, forTag...)
+	}
+
+	return filters, nil
+}
+
+func (r NumberRangeFilter) toFilters(property string) []Filter {
+	filters := []Filter{}
+	if r.GT != nil {
+		filters = append(filters, NewRangeFilter(property, GT{GT: F(*r.GT)}))
+	}
+	if r.GTE != nil {
+		filters = append(filters, NewRangeFilter(property, GTE{GTE: F(*r.GTE)}))
+	}
+	if r.LT != nil {
+		filters = append(filters, NewRangeFilter(property, LT{LT: F(*r.LT)}))
+	}
+	if r.LTE != nil {
+		filters = append(filters, NewRangeFilter(property, LTE{LTE: F(*r.LTE)}))
+	}
+	return filters
+}
+
+func (r *DateRangeFilter) toFilters(property string) []Filter {
+	filters := []Filter{}
+	if r == nil {
+		return filters
+	}
+	if r.From != "" {
+		filters = append(filters, NewRangeFilter(property, GTE{GTE: S(r.From)}))
+	}
+	if r.To != "" {
+		filters = append(filters, NewRangeFilter(property, LT{LT: S(r.To)}))
+	}
+	return filters
+}
+
+// tagFilters translates the filter on a single tag, as parsed from JSON.
+func tagFilters(property string, value interface{}) ([]Filter, error) {
+	switch v := value.(type) {
+	case string:
+		return []Filter{NewEqualFilter(property, S(v))}, nil
+	case float64:
+		return []Filter{NewEqualFilter(property, F(v))}, nil
+	case bool:
+		return []Filter{NewEqualFilter(property, B(v))}, nil
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("empty filter")
+		}
+		if prefix, ok := v["startsWith"]; ok {
+			s, ok := prefix.(string)
+			if !ok || len(v) != 1 {
+				return nil, fmt.Errorf("startsWith takes a single string")
+			}
+			return NewPrefixFilter(property, s), nil
+		}
+
+		for operator := range v {
+			if operator != "gt" && operator != "gte" && operator != "lt" && operator != "lte" {
+				return nil, fmt.Errorf("unknown operator %s", operator)
+			}
+		}
+
+		filters := []Filter{}
+		for _, operator := range []string{"gt", "gte", "lt", "lte"} {
+			bound, ok := v[operator]
+			if !ok {
+				continue
+			}
+
+			var rangeValue RangeValue
+			switch b := bound.(type) {
+			case string:
+				rangeValue = S(b)
+			case float64:
+				rangeValue = F(b)
+			default:
+				return nil, fmt.Errorf("range bounds must be strings or numbers")
+			}
+
+			switch operator {
+			case "gt":
+				filters = append(filters, NewRangeFilter(property, GT{GT: rangeValue}))
+			case "gte":
+				filters = append(filters, NewRangeFilter(property, GTE{GTE: rangeValue}))
+			case "lt":
+				filters = append(filters, NewRangeFilter(property, LT{LT: rangeValue}))
+			case "lte":
+				filters = append(filters, NewRangeFilter(property, LTE{LTE: rangeValue}))
+			}
+		}
+		return filters, nil
+	}
+	return nil, fmt.Errorf("unsupported value %v", value)
+}
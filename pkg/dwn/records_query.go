@@ -0,0 +1,197 @@
+package dwn
+
+import (
+	"fmt"
+)
+
+// Values of the dateSort property of RecordsQuery.
+const (
+	DateSortCreatedAscending    = "createdAscending"
+	DateSortCreatedDescending   = "createdDescending"
+	DateSortPublishedAscending  = "publishedAscending"
+	DateSortPublishedDescending = "publishedDescending"
+)
+
+type RecordsQueryHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	dataStore    DataStore
+}
+
+func NewRecordsQueryHandler(didResolver *DidResolver, messageStore MessageStore, dataStore DataStore) MethodHandler {
+	return &RecordsQueryHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		dataStore:    dataStore,
+	}
+}
+
+func (h *RecordsQueryHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	reply, err := h.query(Tenant(request.Tenant), request.Message)
+	if err != nil {
+		return replyFromError(err)
+	}
+	return reply, nil
+}
+
+func (h *RecordsQueryHandler) query(tenant Tenant, rawMessage map[string]interface{}) (UnionMessageReply, error) {
+	var message RecordsQuery
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceRecords || descriptor.Method != MethodQuery {
+		return UnionMessageReply{}, newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceRecords, MethodQuery, descriptor.Interface, descriptor.Method)
+	}
+
+	// Queries may be anonymous, in which case only published records are
+	// visible.
+	var requester, protocolRole, grantId string
+	if message.Authorization != nil {
+		author, err := messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+		if err != nil {
+			return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+		}
+		requester = author
+		if protocolRole, err = signatureProtocolRole(message.Authorization.Signature); err != nil {
+			return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+		}
+		if grantId, err = signaturePermissionGrantId(message.Authorization.Signature); err != nil {
+			return UnionMessageReply{}, err
+		}
+	}
+
+	action := grantedAction{
+		Interface:        InterfaceRecords,
+		Method:           MethodQuery,
+		MessageTimestamp: descriptor.MessageTimestamp,
+		Protocol:         descriptor.Filter.Protocol,
+		ContextId:        descriptor.Filter.ContextId,
+		ProtocolPath:     descriptor.Filter.ProtocolPath,
+	}
+	if grant := rawDelegatedGrant(rawMessage, "authorDelegatedGrant"); grant != nil {
+		if err := verifyDelegatedGrant(h.messageStore, tenant, message.Authorization.Signature, grant, action); err != nil {
+			return UnionMessageReply{}, err
+		}
+	}
+
+	filters, err := descriptor.Filter.ToFilters()
+	if err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	filters = append(filters,
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("method", S(MethodWrite)),
+		NewEqualFilter("isLatestBaseState", B(true)),
+	)
+
+	messageSort, err := recordsQuerySort(descriptor.DateSort)
+	if err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	// Only published records have a datePublished to sort by.
+	if messageSort.DatePublished != 0 {
+		filters = append(filters, NewEqualFilter("published", B(true)))
+	}
+
+	// A role allowed to query a protocol path, like a grant covering the
+	// query, sees all records at that path, not only the ones it could see
+	// otherwise.
+	if requester != string(tenant) {
+		if grantId != "" {
+			if err := verifyPermissionGrant(h.messageStore, tenant, requester, grantId, action); err != nil {
+				return UnionMessageReply{}, err
+			}
+		} else if protocolRole != "" {
+			err := authorizeProtocolFilter(h.messageStore, tenant, requester, protocolRole, descriptor.Filter, ActionQuery)
+			if err != nil {
+				return UnionMessageReply{}, err
+			}
+		} else {
+			filters = append(filters, recordsVisibilityFilter(requester))
+		}
+	}
+
+	pagination := Pagination{}
+	if p := descriptor.Pagination; p != nil {
+		pagination.Limit = p.Limit
+		pagination.Cursor = p.Cursor
+	}
+
+	messages, cursor, err := h.messageStore.Query(tenant, filters, messageSort, pagination)
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+
+	entries := make([]map[string]interface{}, 0, len(messages))
+	for _, message := range messages {
+		rawMessage, err := toRawMessage(message)
+		if err != nil {
+			return UnionMessageReply{}, err
+		}
+		entry, err := withInitialWrite(h.messageStore, tenant, rawMessage)
+		if err != nil {
+			return UnionMessageReply{}, err
+		}
+		entries = append(entries, entry)
+	}
+
+	reply := UnionMessageReply{Status: Status{Code: 200}, Entries: entries}
+	if len(entries) > 0 {
+		reply.Cursor = cursor
+	}
+	return reply, nil
+}
+
+// authorizeProtocolFilter checks that protocolRole may query or subscribe to,
+// as action says, the records selected by filter, which must name the
+// protocol and protocolPath.
+func authorizeProtocolFilter(messageStore MessageStore, tenant Tenant, requester, protocolRole string,
+	filter RecordsFilter, action string) error {
+	if filter.Protocol == "" || filter.ProtocolPath == "" {
+		return newStatusError(400, "filters invoking a protocolRole must name the protocol and protocolPath")
+	}
+	authorizer, err := newProtocolAuthorizer(messageStore, tenant, filter.Protocol)
+	if err != nil {
+		return err
+	}
+	if authorizer == nil {
+		return newStatusError(400, "protocol %s is not installed", filter.Protocol)
+	}
+	return authorizer.authorize(protocolRequest{
+		Requester:    requester,
+		ProtocolRole: protocolRole,
+		ProtocolPath: filter.ProtocolPath,
+		ContextId:    filter.ContextId,
+		Actions:      []string{action},
+	})
+}
+
+// recordsVisibilityFilter limits a query by someone other than the tenant to
+// the records they may see: published records, and the records they wrote
+// or received.
+func recordsVisibilityFilter(requester string) Filter {
+	visible := [][]Filter{{NewEqualFilter("published", B(true))}}
+	if requester != "" {
+		visible = append(visible,
+			[]Filter{NewEqualFilter("author", S(requester))},
+			[]Filter{NewEqualFilter("recipient", S(requester))},
+		)
+	}
+	return OrFilter{AnyOf: visible}
+}
+
+func recordsQuerySort(dateSort string) (MessageSort, error) {
+	switch dateSort {
+	case "", DateSortCreatedAscending:
+		return MessageSort{DateCreated: Ascending}, nil
+	case DateSortCreatedDescending:
+		return MessageSort{DateCreated: Descending}, nil
+	case DateSortPublishedAscending:
+		return MessageSort{DatePublished: Ascending}, nil
+	case DateSortPublishedDescending:
+		return MessageSort{DatePublished: Descending}, nil
+	}
+	return MessageSort{}, fmt.Errorf("unknown dateSort %s", dateSort)
+}
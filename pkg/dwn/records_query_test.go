@@ -0,0 +1,178 @@
+package dwn
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func queryTestRecords(t *testing.T, dwn *Dwn, tenant string, message map[string]interface{}) UnionMessageReply {
+	t.Helper()
+	reply, err := dwn.ProcessMessage(tenant, message, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+	return reply
+}
+
+func entryRecordIds(entries []map[string]interface{}) []string {
+	recordIds := []string{}
+	for _, entry := range entries {
+		recordIds = append(recordIds, entry["recordId"].(string))
+	}
+	return recordIds
+}
+
+func TestRecordsQuery(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+	schema := "https://example.com/title"
+
+	t.Run("hides unpublished records from non-owners", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		private := writeTestRecord(t, dwn, alice, testRecordsWrite{schema: schema})
+		public := writeTestRecord(t, dwn, alice, testRecordsWrite{schema: schema, published: true})
+		forBob := writeTestRecord(t, dwn, alice, testRecordsWrite{schema: schema, recipient: bob.URI})
+		filter := map[string]interface{}{"schema": schema}
+
+		reply := queryTestRecords(t, dwn, alice.URI, newTestRecordsQuery(t, &alice, filter, nil))
+		assert.Equal(t, []string{
+			private["recordId"].(string), public["recordId"].(string), forBob["recordId"].(string),
+		}, entryRecordIds(reply.Entries))
+
+		reply = queryTestRecords(t, dwn, alice.URI, newTestRecordsQuery(t, &bob, filter, nil))
+		assert.Equal(t, []string{
+			public["recordId"].(string), forBob["recordId"].(string),
+		}, entryRecordIds(reply.Entries))
+
+		reply = queryTestRecords(t, dwn, alice.URI, newTestRecordsQuery(t, nil, filter, nil))
+		assert.Equal(t, []string{public["recordId"].(string)}, entryRecordIds(reply.Entries))
+	})
+
+	t.Run("returns the latest write with its initial write", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		initial := writeTestRecord(t, dwn, alice, testRecordsWrite{schema: schema})
+		update := writeTestRecord(t, dwn, alice, testRecordsWrite{update: initial})
+
+		reply := queryTestRecords(t, dwn, alice.URI,
+			newTestRecordsQuery(t, &alice, map[string]interface{}{"recordId": initial["recordId"]}, nil))
+		require.Len(t, reply.Entries, 1)
+		assert.Equal(t, update["descriptor"], reply.Entries[0]["descriptor"])
+		assert.Contains(t, reply.Entries[0], "encodedData")
+		require.Contains(t, reply.Entries[0], "initialWrite")
+		assert.Equal(t, initial["descriptor"], reply.Entries[0]["initialWrite"].(map[string]interface{})["descriptor"])
+	})
+
+	t.Run("filters by tags", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		car := writeTestRecord(t, dwn, alice, testRecordsWrite{
+			tags: map[string]interface{}{"assetType": "vehicle", "value": 25000, "registered": true},
+		})
+		house := writeTestRecord(t, dwn, alice, testRecordsWrite{
+			tags: map[string]interface{}{"assetType": "real-estate", "value": 400000, "registered": true},
+		})
+
+		tests := []struct {
+			name     string
+			tags     map[string]interface{}
+			expected []string
+		}{
+			{"equal string", map[string]interface{}{"assetType": "vehicle"},
+				[]string{car["recordId"].(string)}},
+			{"equal boolean", map[string]interface{}{"registered": true},
+				[]string{car["recordId"].(string), house["recordId"].(string)}},
+			{"starts with", map[string]interface{}{"assetType": map[string]interface{}{"startsWith": "real"}},
+				[]string{house["recordId"].(string)}},
+			{"number range", map[string]interface{}{"value": map[string]interface{}{"gte": 100000}},
+				[]string{house["recordId"].(string)}},
+			{"string range", map[string]interface{}{"assetType": map[string]interface{}{"lt": "w", "gt": "s"}},
+				[]string{car["recordId"].(string)}},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				reply := queryTestRecords(t, dwn, alice.URI,
+					newTestRecordsQuery(t, &alice, map[string]interface{}{"tags": tc.tags}, nil))
+				assert.Equal(t, tc.expected, entryRecordIds(reply.Entries))
+			})
+		}
+	})
+
+	t.Run("filters by ranges", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		small := writeTestRecord(t, dwn, alice, testRecordsWrite{data: []byte("small")})
+		large := writeTestRecord(t, dwn, alice, testRecordsWrite{data: bytes.Repeat([]byte("l"), 100)})
+		dateCreated := large["descriptor"].(map[string]interface{})["dateCreated"]
+
+		reply := queryTestRecords(t, dwn, alice.URI, newTestRecordsQuery(t, &alice,
+			map[string]interface{}{"dataSize": map[string]interface{}{"lte": 10}}, nil))
+		assert.Equal(t, []string{small["recordId"].(string)}, entryRecordIds(reply.Entries))
+
+		reply = queryTestRecords(t, dwn, alice.URI, newTestRecordsQuery(t, &alice,
+			map[string]interface{}{"dateCreated": map[string]interface{}{"from": dateCreated}}, nil))
+		assert.Equal(t, []string{large["recordId"].(string)}, entryRecordIds(reply.Entries))
+
+		reply = queryTestRecords(t, dwn, alice.URI, newTestRecordsQuery(t, &alice,
+			map[string]interface{}{"dateCreated": map[string]interface{}{"to": dateCreated}}, nil))
+		assert.Equal(t, []string{small["recordId"].(string)}, entryRecordIds(reply.Entries))
+	})
+
+	t.Run("sorts and paginates", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		expected := []string{}
+		for i := 0; i < 5; i++ {
+			message := writeTestRecord(t, dwn, alice, testRecordsWrite{schema: schema})
+			expected = append([]string{message["recordId"].(string)}, expected...)
+		}
+
+		recordIds := []string{}
+		var cursor *PaginationCursor
+		for pages := 0; pages < 5; pages++ {
+			pagination := map[string]interface{}{"limit": 2}
+			if cursor != nil {
+				pagination["cursor"] = cursor
+			}
+			reply := queryTestRecords(t, dwn, alice.URI, newTestRecordsQuery(t, &alice,
+				map[string]interface{}{"schema": schema},
+				map[string]interface{}{"dateSort": DateSortCreatedDescending, "pagination": pagination}))
+			recordIds = append(recordIds, entryRecordIds(reply.Entries)...)
+			cursor = reply.Cursor
+			if cursor == nil {
+				break
+			}
+		}
+		assert.Equal(t, expected, recordIds)
+	})
+
+	t.Run("resumes after a cursor whose record is gone", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		recordIds := []string{}
+		for i := 0; i < 3; i++ {
+			message := writeTestRecord(t, dwn, alice, testRecordsWrite{schema: schema})
+			recordIds = append(recordIds, message["recordId"].(string))
+		}
+		sort := map[string]interface{}{"dateSort": DateSortCreatedAscending, "pagination": map[string]interface{}{"limit": 1}}
+
+		first := queryTestRecords(t, dwn, alice.URI, newTestRecordsQuery(t, &alice,
+			map[string]interface{}{"schema": schema}, sort))
+		require.Equal(t, recordIds[:1], entryRecordIds(first.Entries))
+		require.NotNil(t, first.Cursor)
+
+		reply, err := dwn.ProcessMessage(alice.URI, newTestRecordsDelete(t, alice, recordIds[0], false), nil)
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		sort["pagination"] = map[string]interface{}{"limit": 1, "cursor": first.Cursor}
+		next := queryTestRecords(t, dwn, alice.URI, newTestRecordsQuery(t, &alice,
+			map[string]interface{}{"schema": schema}, sort))
+		assert.Equal(t, recordIds[1:2], entryRecordIds(next.Entries))
+	})
+
+	t.Run("rejects unknown dateSort", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		reply, err := dwn.ProcessMessage(alice.URI, newTestRecordsQuery(t, &alice,
+			map[string]interface{}{"schema": schema}, map[string]interface{}{"dateSort": "sideways"}), nil)
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+}
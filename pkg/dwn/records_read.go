@@ -0,0 +1,178 @@
+package dwn
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+)
+
+type RecordsReadHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	dataStore    DataStore
+}
+
+func NewRecordsReadHandler(didResolver *DidResolver, messageStore MessageStore, dataStore DataStore) MethodHandler {
+	return &RecordsReadHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		dataStore:    dataStore,
+	}
+}
+
+func (h *RecordsReadHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	reply, err := h.read(Tenant(request.Tenant), request.Message)
+	if err != nil {
+		return replyFromError(err)
+	}
+	return reply, nil
+}
+
+func (h *RecordsReadHandler) read(tenant Tenant, rawMessage map[string]interface{}) (UnionMessageReply, error) {
+	var message RecordsRead
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceRecords || descriptor.Method != MethodRead {
+		return UnionMessageReply{}, newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceRecords, MethodRead, descriptor.Interface, descriptor.Method)
+	}
+
+	// Reads may be anonymous, in which case only published records can be
+	// read.
+	var requester, protocolRole, grantId string
+	if message.Authorization != nil {
+		author, err := messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+		if err != nil {
+			return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+		}
+		requester = author
+		if protocolRole, err = signatureProtocolRole(message.Authorization.Signature); err != nil {
+			return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+		}
+		if grantId, err = signaturePermissionGrantId(message.Authorization.Signature); err != nil {
+			return UnionMessageReply{}, err
+		}
+	}
+
+	filters, err := descriptor.Filter.ToFilters()
+	if err != nil {
+		return UnionMessageReply{}, &statusError{Code: 400, Err: err}
+	}
+	filters = append(filters,
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("method", S(MethodWrite)),
+		NewEqualFilter("isLatestBaseState", B(true)),
+	)
+
+	matches, err := queryMessageEntries(h.messageStore, tenant, filters)
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+	switch {
+	case len(matches) == 0:
+		return UnionMessageReply{}, newStatusError(404, "record not found")
+	case len(matches) > 1:
+		return UnionMessageReply{}, newStatusError(400, "filter matches %d records, expected one", len(matches))
+	}
+	match := matches[0]
+
+	action := grantedAction{
+		Interface:        InterfaceRecords,
+		Method:           MethodRead,
+		MessageTimestamp: descriptor.MessageTimestamp,
+		Protocol:         match.descriptorStr("protocol"),
+		ContextId:        getPathedStrNoErr(match.Message, "contextId"),
+		ProtocolPath:     match.descriptorStr("protocolPath"),
+	}
+	if grant := rawDelegatedGrant(rawMessage, "authorDelegatedGrant"); grant != nil {
+		if err := verifyDelegatedGrant(h.messageStore, tenant, message.Authorization.Signature, grant, action); err != nil {
+			return UnionMessageReply{}, err
+		}
+	}
+	if grantId != "" && requester != string(tenant) {
+		err = verifyPermissionGrant(h.messageStore, tenant, requester, grantId, action)
+	} else {
+		err = authorizeRecordsRead(h.messageStore, tenant, requester, protocolRole, match)
+	}
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+
+	record, err := withInitialWrite(h.messageStore, tenant, withoutEncodedData(match.Message))
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+	reply := UnionMessageReply{Status: Status{Code: 200}, Record: record}
+
+	if encodedData, ok := match.Message["encodedData"].(string); ok {
+		data, err := base64.RawURLEncoding.DecodeString(encodedData)
+		if err != nil {
+			return UnionMessageReply{}, fmt.Errorf("malformed encodedData of record %s: %w",
+				getPathedStrNoErr(match.Message, "recordId"), err)
+		}
+		reply.Data = bytes.NewReader(data)
+		return reply, nil
+	}
+
+	dataCid := DataCid(match.descriptorStr("dataCid"))
+	_, _, dataStream, err := h.dataStore.Get(tenant, match.Cid, dataCid)
+	if err != nil {
+		return UnionMessageReply{}, err
+	}
+	if dataStream == nil {
+		return UnionMessageReply{}, newStatusError(404, "data %s not found", dataCid)
+	}
+	reply.Data = dataStream
+	return reply, nil
+}
+
+// authorizeRecordsRead allows the tenant to read any record, and anyone else
+// to read published records and the records they wrote or received.  Other
+// protocol records may be read as the `$actions` of their protocol allow.
+func authorizeRecordsRead(messageStore MessageStore, tenant Tenant, requester, protocolRole string,
+	record messageEntry) error {
+	if requester == string(tenant) {
+		return nil
+	}
+	if published, _ := record.descriptorValue("published").(bool); published {
+		return nil
+	}
+	recordId := getPathedStrNoErr(record.Message, "recordId")
+	if requester == "" {
+		return newStatusError(401, "not authorized to read record %s", recordId)
+	}
+
+	author, err := record.author()
+	if err != nil {
+		return err
+	}
+	if requester == author || requester == record.descriptorStr("recipient") {
+		return nil
+	}
+
+	protocol := record.descriptorStr("protocol")
+	if protocol == "" {
+		return newStatusError(401, "not authorized to read record %s", recordId)
+	}
+	authorizer, err := newProtocolAuthorizer(messageStore, tenant, protocol)
+	if err != nil {
+		return err
+	}
+	if authorizer == nil {
+		return newStatusError(401, "not authorized to read record %s", recordId)
+	}
+	ancestors, err := fetchAncestors(messageStore, tenant, record.descriptorStr("parentId"))
+	if err != nil {
+		return err
+	}
+	return authorizer.authorize(protocolRequest{
+		Requester:    requester,
+		ProtocolRole: protocolRole,
+		ProtocolPath: record.descriptorStr("protocolPath"),
+		ContextId:    getPathedStrNoErr(record.Message, "contextId"),
+		Records:      append(ancestors, record),
+		Actions:      []string{ActionRead},
+	})
+}
@@ -0,0 +1,128 @@
+package dwn
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordsRead(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+
+	readData := func(t *testing.T, reply UnionMessageReply) []byte {
+		t.Helper()
+		require.NotNil(t, reply.Data)
+		data, err := io.ReadAll(reply.Data)
+		require.NoError(t, err)
+		return data
+	}
+
+	t.Run("returns inline data", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		message, data := newTestRecordsWrite(t, alice, testRecordsWrite{})
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI,
+			newTestRecordsRead(t, &alice, map[string]interface{}{"recordId": message["recordId"]}), nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Equal(t, message["descriptor"], reply.Record["descriptor"])
+		assert.NotContains(t, reply.Record, "encodedData")
+		assert.Equal(t, data, readData(t, reply))
+	})
+
+	t.Run("streams data from the data store", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		data := bytes.Repeat([]byte("b"), MaxEncodedDataSize*2)
+		message, _ := newTestRecordsWrite(t, alice, testRecordsWrite{data: data})
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI,
+			newTestRecordsRead(t, &alice, map[string]interface{}{"recordId": message["recordId"]}), nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Equal(t, data, readData(t, reply))
+	})
+
+	t.Run("returns the latest write with its initial write", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		initial := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		update, data := newTestRecordsWrite(t, alice, testRecordsWrite{update: initial})
+		reply, err := dwn.ProcessMessage(alice.URI, update, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI,
+			newTestRecordsRead(t, &alice, map[string]interface{}{"recordId": initial["recordId"]}), nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		assert.Equal(t, update["descriptor"], reply.Record["descriptor"])
+		assert.Contains(t, reply.Record, "initialWrite")
+		assert.Equal(t, data, readData(t, reply))
+	})
+
+	t.Run("authorizes readers", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		private := writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		public := writeTestRecord(t, dwn, alice, testRecordsWrite{published: true})
+		forBob := writeTestRecord(t, dwn, alice, testRecordsWrite{recipient: bob.URI})
+
+		tests := []struct {
+			name     string
+			reader   string
+			record   map[string]interface{}
+			expected int
+		}{
+			{"owner reads unpublished", "alice", private, 200},
+			{"anyone reads published", "anonymous", public, 200},
+			{"recipient reads unpublished", "bob", forBob, 200},
+			{"others cannot read unpublished", "bob", private, 401},
+			{"anonymous cannot read unpublished", "anonymous", forBob, 401},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				filter := map[string]interface{}{"recordId": tc.record["recordId"]}
+				var message map[string]interface{}
+				switch tc.reader {
+				case "alice":
+					message = newTestRecordsRead(t, &alice, filter)
+				case "bob":
+					message = newTestRecordsRead(t, &bob, filter)
+				default:
+					message = newTestRecordsRead(t, nil, filter)
+				}
+
+				reply, err := dwn.ProcessMessage(alice.URI, message, nil)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, reply.Status.Code, reply.Status.Detail)
+			})
+		}
+	})
+
+	t.Run("returns 404 for unknown records", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		reply, err := dwn.ProcessMessage(alice.URI,
+			newTestRecordsRead(t, &alice, map[string]interface{}{"recordId": "unknown"}), nil)
+		require.NoError(t, err)
+		assert.Equal(t, 404, reply.Status.Code)
+	})
+
+	t.Run("rejects filters matching several records", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		writeTestRecord(t, dwn, alice, testRecordsWrite{schema: "https://example.com/note"})
+		writeTestRecord(t, dwn, alice, testRecordsWrite{schema: "https://example.com/note"})
+
+		reply, err := dwn.ProcessMessage(alice.URI,
+			newTestRecordsRead(t, &alice, map[string]interface{}{"schema": "https://example.com/note"}), nil)
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+}
@@ -0,0 +1,121 @@
+package dwn
+
+type RecordsSubscribeHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	eventStream  EventStream
+}
+
+func NewRecordsSubscribeHandler(didResolver *DidResolver, messageStore MessageStore,
+	eventStream EventStream) MethodHandler {
+	return &RecordsSubscribeHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		eventStream:  eventStream,
+	}
+}
+
+func (h *RecordsSubscribeHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	subscription, err := h.subscribe(Tenant(request.Tenant), request.Message, request.SubscriptionHandler)
+	if err != nil {
+		return replyFromError(err)
+	}
+	return UnionMessageReply{Status: Status{Code: 200}, Subscription: subscription}, nil
+}
+
+// subscribe passes the RecordsWrite and RecordsDelete events matching the
+// filter to handler.  Like a RecordsQuery, a subscription by someone other
+// than the tenant only sees the records they may read, unless a protocol
+// role or grant lets them see all of the filtered records.
+func (h *RecordsSubscribeHandler) subscribe(tenant Tenant, rawMessage map[string]interface{},
+	handler SubscriptionHandler) (EventSubscription, error) {
+	var message RecordsSubscribe
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return nil, &statusError{Code: 400, Err: err}
+	}
+	descriptor := message.Descriptor
+	if descriptor.Interface != InterfaceRecords || descriptor.Method != MethodSubscribe {
+		return nil, newStatusError(400, "expected %s%s message, got %s%s",
+			InterfaceRecords, MethodSubscribe, descriptor.Interface, descriptor.Method)
+	}
+	if h.eventStream == nil {
+		return nil, newStatusError(501, "subscriptions are not supported")
+	}
+	if handler == nil {
+		return nil, newStatusError(400, "subscriptions require a subscription handler")
+	}
+
+	// Subscriptions may be anonymous, in which case only published records
+	// are visible.
+	var requester, protocolRole, grantId string
+	if message.Authorization != nil {
+		author, err := messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+		if err != nil {
+			return nil, &statusError{Code: 400, Err: err}
+		}
+		requester = author
+		if protocolRole, err = signatureProtocolRole(message.Authorization.Signature); err != nil {
+			return nil, &statusError{Code: 400, Err: err}
+		}
+		if grantId, err = signaturePermissionGrantId(message.Authorization.Signature); err != nil {
+			return nil, err
+		}
+	}
+
+	action := grantedAction{
+		Interface:        InterfaceRecords,
+		Method:           MethodSubscribe,
+		MessageTimestamp: descriptor.MessageTimestamp,
+		Protocol:         descriptor.Filter.Protocol,
+		ContextId:        descriptor.Filter.ContextId,
+		ProtocolPath:     descriptor.Filter.ProtocolPath,
+	}
+	if grant := rawDelegatedGrant(rawMessage, "authorDelegatedGrant"); grant != nil {
+		if err := verifyDelegatedGrant(h.messageStore, tenant, message.Authorization.Signature, grant, action); err != nil {
+			return nil, err
+		}
+	}
+
+	filters, err := descriptor.Filter.ToFilters()
+	if err != nil {
+		return nil, &statusError{Code: 400, Err: err}
+	}
+	filters = append(filters, NewEqualFilter("interface", S(InterfaceRecords)))
+	if requester != string(tenant) {
+		if grantId != "" {
+			if err := verifyPermissionGrant(h.messageStore, tenant, requester, grantId, action); err != nil {
+				return nil, err
+			}
+		} else if protocolRole != "" {
+			err := authorizeProtocolFilter(h.messageStore, tenant, requester, protocolRole, descriptor.Filter,
+				ActionSubscribe)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			filters = append(filters, recordsVisibilityFilter(requester))
+		}
+	}
+
+	id, err := computeMessageCid(rawMessage)
+	if err != nil {
+		return nil, &statusError{Code: 400, Err: err}
+	}
+	return subscribeEvents(h.eventStream, tenant, string(id), filters, handler)
+}
+
+// subscribeEvents subscribes handler to the tenant's events matching all of
+// filters.
+func subscribeEvents(eventStream EventStream, tenant Tenant, id string, filters []Filter,
+	handler SubscriptionHandler) (EventSubscription, error) {
+	subscription, err := eventStream.Subscribe(tenant, id,
+		func(_ Tenant, event MessageEvent, indexes IndexableKeyValues) {
+			if matchFilters(indexes, filters) {
+				handler(event)
+			}
+		})
+	if err != nil {
+		return nil, newStatusError(409, "failed to subscribe: %w", err)
+	}
+	return subscription, nil
+}
@@ -0,0 +1,120 @@
+package dwn
+
+import (
+	"sync"
+	"testing"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSubscriber collects the events of a subscription.
+type testSubscriber struct {
+	mu     sync.Mutex
+	events []MessageEvent
+}
+
+func (s *testSubscriber) handle(event MessageEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+// messageCids returns the CIDs of the messages received so far.
+func (s *testSubscriber) messageCids(t *testing.T) []string {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cids := make([]string, 0, len(s.events))
+	for _, event := range s.events {
+		cids = append(cids, testMessageCid(t, event.Message))
+	}
+	return cids
+}
+
+func newTestRecordsSubscribe(t *testing.T, author *_did.BearerDID, filter map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	return newTestMessage(t, author, InterfaceRecords, MethodSubscribe, map[string]interface{}{"filter": filter})
+}
+
+func subscribeTest(t *testing.T, dwn *Dwn, tenant string, message map[string]interface{}) (*testSubscriber, UnionMessageReply) {
+	t.Helper()
+	subscriber := &testSubscriber{}
+	reply, err := dwn.ProcessSubscription(tenant, message, subscriber.handle)
+	require.NoError(t, err)
+	if reply.Subscription != nil {
+		t.Cleanup(func() { reply.Subscription.Close() })
+	}
+	return subscriber, reply
+}
+
+func TestRecordsSubscribe(t *testing.T) {
+	alice := newTestPersona(t)
+	bob := newTestPersona(t)
+
+	t.Run("receives matching writes and deletes in order", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		subscriber, reply := subscribeTest(t, dwn, alice.URI,
+			newTestRecordsSubscribe(t, &alice, map[string]interface{}{"schema": "note"}))
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+
+		note := writeTestRecord(t, dwn, alice, testRecordsWrite{schema: "note"})
+		writeTestRecord(t, dwn, alice, testRecordsWrite{schema: "other"})
+		update := writeTestRecord(t, dwn, alice, testRecordsWrite{update: note})
+		remove := newTestRecordsDelete(t, alice, note["recordId"], false)
+		require.Equal(t, 202, processStatus(t, dwn, alice.URI, remove))
+
+		assert.Equal(t, []string{
+			testMessageCid(t, note), testMessageCid(t, update), testMessageCid(t, remove),
+		}, subscriber.messageCids(t))
+		assert.Nil(t, subscriber.events[0].InitialWrite)
+		assert.Equal(t, note["descriptor"], subscriber.events[1].InitialWrite["descriptor"])
+		assert.Equal(t, note["descriptor"], subscriber.events[2].InitialWrite["descriptor"])
+	})
+
+	t.Run("stops after the subscription is closed", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		subscriber, reply := subscribeTest(t, dwn, alice.URI, newTestRecordsSubscribe(t, &alice, map[string]interface{}{}))
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+
+		writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		require.NoError(t, reply.Subscription.Close())
+		writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		assert.Len(t, subscriber.events, 1)
+	})
+
+	t.Run("others only see records they may read", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		subscriber, reply := subscribeTest(t, dwn, alice.URI, newTestRecordsSubscribe(t, &bob, map[string]interface{}{}))
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		anonymous, reply := subscribeTest(t, dwn, alice.URI, newTestRecordsSubscribe(t, nil, map[string]interface{}{}))
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+
+		writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		published := writeTestRecord(t, dwn, alice, testRecordsWrite{published: true})
+		received := writeTestRecord(t, dwn, alice, testRecordsWrite{recipient: bob.URI})
+
+		assert.Equal(t, []string{testMessageCid(t, published), testMessageCid(t, received)}, subscriber.messageCids(t))
+		assert.Equal(t, []string{testMessageCid(t, published)}, anonymous.messageCids(t))
+	})
+
+	t.Run("grants let others see all records", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		grantId := grantTestPermission(t, dwn, alice, bob, map[string]interface{}{
+			"interface": InterfaceRecords, "method": MethodSubscribe,
+		}, nil)
+		subscribe := withTestPermissionGrant(t, bob, newTestRecordsSubscribe(t, &bob, map[string]interface{}{}), grantId)
+		subscriber, reply := subscribeTest(t, dwn, alice.URI, subscribe)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+
+		writeTestRecord(t, dwn, alice, testRecordsWrite{})
+		assert.Len(t, subscriber.events, 1)
+	})
+
+	t.Run("requires a subscription handler", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		subscribe := newTestRecordsSubscribe(t, &alice, map[string]interface{}{})
+		assert.Equal(t, 400, processStatus(t, dwn, alice.URI, subscribe))
+	})
+}
@@ -0,0 +1,588 @@
+package dwn
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
+	"github.com/abaxxtech/abaxx-id-go/pkg/utils"
+)
+
+// MaxEncodedDataSize is the largest record payload, in bytes, that is kept
+// inline with its RecordsWrite as `encodedData` instead of in the DataStore.
+const MaxEncodedDataSize = 30000
+
+// immutableDescriptorProperties may not change between the initial write of
+// a record and any later write to it.
+var immutableDescriptorProperties = []string{
+	"dateCreated", "schema", "protocol", "protocolPath", "recipient", "parentId",
+}
+
+type RecordsWriteHandler struct {
+	didResolver  *DidResolver
+	messageStore MessageStore
+	dataStore    DataStore
+	eventLog     EventLog
+	eventStream  EventStream
+}
+
+func NewRecordsWriteHandler(didResolver *DidResolver, messageStore MessageStore,
+	dataStore DataStore, eventLog EventLog, eventStream EventStream) MethodHandler {
+	return &RecordsWriteHandler{
+		didResolver:  didResolver,
+		messageStore: messageStore,
+		dataStore:    dataStore,
+		eventLog:     eventLog,
+		eventStream:  eventStream,
+	}
+}
+
+func (h *RecordsWriteHandler) Handle(request *HandlerRequest) (UnionMessageReply, error) {
+	if err := h.write(Tenant(request.Tenant), request.Message, request.DataStream); err != nil {
+		return replyFromError(err)
+	}
+	return UnionMessageReply{Status: Status{Code: 202}}, nil
+}
+
+func (h *RecordsWriteHandler) write(tenant Tenant, rawMessage map[string]interface{}, dataStream io.Reader) error {
+	message, err := parseRecordsWrite(rawMessage)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	author, err := messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	entryId, err := recordsWriteEntryId(rawMessage, author)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	if err := message.validateIntegrity(entryId); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+
+	// encodedData is never accepted from the client; data always arrives on
+	// the data stream.
+	incoming := messageEntry{Message: withoutEncodedData(rawMessage)}
+	if incoming.Cid, err = computeMessageCid(incoming.Message); err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+
+	existing, err := queryMessageEntries(h.messageStore, tenant, []Filter{
+		NewEqualFilter("interface", S(InterfaceRecords)),
+		NewEqualFilter("recordId", S(message.RecordId)),
+	})
+	if err != nil {
+		return err
+	}
+
+	isInitialWrite := entryId == message.RecordId
+	var initialWrite *messageEntry
+	if isInitialWrite {
+		if err := h.validateContextId(tenant, message); err != nil {
+			return err
+		}
+	} else {
+		if initialWrite, err = findInitialWrite(existing); err != nil {
+			return err
+		}
+		if initialWrite == nil {
+			return newStatusError(400, "initial write for record %s not found", message.RecordId)
+		}
+		if err := validateImmutableProperties(incoming.Message, initialWrite.Message); err != nil {
+			return &statusError{Code: 400, Err: err}
+		}
+	}
+
+	if grant := rawDelegatedGrant(rawMessage, "authorDelegatedGrant"); grant != nil {
+		if err := verifyDelegatedGrant(h.messageStore, tenant, message.Authorization.Signature, grant,
+			message.grantedAction()); err != nil {
+			return err
+		}
+	}
+	owner, err := message.owner(h.messageStore, tenant, rawMessage)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != string(tenant) {
+		return newStatusError(401, "owner %s is not tenant %s", owner, tenant)
+	}
+
+	// Records the tenant wrote or signed as owner need no further permission,
+	// and neither do records written under a grant of the tenant.
+	byTenant := author == string(tenant) || owner != ""
+	if !byTenant {
+		grantId, err := signaturePermissionGrantId(message.Authorization.Signature)
+		if err != nil {
+			return err
+		}
+		if grantId != "" {
+			if err := verifyPermissionGrant(h.messageStore, tenant, author, grantId, message.grantedAction()); err != nil {
+				return err
+			}
+			byTenant = true
+		}
+	}
+	if message.Descriptor.Protocol != "" {
+		if err := h.authorizeProtocolWrite(tenant, author, byTenant, message, initialWrite); err != nil {
+			return err
+		}
+	} else if !byTenant {
+		return newStatusError(401, "%s is not authorized to write records of tenant %s", author, tenant)
+	}
+
+	newest := newestMessage(existing)
+	if newest != nil && newest.interfaceMethod() == InterfaceRecords+MethodDelete {
+		return newStatusError(400, "record %s has been deleted", message.RecordId)
+	}
+	if newest != nil && !incoming.isNewerThan(*newest) {
+		return newStatusError(409, "a newer or identical message for record %s already exists", message.RecordId)
+	}
+
+	stored, isLatestBaseState, err := h.storeData(tenant, message, incoming, newest, isInitialWrite, dataStream)
+	if err != nil {
+		return err
+	}
+
+	indexes := recordsWriteIndexes(message, author, isLatestBaseState)
+	if err := h.messageStore.Put(tenant, stored, indexes); err != nil {
+		return err
+	}
+	if err := h.eventLog.Append(tenant, incoming.Cid, indexes); err != nil {
+		return err
+	}
+	event := MessageEvent{Message: stored}
+	if initialWrite != nil {
+		event.InitialWrite = initialWrite.Message
+	}
+	emitEvent(h.eventStream, tenant, event, indexes)
+
+	return deleteOlderWrites(h.messageStore, h.dataStore, h.eventLog, tenant, existing)
+}
+
+// storeData attaches the record's data to the message being stored.  Small
+// payloads are inlined as encodedData and larger ones go to the DataStore.
+// Without a data stream, the data of the newest existing write is reused if
+// it is the same; an initial write may also be stored without any data, but
+// then it does not hold the latest state of the record.
+func (h *RecordsWriteHandler) storeData(tenant Tenant, message *RecordsWrite, incoming messageEntry,
+	newest *messageEntry, isInitialWrite bool, dataStream io.Reader) (map[string]interface{}, bool, error) {
+	descriptor := message.Descriptor
+	stored := incoming.Message
+
+	if dataStream == nil {
+		if newest != nil && newest.descriptorStr("dataCid") == string(descriptor.DataCid) {
+			if encodedData, ok := newest.Message["encodedData"]; ok {
+				stored = withEncodedData(stored, encodedData)
+				return stored, true, nil
+			}
+			dataCid, dataSize, err := h.dataStore.Associate(tenant, incoming.Cid, descriptor.DataCid)
+			if err != nil {
+				return nil, false, err
+			}
+			if dataCid != "" {
+				if dataSize != descriptor.DataSize {
+					h.dataStore.Delete(tenant, incoming.Cid, dataCid)
+					return nil, false, newStatusError(400,
+						"dataSize %d does not match size of stored data %d", descriptor.DataSize, dataSize)
+				}
+				return stored, true, nil
+			}
+		}
+		if isInitialWrite {
+			return stored, false, nil
+		}
+		return nil, false, newStatusError(400, "data stream is required for record %s", message.RecordId)
+	}
+
+	if descriptor.DataSize <= MaxEncodedDataSize {
+		data, err := io.ReadAll(io.LimitReader(dataStream, MaxEncodedDataSize+1))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read data stream: %w", err)
+		}
+		if err := verifyData(descriptor, bytes.NewReader(data)); err != nil {
+			return nil, false, &statusError{Code: 400, Err: err}
+		}
+		stored = withEncodedData(stored, base64.RawURLEncoding.EncodeToString(data))
+		return stored, true, nil
+	}
+
+	dataCid, dataSize, err := h.dataStore.Put(tenant, incoming.Cid, descriptor.DataCid, dataStream)
+	if err != nil {
+		return nil, false, &statusError{Code: 400, Err: err}
+	}
+	if dataCid != descriptor.DataCid || dataSize != descriptor.DataSize {
+		h.dataStore.Delete(tenant, incoming.Cid, dataCid)
+		return nil, false, newStatusError(400,
+			"data CID %s and size %d do not match descriptor dataCid %s and dataSize %d",
+			dataCid, dataSize, descriptor.DataCid, descriptor.DataSize)
+	}
+	return stored, true, nil
+}
+
+// deleteOlderWrites removes the writes superseded by a newly stored message
+// of the record.  The initial write is kept, since it anchors the immutable
+// properties of the record, but it no longer holds the latest state or any
+// data.
+func deleteOlderWrites(messageStore MessageStore, dataStore DataStore, eventLog EventLog,
+	tenant Tenant, older []messageEntry) error {
+	deleted := []MessageCid{}
+	for _, entry := range older {
+		if entry.interfaceMethod() != InterfaceRecords+MethodWrite {
+			continue
+		}
+		message, err := parseRecordsWrite(entry.Message)
+		if err != nil {
+			return err
+		}
+		if _, ok := entry.Message["encodedData"]; !ok {
+			if err := dataStore.Delete(tenant, entry.Cid, message.Descriptor.DataCid); err != nil {
+				return err
+			}
+		}
+
+		author, err := messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+		if err != nil {
+			return err
+		}
+		entryId, err := recordsWriteEntryId(entry.Message, author)
+		if err != nil {
+			return err
+		}
+		if entryId == message.RecordId {
+			indexes := recordsWriteIndexes(message, author, false)
+			if err := messageStore.Put(tenant, withoutEncodedData(entry.Message), indexes); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := messageStore.Delete(tenant, entry.Cid); err != nil {
+			return err
+		}
+		deleted = append(deleted, entry.Cid)
+	}
+
+	if len(deleted) == 0 {
+		return nil
+	}
+	return eventLog.DeleteEventsByCid(tenant, deleted)
+}
+
+// validateContextId checks the contextId of an initial protocol write: it is
+// the recordId for a root record, and the parent's contextId followed by the
+// recordId otherwise.
+func (h *RecordsWriteHandler) validateContextId(tenant Tenant, message *RecordsWrite) error {
+	descriptor := message.Descriptor
+	if descriptor.Protocol == "" {
+		return nil
+	}
+
+	expected := message.RecordId
+	if descriptor.ParentId != "" {
+		parents, err := queryMessageEntries(h.messageStore, tenant, []Filter{
+			NewEqualFilter("interface", S(InterfaceRecords)),
+			NewEqualFilter("method", S(MethodWrite)),
+			NewEqualFilter("recordId", S(descriptor.ParentId)),
+		})
+		if err != nil {
+			return err
+		}
+		parent := newestMessage(parents)
+		if parent == nil {
+			return newStatusError(400, "parent record %s not found", descriptor.ParentId)
+		}
+		if parent.descriptorStr("protocol") != descriptor.Protocol {
+			return newStatusError(400, "parent record %s belongs to a different protocol", descriptor.ParentId)
+		}
+		expected = getPathedStrNoErr(parent.Message, "contextId") + "/" + message.RecordId
+	}
+
+	if message.ContextId != expected {
+		return newStatusError(400, "contextId %s does not match expected %s", message.ContextId, expected)
+	}
+	return nil
+}
+
+// authorizeProtocolWrite checks a protocol RecordsWrite against the
+// installed definition of its protocol.  The tenant may write any record that
+// fits the structure of the protocol; anyone else also needs an `$actions`
+// rule that lets them create or update the record.  initialWrite is nil for
+// the initial write of a record.
+func (h *RecordsWriteHandler) authorizeProtocolWrite(tenant Tenant, author string, byTenant bool,
+	message *RecordsWrite, initialWrite *messageEntry) error {
+	descriptor := message.Descriptor
+	authorizer, err := newProtocolAuthorizer(h.messageStore, tenant, descriptor.Protocol)
+	if err != nil {
+		return err
+	}
+	if authorizer == nil {
+		return newStatusError(400, "protocol %s is not installed", descriptor.Protocol)
+	}
+
+	ancestors, err := fetchAncestors(h.messageStore, tenant, string(descriptor.ParentId))
+	if err != nil {
+		return err
+	}
+	if err := authorizer.validateStructure(message, ancestors); err != nil {
+		return err
+	}
+	if initialWrite == nil {
+		if err := authorizer.validateRoleRecord(message); err != nil {
+			return err
+		}
+	}
+
+	if byTenant {
+		return nil
+	}
+
+	protocolRole, err := signatureProtocolRole(message.Authorization.Signature)
+	if err != nil {
+		return &statusError{Code: 400, Err: err}
+	}
+	request := protocolRequest{
+		Requester:    author,
+		ProtocolRole: protocolRole,
+		ProtocolPath: descriptor.ProtocolPath,
+		ContextId:    message.ContextId,
+		Records:      ancestors,
+		Actions:      []string{ActionCreate},
+	}
+	if initialWrite != nil {
+		initialAuthor, err := initialWrite.author()
+		if err != nil {
+			return err
+		}
+		request.Records = append(request.Records, *initialWrite)
+		request.Actions = []string{ActionCoUpdate}
+		if initialAuthor == author {
+			request.Actions = append(request.Actions, ActionUpdate)
+		}
+	}
+	return authorizer.authorize(request)
+}
+
+func parseRecordsWrite(rawMessage map[string]interface{}) (*RecordsWrite, error) {
+	var message RecordsWrite
+	if err := parseMessage(rawMessage, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// owner returns the owner who signed a RecordsWrite in addition to its
+// author, or "" if there is no owner signature.  The owner may act under a
+// delegated grant of their own.
+func (m *RecordsWrite) owner(messageStore MessageStore, tenant Tenant, rawMessage map[string]interface{}) (string, error) {
+	ownerSignature := m.Authorization.OwnerSignature
+	if ownerSignature == nil {
+		if m.Authorization.OwnerDelegatedGrant != nil {
+			return "", newStatusError(400, "ownerDelegatedGrant requires an ownerSignature")
+		}
+		return "", nil
+	}
+
+	if grant := rawDelegatedGrant(rawMessage, "ownerDelegatedGrant"); grant != nil {
+		if err := verifyDelegatedGrant(messageStore, tenant, *ownerSignature, grant, m.grantedAction()); err != nil {
+			return "", err
+		}
+	}
+	owner, err := messageAuthor(*ownerSignature, m.Authorization.OwnerDelegatedGrant)
+	if err != nil {
+		return "", &statusError{Code: 400, Err: err}
+	}
+	return owner, nil
+}
+
+// grantedAction describes the write for checking it against a grant.
+func (m *RecordsWrite) grantedAction() grantedAction {
+	descriptor := m.Descriptor
+	return grantedAction{
+		Interface:        InterfaceRecords,
+		Method:           MethodWrite,
+		MessageTimestamp: descriptor.MessageTimestamp,
+		Protocol:         descriptor.Protocol,
+		ContextId:        m.ContextId,
+		ProtocolPath:     descriptor.ProtocolPath,
+		Published:        &descriptor.Published,
+	}
+}
+
+// validateIntegrity checks the parts of a RecordsWrite that can be verified
+// from the message alone.
+func (m *RecordsWrite) validateIntegrity(entryId string) error {
+	descriptor := m.Descriptor
+	if descriptor.Interface != InterfaceRecords || descriptor.Method != MethodWrite {
+		return fmt.Errorf("expected %s%s message, got %s%s",
+			InterfaceRecords, MethodWrite, descriptor.Interface, descriptor.Method)
+	}
+	if m.RecordId == "" {
+		return errors.New("recordId is missing")
+	}
+	if err := cid.ValidateDataCid(string(descriptor.DataCid)); err != nil {
+		return err
+	}
+	if len(m.Authorization.Signature.Signatures) != 1 {
+		return errors.New("expected exactly one signature")
+	}
+
+	var payload utils.RecordsWriteSignaturePayload
+	if err := decodeSignaturePayload(m.Authorization.Signature, &payload); err != nil {
+		return err
+	}
+	if payload.RecordId != m.RecordId {
+		return fmt.Errorf("recordId %s does not match recordId %s in signature payload",
+			m.RecordId, payload.RecordId)
+	}
+	if payload.ContextId != m.ContextId {
+		return fmt.Errorf("contextId %s does not match contextId %s in signature payload",
+			m.ContextId, payload.ContextId)
+	}
+
+	if entryId == m.RecordId && descriptor.DateCreated != descriptor.MessageTimestamp {
+		return errors.New("dateCreated must equal messageTimestamp for the initial write")
+	}
+
+	if descriptor.Protocol == "" {
+		if m.ContextId != "" || descriptor.ProtocolPath != "" || descriptor.ParentId != "" {
+			return errors.New("contextId, protocolPath and parentId require a protocol")
+		}
+	} else if m.ContextId == "" || descriptor.ProtocolPath == "" {
+		return errors.New("protocol records require a contextId and a protocolPath")
+	}
+
+	if descriptor.Published && descriptor.DatePublished == "" {
+		return errors.New("published records require a datePublished")
+	}
+	if !descriptor.Published && descriptor.DatePublished != "" {
+		return errors.New("datePublished is only allowed on published records")
+	}
+
+	return nil
+}
+
+// recordsWriteEntryId returns the entryId of a RecordsWrite: the CID of its
+// descriptor together with its author.  The recordId of a record is the
+// entryId of its initial write.
+func recordsWriteEntryId(rawMessage map[string]interface{}, author string) (string, error) {
+	descriptor, ok := rawMessage["descriptor"].(map[string]interface{})
+	if !ok {
+		return "", errors.New("descriptor is missing")
+	}
+
+	entryIdInput := make(map[string]interface{}, len(descriptor)+1)
+	for k, v := range descriptor {
+		entryIdInput[k] = v
+	}
+	entryIdInput["author"] = author
+
+	return computeCid(entryIdInput)
+}
+
+// findInitialWrite returns the initial write among the messages of a record,
+// or nil if it is not there.
+func findInitialWrite(entries []messageEntry) (*messageEntry, error) {
+	for i, entry := range entries {
+		if entry.interfaceMethod() != InterfaceRecords+MethodWrite {
+			continue
+		}
+		message, err := parseRecordsWrite(entry.Message)
+		if err != nil {
+			return nil, err
+		}
+		author, err := messageAuthor(message.Authorization.Signature, message.Authorization.AuthorDelegatedGrant)
+		if err != nil {
+			return nil, err
+		}
+		entryId, err := recordsWriteEntryId(entry.Message, author)
+		if err != nil {
+			return nil, err
+		}
+		if entryId == message.RecordId {
+			return &entries[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func validateImmutableProperties(message, initialWrite map[string]interface{}) error {
+	descriptor, _ := message["descriptor"].(map[string]interface{})
+	initialDescriptor, _ := initialWrite["descriptor"].(map[string]interface{})
+	for _, property := range immutableDescriptorProperties {
+		if !reflect.DeepEqual(descriptor[property], initialDescriptor[property]) {
+			return fmt.Errorf("%s is immutable and must match the initial write", property)
+		}
+	}
+	if !reflect.DeepEqual(message["contextId"], initialWrite["contextId"]) {
+		return errors.New("contextId is immutable and must match the initial write")
+	}
+	return nil
+}
+
+// verifyData checks that data matches the dataCid and dataSize of a
+// descriptor.
+func verifyData(descriptor Descriptor, data io.Reader) error {
+	dataCid, dataSize, err := computeDataCid(data)
+	if err != nil {
+		return err
+	}
+	if dataCid != descriptor.DataCid {
+		return fmt.Errorf("data CID %s does not match descriptor dataCid %s", dataCid, descriptor.DataCid)
+	}
+	if dataSize != descriptor.DataSize {
+		return fmt.Errorf("data size %d does not match descriptor dataSize %d", dataSize, descriptor.DataSize)
+	}
+	return nil
+}
+
+// recordsWriteIndexes returns the properties a RecordsWrite is indexed by.
+// Tags are indexed as "tag.<name>"; only scalar tag values are indexed.
+func recordsWriteIndexes(message *RecordsWrite, author string, isLatestBaseState bool) IndexableKeyValues {
+	descriptor := message.Descriptor
+	indexes := IndexableKeyValues{
+		"interface":         S(descriptor.Interface),
+		"method":            S(descriptor.Method),
+		"recordId":          S(message.RecordId),
+		"author":            S(author),
+		"messageTimestamp":  S(descriptor.MessageTimestamp),
+		"dateCreated":       S(descriptor.DateCreated),
+		"dataCid":           S(descriptor.DataCid),
+		"dataSize":          I(descriptor.DataSize),
+		"dataFormat":        S(descriptor.DataFormat),
+		"published":         B(descriptor.Published),
+		"isLatestBaseState": B(isLatestBaseState),
+	}
+
+	optional := map[string]string{
+		"contextId":     message.ContextId,
+		"schema":        descriptor.Schema,
+		"protocol":      descriptor.Protocol,
+		"protocolPath":  descriptor.ProtocolPath,
+		"recipient":     string(descriptor.Recipient),
+		"parentId":      string(descriptor.ParentId),
+		"datePublished": descriptor.DatePublished,
+	}
+	for property, value := range optional {
+		if value != "" {
+			indexes[property] = S(value)
+		}
+	}
+
+	for name, value := range descriptor.Tags {
+		switch v := value.(type) {
+		case string:
+			indexes["tag."+name] = S(v)
+		case float64:
+			indexes["tag."+name] = F(v)
+		case bool:
+			indexes["tag."+name] = B(v)
+		}
+	}
+
+	return indexes
+}
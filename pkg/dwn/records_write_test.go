@@ -0,0 +1,244 @@
+package dwn
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func queryRecord(t *testing.T, dwn *Dwn, tenant string, recordId string) []messageEntry {
+	t.Helper()
+	entries, err := queryMessageEntries(dwn.messageStore, Tenant(tenant), []Filter{
+		NewEqualFilter("recordId", S(recordId)),
+	})
+	require.NoError(t, err)
+	return entries
+}
+
+func TestRecordsWrite(t *testing.T) {
+	alice := newTestPersona(t)
+
+	t.Run("stores small data inline", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		message, data := newTestRecordsWrite(t, alice, testRecordsWrite{})
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		entries := queryRecord(t, dwn, alice.URI, message["recordId"].(string))
+		require.Len(t, entries, 1)
+		encodedData, _ := entries[0].Message["encodedData"].(string)
+		decoded, err := base64.RawURLEncoding.DecodeString(encodedData)
+		require.NoError(t, err)
+		assert.Equal(t, data, decoded)
+
+		events, err := dwn.eventLog.GetEvents(Tenant(alice.URI))
+		require.NoError(t, err)
+		assert.Equal(t, []string{string(entries[0].Cid)}, events)
+	})
+
+	t.Run("stores large data in the data store", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		data := bytes.Repeat([]byte("a"), MaxEncodedDataSize+1)
+		message, _ := newTestRecordsWrite(t, alice, testRecordsWrite{data: data})
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		entries := queryRecord(t, dwn, alice.URI, message["recordId"].(string))
+		require.Len(t, entries, 1)
+		assert.NotContains(t, entries[0].Message, "encodedData")
+
+		dataCid := DataCid(entries[0].descriptorStr("dataCid"))
+		_, _, stream, err := dwn.dataStore.Get(Tenant(alice.URI), entries[0].Cid, dataCid)
+		require.NoError(t, err)
+		require.NotNil(t, stream)
+		stored, err := io.ReadAll(stream)
+		require.NoError(t, err)
+		assert.Equal(t, data, stored)
+	})
+
+	t.Run("newer write supersedes older writes", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		initial, initialData := newTestRecordsWrite(t, alice, testRecordsWrite{})
+		first, firstData := newTestRecordsWrite(t, alice, testRecordsWrite{update: initial})
+		second, secondData := newTestRecordsWrite(t, alice, testRecordsWrite{update: initial})
+
+		for _, write := range []struct {
+			message map[string]interface{}
+			data    []byte
+		}{{initial, initialData}, {first, firstData}, {second, secondData}} {
+			reply, err := dwn.ProcessMessage(alice.URI, write.message, bytes.NewReader(write.data))
+			require.NoError(t, err)
+			require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+		}
+
+		entries := queryRecord(t, dwn, alice.URI, initial["recordId"].(string))
+		require.Len(t, entries, 2)
+
+		latest, err := queryMessageEntries(dwn.messageStore, Tenant(alice.URI), []Filter{
+			NewEqualFilter("recordId", S(initial["recordId"].(string))),
+			NewEqualFilter("isLatestBaseState", B(true)),
+		})
+		require.NoError(t, err)
+		require.Len(t, latest, 1)
+		assert.Equal(t, second["descriptor"], latest[0].Message["descriptor"])
+
+		events, err := dwn.eventLog.GetEvents(Tenant(alice.URI))
+		require.NoError(t, err)
+		assert.Len(t, events, 2)
+
+		reply, err := dwn.ProcessMessage(alice.URI, first, bytes.NewReader(firstData))
+		require.NoError(t, err)
+		assert.Equal(t, 409, reply.Status.Code)
+	})
+
+	t.Run("rejects duplicate writes", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		message, data := newTestRecordsWrite(t, alice, testRecordsWrite{})
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 409, reply.Status.Code)
+	})
+
+	t.Run("reuses data of the newest write", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		initial, data := newTestRecordsWrite(t, alice, testRecordsWrite{})
+		update, _ := newTestRecordsWrite(t, alice, testRecordsWrite{update: initial, data: data})
+
+		reply, err := dwn.ProcessMessage(alice.URI, initial, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI, update, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+	})
+
+	t.Run("requires data for updates", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		initial, data := newTestRecordsWrite(t, alice, testRecordsWrite{})
+		update, _ := newTestRecordsWrite(t, alice, testRecordsWrite{update: initial})
+
+		reply, err := dwn.ProcessMessage(alice.URI, initial, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI, update, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+
+	t.Run("rejects data not matching dataCid", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		message, _ := newTestRecordsWrite(t, alice, testRecordsWrite{})
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader([]byte("other data")))
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+
+	t.Run("rejects a dataCid that is not a data CID", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		messageCid, err := computeCid(map[string]interface{}{})
+		require.NoError(t, err)
+		message, err := NewRecordsWrite(RecordsWriteOptions{
+			DataCid:       DataCid(messageCid),
+			DataSize:      5,
+			Authorization: AuthorizationOptions{Signer: &alice},
+		})
+		require.NoError(t, err)
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+		assert.Contains(t, reply.Status.Detail, "unexpected codec")
+	})
+
+	t.Run("rejects recordId not matching the signature", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		message, data := newTestRecordsWrite(t, alice, testRecordsWrite{})
+		other, _ := newTestRecordsWrite(t, alice, testRecordsWrite{})
+		message["recordId"] = other["recordId"]
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+
+	t.Run("rejects changes to immutable properties", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		initial, data := newTestRecordsWrite(t, alice, testRecordsWrite{})
+		update, updateData := newTestRecordsWrite(t, alice, testRecordsWrite{update: initial})
+		update["descriptor"].(map[string]interface{})["schema"] = "https://example.com/schema"
+		update = resignTestRecordsWrite(t, alice, update)
+
+		reply, err := dwn.ProcessMessage(alice.URI, initial, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI, update, bytes.NewReader(updateData))
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+
+	t.Run("rejects writes by other authors", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		bob := newTestPersona(t)
+		message, data := newTestRecordsWrite(t, bob, testRecordsWrite{})
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 401, reply.Status.Code)
+	})
+
+	t.Run("derives contextId from the parent record", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		definition := loadTestProtocolDefinition(t, "chat.json")
+		configureTestProtocol(t, dwn, alice, definition)
+		protocol := definition["protocol"].(string)
+		thread, threadData := newTestRecordsWrite(t, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread", schema: "thread",
+		})
+		message, messageData := newTestRecordsWrite(t, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread/message", schema: "message", parent: thread,
+		})
+		assert.Equal(t, thread["contextId"].(string)+"/"+message["recordId"].(string), message["contextId"])
+
+		reply, err := dwn.ProcessMessage(alice.URI, thread, bytes.NewReader(threadData))
+		require.NoError(t, err)
+		require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+		reply, err = dwn.ProcessMessage(alice.URI, message, bytes.NewReader(messageData))
+		require.NoError(t, err)
+		assert.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+	})
+
+	t.Run("rejects a child written before its parent", func(t *testing.T) {
+		dwn := NewTestDwn(t)
+		definition := loadTestProtocolDefinition(t, "chat.json")
+		configureTestProtocol(t, dwn, alice, definition)
+		protocol := definition["protocol"].(string)
+		thread, _ := newTestRecordsWrite(t, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread", schema: "thread",
+		})
+		message, messageData := newTestRecordsWrite(t, alice, testRecordsWrite{
+			protocol: protocol, protocolPath: "thread/message", schema: "message", parent: thread,
+		})
+
+		reply, err := dwn.ProcessMessage(alice.URI, message, bytes.NewReader(messageData))
+		require.NoError(t, err)
+		assert.Equal(t, 400, reply.Status.Code)
+	})
+}
@@ -0,0 +1,281 @@
+// Package server serves a DWN over HTTP, speaking the JSON-RPC protocol of
+// the reference dwn-server.
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/jsonrpc"
+	"golang.org/x/net/websocket"
+)
+
+// DefaultMaxFileSize is the largest request body, in bytes, accepted when
+// Config.MaxFileSize is not set.
+const DefaultMaxFileSize = 1 << 30
+
+// maxRequestSize bounds a JSON-RPC request sent as the HTTP body.
+const maxRequestSize = 1 << 20
+
+// DefaultMaxSubscriptions is the number of subscriptions a WebSocket
+// connection may hold open when Config.MaxSubscriptions is not set.
+const DefaultMaxSubscriptions = 100
+
+// DefaultMaxMessageSize is the largest WebSocket message, in bytes, accepted
+// when Config.MaxMessageSize is not set.
+const DefaultMaxMessageSize = 10 << 20
+
+// MessageProcessor processes DWN messages; *dwn.Dwn is one.
+type MessageProcessor interface {
+	ProcessMessage(tenant string, rawMessage map[string]interface{}, dataStream io.Reader) (dwn.UnionMessageReply, error)
+	ProcessSubscription(tenant string, rawMessage map[string]interface{},
+		handler dwn.SubscriptionHandler) (dwn.UnionMessageReply, error)
+}
+
+type Config struct {
+	// Version is reported by /info.
+	Version string
+	// MaxFileSize is the largest record data accepted, in bytes.
+	MaxFileSize int64
+
+	// MaxSubscriptions is the number of subscriptions a WebSocket
+	// connection may hold open.
+	MaxSubscriptions int
+	// MaxMessageSize is the largest WebSocket message accepted, in bytes.
+	MaxMessageSize int
+}
+
+// Server is an http.Handler serving:
+//
+//	POST /        JSON-RPC requests, see ServeRPC
+//	GET  /        JSON-RPC over WebSocket, see ServeSocket
+//	GET  /health  liveness
+//	GET  /info    server information
+type Server struct {
+	dwn    MessageProcessor
+	config Config
+	mux    *http.ServeMux
+}
+
+func New(dwn MessageProcessor, config Config) *Server {
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = DefaultMaxFileSize
+	}
+	if config.MaxSubscriptions <= 0 {
+		config.MaxSubscriptions = DefaultMaxSubscriptions
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = DefaultMaxMessageSize
+	}
+
+	s := &Server{dwn: dwn, config: config, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /health", s.serveHealth)
+	s.mux.HandleFunc("GET /info", s.serveInfo)
+	s.mux.HandleFunc("POST /{$}", s.ServeRPC)
+	s.mux.Handle("GET /{$}", websocket.Server{Handler: s.ServeSocket})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]interface{}{"ok": true})
+}
+
+// Info is the body of /info.
+type Info struct {
+	Server                   string   `json:"server"`
+	Version                  string   `json:"version,omitempty"`
+	MaxFileSize              int64    `json:"maxFileSize"`
+	RegistrationRequirements []string `json:"registrationRequirements"`
+	WebSocketSupport         bool     `json:"webSocketSupport"`
+}
+
+func (s *Server) serveInfo(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, Info{
+		Server:                   "abaxx-id-dwn",
+		Version:                  s.config.Version,
+		MaxFileSize:              s.config.MaxFileSize,
+		RegistrationRequirements: []string{},
+		WebSocketSupport:         true,
+	})
+}
+
+// ServeRPC serves a JSON-RPC request.  The request is either the body, or,
+// when the message comes with data, the dwn-request header with the data as
+// the body.  Likewise the response is the body, unless the reply carries
+// record data: then the response is in the dwn-response header and the data
+// is streamed as the body.
+func (s *Server) ServeRPC(w http.ResponseWriter, r *http.Request) {
+	var request jsonrpc.Request
+	var dataStream io.Reader
+	if header := r.Header.Get(jsonrpc.HeaderDwnRequest); header != "" {
+		if err := json.Unmarshal([]byte(header), &request); err != nil {
+			writeRpcError(w, jsonrpc.NewError("", jsonrpc.ParseError, "malformed %s header: %v",
+				jsonrpc.HeaderDwnRequest, err))
+			return
+		}
+		if r.ContentLength != 0 {
+			dataStream = http.MaxBytesReader(w, r.Body, s.config.MaxFileSize)
+		}
+	} else {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if err != nil {
+			writeRpcError(w, jsonrpc.NewError("", jsonrpc.ParseError, "failed to read request: %v", err))
+			return
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeRpcError(w, jsonrpc.NewError("", jsonrpc.ParseError, "malformed request: %v", err))
+			return
+		}
+	}
+
+	if rpcErr := checkRequest(&request); rpcErr != nil {
+		writeRpcError(w, rpcErr)
+		return
+	}
+	if request.Method != jsonrpc.MethodProcessMessage {
+		writeRpcError(w, jsonrpc.NewError(request.Id, jsonrpc.MethodNotFound, "unknown method %q", request.Method))
+		return
+	}
+	params, rpcErr := parseProcessMessageParams(&request)
+	if rpcErr != nil {
+		writeRpcError(w, rpcErr)
+		return
+	}
+	if isSubscription(params.Message) {
+		writeRpcError(w, jsonrpc.NewError(request.Id, jsonrpc.InvalidRequest,
+			"subscriptions are only supported over WebSocket"))
+		return
+	}
+	if dataStream == nil {
+		dataStream, rpcErr = decodeData(&request, params)
+		if rpcErr != nil {
+			writeRpcError(w, rpcErr)
+			return
+		}
+	}
+
+	reply, rpcErr := s.processMessage(&request, params, dataStream)
+	if rpcErr != nil {
+		writeRpcError(w, rpcErr)
+		return
+	}
+	// MessagesGet data too large to be inlined is not carried over HTTP; it
+	// can be fetched with RecordsRead.
+	reply.EntryData = nil
+
+	data := reply.Data
+	if data != nil {
+		reply.Data = nil
+		if closer, ok := data.(io.Closer); ok {
+			defer closer.Close()
+		}
+	}
+	response, err := jsonrpc.NewResult(request.Id, jsonrpc.ProcessMessageResult{Reply: reply})
+	if err != nil {
+		writeRpcError(w, jsonrpc.NewError(request.Id, jsonrpc.InternalError, "%v", err))
+		return
+	}
+	if data == nil {
+		writeJson(w, http.StatusOK, response)
+		return
+	}
+
+	header, err := json.Marshal(response)
+	if err != nil {
+		writeRpcError(w, jsonrpc.NewError(request.Id, jsonrpc.InternalError, "%v", err))
+		return
+	}
+	w.Header().Set(jsonrpc.HeaderDwnResponse, string(header))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	// The status is sent; a failure now can only cut the data short.
+	_, _ = io.Copy(w, data)
+}
+
+func checkRequest(request *jsonrpc.Request) *jsonrpc.Response {
+	if request.JsonRpc != jsonrpc.Version {
+		return jsonrpc.NewError(request.Id, jsonrpc.InvalidRequest, "unsupported JSON-RPC version %q", request.JsonRpc)
+	}
+	return nil
+}
+
+func parseProcessMessageParams(request *jsonrpc.Request) (*jsonrpc.ProcessMessageParams, *jsonrpc.Response) {
+	var params jsonrpc.ProcessMessageParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		return nil, jsonrpc.NewError(request.Id, jsonrpc.InvalidParams, "malformed params: %v", err)
+	}
+	if params.Target == "" {
+		return nil, jsonrpc.NewError(request.Id, jsonrpc.InvalidParams, "target is required")
+	}
+	if params.Message == nil {
+		return nil, jsonrpc.NewError(request.Id, jsonrpc.InvalidParams, "message is required")
+	}
+	return &params, nil
+}
+
+// decodeData returns the data given as encodedData, if any.
+func decodeData(request *jsonrpc.Request, params *jsonrpc.ProcessMessageParams) (io.Reader, *jsonrpc.Response) {
+	if params.EncodedData == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(params.EncodedData)
+	if err != nil {
+		return nil, jsonrpc.NewError(request.Id, jsonrpc.InvalidParams, "malformed encodedData: %v", err)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// isSubscription reports whether message is a RecordsSubscribe or
+// MessagesSubscribe, which need a transport that can push events.
+func isSubscription(message map[string]interface{}) bool {
+	descriptor, ok := message["descriptor"].(map[string]interface{})
+	return ok && descriptor["method"] == dwn.MethodSubscribe
+}
+
+// processMessage runs a dwn.processMessage request.
+func (s *Server) processMessage(request *jsonrpc.Request, params *jsonrpc.ProcessMessageParams,
+	dataStream io.Reader) (dwn.UnionMessageReply, *jsonrpc.Response) {
+	reply, err := s.dwn.ProcessMessage(params.Target, params.Message, dataStream)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return dwn.UnionMessageReply{}, jsonrpc.NewError(request.Id, jsonrpc.InvalidRequest,
+				"data exceeds the maximum size of %d bytes", maxBytesErr.Limit)
+		}
+		return dwn.UnionMessageReply{}, jsonrpc.NewError(request.Id, jsonrpc.InternalError,
+			"failed to process message: %v", err)
+	}
+	return reply, nil
+}
+
+func writeRpcError(w http.ResponseWriter, response *jsonrpc.Response) {
+	status := http.StatusBadRequest
+	switch response.Error.Code {
+	case jsonrpc.MethodNotFound:
+		status = http.StatusNotFound
+	case jsonrpc.InternalError:
+		status = http.StatusInternalServerError
+	}
+	writeJson(w, status, response)
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(encoded)
+}
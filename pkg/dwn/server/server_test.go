@@ -0,0 +1,379 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	_did "github.com/abaxxtech/abaxx-id-go/pkg/dids/did"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dids/didjwk"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/jsonrpc"
+	"github.com/abaxxtech/abaxx-id-go/pkg/store/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProcessor records the messages it processes and replies with reply.
+type testProcessor struct {
+	reply   dwn.UnionMessageReply
+	tenant  string
+	message map[string]interface{}
+	data    []byte
+
+	mu            sync.Mutex
+	subscriptions []*testSubscription
+}
+
+func (p *testProcessor) ProcessMessage(tenant string, rawMessage map[string]interface{},
+	dataStream io.Reader) (dwn.UnionMessageReply, error) {
+	p.tenant, p.message, p.data = tenant, rawMessage, nil
+	if dataStream != nil {
+		data, err := io.ReadAll(dataStream)
+		if err != nil {
+			return dwn.UnionMessageReply{}, err
+		}
+		p.data = data
+	}
+	return p.reply, nil
+}
+
+func (p *testProcessor) ProcessSubscription(tenant string, rawMessage map[string]interface{},
+	handler dwn.SubscriptionHandler) (dwn.UnionMessageReply, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tenant, p.message = tenant, rawMessage
+	subscription := &testSubscription{id: fmt.Sprintf("subscription-%d", len(p.subscriptions)), handler: handler}
+	p.subscriptions = append(p.subscriptions, subscription)
+	return dwn.UnionMessageReply{Status: dwn.Status{Code: 200}, Subscription: subscription}, nil
+}
+
+// lastSubscription returns the subscription opened last.
+func (p *testProcessor) lastSubscription() *testSubscription {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.subscriptions[len(p.subscriptions)-1]
+}
+
+type testSubscription struct {
+	id      string
+	handler dwn.SubscriptionHandler
+	closed  atomic.Bool
+}
+
+func (s *testSubscription) Id() string {
+	return s.id
+}
+
+func (s *testSubscription) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func newTestRequest(t *testing.T, method string, params interface{}) []byte {
+	t.Helper()
+	request, err := jsonrpc.NewRequest("test-id", method, params)
+	require.NoError(t, err)
+	encoded, err := json.Marshal(request)
+	require.NoError(t, err)
+	return encoded
+}
+
+func testMessage(method string) map[string]interface{} {
+	return map[string]interface{}{
+		"descriptor": map[string]interface{}{"interface": dwn.InterfaceRecords, "method": method},
+	}
+}
+
+func decodeTestResponse(t *testing.T, encoded []byte) (jsonrpc.Response, dwn.UnionMessageReply) {
+	t.Helper()
+	var response jsonrpc.Response
+	require.NoError(t, json.Unmarshal(encoded, &response))
+	var result jsonrpc.ProcessMessageResult
+	if response.Result != nil {
+		require.NoError(t, json.Unmarshal(response.Result, &result))
+	}
+	return response, result.Reply
+}
+
+func TestServeRPC(t *testing.T) {
+	processor := &testProcessor{reply: dwn.UnionMessageReply{Status: dwn.Status{Code: 202}}}
+	server := httptest.NewServer(New(processor, Config{MaxFileSize: 16}))
+	defer server.Close()
+
+	params := jsonrpc.ProcessMessageParams{Target: "did:example:alice", Message: testMessage(dwn.MethodWrite)}
+
+	t.Run("processes a message in the body", func(t *testing.T) {
+		resp, err := http.Post(server.URL, "application/json",
+			bytes.NewReader(newTestRequest(t, jsonrpc.MethodProcessMessage, params)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		response, reply := decodeTestResponse(t, body)
+		assert.Equal(t, "test-id", response.Id)
+		assert.Nil(t, response.Error)
+		assert.Equal(t, 202, reply.Status.Code)
+		assert.Equal(t, "did:example:alice", processor.tenant)
+		assert.Equal(t, params.Message, processor.message)
+		assert.Nil(t, processor.data)
+	})
+
+	t.Run("takes data as the body with the message in the dwn-request header", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("some data"))
+		require.NoError(t, err)
+		req.Header.Set(jsonrpc.HeaderDwnRequest, string(newTestRequest(t, jsonrpc.MethodProcessMessage, params)))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, []byte("some data"), processor.data)
+	})
+
+	t.Run("rejects data over the maximum size", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(strings.Repeat("a", 17)))
+		require.NoError(t, err)
+		req.Header.Set(jsonrpc.HeaderDwnRequest, string(newTestRequest(t, jsonrpc.MethodProcessMessage, params)))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		response, _ := decodeTestResponse(t, body)
+		require.NotNil(t, response.Error)
+		assert.Equal(t, jsonrpc.InvalidRequest, response.Error.Code)
+	})
+
+	t.Run("streams record data with the response in the dwn-response header", func(t *testing.T) {
+		processor.reply = dwn.UnionMessageReply{
+			Status: dwn.Status{Code: 200},
+			Record: map[string]interface{}{"recordId": "a-record"},
+			Data:   strings.NewReader("record data"),
+		}
+		defer func() { processor.reply = dwn.UnionMessageReply{Status: dwn.Status{Code: 202}} }()
+
+		readParams := jsonrpc.ProcessMessageParams{Target: "did:example:alice", Message: testMessage(dwn.MethodRead)}
+		resp, err := http.Post(server.URL, "application/json",
+			bytes.NewReader(newTestRequest(t, jsonrpc.MethodProcessMessage, readParams)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "record data", string(body))
+		_, reply := decodeTestResponse(t, []byte(resp.Header.Get(jsonrpc.HeaderDwnResponse)))
+		assert.Equal(t, 200, reply.Status.Code)
+		assert.Equal(t, "a-record", reply.Record["recordId"])
+	})
+
+	t.Run("reports JSON-RPC errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			body   []byte
+			status int
+			code   jsonrpc.ErrorCode
+		}{
+			{"malformed request", []byte("{"), http.StatusBadRequest, jsonrpc.ParseError},
+			{"wrong version", []byte(`{"jsonrpc":"1.0","method":"dwn.processMessage"}`),
+				http.StatusBadRequest, jsonrpc.InvalidRequest},
+			{"unknown method", newTestRequest(t, "dwn.unknown", params), http.StatusNotFound, jsonrpc.MethodNotFound},
+			{"missing target", newTestRequest(t, jsonrpc.MethodProcessMessage,
+				jsonrpc.ProcessMessageParams{Message: params.Message}), http.StatusBadRequest, jsonrpc.InvalidParams},
+			{"missing message", newTestRequest(t, jsonrpc.MethodProcessMessage,
+				jsonrpc.ProcessMessageParams{Target: params.Target}), http.StatusBadRequest, jsonrpc.InvalidParams},
+			{"subscription", newTestRequest(t, jsonrpc.MethodProcessMessage, jsonrpc.ProcessMessageParams{
+				Target: params.Target, Message: testMessage(dwn.MethodSubscribe),
+			}), http.StatusBadRequest, jsonrpc.InvalidRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp, err := http.Post(server.URL, "application/json", bytes.NewReader(tt.body))
+				require.NoError(t, err)
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+
+				assert.Equal(t, tt.status, resp.StatusCode)
+				response, _ := decodeTestResponse(t, body)
+				require.NotNil(t, response.Error)
+				assert.Equal(t, tt.code, response.Error.Code)
+			})
+		}
+	})
+}
+
+func TestHealthAndInfo(t *testing.T) {
+	server := httptest.NewServer(New(&testProcessor{}, Config{Version: "1.2.3"}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/info")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var info Info
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, int64(DefaultMaxFileSize), info.MaxFileSize)
+	assert.True(t, info.WebSocketSupport)
+}
+
+func TestServeDwn(t *testing.T) {
+	for _, storeConfig := range []StoreConfig{
+		{Backend: StoreMemory},
+		{Backend: StoreLevel},
+		{Backend: StoreSQL, DB: config.NewSQLiteConfig(":memory:")},
+	} {
+		t.Run(string(storeConfig.Backend), func(t *testing.T) {
+			storeConfig.DataDir = t.TempDir()
+			node, err := OpenDwn(storeConfig)
+			require.NoError(t, err)
+			defer node.Close()
+			server := httptest.NewServer(New(node, Config{}))
+			defer server.Close()
+
+			alice, err := didjwk.Create()
+			require.NoError(t, err)
+			query := map[string]interface{}{
+				"descriptor": map[string]interface{}{
+					"interface":        dwn.InterfaceProtocols,
+					"method":           dwn.MethodQuery,
+					"messageTimestamp": "2024-01-01T00:00:00.000000Z",
+				},
+			}
+			resp, err := http.Post(server.URL, "application/json", bytes.NewReader(newTestRequest(t,
+				jsonrpc.MethodProcessMessage, jsonrpc.ProcessMessageParams{Target: alice.URI, Message: query})))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			response, reply := decodeTestResponse(t, body)
+			require.Nil(t, response.Error)
+			assert.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+
+			// Data up to MaxEncodedDataSize is kept inline with its
+			// message, larger data in the data store
+			for name, size := range map[string]int{"inline": 16, "large": dwn.MaxEncodedDataSize + 1} {
+				t.Run(name, func(t *testing.T) {
+					testRecordRoundTrip(t, server.URL, alice, size)
+				})
+			}
+		})
+	}
+}
+
+// testRecordRoundTrip writes a record of size bytes to the DWN of alice at
+// url, then reads, updates, queries and deletes it.
+func testRecordRoundTrip(t *testing.T, url string, alice _did.BearerDID, size int) {
+	authorization := dwn.AuthorizationOptions{Signer: &alice}
+	schema := fmt.Sprintf("https://example.com/note-%d", size)
+	first := bytes.Repeat([]byte("a"), size)
+	second := bytes.Repeat([]byte("b"), size)
+
+	write, err := dwn.NewRecordsWrite(dwn.RecordsWriteOptions{Data: first, Schema: schema, Authorization: authorization})
+	require.NoError(t, err)
+	reply, _ := sendTestMessage(t, url, alice.URI, write, first)
+	require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+	recordId := write["recordId"].(string)
+
+	read := func() (dwn.UnionMessageReply, []byte) {
+		message, err := dwn.NewRecordsRead(dwn.RecordsReadOptions{
+			Filter: dwn.RecordsFilter{RecordId: recordId}, Authorization: authorization,
+		})
+		require.NoError(t, err)
+		return sendTestMessage(t, url, alice.URI, message, nil)
+	}
+	query := func() dwn.UnionMessageReply {
+		message, err := dwn.NewRecordsQuery(dwn.RecordsQueryOptions{
+			Filter: dwn.RecordsFilter{Schema: schema}, Authorization: authorization,
+		})
+		require.NoError(t, err)
+		reply, _ := sendTestMessage(t, url, alice.URI, message, nil)
+		require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+		return reply
+	}
+
+	reply, data := read()
+	require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+	assert.Equal(t, first, data)
+
+	update, err := dwn.NewRecordsWrite(dwn.RecordsWriteOptions{Data: second, Update: write, Authorization: authorization})
+	require.NoError(t, err)
+	reply, _ = sendTestMessage(t, url, alice.URI, update, second)
+	require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+	reply, data = read()
+	require.Equal(t, 200, reply.Status.Code, reply.Status.Detail)
+	assert.Equal(t, second, data)
+	entries := query().Entries
+	require.Len(t, entries, 1)
+	assert.Equal(t, update["descriptor"].(map[string]interface{})["dataCid"], entries[0]["descriptor"].(map[string]interface{})["dataCid"])
+	if size <= dwn.MaxEncodedDataSize {
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(second), entries[0]["encodedData"])
+	} else {
+		assert.NotContains(t, entries[0], "encodedData")
+	}
+
+	deletion, err := dwn.NewRecordsDelete(dwn.RecordsDeleteOptions{RecordId: recordId, Authorization: authorization})
+	require.NoError(t, err)
+	reply, _ = sendTestMessage(t, url, alice.URI, deletion, nil)
+	require.Equal(t, 202, reply.Status.Code, reply.Status.Detail)
+
+	assert.Empty(t, query().Entries)
+	reply, _ = read()
+	assert.Equal(t, 404, reply.Status.Code, reply.Status.Detail)
+}
+
+// sendTestMessage sends message to the DWN of target at url, with data in
+// the body unless it is nil, and returns the reply along with the record
+// data it streams, if any.
+func sendTestMessage(t *testing.T, url, target string, message map[string]interface{},
+	data []byte) (dwn.UnionMessageReply, []byte) {
+	t.Helper()
+	request := newTestRequest(t, jsonrpc.MethodProcessMessage,
+		jsonrpc.ProcessMessageParams{Target: target, Message: message})
+	body, contentType := request, "application/json"
+	if data != nil {
+		body, contentType = data, "application/octet-stream"
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	if data != nil {
+		req.Header.Set(jsonrpc.HeaderDwnRequest, string(request))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	if header := resp.Header.Get(jsonrpc.HeaderDwnResponse); header != "" {
+		response, reply := decodeTestResponse(t, []byte(header))
+		require.Nil(t, response.Error)
+		return reply, content
+	}
+	response, reply := decodeTestResponse(t, content)
+	require.Nil(t, response.Error)
+	return reply, nil
+}
@@ -0,0 +1,438 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/store"
+	"github.com/abaxxtech/abaxx-id-go/pkg/store/config"
+	"github.com/abaxxtech/abaxx-id-go/pkg/store/models"
+)
+
+// StoreBackend names where a DWN keeps its messages, data and events.
+type StoreBackend string
+
+const (
+	// StoreMemory keeps everything in memory, for tests and demos.
+	StoreMemory StoreBackend = "memory"
+	// StoreLevel keeps messages, data and events in LevelDB databases
+	// under StoreConfig.DataDir.
+	StoreLevel StoreBackend = "level"
+	// StoreSQL keeps messages, data and events in the database of
+	// StoreConfig.DB.
+	StoreSQL StoreBackend = "sql"
+)
+
+type StoreConfig struct {
+	Backend StoreBackend
+	// DataDir holds the LevelDB databases of the level backend, and the
+	// blockstore unless BlockstoreLocation is set.
+	DataDir            string
+	BlockstoreLocation string
+	// PrefixPartitions keeps the messages of all tenants in one LevelDB,
+	// under a key prefix per tenant, rather than in a LevelDB per tenant.
+	PrefixPartitions bool
+	DB               config.DBConfig
+}
+
+// OpenDwn creates a DWN over the stores config selects, resolving DIDs with
+// the default resolvers.  It supports subscriptions through an in-memory
+// event stream.
+func OpenDwn(config StoreConfig) (*dwn.Dwn, error) {
+	if config.DataDir == "" {
+		config.DataDir = "data"
+	}
+	if config.BlockstoreLocation == "" {
+		config.BlockstoreLocation = filepath.Join(config.DataDir, "blockstore")
+	}
+
+	dwnConfig := dwn.DwnConfig{
+		EventStream:        dwn.NewMemoryEventStream(),
+		BlockstoreLocation: config.BlockstoreLocation,
+	}
+	switch config.Backend {
+	case StoreMemory:
+		dwnConfig.MessageStore = dwn.NewMemoryMessageStore()
+		dwnConfig.DataStore = dwn.NewMemoryDatastore()
+		dwnConfig.EventLog = dwn.NewMemoryEventLog()
+	case StoreLevel:
+		messageStore, err := store.NewMessageStoreLevel(store.MessageStoreLevelConfig{
+			BlockstoreLocation: filepath.Join(config.DataDir, "messagestore", "blocks"),
+			IndexLocation:      filepath.Join(config.DataDir, "messagestore", "index"),
+			PrefixPartitions:   config.PrefixPartitions,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create message store: %w", err)
+		}
+		dataStore, err := store.NewDataStoreLevel(store.DataStoreLevelConfig{
+			BlockstoreLocation: filepath.Join(config.DataDir, "datastore"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create data store: %w", err)
+		}
+		eventLog, err := store.NewEventLogLevel(store.EventLogLevelConfig{
+			Location: filepath.Join(config.DataDir, "eventlog"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create event log: %w", err)
+		}
+		dwnConfig.MessageStore = NewLevelMessageStore(messageStore)
+		dwnConfig.DataStore = NewLevelDataStore(dataStore)
+		dwnConfig.EventLog = NewLevelEventLog(eventLog)
+	case StoreSQL:
+		// The stores share one database, closed with the last of them
+		sqlConfig := store.MessageStoreSQLConfig{DBProvider: models.NewDBProvider(config.DB)}
+		messageStore, err := store.NewMessageStoreSQL(sqlConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create message store: %w", err)
+		}
+		dataStore, err := store.NewDataStoreSQL(sqlConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create data store: %w", err)
+		}
+		eventLog, err := store.NewEventLogSQL(sqlConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create event log: %w", err)
+		}
+		dwnConfig.MessageStore = NewSQLMessageStore(messageStore)
+		dwnConfig.DataStore = NewSQLDataStore(dataStore)
+		dwnConfig.EventLog = NewSQLEventLog(eventLog)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", config.Backend)
+	}
+
+	return dwn.NewDwn(dwnConfig)
+}
+
+// eventLogStore is what store.EventLogSQL and store.EventLogLevel have in
+// common.
+type eventLogStore interface {
+	Open() error
+	Close() error
+	Clear() error
+	Append(tenant string, messageCid string, indexes store.KeyValues) error
+	GetEvents(tenant string, options *store.EventOptions) ([]string, error)
+	QueryEvents(tenant string, filters []store.Filter, options *store.EventOptions) ([]store.Event, error)
+	DeleteEventsByCid(tenant string, messageCids []string) error
+}
+
+// storeEventLog adapts an event log of the store package to dwn.EventLog.
+// Its watermarks are those the store gives events: the IDs the database
+// assigns them, or the counter of the LevelDB event log.
+type storeEventLog struct {
+	log eventLogStore
+}
+
+func NewSQLEventLog(eventLog *store.EventLogSQL) dwn.EventLog {
+	return &storeEventLog{log: eventLog}
+}
+
+func NewLevelEventLog(eventLog *store.EventLogLevel) dwn.EventLog {
+	return &storeEventLog{log: eventLog}
+}
+
+func (l *storeEventLog) Open() error {
+	return l.log.Open()
+}
+
+func (l *storeEventLog) Close() error {
+	return l.log.Close()
+}
+
+func (l *storeEventLog) Clear() error {
+	return l.log.Clear()
+}
+
+func (l *storeEventLog) Append(tenant dwn.Tenant, messageCid dwn.MessageCid, indexes dwn.IndexableKeyValues) error {
+	return l.log.Append(string(tenant), string(messageCid), storeKeyValues(indexes))
+}
+
+func (l *storeEventLog) GetEvents(tenant dwn.Tenant) ([]string, error) {
+	return l.log.GetEvents(string(tenant), nil)
+}
+
+func (l *storeEventLog) QueryEvents(tenant dwn.Tenant, filters []dwn.Filter, cursor dwn.EventLogCursor,
+	limit int) ([]dwn.EventLogEntry, error) {
+	storeFilters, err := toStoreFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	if len(storeFilters) == 0 {
+		return []dwn.EventLogEntry{}, nil
+	}
+	events, err := l.log.QueryEvents(string(tenant), storeFilters, &store.EventOptions{
+		Cursor: string(cursor),
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]dwn.EventLogEntry, len(events))
+	for i, event := range events {
+		entries[i] = dwn.EventLogEntry{
+			MessageCid: dwn.MessageCid(event.MessageCid),
+			Watermark:  dwn.EventLogCursor(event.Watermark),
+		}
+	}
+	return entries, nil
+}
+
+func (l *storeEventLog) DeleteEventsByCid(tenant dwn.Tenant, messageCids []dwn.MessageCid) error {
+	cids := make([]string, len(messageCids))
+	for i, messageCid := range messageCids {
+		cids[i] = string(messageCid)
+	}
+	return l.log.DeleteEventsByCid(string(tenant), cids)
+}
+
+// indexValue returns the Go value of an index value, as the store package
+// expects it.
+func indexValue(value dwn.IndexableValue) interface{} {
+	switch v := value.(type) {
+	case dwn.S:
+		return string(v)
+	case dwn.I:
+		return int64(v)
+	case dwn.F:
+		return float64(v)
+	case dwn.B:
+		return bool(v)
+	}
+	return nil
+}
+
+// splitEncodedData returns message without its inline data, and the data.
+func splitEncodedData(message interface{}) (map[string]interface{}, interface{}, error) {
+	rawMessage, err := toRawMessage(message)
+	if err != nil {
+		return nil, nil, err
+	}
+	encodedData, ok := rawMessage["encodedData"]
+	if !ok {
+		return rawMessage, nil, nil
+	}
+	stripped := make(map[string]interface{}, len(rawMessage)-1)
+	for k, v := range rawMessage {
+		if k != "encodedData" {
+			stripped[k] = v
+		}
+	}
+	return stripped, encodedData, nil
+}
+
+func toRawMessage(message interface{}) (map[string]interface{}, error) {
+	if rawMessage, ok := message.(map[string]interface{}); ok {
+		return rawMessage, nil
+	}
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize message: %w", err)
+	}
+	var rawMessage map[string]interface{}
+	if err := json.Unmarshal(encoded, &rawMessage); err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+	return rawMessage, nil
+}
+
+// fromStoredMessage returns a message decoded by a store in the form it was
+// received in: CBOR decodes maps with interface{} keys and integers as
+// integers, where JSON has string keys and float64 numbers.  Numbers matter,
+// as they change the CID of the message.
+func fromStoredMessage(message interface{}) (map[string]interface{}, error) {
+	if message == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(withStringKeys(message))
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize stored message: %w", err)
+	}
+	var rawMessage map[string]interface{}
+	if err := json.Unmarshal(encoded, &rawMessage); err != nil {
+		return nil, fmt.Errorf("failed to parse stored message: %w", err)
+	}
+	return rawMessage, nil
+}
+
+func withStringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			converted[fmt.Sprint(k)] = withStringKeys(value)
+		}
+		return converted
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			converted[k] = withStringKeys(value)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, value := range v {
+			converted[i] = withStringKeys(value)
+		}
+		return converted
+	}
+	return v
+}
+
+// conjunctions expands filters that must all match into alternatives, any
+// of which may match, each a list of property filters that must all match.
+func conjunctions(filters []dwn.Filter) [][]dwn.PropertyFilter {
+	alternatives := [][]dwn.PropertyFilter{{}}
+	for _, filter := range filters {
+		or, ok := filter.(dwn.OrFilter)
+		if !ok {
+			for i := range alternatives {
+				alternatives[i] = append(alternatives[i], dwn.PropertyFilter{
+					Name:   filter.Property(),
+					Filter: filter.Value(),
+				})
+			}
+			continue
+		}
+
+		expanded := [][]dwn.PropertyFilter{}
+		for _, anyOf := range or.AnyOf {
+			for _, tail := range conjunctions(anyOf) {
+				for _, head := range alternatives {
+					alternative := append(append([]dwn.PropertyFilter{}, head...), tail...)
+					expanded = append(expanded, alternative)
+				}
+			}
+		}
+		alternatives = expanded
+	}
+	return alternatives
+}
+
+func storeKeyValues(indexes dwn.IndexableKeyValues) store.KeyValues {
+	keyValues := make(store.KeyValues, len(indexes))
+	for k, v := range indexes {
+		keyValues[k] = indexValue(v)
+	}
+	return keyValues
+}
+
+// toStoreFilters translates filters into the filters of the store package,
+// any of which may match.  Each maps properties to an equal value, a list of
+// values for oneOf, or a store.RangeFilter with gt, gte, lt and lte bounds.
+func toStoreFilters(filters []dwn.Filter) ([]store.Filter, error) {
+	alternatives := conjunctions(filters)
+	storeFilters := make([]store.Filter, 0, len(alternatives))
+	for _, alternative := range alternatives {
+		storeFilter := store.Filter{}
+		for _, filter := range alternative {
+			if err := addStoreFilter(storeFilter, filter); err != nil {
+				return nil, err
+			}
+		}
+		storeFilters = append(storeFilters, storeFilter)
+	}
+	return storeFilters, nil
+}
+
+func addStoreFilter(storeFilter store.Filter, filter dwn.PropertyFilter) error {
+	var bound string
+	var value dwn.RangeValue
+	switch f := filter.Filter.(type) {
+	case dwn.EqualFilter:
+		return setStoreFilter(storeFilter, filter.Name, indexValue(f.EqualTo))
+	case dwn.OneOfFilter:
+		values := make([]interface{}, len(f.OneOf))
+		for i, equal := range f.OneOf {
+			values[i] = indexValue(equal.EqualTo)
+		}
+		return setStoreFilter(storeFilter, filter.Name, values)
+	case dwn.GT:
+		bound, value = "gt", f.GT
+	case dwn.GTE:
+		bound, value = "gte", f.GTE
+	case dwn.LT:
+		bound, value = "lt", f.LT
+	case dwn.LTE:
+		bound, value = "lte", f.LTE
+	default:
+		return fmt.Errorf("unsupported filter %T on %s", filter.Filter, filter.Name)
+	}
+
+	rangeValue, ok := value.(dwn.IndexableValue)
+	if !ok {
+		return fmt.Errorf("unsupported range value %T on %s", value, filter.Name)
+	}
+	existing, ok := storeFilter[filter.Name]
+	if !ok {
+		storeFilter[filter.Name] = store.RangeFilter{bound: indexValue(rangeValue)}
+		return nil
+	}
+	rangeFilter, ok := existing.(store.RangeFilter)
+	if !ok {
+		return fmt.Errorf("conflicting filters on %s", filter.Name)
+	}
+	rangeFilter[bound] = indexValue(rangeValue)
+	return nil
+}
+
+func setStoreFilter(storeFilter store.Filter, property string, value interface{}) error {
+	if _, ok := storeFilter[property]; ok {
+		return fmt.Errorf("conflicting filters on %s", property)
+	}
+	storeFilter[property] = value
+	return nil
+}
+
+func toStoreSort(sort dwn.MessageSort) *store.MessageSort {
+	direction := func(d dwn.SortDirection) *store.SortDirection {
+		if d == 0 {
+			return nil
+		}
+		sortDirection := store.SortAscending
+		if d == dwn.Descending {
+			sortDirection = store.SortDescending
+		}
+		return &sortDirection
+	}
+
+	storeSort := &store.MessageSort{
+		DateCreated:      direction(sort.DateCreated),
+		DatePublished:    direction(sort.DatePublished),
+		MessageTimestamp: direction(sort.MessageTimestamp),
+	}
+	if sort.Property != "" {
+		storeSort.Property = sort.Property
+		storeSort.Direction = string(store.SortAscending)
+		if sort.Direction == dwn.Descending {
+			storeSort.Direction = string(store.SortDescending)
+		}
+	}
+	return storeSort
+}
+
+// toStorePagination returns pagination in the form of the store package,
+// whose cursors are opaque.
+func toStorePagination(pagination dwn.Pagination) (*store.Pagination, error) {
+	storePagination := &store.Pagination{Limit: pagination.Limit}
+	if cursor := pagination.Cursor; cursor != nil {
+		encoded, err := store.EncodeCursor(store.PaginationCursor{MessageCid: cursor.MessageCid, Value: cursor.Value})
+		if err != nil {
+			return nil, err
+		}
+		storePagination.Cursor = encoded
+	}
+	return storePagination, nil
+}
+
+func fromStoreCursor(cursor string) (*dwn.PaginationCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	decoded, err := store.DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return &dwn.PaginationCursor{MessageCid: decoded.MessageCid, Value: decoded.Value}, nil
+}
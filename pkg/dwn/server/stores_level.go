@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/store"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// levelMessageStore adapts store.MessageStoreLevel to dwn.MessageStore.
+type levelMessageStore struct {
+	store *store.MessageStoreLevel
+}
+
+func NewLevelMessageStore(messageStore *store.MessageStoreLevel) dwn.MessageStore {
+	return &levelMessageStore{store: messageStore}
+}
+
+func (s *levelMessageStore) Open() error {
+	return s.store.Open()
+}
+
+func (s *levelMessageStore) Close() error {
+	return s.store.Close()
+}
+
+func (s *levelMessageStore) Clear() error {
+	return s.store.Clear()
+}
+
+func (s *levelMessageStore) Put(tenant dwn.Tenant, message interface{}, indexes dwn.IndexableKeyValues) error {
+	rawMessage, err := toRawMessage(message)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(string(tenant), rawMessage, storeKeyValues(indexes), nil)
+}
+
+func (s *levelMessageStore) Get(tenant dwn.Tenant, messageCid dwn.MessageCid) (interface{}, error) {
+	message, err := s.store.Get(string(tenant), string(messageCid), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromStoredMessage(message)
+}
+
+func (s *levelMessageStore) Query(tenant dwn.Tenant, filters []dwn.Filter, sort dwn.MessageSort,
+	pagination dwn.Pagination) ([]interface{}, *dwn.PaginationCursor, error) {
+	if pagination.Offset > 0 {
+		return nil, nil, errors.New("offset pagination is not supported by the LevelDB message store")
+	}
+	storeFilters, err := toStoreFilters(filters)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(storeFilters) == 0 {
+		return []interface{}{}, nil, nil
+	}
+
+	storePagination, err := toStorePagination(pagination)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages, cursor, err := s.store.Query(string(tenant), storeFilters, toStoreSort(sort), storePagination, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	results := make([]interface{}, 0, len(messages))
+	for _, message := range messages {
+		rawMessage, err := fromStoredMessage(message)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, rawMessage)
+	}
+	next, err := fromStoreCursor(cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, next, nil
+}
+
+func (s *levelMessageStore) Delete(tenant dwn.Tenant, messageCid dwn.MessageCid) error {
+	return s.store.Delete(string(tenant), string(messageCid), nil)
+}
+
+// levelDataStore adapts store.DataStoreLevel to dwn.DataStore.
+type levelDataStore struct {
+	store *store.DataStoreLevel
+}
+
+func NewLevelDataStore(dataStore *store.DataStoreLevel) dwn.DataStore {
+	return &levelDataStore{store: dataStore}
+}
+
+func (s *levelDataStore) Open() error {
+	return s.store.Open()
+}
+
+func (s *levelDataStore) Close() error {
+	return s.store.Close()
+}
+
+func (s *levelDataStore) Clear() error {
+	return s.store.Clear(context.Background())
+}
+
+func (s *levelDataStore) Put(tenant dwn.Tenant, messageCid dwn.MessageCid, dataCid dwn.DataCid,
+	dataStream io.Reader) (dwn.DataCid, int64, error) {
+	ctx := context.Background()
+	result, err := s.store.Put(ctx, string(tenant), string(messageCid), string(dataCid), dataStream)
+	if err != nil {
+		return "", 0, err
+	}
+	if dataCid != "" && result.DataCid != string(dataCid) {
+		if err := s.store.Delete(ctx, string(tenant), string(messageCid), string(dataCid)); err != nil {
+			return "", 0, err
+		}
+		return "", 0, fmt.Errorf("computed data CID %s does not match expected %s", result.DataCid, dataCid)
+	}
+	return dwn.DataCid(result.DataCid), int64(result.DataSize), nil
+}
+
+func (s *levelDataStore) Get(tenant dwn.Tenant, messageCid dwn.MessageCid, dataCid dwn.DataCid) (dwn.DataCid,
+	int64, io.Reader, error) {
+	result, err := s.store.Get(context.Background(), string(tenant), string(messageCid), string(dataCid))
+	if err != nil || result == nil {
+		return "", 0, nil, err
+	}
+	return dwn.DataCid(result.DataCid), int64(result.DataSize), result.DataReader, nil
+}
+
+func (s *levelDataStore) Associate(tenant dwn.Tenant, messageCid dwn.MessageCid, dataCid dwn.DataCid) (dwn.DataCid,
+	int64, error) {
+	result, err := s.store.Associate(context.Background(), string(tenant), string(messageCid), string(dataCid))
+	if err != nil || result == nil {
+		return "", 0, err
+	}
+	return dwn.DataCid(result.DataCid), int64(result.DataSize), nil
+}
+
+func (s *levelDataStore) Delete(tenant dwn.Tenant, messageCid dwn.MessageCid, dataCid dwn.DataCid) error {
+	return s.store.Delete(context.Background(), string(tenant), string(messageCid), string(dataCid))
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
+	"github.com/abaxxtech/abaxx-id-go/pkg/store"
+)
+
+// sqlMessageStore adapts store.GormMessageStore to dwn.MessageStore.  The
+// store keeps the inline data of a message apart from it, in the
+// encodedData index.
+type sqlMessageStore struct {
+	store *store.GormMessageStore
+}
+
+func NewSQLMessageStore(messageStore *store.GormMessageStore) dwn.MessageStore {
+	return &sqlMessageStore{store: messageStore}
+}
+
+func (s *sqlMessageStore) Open() error {
+	return s.store.Open()
+}
+
+func (s *sqlMessageStore) Close() error {
+	return s.store.Close()
+}
+
+func (s *sqlMessageStore) Clear() error {
+	return s.store.Clear()
+}
+
+func (s *sqlMessageStore) Put(tenant dwn.Tenant, message interface{}, indexes dwn.IndexableKeyValues) error {
+	rawMessage, encodedData, err := splitEncodedData(message)
+	if err != nil {
+		return err
+	}
+	keyValues := storeKeyValues(indexes)
+	if encodedData != nil {
+		keyValues["encodedData"] = fmt.Sprint(encodedData)
+	}
+	return s.store.Put(string(tenant), rawMessage, keyValues, nil)
+}
+
+func (s *sqlMessageStore) Get(tenant dwn.Tenant, messageCid dwn.MessageCid) (interface{}, error) {
+	message, err := s.store.Get(string(tenant), string(messageCid))
+	if err != nil || message == nil {
+		return nil, err
+	}
+	return fromStoredMessage(message)
+}
+
+func (s *sqlMessageStore) Query(tenant dwn.Tenant, filters []dwn.Filter, sort dwn.MessageSort,
+	pagination dwn.Pagination) ([]interface{}, *dwn.PaginationCursor, error) {
+	if pagination.Offset > 0 {
+		return nil, nil, errors.New("offset pagination is not supported by the SQL message store")
+	}
+	storeFilters, err := toStoreFilters(filters)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(storeFilters) == 0 {
+		return []interface{}{}, nil, nil
+	}
+
+	storePagination, err := toStorePagination(pagination)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages, cursor, err := s.store.Query(string(tenant), storeFilters, toStoreSort(sort), storePagination, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	results := make([]interface{}, 0, len(messages))
+	for _, message := range messages {
+		rawMessage, err := fromStoredMessage(message)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, rawMessage)
+	}
+	next, err := fromStoreCursor(cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, next, nil
+}
+
+func (s *sqlMessageStore) Delete(tenant dwn.Tenant, messageCid dwn.MessageCid) error {
+	return s.store.Delete(string(tenant), string(messageCid), nil)
+}
+
+// sqlDataStore adapts store.DataStoreSQL to dwn.DataStore.
+type sqlDataStore struct {
+	store *store.DataStoreSQL
+}
+
+func NewSQLDataStore(dataStore *store.DataStoreSQL) dwn.DataStore {
+	return &sqlDataStore{store: dataStore}
+}
+
+func (s *sqlDataStore) Open() error {
+	return s.store.Open()
+}
+
+func (s *sqlDataStore) Close() error {
+	return s.store.Close()
+}
+
+func (s *sqlDataStore) Clear() error {
+	return s.store.Clear()
+}
+
+// Put verifies the data CID itself, as the SQL data store keeps data as it
+// is given.
+func (s *sqlDataStore) Put(tenant dwn.Tenant, messageCid dwn.MessageCid, dataCid dwn.DataCid,
+	dataStream io.Reader) (dwn.DataCid, int64, error) {
+	data, err := io.ReadAll(dataStream)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read data stream: %w", err)
+	}
+	resultCid, _, err := cid.ComputeData(bytes.NewReader(data))
+	if err != nil {
+		return "", 0, err
+	}
+	if dataCid != "" && string(dataCid) != resultCid {
+		return "", 0, fmt.Errorf("computed data CID %s does not match expected %s", resultCid, dataCid)
+	}
+
+	result, err := s.store.Put(string(tenant), string(messageCid), resultCid, bytes.NewReader(data))
+	if err != nil {
+		return "", 0, err
+	}
+	return dwn.DataCid(result.DataCid), result.DataSize, nil
+}
+
+func (s *sqlDataStore) Get(tenant dwn.Tenant, messageCid dwn.MessageCid, dataCid dwn.DataCid) (dwn.DataCid,
+	int64, io.Reader, error) {
+	resultCid, dataSize, dataStream, err := s.store.Get(string(tenant), string(messageCid), string(dataCid))
+	return dwn.DataCid(resultCid), dataSize, dataStream, err
+}
+
+func (s *sqlDataStore) Associate(tenant dwn.Tenant, messageCid dwn.MessageCid, dataCid dwn.DataCid) (dwn.DataCid,
+	int64, error) {
+	result, err := s.store.Associate(string(tenant), string(messageCid), string(dataCid))
+	if err != nil || result == nil {
+		return "", 0, err
+	}
+	return dwn.DataCid(result.DataCid), result.DataSize, nil
+}
+
+func (s *sqlDataStore) Delete(tenant dwn.Tenant, messageCid dwn.MessageCid, dataCid dwn.DataCid) error {
+	return s.store.Delete(string(tenant), string(messageCid), string(dataCid))
+}
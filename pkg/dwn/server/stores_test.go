@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
+	"github.com/abaxxtech/abaxx-id-go/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelDataStore(t *testing.T) {
+	levelStore, err := store.NewDataStoreLevel(store.DataStoreLevelConfig{
+		BlockstoreLocation: filepath.Join(t.TempDir(), "datastore"),
+	})
+	require.NoError(t, err)
+	dataStore := NewLevelDataStore(levelStore)
+	defer dataStore.Close()
+
+	tenant := dwn.Tenant("did:example:alice")
+	for name, data := range map[string][]byte{
+		"small": []byte("hello"),
+		"large": bytes.Repeat([]byte("0123456789"), 100000),
+	} {
+		t.Run(name, func(t *testing.T) {
+			computed, dataSize, err := cid.ComputeData(bytes.NewReader(data))
+			require.NoError(t, err)
+			dataCid := dwn.DataCid(computed)
+
+			resultCid, resultSize, err := dataStore.Put(tenant, "message-1", dataCid, bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, dataCid, resultCid)
+			assert.Equal(t, dataSize, resultSize)
+
+			_, size, stream, err := dataStore.Get(tenant, "message-1", dataCid)
+			require.NoError(t, err)
+			require.NotNil(t, stream)
+			assert.Equal(t, dataSize, size)
+			stored, err := io.ReadAll(stream)
+			require.NoError(t, err)
+			assert.Equal(t, data, stored)
+
+			_, _, stream, err = dataStore.Get(tenant, "message-2", dataCid)
+			require.NoError(t, err)
+			assert.Nil(t, stream)
+
+			_, size, err = dataStore.Associate(tenant, "message-2", dataCid)
+			require.NoError(t, err)
+			assert.Equal(t, dataSize, size)
+			_, _, stream, err = dataStore.Get(tenant, "message-2", dataCid)
+			require.NoError(t, err)
+			assert.NotNil(t, stream)
+
+			require.NoError(t, dataStore.Delete(tenant, "message-1", dataCid))
+			_, _, stream, err = dataStore.Get(tenant, "message-2", dataCid)
+			require.NoError(t, err)
+			assert.NotNil(t, stream)
+		})
+	}
+
+	t.Run("rejects data not matching its CID", func(t *testing.T) {
+		dataCid, _, err := cid.ComputeData(bytes.NewReader([]byte("expected")))
+		require.NoError(t, err)
+		_, _, err = dataStore.Put(tenant, "message-3", dwn.DataCid(dataCid), bytes.NewReader([]byte("actual")))
+		assert.Error(t, err)
+	})
+}
+
+func TestToStoreFilters(t *testing.T) {
+	filters := []dwn.Filter{
+		dwn.NewEqualFilter("interface", dwn.S(dwn.InterfaceRecords)),
+		dwn.NewRangeFilter("dateCreated", dwn.GTE{GTE: dwn.S("2024")}),
+		dwn.NewRangeFilter("dateCreated", dwn.LT{LT: dwn.S("2025")}),
+		dwn.OrFilter{AnyOf: [][]dwn.Filter{
+			{dwn.NewEqualFilter("published", dwn.B(true))},
+			{dwn.NewEqualFilter("author", dwn.S("did:example:bob"))},
+		}},
+	}
+
+	storeFilters, err := toStoreFilters(filters)
+	require.NoError(t, err)
+	assert.Equal(t, []store.Filter{
+		{
+			"interface":   dwn.InterfaceRecords,
+			"dateCreated": store.RangeFilter{"gte": "2024", "lt": "2025"},
+			"published":   true,
+		},
+		{
+			"interface":   dwn.InterfaceRecords,
+			"dateCreated": store.RangeFilter{"gte": "2024", "lt": "2025"},
+			"author":      "did:example:bob",
+		},
+	}, storeFilters)
+
+	_, err = toStoreFilters([]dwn.Filter{
+		dwn.NewEqualFilter("protocol", dwn.S("a")),
+		dwn.NewEqualFilter("protocol", dwn.S("b")),
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/jsonrpc"
+	"golang.org/x/net/websocket"
+)
+
+// sendQueueSize bounds the messages waiting to be sent on a WebSocket
+// connection.  A client that falls this far behind is disconnected rather
+// than holding up the events of everyone else.
+const sendQueueSize = 256
+
+// ServeSocket serves JSON-RPC over a WebSocket connection.  Besides
+// dwn.processMessage, which opens a subscription for RecordsSubscribe and
+// MessagesSubscribe given the subscription id in the request, clients can
+// call rpc.subscribe.close.  The events of a subscription are pushed as
+// rpc.subscribe.event notifications.  The subscriptions of a connection are
+// closed with it.
+func (s *Server) ServeSocket(ws *websocket.Conn) {
+	ws.MaxPayloadBytes = s.config.MaxMessageSize
+	conn := &socketConnection{
+		server:        s,
+		ws:            ws,
+		send:          make(chan interface{}, sendQueueSize),
+		closed:        make(chan struct{}),
+		subscriptions: map[string]dwn.EventSubscription{},
+	}
+	go conn.writeLoop()
+	conn.readLoop()
+}
+
+type socketConnection struct {
+	server *Server
+	ws     *websocket.Conn
+
+	send      chan interface{}
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu            sync.Mutex
+	subscriptions map[string]dwn.EventSubscription
+}
+
+func (c *socketConnection) readLoop() {
+	defer c.close()
+	for {
+		var data []byte
+		err := websocket.Message.Receive(c.ws, &data)
+		if errors.Is(err, websocket.ErrFrameTooLarge) {
+			c.enqueue(jsonrpc.NewError("", jsonrpc.InvalidRequest,
+				"message exceeds the maximum size of %d bytes", c.server.config.MaxMessageSize))
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		var request jsonrpc.Request
+		if err := json.Unmarshal(data, &request); err != nil {
+			c.enqueue(jsonrpc.NewError("", jsonrpc.ParseError, "malformed request: %v", err))
+			continue
+		}
+		if response := c.handle(&request); response != nil {
+			c.enqueue(response)
+		}
+	}
+}
+
+func (c *socketConnection) writeLoop() {
+	for {
+		select {
+		case message := <-c.send:
+			if err := websocket.JSON.Send(c.ws, message); err != nil {
+				c.close()
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// enqueue queues a message to be sent, disconnecting the client if too many
+// are waiting already.
+func (c *socketConnection) enqueue(message interface{}) {
+	select {
+	case <-c.closed:
+	case c.send <- message:
+	default:
+		c.close()
+	}
+}
+
+// close closes the subscriptions of the connection, then the connection.
+func (c *socketConnection) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+
+		c.mu.Lock()
+		subscriptions := c.subscriptions
+		c.subscriptions = map[string]dwn.EventSubscription{}
+		c.mu.Unlock()
+		for _, subscription := range subscriptions {
+			_ = subscription.Close()
+		}
+
+		_ = c.ws.Close()
+	})
+}
+
+func (c *socketConnection) handle(request *jsonrpc.Request) *jsonrpc.Response {
+	if rpcErr := checkRequest(request); rpcErr != nil {
+		return rpcErr
+	}
+	switch request.Method {
+	case jsonrpc.MethodProcessMessage:
+		return c.processMessage(request)
+	case jsonrpc.MethodSubscribeClose:
+		return c.closeSubscription(request)
+	}
+	return jsonrpc.NewError(request.Id, jsonrpc.MethodNotFound, "unknown method %q", request.Method)
+}
+
+func (c *socketConnection) processMessage(request *jsonrpc.Request) *jsonrpc.Response {
+	params, rpcErr := parseProcessMessageParams(request)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	if isSubscription(params.Message) {
+		return c.subscribe(request, params)
+	}
+
+	dataStream, rpcErr := decodeData(request, params)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	reply, rpcErr := c.server.processMessage(request, params, dataStream)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	reply.EntryData = nil
+
+	result := jsonrpc.ProcessMessageResult{Reply: reply}
+	if reply.Data != nil {
+		data, err := io.ReadAll(reply.Data)
+		if closer, ok := reply.Data.(io.Closer); ok {
+			closer.Close()
+		}
+		if err != nil {
+			return jsonrpc.NewError(request.Id, jsonrpc.InternalError, "failed to read data: %v", err)
+		}
+		result.EncodedData = base64.RawURLEncoding.EncodeToString(data)
+		result.Reply.Data = nil
+	}
+	return newResult(request.Id, result)
+}
+
+// subscribe opens the subscription of a subscribe message under the id the
+// client chose for it.
+func (c *socketConnection) subscribe(request *jsonrpc.Request, params *jsonrpc.ProcessMessageParams) *jsonrpc.Response {
+	if request.Subscription == nil || request.Subscription.Id == "" {
+		return jsonrpc.NewError(request.Id, jsonrpc.InvalidRequest, "subscription id is required")
+	}
+	id := request.Subscription.Id
+
+	c.mu.Lock()
+	_, exists := c.subscriptions[id]
+	count := len(c.subscriptions)
+	c.mu.Unlock()
+	if exists {
+		return jsonrpc.NewError(request.Id, jsonrpc.InvalidRequest, "subscription %s already exists", id)
+	}
+	if count >= c.server.config.MaxSubscriptions {
+		return jsonrpc.NewError(request.Id, jsonrpc.InvalidRequest,
+			"connection already has the maximum of %d subscriptions", c.server.config.MaxSubscriptions)
+	}
+
+	reply, err := c.server.dwn.ProcessSubscription(params.Target, params.Message, func(event dwn.MessageEvent) {
+		notification, err := jsonrpc.NewNotification(jsonrpc.MethodSubscribeEvent, jsonrpc.SubscribeEventParams{
+			Subscription: jsonrpc.Subscription{Id: id},
+			Event:        event,
+		})
+		if err != nil {
+			return
+		}
+		c.enqueue(notification)
+	})
+	if err != nil {
+		return jsonrpc.NewError(request.Id, jsonrpc.InternalError, "failed to process message: %v", err)
+	}
+
+	if reply.Subscription != nil {
+		c.mu.Lock()
+		select {
+		case <-c.closed:
+			// The connection closed while subscribing.
+			c.mu.Unlock()
+			_ = reply.Subscription.Close()
+			return nil
+		default:
+		}
+		c.subscriptions[id] = reply.Subscription
+		c.mu.Unlock()
+	}
+	return newResult(request.Id, jsonrpc.ProcessMessageResult{Reply: reply})
+}
+
+func (c *socketConnection) closeSubscription(request *jsonrpc.Request) *jsonrpc.Response {
+	if request.Subscription == nil {
+		return jsonrpc.NewError(request.Id, jsonrpc.InvalidRequest, "subscription id is required")
+	}
+	id := request.Subscription.Id
+
+	c.mu.Lock()
+	subscription, ok := c.subscriptions[id]
+	delete(c.subscriptions, id)
+	c.mu.Unlock()
+	if !ok {
+		return jsonrpc.NewError(request.Id, jsonrpc.InvalidParams, "subscription %s does not exist", id)
+	}
+	if err := subscription.Close(); err != nil {
+		return jsonrpc.NewError(request.Id, jsonrpc.InternalError, "failed to close subscription: %v", err)
+	}
+	return newResult(request.Id, jsonrpc.ProcessMessageResult{Reply: dwn.UnionMessageReply{
+		Status: dwn.Status{Code: 200},
+	}})
+}
+
+func newResult(id string, result interface{}) *jsonrpc.Response {
+	response, err := jsonrpc.NewResult(id, result)
+	if err != nil {
+		return jsonrpc.NewError(id, jsonrpc.InternalError, "%v", err)
+	}
+	return response
+}
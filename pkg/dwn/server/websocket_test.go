@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn"
+	"github.com/abaxxtech/abaxx-id-go/pkg/dwn/jsonrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func dialTestSocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	ws, err := websocket.Dial("ws://"+strings.TrimPrefix(server.URL, "http://")+"/", "", "http://localhost/")
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// sendTestRequest sends a request, opening subscriptionId if it is set, and
+// returns the next message received.
+func sendTestRequest(t *testing.T, ws *websocket.Conn, method string, subscriptionId string,
+	params interface{}) []byte {
+	t.Helper()
+	request, err := jsonrpc.NewRequest("test-id", method, params)
+	require.NoError(t, err)
+	if subscriptionId != "" {
+		request.Subscription = &jsonrpc.Subscription{Id: subscriptionId}
+	}
+	require.NoError(t, websocket.JSON.Send(ws, request))
+	return receiveTestMessage(t, ws)
+}
+
+func receiveTestMessage(t *testing.T, ws *websocket.Conn) []byte {
+	t.Helper()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var message []byte
+	require.NoError(t, websocket.Message.Receive(ws, &message))
+	return message
+}
+
+func TestServeSocket(t *testing.T) {
+	processor := &testProcessor{reply: dwn.UnionMessageReply{Status: dwn.Status{Code: 202}}}
+	server := httptest.NewServer(New(processor, Config{MaxSubscriptions: 2, MaxMessageSize: 4096}))
+	defer server.Close()
+
+	subscribe := jsonrpc.ProcessMessageParams{Target: "did:example:alice", Message: testMessage(dwn.MethodSubscribe)}
+
+	t.Run("processes a message with encoded data", func(t *testing.T) {
+		ws := dialTestSocket(t, server)
+		response, reply := decodeTestResponse(t, sendTestRequest(t, ws, jsonrpc.MethodProcessMessage, "",
+			jsonrpc.ProcessMessageParams{
+				Target:      "did:example:alice",
+				Message:     testMessage(dwn.MethodWrite),
+				EncodedData: base64.RawURLEncoding.EncodeToString([]byte("some data")),
+			}))
+		assert.Equal(t, "test-id", response.Id)
+		assert.Nil(t, response.Error)
+		assert.Equal(t, 202, reply.Status.Code)
+		assert.Equal(t, []byte("some data"), processor.data)
+	})
+
+	t.Run("returns record data encoded", func(t *testing.T) {
+		processor.reply = dwn.UnionMessageReply{Status: dwn.Status{Code: 200}, Data: strings.NewReader("record data")}
+		defer func() { processor.reply = dwn.UnionMessageReply{Status: dwn.Status{Code: 202}} }()
+
+		ws := dialTestSocket(t, server)
+		encoded := sendTestRequest(t, ws, jsonrpc.MethodProcessMessage, "",
+			jsonrpc.ProcessMessageParams{Target: "did:example:alice", Message: testMessage(dwn.MethodRead)})
+		var response jsonrpc.Response
+		require.NoError(t, json.Unmarshal(encoded, &response))
+		var result jsonrpc.ProcessMessageResult
+		require.NoError(t, json.Unmarshal(response.Result, &result))
+		data, err := base64.RawURLEncoding.DecodeString(result.EncodedData)
+		require.NoError(t, err)
+		assert.Equal(t, "record data", string(data))
+	})
+
+	t.Run("pushes the events of a subscription until it is closed", func(t *testing.T) {
+		ws := dialTestSocket(t, server)
+		response, reply := decodeTestResponse(t,
+			sendTestRequest(t, ws, jsonrpc.MethodProcessMessage, "sub-1", subscribe))
+		require.Nil(t, response.Error)
+		assert.Equal(t, 200, reply.Status.Code)
+
+		subscription := processor.lastSubscription()
+		subscription.handler(dwn.MessageEvent{
+			Message:      map[string]interface{}{"recordId": "a-record"},
+			InitialWrite: map[string]interface{}{"recordId": "a-record"},
+		})
+		var notification jsonrpc.Request
+		require.NoError(t, json.Unmarshal(receiveTestMessage(t, ws), &notification))
+		assert.Equal(t, jsonrpc.MethodSubscribeEvent, notification.Method)
+		assert.Empty(t, notification.Id)
+		var params jsonrpc.SubscribeEventParams
+		require.NoError(t, json.Unmarshal(notification.Params, &params))
+		assert.Equal(t, "sub-1", params.Subscription.Id)
+		assert.Equal(t, "a-record", params.Event.Message["recordId"])
+		assert.Equal(t, "a-record", params.Event.InitialWrite["recordId"])
+
+		response, reply = decodeTestResponse(t,
+			sendTestRequest(t, ws, jsonrpc.MethodSubscribeClose, "sub-1", nil))
+		require.Nil(t, response.Error)
+		assert.Equal(t, 200, reply.Status.Code)
+		assert.True(t, subscription.closed.Load())
+
+		response, _ = decodeTestResponse(t, sendTestRequest(t, ws, jsonrpc.MethodSubscribeClose, "sub-1", nil))
+		require.NotNil(t, response.Error)
+		assert.Equal(t, jsonrpc.InvalidParams, response.Error.Code)
+	})
+
+	t.Run("limits the subscriptions of a connection", func(t *testing.T) {
+		ws := dialTestSocket(t, server)
+		for _, id := range []string{"sub-1", "sub-2"} {
+			response, _ := decodeTestResponse(t, sendTestRequest(t, ws, jsonrpc.MethodProcessMessage, id, subscribe))
+			require.Nil(t, response.Error)
+		}
+
+		for _, id := range []string{"sub-2", "sub-3", ""} {
+			response, _ := decodeTestResponse(t, sendTestRequest(t, ws, jsonrpc.MethodProcessMessage, id, subscribe))
+			require.NotNil(t, response.Error, id)
+			assert.Equal(t, jsonrpc.InvalidRequest, response.Error.Code, id)
+		}
+	})
+
+	t.Run("closes the subscriptions of a connection with it", func(t *testing.T) {
+		ws := dialTestSocket(t, server)
+		response, _ := decodeTestResponse(t, sendTestRequest(t, ws, jsonrpc.MethodProcessMessage, "sub-1", subscribe))
+		require.Nil(t, response.Error)
+		subscription := processor.lastSubscription()
+
+		require.NoError(t, ws.Close())
+		assert.Eventually(t, subscription.closed.Load, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("rejects messages over the maximum size", func(t *testing.T) {
+		ws := dialTestSocket(t, server)
+		response, _ := decodeTestResponse(t, sendTestRequest(t, ws, jsonrpc.MethodProcessMessage, "",
+			jsonrpc.ProcessMessageParams{
+				Target:      "did:example:alice",
+				Message:     testMessage(dwn.MethodWrite),
+				EncodedData: strings.Repeat("a", 8192),
+			}))
+		require.NotNil(t, response.Error)
+		assert.Equal(t, jsonrpc.InvalidRequest, response.Error.Code)
+
+		// The connection is still usable.
+		response, _ = decodeTestResponse(t, sendTestRequest(t, ws, jsonrpc.MethodProcessMessage, "",
+			jsonrpc.ProcessMessageParams{Target: "did:example:alice", Message: testMessage(dwn.MethodWrite)}))
+		assert.Nil(t, response.Error)
+	})
+
+	t.Run("reports JSON-RPC errors", func(t *testing.T) {
+		ws := dialTestSocket(t, server)
+		require.NoError(t, websocket.Message.Send(ws, "{"))
+		response, _ := decodeTestResponse(t, receiveTestMessage(t, ws))
+		require.NotNil(t, response.Error)
+		assert.Equal(t, jsonrpc.ParseError, response.Error.Code)
+
+		response, _ = decodeTestResponse(t, sendTestRequest(t, ws, "dwn.unknown", "", subscribe))
+		require.NotNil(t, response.Error)
+		assert.Equal(t, jsonrpc.MethodNotFound, response.Error.Code)
+	})
+}
@@ -10,17 +10,19 @@ type DataCid string
 type RawDwnMessage map[string]interface{}
 
 type Status struct {
-	Code   int
-	Detail string
+	Code   int    `json:"code"`
+	Detail string `json:"detail"`
 }
 
 // Update the DwnConfig struct
 type DwnConfig struct {
-	DidResolver        *DidResolver
-	TenantGate         TenantGate
-	MessageStore       MessageStore
-	DataStore          DataStore
-	EventLog           EventLog
+	DidResolver  *DidResolver
+	TenantGate   TenantGate
+	MessageStore MessageStore
+	DataStore    DataStore
+	EventLog     EventLog
+	// EventStream is optional; without it subscriptions are not supported.
+	EventStream        EventStream
 	BlockstoreLocation string
 }
 
@@ -42,7 +44,40 @@ type MessageSort struct {
 }
 
 type Pagination struct {
-	Cursor string
+	Cursor *PaginationCursor
 	Limit  int
 	Offset int
 }
+
+// PaginationCursor is the cursor handed to clients: the CID of the last
+// message returned and the value it was sorted by.
+type PaginationCursor struct {
+	MessageCid string      `json:"messageCid"`
+	Value      interface{} `json:"value"`
+}
+
+// QueryPagination is the pagination requested in a query message.
+type QueryPagination struct {
+	Limit  int               `json:"limit,omitempty"`
+	Cursor *PaginationCursor `json:"cursor,omitempty"`
+}
+
+// Interface and method names found in message descriptors.
+const (
+	InterfaceEvents      = "Events"
+	InterfaceMessages    = "Messages"
+	InterfacePermissions = "Permissions"
+	InterfaceProtocols   = "Protocols"
+	InterfaceRecords     = "Records"
+
+	MethodConfigure = "Configure"
+	MethodDelete    = "Delete"
+	MethodGet       = "Get"
+	MethodGrant     = "Grant"
+	MethodQuery     = "Query"
+	MethodRead      = "Read"
+	MethodRequest   = "Request"
+	MethodRevoke    = "Revoke"
+	MethodSubscribe = "Subscribe"
+	MethodWrite     = "Write"
+)
@@ -3,34 +3,69 @@ package store
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/ipfs/go-cid"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // BlockstoreLevel implements the Blockstore interface using LevelDB
 type BlockstoreLevel struct {
-	db   *leveldb.DB
-	path string
-	mu   sync.RWMutex
+	db      *leveldb.DB
+	path    string
+	options BlockstoreLevelOptions
+	mu      sync.RWMutex
+
+	// parent and prefix are set on partitions kept under a key prefix of
+	// their parent's database.
+	parent *BlockstoreLevel
+	prefix []byte
+
+	partitionsMu sync.Mutex
+	partitions   map[string]*BlockstoreLevel
+}
+
+// BlockstoreLevelOptions configures how a BlockstoreLevel keeps its
+// partitions.
+type BlockstoreLevelOptions struct {
+	// PrefixPartitions keeps partitions under key prefixes of a single
+	// LevelDB rather than in a LevelDB of their own in a subdirectory.
+	PrefixPartitions bool
 }
 
 // NewBlockstoreLevel creates a new BlockstoreLevel
 func NewBlockstoreLevel(path string) (*BlockstoreLevel, error) {
+	return NewBlockstoreLevelWithOptions(path, BlockstoreLevelOptions{})
+}
+
+// NewBlockstoreLevelWithOptions creates a new BlockstoreLevel keeping its
+// partitions as options say.
+func NewBlockstoreLevelWithOptions(path string, options BlockstoreLevelOptions) (*BlockstoreLevel, error) {
 	db, err := leveldb.OpenFile(path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open leveldb: %w", err)
 	}
 
 	return &BlockstoreLevel{
-		db:   db,
-		path: path,
+		db:      db,
+		path:    path,
+		options: options,
 	}, nil
 }
 
 // Open opens the database
 func (b *BlockstoreLevel) Open() error {
+	if b.parent != nil {
+		if err := b.parent.Open(); err != nil {
+			return err
+		}
+		b.parent.mu.RLock()
+		defer b.parent.mu.RUnlock()
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -38,6 +73,11 @@ func (b *BlockstoreLevel) Open() error {
 		return nil
 	}
 
+	if b.parent != nil {
+		b.db = b.parent.db
+		return nil
+	}
+
 	db, err := leveldb.OpenFile(b.path, nil)
 	if err != nil {
 		return fmt.Errorf("failed to open leveldb: %w", err)
@@ -47,18 +87,37 @@ func (b *BlockstoreLevel) Open() error {
 	return nil
 }
 
-// Close closes the database
+// Close closes the database, along with its partitions
 func (b *BlockstoreLevel) Close() error {
+	b.partitionsMu.Lock()
+	var firstErr error
+	for _, partition := range b.partitions {
+		if err := partition.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	b.partitionsMu.Unlock()
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	if b.db == nil {
-		return nil
+		return firstErr
 	}
 
-	err := b.db.Close()
+	// A prefixed partition shares its parent's database, which the parent
+	// closes.
+	if b.parent == nil {
+		if err := b.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
 	b.db = nil
-	return err
+	return firstErr
+}
+
+func (b *BlockstoreLevel) key(c cid.Cid) []byte {
+	return append(append([]byte{}, b.prefix...), c.Bytes()...)
 }
 
 // Put stores a block in the database
@@ -66,7 +125,7 @@ func (b *BlockstoreLevel) Put(ctx context.Context, c cid.Cid, block []byte) erro
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	return b.db.Put(c.Bytes(), block, nil)
+	return b.db.Put(b.key(c), block, nil)
 }
 
 // Get retrieves a block from the database
@@ -74,7 +133,7 @@ func (b *BlockstoreLevel) Get(ctx context.Context, c cid.Cid) ([]byte, error) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	return b.db.Get(c.Bytes(), nil)
+	return b.db.Get(b.key(c), nil)
 }
 
 // Has checks if a block exists in the database
@@ -82,7 +141,7 @@ func (b *BlockstoreLevel) Has(ctx context.Context, c cid.Cid) (bool, error) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	return b.db.Has(c.Bytes(), nil)
+	return b.db.Has(b.key(c), nil)
 }
 
 // Delete removes a block from the database
@@ -90,7 +149,7 @@ func (b *BlockstoreLevel) Delete(ctx context.Context, c cid.Cid) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	return b.db.Delete(c.Bytes(), nil)
+	return b.db.Delete(b.key(c), nil)
 }
 
 // PutMany stores multiple blocks in the database
@@ -100,7 +159,7 @@ func (b *BlockstoreLevel) PutMany(ctx context.Context, blocks map[cid.Cid][]byte
 
 	batch := new(leveldb.Batch)
 	for c, block := range blocks {
-		batch.Put(c.Bytes(), block)
+		batch.Put(b.key(c), block)
 	}
 	return b.db.Write(batch, nil)
 }
@@ -113,7 +172,7 @@ func (b *BlockstoreLevel) AllKeysChan(ctx context.Context) (<-chan cid.Cid, erro
 	ch := make(chan cid.Cid, 100)
 	go func() {
 		defer close(ch)
-		iter := b.db.NewIterator(nil, nil)
+		iter := b.db.NewIterator(util.BytesPrefix(b.prefix), nil)
 		defer iter.Release()
 
 		for iter.Next() {
@@ -121,7 +180,7 @@ func (b *BlockstoreLevel) AllKeysChan(ctx context.Context) (<-chan cid.Cid, erro
 			case <-ctx.Done():
 				return
 			default:
-				c, err := cid.Cast(iter.Key())
+				c, err := cid.Cast(iter.Key()[len(b.prefix):])
 				if err == nil {
 					ch <- c
 				}
@@ -132,35 +191,102 @@ func (b *BlockstoreLevel) AllKeysChan(ctx context.Context) (<-chan cid.Cid, erro
 	return ch, nil
 }
 
-// Clear deletes all entries in the database
+// Clear deletes all entries in the database, including those of its
+// partitions
 func (b *BlockstoreLevel) Clear() error {
+	if !b.options.PrefixPartitions {
+		if err := b.clearPartitionDirectories(); err != nil {
+			return err
+		}
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	iter := b.db.NewIterator(nil, nil)
+	iter := b.db.NewIterator(util.BytesPrefix(b.prefix), nil)
 	defer iter.Release()
 
 	batch := new(leveldb.Batch)
 	for iter.Next() {
 		batch.Delete(iter.Key())
 	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
 
 	return b.db.Write(batch, nil)
 }
 
+// clearPartitionDirectories clears the partitions in subdirectories, whether
+// opened yet or not.
+func (b *BlockstoreLevel) clearPartitionDirectories() error {
+	entries, err := os.ReadDir(b.path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		partition, err := b.Partition(entry.Name())
+		if err != nil {
+			return err
+		}
+		if err := partition.Clear(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // IsEmpty checks if the database is empty
 func (b *BlockstoreLevel) IsEmpty() (bool, error) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	iter := b.db.NewIterator(nil, nil)
+	iter := b.db.NewIterator(util.BytesPrefix(b.prefix), nil)
 	defer iter.Release()
 
-	return !iter.Next(), nil
+	return !iter.Next(), iter.Error()
 }
 
-// Add a Partition method to BlockstoreLevel
-func (b *BlockstoreLevel) Partition(tenant string) (*BlockstoreLevel, error) {
-	path := fmt.Sprintf("%s/%s", b.path, tenant)
-	return NewBlockstoreLevel(path)
+// Partition returns the partition of the blockstore named name, such as a
+// tenant's.  Each partition is opened once, on first use, and shared by all
+// callers until the blockstore is closed.
+func (b *BlockstoreLevel) Partition(name string) (*BlockstoreLevel, error) {
+	if err := b.Open(); err != nil {
+		return nil, err
+	}
+
+	b.partitionsMu.Lock()
+	defer b.partitionsMu.Unlock()
+
+	if partition, ok := b.partitions[name]; ok {
+		return partition, partition.Open()
+	}
+
+	var partition *BlockstoreLevel
+	if b.options.PrefixPartitions {
+		b.mu.RLock()
+		partition = &BlockstoreLevel{
+			db:      b.db,
+			path:    b.path,
+			options: b.options,
+			parent:  b,
+			prefix:  append(append([]byte{}, b.prefix...), name+DELIMITER...),
+		}
+		b.mu.RUnlock()
+	} else {
+		var err error
+		partition, err = NewBlockstoreLevelWithOptions(filepath.Join(b.path, name), b.options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if b.partitions == nil {
+		b.partitions = map[string]*BlockstoreLevel{}
+	}
+	b.partitions[name] = partition
+	return partition, nil
 }
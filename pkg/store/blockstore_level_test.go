@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBlock(t *testing.T, data string) cid.Cid {
+	t.Helper()
+	hash, err := mh.Sum([]byte(data), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV1(cid.Raw, hash)
+}
+
+func TestBlockstoreLevelPartition(t *testing.T) {
+	for name, options := range map[string]BlockstoreLevelOptions{
+		"directories": {},
+		"prefixes":    {PrefixPartitions: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			bs, err := NewBlockstoreLevelWithOptions(filepath.Join(t.TempDir(), "blockstore"), options)
+			require.NoError(t, err)
+			defer bs.Close()
+
+			alice, err := bs.Partition("did:example:alice")
+			require.NoError(t, err)
+			again, err := bs.Partition("did:example:alice")
+			require.NoError(t, err)
+			assert.Same(t, alice, again)
+
+			bob, err := bs.Partition("did:example:bob")
+			require.NoError(t, err)
+			block := newTestBlock(t, "hello")
+			require.NoError(t, alice.Put(ctx, block, []byte("hello")))
+
+			stored, err := again.Get(ctx, block)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("hello"), stored)
+			has, err := bob.Has(ctx, block)
+			require.NoError(t, err)
+			assert.False(t, has)
+
+			keys, err := alice.AllKeysChan(ctx)
+			require.NoError(t, err)
+			var all []cid.Cid
+			for key := range keys {
+				all = append(all, key)
+			}
+			assert.Equal(t, []cid.Cid{block}, all)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					partition, err := bs.Partition(fmt.Sprintf("did:example:%d", i%4))
+					if assert.NoError(t, err) {
+						assert.NoError(t, partition.Put(ctx, newTestBlock(t, fmt.Sprint(i)), []byte{byte(i)}))
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			require.NoError(t, bs.Close())
+			require.NoError(t, bs.Open())
+			reopened, err := bs.Partition("did:example:alice")
+			require.NoError(t, err)
+			stored, err = reopened.Get(ctx, block)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("hello"), stored)
+
+			require.NoError(t, bs.Clear())
+			empty, err := reopened.IsEmpty()
+			require.NoError(t, err)
+			assert.True(t, empty)
+		})
+	}
+}
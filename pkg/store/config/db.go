@@ -1,18 +1,46 @@
 package config
 
+import "time"
+
+// Database drivers DBConfig.Driver selects between
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 // DBConfig holds database configuration
 type DBConfig struct {
+	// Driver is DriverPostgres, the default, or DriverSQLite
+	Driver   string
 	Host     string
 	Port     string
 	User     string
 	Password string
 	DBName   string
 	SSLMode  string
+	// Path is the file of a SQLite database, or ":memory:" for one that
+	// lives as long as the connection
+	Path string
+	// DSN, when set, is the connection string or URL of the database and
+	// takes the place of the fields above, other than Driver
+	DSN string
+
+	// ManualMigrations leaves migrating the schema to `abaxx-id store
+	// migrate`; opening the database fails unless its schema is current
+	ManualMigrations bool
+
+	// Connection pool tuning; zero leaves the database/sql default, except
+	// that SQLite keeps a single open connection
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
 }
 
 // NewDefaultConfig returns a DBConfig with default values
 func NewDefaultConfig() DBConfig {
 	return DBConfig{
+		Driver:   DriverPostgres,
 		Host:     "localhost",
 		Port:     "5432",
 		User:     "postgres",
@@ -21,3 +49,11 @@ func NewDefaultConfig() DBConfig {
 		SSLMode:  "disable",
 	}
 }
+
+// NewSQLiteConfig returns a DBConfig for the SQLite database at path
+func NewSQLiteConfig(path string) DBConfig {
+	return DBConfig{
+		Driver: DriverSQLite,
+		Path:   path,
+	}
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// PaginationCursor resumes a query after the message it names: the CID of
+// the last message of the previous page and the value it was sorted by.
+// Queries resume from these alone, so a page stays put when messages before
+// it are written or deleted.
+type PaginationCursor struct {
+	MessageCid string      `json:"messageCid"`
+	Value      interface{} `json:"value"`
+}
+
+// EncodeCursor returns cursor in the opaque form the message stores hand
+// out, which every store accepts.
+func EncodeCursor(cursor PaginationCursor) (string, error) {
+	encoded, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// DecodeCursor returns the cursor an opaque cursor of EncodeCursor holds.
+func DecodeCursor(cursor string) (*PaginationCursor, error) {
+	encoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var decoded PaginationCursor
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if decoded.MessageCid == "" {
+		return nil, fmt.Errorf("invalid cursor: missing messageCid")
+	}
+	return &decoded, nil
+}
@@ -5,7 +5,8 @@ import (
 	"errors"
 	"io"
 
-	importer "github.com/ipfs/boxo/ipld/unixfs/importer"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
 	blockservice "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
@@ -20,6 +21,7 @@ import (
 	dag "github.com/ipfs/go-merkledag"
 	unixfs "github.com/ipfs/go-unixfs"
 	uio "github.com/ipfs/go-unixfs/io"
+	"github.com/multiformats/go-multihash"
 )
 
 // PlaceholderValue is used as a placeholder value for reference counting
@@ -89,15 +91,20 @@ func (d *DataStoreLevel) Put(ctx context.Context, tenant, messageCid, dataCid st
 	dagService := dag.NewDAGService(blockservice.New(dataBS, offline.Exchange(dataBS)))
 	file := files.NewReaderFile(dataReader)
 
-	// params := helpers.DagBuilderParams{
-	// 	Dagserv:    dagService,
-	// 	RawLeaves:  true,
-	// 	CidBuilder: cid.V1Builder{Codec: cid.DagProtobuf, MhType: multihash.SHA2_256},
-	// }
-
-	// dagBuilder, _ := params.New(chunker.NewSizeSplitter(file, int64(1024*256))) // 256KB chunks
+	// CIDv1 with raw leaves, like the reference implementation, so data CIDs
+	// match the dataCid of RecordsWrite messages.
+	params := helpers.DagBuilderParams{
+		Dagserv:    dagService,
+		RawLeaves:  true,
+		Maxlinks:   helpers.DefaultLinksPerBlock,
+		CidBuilder: cid.V1Builder{Codec: cid.DagProtobuf, MhType: multihash.SHA2_256},
+	}
+	dagBuilder, err := params.New(chunker.NewSizeSplitter(file, chunker.DefaultBlockSize))
+	if err != nil {
+		return nil, err
+	}
 
-	rootNode, err := importer.BuildDagFromReader(dagService, chunker.DefaultSplitter(file))
+	rootNode, err := balanced.Layout(dagBuilder)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +120,8 @@ func (d *DataStoreLevel) Put(ctx context.Context, tenant, messageCid, dataCid st
 	}, nil
 }
 
-// Get retrieves the data if the caller has access
+// Get retrieves the data if the caller has access.  It returns nil if the
+// message does not reference the data or the data does not exist.
 func (d *DataStoreLevel) Get(ctx context.Context, tenant, messageCid, dataCid string) (*GetResult, error) {
 	refDS := d.getDatastoreForReferenceCounting(tenant, dataCid)
 	dataBS := d.getBlockstoreForStoringData(tenant, dataCid)
@@ -121,8 +129,11 @@ func (d *DataStoreLevel) Get(ctx context.Context, tenant, messageCid, dataCid st
 	// Check if messageCid is allowed
 	refKey := ds.NewKey(messageCid)
 	hasRef, err := refDS.Has(ctx, refKey)
-	if err != nil || !hasRef {
-		return nil, errors.New("access denied or reference not found")
+	if err != nil {
+		return nil, err
+	}
+	if !hasRef {
+		return nil, nil
 	}
 
 	// Check if data exists
@@ -132,8 +143,11 @@ func (d *DataStoreLevel) Get(ctx context.Context, tenant, messageCid, dataCid st
 	}
 
 	hasData, err := dataBS.Has(ctx, c)
-	if err != nil || !hasData {
-		return nil, errors.New("data not found")
+	if err != nil {
+		return nil, err
+	}
+	if !hasData {
+		return nil, nil
 	}
 
 	dagService := dag.NewDAGService(blockservice.New(dataBS, offline.Exchange(dataBS)))
@@ -159,6 +173,46 @@ func (d *DataStoreLevel) Get(ctx context.Context, tenant, messageCid, dataCid st
 	}, nil
 }
 
+// Associate adds a reference from the message to data already stored for the
+// tenant.  It returns nil if there is no such data.
+func (d *DataStoreLevel) Associate(ctx context.Context, tenant, messageCid, dataCid string) (*PutResult, error) {
+	refDS := d.getDatastoreForReferenceCounting(tenant, dataCid)
+	dataBS := d.getBlockstoreForStoringData(tenant, dataCid)
+
+	c, err := cid.Decode(dataCid)
+	if err != nil {
+		return nil, err
+	}
+
+	hasData, err := dataBS.Has(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if !hasData {
+		return nil, nil
+	}
+
+	dagService := dag.NewDAGService(blockservice.New(dataBS, offline.Exchange(dataBS)))
+	rootNode, err := dagService.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	dataSize, err := sizeOfNode(rootNode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := refDS.Put(ctx, ds.NewKey(messageCid), PlaceholderValue); err != nil {
+		return nil, err
+	}
+
+	return &PutResult{
+		DataCid:  dataCid,
+		DataSize: dataSize,
+	}, nil
+}
+
 // Delete removes the reference and deletes data if it's no longer referenced
 func (d *DataStoreLevel) Delete(ctx context.Context, tenant, messageCid, dataCid string) error {
 	refDS := d.getDatastoreForReferenceCounting(tenant, dataCid)
@@ -223,12 +277,19 @@ func (d *DataStoreLevel) getBlockstoreForStoringData(tenant, dataCid string) blo
 
 // sizeOfNode calculates the total size of a DAG node
 func sizeOfNode(node format.Node) (uint64, error) {
-	if unixfsNode, ok := node.(*dag.ProtoNode); ok {
-		fsNode, err := unixfs.FSNodeFromBytes(unixfsNode.Data())
-		if err != nil {
-			return 0, err
+	// Nodes may come from either the go-merkledag or the boxo importer, so
+	// look at the codec rather than the node type.
+	switch node.Cid().Type() {
+	case cid.Raw:
+		return uint64(len(node.RawData())), nil
+	case cid.DagProtobuf:
+		if unixfsNode, ok := node.(interface{ Data() []byte }); ok {
+			fsNode, err := unixfs.FSNodeFromBytes(unixfsNode.Data())
+			if err != nil {
+				return 0, err
+			}
+			return fsNode.FileSize(), nil
 		}
-		return fsNode.FileSize(), nil
 	}
 	return 0, errors.New("unsupported node type")
 }
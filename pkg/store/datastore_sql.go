@@ -27,35 +27,38 @@ type AssociateGormResult struct {
 }
 
 type DataStoreSQL struct {
-	db     *gorm.DB
-	config MessageStoreSQLConfig
+	db       *gorm.DB
+	provider *models.DBProvider
+	config   MessageStoreSQLConfig
 }
 
 func NewDataStoreSQL(config MessageStoreSQLConfig) (*DataStoreSQL, error) {
 	return &DataStoreSQL{
-		config: config,
+		provider: config.dbProvider(),
+		config:   config,
 	}, nil
 }
 
 func (dss *DataStoreSQL) Open() error {
-	db, err := models.GetDB(dss.config.DBConfig)
-	if err != nil {
-		return fmt.Errorf("failed to get database connection: %w", err)
+	if dss.db != nil {
+		return nil
 	}
-
-	// Auto-migrate tables
-	err = db.AutoMigrate(&models.DataStore{}, &models.DataStoreReference{})
+	db, err := dss.provider.Acquire()
 	if err != nil {
-		return fmt.Errorf("failed to create database schema: %w", err)
+		return fmt.Errorf("failed to get database connection: %w", err)
 	}
-
 	dss.db = db
 	return nil
 }
 
+// Close gives back the database connection, closing the database unless
+// other stores of its DBProvider still use it.
 func (dss *DataStoreSQL) Close() error {
+	if dss.db == nil {
+		return nil
+	}
 	dss.db = nil
-	return nil
+	return dss.provider.Release()
 }
 
 func (dss *DataStoreSQL) Get(tenant string, messageCid string, dataCid string) (string, int64, io.Reader, error) {
@@ -1,9 +1,11 @@
 package store
 
 import (
+	"bytes"
+	"io"
 	"testing"
 
-	"github.com/abaxxtech/abaxx-id-go/pkg/store/models"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,9 +14,8 @@ func setupTestDataStoreSQLWithoutCleanup(t *testing.T) *DataStoreSQL {
 	store, err := NewDataStoreSQL(config)
 	require.NoError(t, err)
 
-	db, err := models.GetDB(config.DBConfig)
-	require.NoError(t, err)
-	store.db = db
+	require.NoError(t, store.Open())
+	t.Cleanup(func() { store.Close() })
 
 	return store
 }
@@ -38,6 +39,42 @@ func cleanupTestDataStoreSQL(t *testing.T, store *DataStoreSQL) error {
 	return nil
 }
 
+func TestDataStoreSQL(t *testing.T) {
+	store := setupTestDataStoreSQLWithoutCleanup(t)
+	require.NoError(t, cleanupTestDataStoreSQL(t, store))
+	defer cleanupTestDataStoreSQL(t, store)
+
+	put, err := store.Put("did:example:alice", "message-1", "data-1", bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), put.DataSize)
+
+	dataCid, dataSize, reader, err := store.Get("did:example:alice", "message-1", "data-1")
+	require.NoError(t, err)
+	assert.Equal(t, "data-1", dataCid)
+	assert.Equal(t, int64(5), dataSize)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+
+	_, _, reader, err = store.Get("did:example:bob", "message-1", "data-1")
+	require.NoError(t, err)
+	assert.Nil(t, reader)
+
+	associated, err := store.Associate("did:example:alice", "message-2", "data-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), associated.DataSize)
+
+	require.NoError(t, store.Delete("did:example:alice", "message-1", "data-1"))
+	_, _, reader, err = store.Get("did:example:alice", "message-2", "data-1")
+	require.NoError(t, err)
+	assert.NotNil(t, reader)
+
+	require.NoError(t, store.Delete("did:example:alice", "message-2", "data-1"))
+	associated, err = store.Associate("did:example:alice", "message-3", "data-1")
+	require.NoError(t, err)
+	assert.Nil(t, associated)
+}
+
 // func TestDataStoreSQL_OpenClose(t *testing.T) {
 // 	store := setupTestDataStoreSQLWithoutCleanup(t)
 
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Properties the level event log indexes each event under, besides those
+// it is appended with.
+const (
+	eventWatermarkProperty  = "watermark"
+	eventMessageCidProperty = "messageCid"
+)
+
+// eventWatermarkKey holds the last watermark given out.  It begins with
+// DELIMITER, which no tenant does, so that it stays clear of the index.
+const eventWatermarkKey = DELIMITER + "watermark"
+
+// EventLogLevelConfig holds configuration for EventLogLevel
+type EventLogLevelConfig struct {
+	Location string
+}
+
+// EventLogLevel is an event log kept in a LevelDB index.  Each event is
+// indexed under a watermark counted up from the last one given out, which is
+// kept along with the index, so that watermarks stay increasing across
+// restarts and remain valid once their event is deleted.
+type EventLogLevel struct {
+	config EventLogLevelConfig
+
+	mu        sync.Mutex
+	index     *IndexLevel
+	watermark uint64
+}
+
+func NewEventLogLevel(config EventLogLevelConfig) (*EventLogLevel, error) {
+	if config.Location == "" {
+		return nil, errors.New("location is required")
+	}
+	return &EventLogLevel{config: config}, nil
+}
+
+// Open opens the index, unless it is open already.
+func (ell *EventLogLevel) Open() error {
+	ell.mu.Lock()
+	defer ell.mu.Unlock()
+
+	if ell.index != nil {
+		return nil
+	}
+	index, err := NewIndexLevel(IndexLevelConfig{Location: ell.config.Location})
+	if err != nil {
+		return err
+	}
+	watermark, err := index.db.Get([]byte(eventWatermarkKey), nil)
+	switch {
+	case errors.Is(err, leveldb.ErrNotFound):
+		ell.watermark = 0
+	case err != nil:
+		index.Close()
+		return err
+	default:
+		ell.watermark = binary.BigEndian.Uint64(watermark)
+	}
+	ell.index = index
+	return nil
+}
+
+func (ell *EventLogLevel) Close() error {
+	ell.mu.Lock()
+	defer ell.mu.Unlock()
+
+	if ell.index == nil {
+		return nil
+	}
+	err := ell.index.Close()
+	ell.index = nil
+	return err
+}
+
+func (ell *EventLogLevel) Append(tenant string, messageCid string, indexes KeyValues) error {
+	ell.mu.Lock()
+	defer ell.mu.Unlock()
+
+	if ell.index == nil {
+		return fmt.Errorf("event log not open")
+	}
+
+	// The watermark is saved before the event, so that a crash in between
+	// skips a watermark rather than reusing it
+	watermark := make([]byte, 8)
+	binary.BigEndian.PutUint64(watermark, ell.watermark+1)
+	if err := ell.index.db.Put([]byte(eventWatermarkKey), watermark, nil); err != nil {
+		return err
+	}
+	ell.watermark++
+
+	eventIndexes := make(KeyValues, len(indexes)+2)
+	for name, value := range indexes {
+		eventIndexes[name] = value
+	}
+	eventIndexes[eventWatermarkProperty] = eventWatermark(ell.watermark)
+	eventIndexes[eventMessageCidProperty] = messageCid
+	return ell.index.Put(tenant, eventWatermark(ell.watermark), eventIndexes, nil)
+}
+
+func (ell *EventLogLevel) GetEvents(tenant string, options *EventOptions) ([]string, error) {
+	events, err := ell.QueryEvents(tenant, nil, options)
+	if err != nil {
+		return nil, err
+	}
+	messageCids := make([]string, len(events))
+	for i, event := range events {
+		messageCids[i] = event.MessageCid
+	}
+	return messageCids, nil
+}
+
+// QueryEvents returns the events matching any of filters, in the form
+// IndexLevel.Query accepts, in the order they were appended.
+func (ell *EventLogLevel) QueryEvents(tenant string, filters []Filter, options *EventOptions) ([]Event, error) {
+	ell.mu.Lock()
+	index := ell.index
+	ell.mu.Unlock()
+	if index == nil {
+		return nil, fmt.Errorf("event log not open")
+	}
+
+	queryOptions := QueryOptions{SortProperty: eventWatermarkProperty, SortDirection: SortDirectionAscending}
+	if options != nil && options.Cursor != "" {
+		id, err := strconv.ParseUint(options.Cursor, 10, 63)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %q", options.Cursor)
+		}
+		watermark := eventWatermark(id)
+		queryOptions.Cursor = &PaginationCursor{MessageCid: watermark, Value: watermark}
+	}
+	if options != nil {
+		queryOptions.Limit = options.Limit
+	}
+
+	items, err := index.Query(tenant, filters, queryOptions, nil)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(items))
+	for i, item := range items {
+		messageCid, _ := item.Indexes[eventMessageCidProperty].(string)
+		events[i] = Event{MessageCid: messageCid, Watermark: item.ItemID}
+	}
+	return events, nil
+}
+
+func (ell *EventLogLevel) DeleteEventsByCid(tenant string, messageCids []string) error {
+	if len(messageCids) == 0 {
+		return nil
+	}
+
+	cids := make([]interface{}, len(messageCids))
+	for i, messageCid := range messageCids {
+		cids[i] = messageCid
+	}
+	events, err := ell.QueryEvents(tenant, []Filter{{eventMessageCidProperty: cids}}, nil)
+	if err != nil {
+		return err
+	}
+
+	ell.mu.Lock()
+	defer ell.mu.Unlock()
+	if ell.index == nil {
+		return fmt.Errorf("event log not open")
+	}
+	for _, event := range events {
+		if err := ell.index.Delete(tenant, event.Watermark, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear deletes every event, leaving the watermark counter as it is.
+func (ell *EventLogLevel) Clear() error {
+	ell.mu.Lock()
+	defer ell.mu.Unlock()
+
+	if ell.index == nil {
+		return fmt.Errorf("event log not open")
+	}
+	batch := new(leveldb.Batch)
+	iter := ell.index.db.NewIterator(nil, nil)
+	for iter.Next() {
+		if string(iter.Key()) != eventWatermarkKey {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return ell.index.db.Write(batch, nil)
+}
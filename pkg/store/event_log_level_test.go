@@ -0,0 +1,65 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLogLevel(t *testing.T) {
+	config := EventLogLevelConfig{Location: filepath.Join(t.TempDir(), "eventlog")}
+	eventLog, err := NewEventLogLevel(config)
+	require.NoError(t, err)
+	require.NoError(t, eventLog.Open())
+	defer func() { eventLog.Close() }()
+
+	require.NoError(t, eventLog.Append("did:example:alice", "cid-1", KeyValues{"interface": "Records", "tag.draft": true}))
+	require.NoError(t, eventLog.Append("did:example:alice", "cid-2", KeyValues{"interface": "Protocols"}))
+	require.NoError(t, eventLog.Append("did:example:alice", "cid-3", KeyValues{"interface": "Records"}))
+	require.NoError(t, eventLog.Append("did:example:bob", "cid-4", KeyValues{"interface": "Records"}))
+
+	events, err := eventLog.GetEvents("did:example:alice", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cid-1", "cid-2", "cid-3"}, events)
+
+	records, err := eventLog.QueryEvents("did:example:alice", []Filter{{"interface": "Records"}}, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "cid-1", records[0].MessageCid)
+	assert.Equal(t, "cid-3", records[1].MessageCid)
+	assert.Less(t, records[0].Watermark, records[1].Watermark)
+
+	events, err = eventLog.GetEvents("did:example:alice", &EventOptions{Cursor: records[0].Watermark, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cid-2"}, events)
+
+	_, err = eventLog.GetEvents("did:example:alice", &EventOptions{Cursor: "cid-1"})
+	assert.Error(t, err)
+
+	require.NoError(t, eventLog.DeleteEventsByCid("did:example:alice", []string{"cid-1", "cid-3"}))
+	events, err = eventLog.GetEvents("did:example:alice", &EventOptions{Cursor: records[0].Watermark})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cid-2"}, events)
+
+	// Events and watermarks outlive a restart
+	require.NoError(t, eventLog.Close())
+	eventLog, err = NewEventLogLevel(config)
+	require.NoError(t, err)
+	require.NoError(t, eventLog.Open())
+	require.NoError(t, eventLog.Append("did:example:alice", "cid-5", KeyValues{"interface": "Records"}))
+
+	latest, err := eventLog.QueryEvents("did:example:alice", nil, &EventOptions{Cursor: records[1].Watermark})
+	require.NoError(t, err)
+	require.Len(t, latest, 1)
+	assert.Equal(t, "cid-5", latest[0].MessageCid)
+	events, err = eventLog.GetEvents("did:example:alice", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cid-2", "cid-5"}, events)
+
+	require.NoError(t, eventLog.Clear())
+	events, err = eventLog.GetEvents("did:example:alice", nil)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -2,24 +2,30 @@ package store
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/abaxxtech/abaxx-id-go/pkg/store/models"
 	"gorm.io/gorm"
 )
 
 type EventLogSQL struct {
-	db     *gorm.DB
-	config MessageStoreSQLConfig
+	db       *gorm.DB
+	provider *models.DBProvider
+	config   MessageStoreSQLConfig
 }
 
 func NewEventLogSQL(config MessageStoreSQLConfig) (*EventLogSQL, error) {
 	return &EventLogSQL{
-		config: config,
+		provider: config.dbProvider(),
+		config:   config,
 	}, nil
 }
 
 func (els *EventLogSQL) Open() error {
-	db, err := models.GetDB(els.config.DBConfig)
+	if els.db != nil {
+		return nil
+	}
+	db, err := els.provider.Acquire()
 	if err != nil {
 		return fmt.Errorf("failed to get database connection: %w", err)
 	}
@@ -27,9 +33,14 @@ func (els *EventLogSQL) Open() error {
 	return nil
 }
 
+// Close gives back the database connection, closing the database unless
+// other stores of its DBProvider still use it.
 func (els *EventLogSQL) Close() error {
+	if els.db == nil {
+		return nil
+	}
 	els.db = nil
-	return nil
+	return els.provider.Release()
 }
 
 func (els *EventLogSQL) Append(tenant string, messageCid string, indexes KeyValues) error {
@@ -73,14 +84,39 @@ func (els *EventLogSQL) Append(tenant string, messageCid string, indexes KeyValu
 		Timestamp:            getStringValue(indexes, "timestamp"),
 	}
 
-	return els.db.Create(&eventLog).Error
+	return els.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&eventLog).Error; err != nil {
+			return err
+		}
+		tags := []models.EventLogTag{}
+		for name, value := range sqlTags(indexes) {
+			tags = append(tags, models.EventLogTag{
+				EventLogID: eventLog.ID, Name: name, Value: sqlText(value), NumberValue: sqlNumber(value),
+			})
+		}
+		if len(tags) > 0 {
+			return tx.Create(&tags).Error
+		}
+		return nil
+	})
 }
 
 func (els *EventLogSQL) GetEvents(tenant string, options *EventOptions) ([]string, error) {
-	return els.QueryEvents(tenant, nil, options)
+	events, err := els.QueryEvents(tenant, nil, options)
+	if err != nil {
+		return nil, err
+	}
+	messageCids := make([]string, len(events))
+	for i, event := range events {
+		messageCids[i] = event.MessageCid
+	}
+	return messageCids, nil
 }
 
-func (els *EventLogSQL) QueryEvents(tenant string, filters []DataFilter, options *EventOptions) ([]string, error) {
+// QueryEvents returns the events matching any of filters, in the form
+// IndexLevel.Query accepts, in the order they were appended.  Filtering on a
+// property without a column fails with an UnknownPropertyError.
+func (els *EventLogSQL) QueryEvents(tenant string, filters []Filter, options *EventOptions) ([]Event, error) {
 	if els.db == nil {
 		return nil, fmt.Errorf("database connection not open")
 	}
@@ -88,34 +124,46 @@ func (els *EventLogSQL) QueryEvents(tenant string, filters []DataFilter, options
 	query := els.db.Model(&models.EventLog{}).Where("tenant = ?", tenant)
 
 	// Apply filters
-	for _, filter := range filters {
-		query = query.Where(fmt.Sprintf("%s %s ?", filter.Property, filter.Operator), filter.Value)
+	condition, vars, err := eventLogTable.where(filters)
+	if err != nil {
+		return nil, err
+	}
+	if condition != "" {
+		query = query.Where(condition, vars...)
 	}
 
-	// Apply cursor-based pagination if cursor is provided
+	// Resume after the watermark, which is the ID of an event, so that it
+	// stays valid once the event is deleted
 	if options != nil && options.Cursor != "" {
-		var cursorEvent models.EventLog
-		if err := els.db.Where("tenant = ? AND message_cid = ?", tenant, options.Cursor).First(&cursorEvent).Error; err != nil {
-			return nil, fmt.Errorf("invalid cursor: %w", err)
+		id, err := strconv.ParseUint(options.Cursor, 10, 63)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %q", options.Cursor)
 		}
-		query = query.Where("id > ?", cursorEvent.ID)
+		query = query.Where("event_logs.id > ?", id)
+	}
+	if options != nil && options.Limit > 0 {
+		query = query.Limit(options.Limit)
 	}
 
 	// Order by ID (watermark) ascending
-	query = query.Order("id asc")
+	query = query.Order("event_logs.id asc")
 
-	var events []models.EventLog
-	if err := query.Find(&events).Error; err != nil {
+	var eventLogs []models.EventLog
+	if err := query.Find(&eventLogs).Error; err != nil {
 		return nil, err
 	}
 
-	// Extract message CIDs
-	messageCids := make([]string, len(events))
-	for i, event := range events {
-		messageCids[i] = event.MessageCid
+	events := make([]Event, len(eventLogs))
+	for i, eventLog := range eventLogs {
+		events[i] = Event{MessageCid: eventLog.MessageCid, Watermark: eventWatermark(uint64(eventLog.ID))}
 	}
+	return events, nil
+}
 
-	return messageCids, nil
+// eventWatermark spells the ID of an event as its watermark, zero-padded so
+// that watermarks sort like IDs.
+func eventWatermark(id uint64) string {
+	return fmt.Sprintf("%020d", id)
 }
 
 func (els *EventLogSQL) DeleteEventsByCid(tenant string, messageCids []string) error {
@@ -127,7 +175,13 @@ func (els *EventLogSQL) DeleteEventsByCid(tenant string, messageCids []string) e
 		return nil
 	}
 
-	return els.db.Where("tenant = ? AND message_cid IN ?", tenant, messageCids).Delete(&models.EventLog{}).Error
+	return els.db.Transaction(func(tx *gorm.DB) error {
+		events := tx.Model(&models.EventLog{}).Select("id").Where("tenant = ? AND message_cid IN ?", tenant, messageCids)
+		if err := tx.Where("event_log_id IN (?)", events).Delete(&models.EventLogTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("tenant = ? AND message_cid IN ?", tenant, messageCids).Delete(&models.EventLog{}).Error
+	})
 }
 
 func (els *EventLogSQL) Clear() error {
@@ -135,9 +189,22 @@ func (els *EventLogSQL) Clear() error {
 		return fmt.Errorf("database connection not open")
 	}
 
-	return els.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.EventLog{}).Error
+	session := els.db.Session(&gorm.Session{AllowGlobalUpdate: true})
+	if err := session.Delete(&models.EventLogTag{}).Error; err != nil {
+		return err
+	}
+	return session.Delete(&models.EventLog{}).Error
+}
+
+// Event is an event of the log, with the watermark to resume after it.
+type Event struct {
+	MessageCid string
+	Watermark  string
 }
 
 type EventOptions struct {
+	// Cursor is the watermark of the event to resume after
 	Cursor string
+	// Limit, when positive, is the most events to return
+	Limit int
 }
@@ -3,7 +3,7 @@ package store
 import (
 	"testing"
 
-	"github.com/abaxxtech/abaxx-id-go/pkg/store/models"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,14 +12,61 @@ func setupTestEventLogSQLWithoutCleanup(t *testing.T) *EventLogSQL {
 	store, err := NewEventLogSQL(config)
 	require.NoError(t, err)
 
-	db, err := models.GetDB(config.DBConfig)
-	require.NoError(t, err)
-	store.db = db
+	require.NoError(t, store.Open())
+	t.Cleanup(func() { store.Close() })
 
 	return store
 }
 
+func TestEventLogSQL(t *testing.T) {
+	store := setupTestEventLogSQL(t)
+	defer cleanupTestEventLogSQL(t, store)
+
+	require.NoError(t, store.Append("did:example:alice", "cid-1", KeyValues{"interface": "Records", "tag.draft": true}))
+	require.NoError(t, store.Append("did:example:alice", "cid-2", KeyValues{"interface": "Protocols"}))
+	require.NoError(t, store.Append("did:example:alice", "cid-3", KeyValues{"interface": "Records"}))
+	require.NoError(t, store.Append("did:example:bob", "cid-4", KeyValues{"interface": "Records"}))
+
+	events, err := store.GetEvents("did:example:alice", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cid-1", "cid-2", "cid-3"}, events)
+
+	records, err := store.QueryEvents("did:example:alice", []Filter{{"interface": "Records"}}, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "cid-1", records[0].MessageCid)
+	assert.Equal(t, "cid-3", records[1].MessageCid)
+	assert.Less(t, records[0].Watermark, records[1].Watermark)
+
+	events, err = store.GetEvents("did:example:alice", &EventOptions{Cursor: records[0].Watermark})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cid-2", "cid-3"}, events)
+
+	events, err = store.GetEvents("did:example:alice", &EventOptions{Cursor: records[0].Watermark, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cid-2"}, events)
+
+	tagged, err := store.QueryEvents("did:example:alice", []Filter{{"tag.draft": true}}, nil)
+	require.NoError(t, err)
+	require.Len(t, tagged, 1)
+	assert.Equal(t, "cid-1", tagged[0].MessageCid)
+
+	_, err = store.GetEvents("did:example:alice", &EventOptions{Cursor: "cid-1"})
+	assert.Error(t, err)
+
+	require.NoError(t, store.DeleteEventsByCid("did:example:alice", []string{"cid-1", "cid-3"}))
+	events, err = store.GetEvents("did:example:alice", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cid-2"}, events)
+
+	// Watermarks of deleted events stay valid
+	events, err = store.GetEvents("did:example:alice", &EventOptions{Cursor: records[0].Watermark})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cid-2"}, events)
+}
+
 func cleanupTestEventLogSQL(t *testing.T, store *EventLogSQL) {
+	require.NoError(t, store.db.Exec("DELETE FROM event_log_tags").Error)
 	require.NoError(t, store.db.Exec("DELETE FROM event_logs").Error)
 }
 
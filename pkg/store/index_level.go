@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 type EqualFilter interface{}
@@ -139,10 +141,260 @@ func (il *IndexLevel) Delete(tenant string, itemId string, options *IndexLevelOp
 	return il.db.Write(batch, nil)
 }
 
-func (il *IndexLevel) Query(tenant string, filters []Filter, queryOptions QueryOptions, options *IndexLevelOptions) ([]string, error) {
-	// Implement query logic
-	// For simplicity, we'll just return an empty slice
-	return []string{}, nil
+// Query returns the items matching any of filters, sorted by
+// queryOptions.SortProperty.  A filter maps each of its properties to a value
+// the property must equal, a []interface{} of values it must equal one of, or
+// a RangeFilter with "gt", "gte", "lt" and "lte" bounds; an empty filter, like
+// an empty list of filters, matches every item.  Only items indexed by the
+// sort property are returned.
+//
+// The partition of the sort property is walked in the sort direction from
+// queryOptions.Cursor, which names the last item of the previous page, and
+// the walk stops once queryOptions.Limit items match.  Keys order items by
+// their encoded sort value, which truncates fractions, so the items sharing
+// an encoded value are read together and put in order by their values.
+func (il *IndexLevel) Query(tenant string, filters []Filter, queryOptions QueryOptions, options *IndexLevelOptions) ([]IndexedItem, error) {
+	if queryOptions.SortProperty == "" {
+		return nil, errors.New("sort property is required")
+	}
+	filterSets := make([][]indexFilter, len(filters))
+	for i, filter := range filters {
+		indexFilters, err := parseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		filterSets[i] = indexFilters
+	}
+	matches := func(item IndexedItem) bool {
+		if len(filterSets) == 0 {
+			return true
+		}
+		for _, indexFilters := range filterSets {
+			if matchIndexFilters(item.Indexes, indexFilters) {
+				return true
+			}
+		}
+		return false
+	}
+
+	sortProperty, cursor := queryOptions.SortProperty, queryOptions.Cursor
+	descending := queryOptions.SortDirection == SortDirectionDescending
+	// order compares items in the sort direction.
+	order := func(aValue interface{}, aId string, bValue interface{}, bId string) int {
+		c := compareIndexValues(aValue, bValue)
+		if c == 0 {
+			c = strings.Compare(aId, bId)
+		}
+		if descending {
+			return -c
+		}
+		return c
+	}
+
+	partition := il.createIndexPartitionKey(tenant, sortProperty, "")
+	iter := il.db.NewIterator(util.BytesPrefix([]byte(partition)), nil)
+	defer iter.Release()
+	var ok bool
+	switch {
+	case cursor == nil && descending:
+		ok = iter.Last()
+	case cursor == nil:
+		ok = iter.First()
+	case descending:
+		// Past every key of the encoded cursor value
+		if ok = iter.Seek([]byte(partition + encodeValue(cursor.Value) + "\x01")); ok {
+			ok = iter.Prev()
+		} else {
+			ok = iter.Last()
+		}
+	default:
+		ok = iter.Seek([]byte(partition + encodeValue(cursor.Value)))
+	}
+	next := iter.Next
+	if descending {
+		next = iter.Prev
+	}
+
+	items := []IndexedItem{}
+	var group []IndexedItem
+	var groupValue string
+	// flush adds the matching items of group that come after the cursor to
+	// items, and reports whether the limit is reached.
+	flush := func() bool {
+		sort.Slice(group, func(i, j int) bool {
+			return order(group[i].Indexes[sortProperty], group[i].ItemID,
+				group[j].Indexes[sortProperty], group[j].ItemID) < 0
+		})
+		for _, item := range group {
+			if cursor != nil && order(item.Indexes[sortProperty], item.ItemID, cursor.Value, cursor.MessageCid) <= 0 {
+				continue
+			}
+			if matches(item) {
+				items = append(items, item)
+				if queryOptions.Limit > 0 && len(items) == queryOptions.Limit {
+					return true
+				}
+			}
+		}
+		group = group[:0]
+		return false
+	}
+
+	for ; ok; ok = next() {
+		key := string(iter.Key()[len(partition):])
+		value := key[:strings.LastIndex(key, DELIMITER)]
+		if value != groupValue && len(group) > 0 {
+			if options != nil && options.Context != nil {
+				if err := options.Context.Err(); err != nil {
+					return nil, err
+				}
+			}
+			if flush() {
+				return items, nil
+			}
+		}
+		groupValue = value
+
+		var item IndexedItem
+		if err := json.Unmarshal(iter.Value(), &item); err != nil {
+			return nil, err
+		}
+		group = append(group, item)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	flush()
+	return items, nil
+}
+
+// indexFilter is the condition a filter puts on one property: equal to one of
+// oneOf, or within the bounds of rangeFilter.
+type indexFilter struct {
+	property    string
+	oneOf       []interface{}
+	rangeFilter RangeFilter
+}
+
+func parseFilter(filter Filter) ([]indexFilter, error) {
+	indexFilters := make([]indexFilter, 0, len(filter))
+	for property, value := range filter {
+		indexFilter := indexFilter{property: property}
+		switch v := value.(type) {
+		case []interface{}:
+			indexFilter.oneOf = v
+		case RangeFilter:
+			indexFilter.rangeFilter = v
+		case map[string]interface{}:
+			indexFilter.rangeFilter = RangeFilter(v)
+		default:
+			indexFilter.oneOf = []interface{}{v}
+		}
+		for bound := range indexFilter.rangeFilter {
+			switch bound {
+			case "gt", "gte", "lt", "lte":
+			default:
+				return nil, fmt.Errorf("unsupported range bound %s on %s", bound, property)
+			}
+		}
+		indexFilters = append(indexFilters, indexFilter)
+	}
+	sort.Slice(indexFilters, func(i, j int) bool {
+		return indexFilters[i].property < indexFilters[j].property
+	})
+	return indexFilters, nil
+}
+
+func matchIndexFilters(indexes KeyValues, indexFilters []indexFilter) bool {
+	for _, f := range indexFilters {
+		value, ok := indexes[f.property]
+		if !ok || !matchIndexFilter(value, f) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchIndexFilter(value interface{}, f indexFilter) bool {
+	if f.rangeFilter == nil {
+		for _, equal := range f.oneOf {
+			if c, ok := compareComparable(value, equal); ok && c == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for bound, boundValue := range f.rangeFilter {
+		c, ok := compareComparable(value, boundValue)
+		if !ok {
+			return false
+		}
+		switch {
+		case bound == "gt" && c <= 0,
+			bound == "gte" && c < 0,
+			bound == "lt" && c >= 0,
+			bound == "lte" && c > 0:
+			return false
+		}
+	}
+	return true
+}
+
+// compareIndexValues orders index values of the same type by value, and
+// others by their encoding.
+func compareIndexValues(a, b interface{}) int {
+	if c, ok := compareComparable(a, b); ok {
+		return c
+	}
+	return strings.Compare(encodeValue(a), encodeValue(b))
+}
+
+// compareComparable compares two numbers, strings or booleans, and reports
+// whether they were comparable.
+func compareComparable(a, b interface{}) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case bool:
+		y, ok := b.(bool)
+		switch {
+		case !ok:
+			return 0, false
+		case x == y:
+			return 0, true
+		case y:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
 }
 
 // Helper functions
@@ -183,7 +435,8 @@ func encodeValue(value interface{}) string {
 	case float64:
 		return encodeNumberValue(int64(v))
 	case string:
-		return fmt.Sprintf("%q", v)
+		// Unescaped, so that keys sort like the strings they hold.
+		return `"` + v
 	case bool:
 		return fmt.Sprintf("%t", v)
 	default:
@@ -210,7 +463,7 @@ func (il *IndexLevel) getIndexes(tenant, itemId string) (KeyValues, error) {
 
 type QueryOptions struct {
 	Limit         int
-	Cursor        string
+	Cursor        *PaginationCursor
 	SortProperty  string
 	SortDirection string
 }
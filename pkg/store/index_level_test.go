@@ -0,0 +1,137 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIndexLevel(t *testing.T) *IndexLevel {
+	t.Helper()
+	index, err := NewIndexLevel(IndexLevelConfig{Location: filepath.Join(t.TempDir(), "index")})
+	require.NoError(t, err)
+	t.Cleanup(func() { index.Close() })
+
+	items := map[string]KeyValues{
+		"a": {"schema": "post", "dataSize": 10, "published": true, "messageTimestamp": "2024-01-01"},
+		"b": {"schema": "post", "dataSize": -5, "published": false, "messageTimestamp": "2024-01-02"},
+		"c": {"schema": "postcard", "dataSize": 200, "published": true, "messageTimestamp": "2024-01-03"},
+		"d": {"schema": "reply", "dataSize": 10.5, "messageTimestamp": "2024-01-04"},
+		"e": {"schema": "post", "dataSize": 10},
+	}
+	for itemId, indexes := range items {
+		require.NoError(t, index.Put("did:example:alice", itemId, indexes, nil))
+	}
+	require.NoError(t, index.Put("did:example:bob", "f", KeyValues{"schema": "post", "messageTimestamp": "2024-01-05"}, nil))
+	return index
+}
+
+func queryTestIndexLevel(t *testing.T, index *IndexLevel, filters []Filter, queryOptions QueryOptions) []string {
+	t.Helper()
+	items, err := index.Query("did:example:alice", filters, queryOptions, nil)
+	require.NoError(t, err)
+	itemIds := make([]string, len(items))
+	for i, item := range items {
+		itemIds[i] = item.ItemID
+	}
+	return itemIds
+}
+
+func TestIndexLevelQuery(t *testing.T) {
+	index := newTestIndexLevel(t)
+	ascending := QueryOptions{SortProperty: "messageTimestamp", SortDirection: SortDirectionAscending}
+
+	tests := []struct {
+		name     string
+		filters  []Filter
+		expected []string
+	}{
+		{"empty filter matches items with the sort property", []Filter{{}}, []string{"a", "b", "c", "d"}},
+		{"no filters match every item with the sort property", nil, []string{"a", "b", "c", "d"}},
+		{"equality", []Filter{{"schema": "post"}}, []string{"a", "b"}},
+		{"equality across properties", []Filter{{"schema": "post", "published": true}}, []string{"a"}},
+		{"numbers of either type", []Filter{{"dataSize": int64(10)}}, []string{"a"}},
+		{"oneOf", []Filter{{"schema": []interface{}{"reply", "postcard"}}}, []string{"c", "d"}},
+		{"gt", []Filter{{"dataSize": RangeFilter{"gt": 10}}}, []string{"c", "d"}},
+		{"gte and lt", []Filter{{"dataSize": RangeFilter{"gte": -5, "lt": 10.5}}}, []string{"a", "b"}},
+		{"lte on a fraction", []Filter{{"dataSize": RangeFilter{"lte": 10.5}}}, []string{"a", "b", "d"}},
+		{"string prefix", []Filter{{"schema": RangeFilter{"gte": "post", "lt": "post\uffff"}}}, []string{"a", "b", "c"}},
+		{"string range excludes the bound", []Filter{{"schema": RangeFilter{"gt": "post"}}}, []string{"c", "d"}},
+		{"range and equality", []Filter{{"schema": "post", "dataSize": RangeFilter{"lt": 0}}}, []string{"b"}},
+		{"filters are ORed", []Filter{{"schema": "reply"}, {"published": false}, {"schema": "post"}},
+			[]string{"a", "b", "d"}},
+		{"type mismatch", []Filter{{"dataSize": RangeFilter{"gt": "1"}}}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, queryTestIndexLevel(t, index, tt.filters, ascending))
+		})
+	}
+
+	t.Run("sorts by any property in either direction", func(t *testing.T) {
+		itemIds := queryTestIndexLevel(t, index, []Filter{{}}, QueryOptions{
+			SortProperty: "dataSize", SortDirection: SortDirectionDescending,
+		})
+		assert.Equal(t, []string{"c", "d", "e", "a", "b"}, itemIds)
+	})
+
+	t.Run("continues after the cursor", func(t *testing.T) {
+		options := QueryOptions{SortProperty: "dataSize", SortDirection: SortDirectionAscending, Limit: 2}
+		var pages [][]string
+		for {
+			items, err := index.Query("did:example:alice", []Filter{{}}, options, nil)
+			require.NoError(t, err)
+			if len(items) == 0 {
+				break
+			}
+			page := []string{}
+			for _, item := range items {
+				page = append(page, item.ItemID)
+			}
+			pages = append(pages, page)
+			last := items[len(items)-1]
+			options.Cursor = &PaginationCursor{MessageCid: last.ItemID, Value: last.Indexes["dataSize"]}
+		}
+		assert.Equal(t, [][]string{{"b", "a"}, {"e", "d"}, {"c"}}, pages)
+	})
+
+	t.Run("continues after the cursor in descending order", func(t *testing.T) {
+		options := QueryOptions{SortProperty: "dataSize", SortDirection: SortDirectionDescending, Limit: 2}
+		var pages [][]string
+		for {
+			items, err := index.Query("did:example:alice", []Filter{{"published": []interface{}{true, false}}}, options, nil)
+			require.NoError(t, err)
+			if len(items) == 0 {
+				break
+			}
+			page := []string{}
+			for _, item := range items {
+				page = append(page, item.ItemID)
+			}
+			pages = append(pages, page)
+			last := items[len(items)-1]
+			options.Cursor = &PaginationCursor{MessageCid: last.ItemID, Value: last.Indexes["dataSize"]}
+		}
+		assert.Equal(t, [][]string{{"c", "a"}, {"b"}}, pages)
+	})
+
+	t.Run("continues after a cursor that is gone", func(t *testing.T) {
+		itemIds := queryTestIndexLevel(t, index, []Filter{{}}, QueryOptions{
+			SortProperty: "dataSize", SortDirection: SortDirectionDescending,
+			Cursor: &PaginationCursor{MessageCid: "z", Value: 10},
+		})
+		assert.Equal(t, []string{"e", "a", "b"}, itemIds)
+	})
+
+	t.Run("rejects unknown range bounds", func(t *testing.T) {
+		_, err := index.Query("did:example:alice", []Filter{{"dataSize": RangeFilter{"ne": 1}}}, ascending, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("skips deleted items", func(t *testing.T) {
+		require.NoError(t, index.Delete("did:example:alice", "a", nil))
+		assert.Equal(t, []string{"b"}, queryTestIndexLevel(t, index, []Filter{{"schema": "post"}}, ascending))
+	})
+}
@@ -2,11 +2,13 @@ package store
 
 import (
 	"context"
+	"errors"
+	"strings"
 
+	dwncid "github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
 	"github.com/fxamacker/cbor/v2"
 	"github.com/ipfs/go-cid"
-	cbornode "github.com/ipfs/go-ipld-cbor"
-	"github.com/multiformats/go-multihash"
+	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
@@ -22,6 +24,9 @@ type MessageStoreLevelConfig struct {
 	BlockstoreLocation  string
 	IndexLocation       string
 	CreateLevelDatabase func(string) (*LevelWrapper, error)
+	// PrefixPartitions keeps the messages of each tenant under a key prefix
+	// of one blockstore rather than in a blockstore of their own.
+	PrefixPartitions bool
 }
 
 // MessageStoreOptions contains options for message store operations
@@ -62,7 +67,9 @@ func NewMessageStoreLevel(config MessageStoreLevelConfig) (*MessageStoreLevel, e
 		}
 	}
 
-	bs, err := NewBlockstoreLevel(config.BlockstoreLocation)
+	bs, err := NewBlockstoreLevelWithOptions(config.BlockstoreLocation, BlockstoreLevelOptions{
+		PrefixPartitions: config.PrefixPartitions,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -115,12 +122,20 @@ func (msl *MessageStoreLevel) Get(tenant, cidString string, options *MessageStor
 	if err != nil {
 		return nil, err
 	}
-	var message GenericMessage
+	var message map[string]interface{}
 	err = cbor.Unmarshal(bytes, &message)
 	if err != nil {
 		return nil, err
 	}
 
+	encodedData, err := partition.Get(context.Background(), encodedDataCid(c))
+	switch {
+	case err == nil:
+		message["encodedData"] = string(encodedData)
+	case !errors.Is(err, leveldb.ErrNotFound):
+		return nil, err
+	}
+
 	return message, nil
 }
 
@@ -134,24 +149,39 @@ func (msl *MessageStoreLevel) Query(tenant string, filters []Filter, messageSort
 		}
 	}
 
-	queryOptions := buildQueryOptions(messageSort, pagination)
-	results, err := msl.index.Query(tenant, filters, queryOptions, &IndexLevelOptions{})
+	queryOptions, err := buildQueryOptions(messageSort, pagination)
 	if err != nil {
 		return nil, "", err
 	}
-
-	messages := make([]GenericMessage, 0, len(results))
-	for _, messageCid := range results {
-		message, err := msl.Get(tenant, messageCid, options)
-		if err == nil {
-			messages = append(messages, message)
-		}
+	indexOptions := &IndexLevelOptions{}
+	if options != nil {
+		indexOptions.Context = options.Signal
+	}
+	results, err := msl.index.Query(tenant, filters, queryOptions, indexOptions)
+	if err != nil {
+		return nil, "", err
 	}
 
 	var cursor string
 	if pagination != nil && pagination.Limit > 0 && len(results) > pagination.Limit {
-		messages = messages[:pagination.Limit]
-		cursor = results[pagination.Limit-1]
+		results = results[:pagination.Limit]
+		last := results[len(results)-1]
+		cursor, err = EncodeCursor(PaginationCursor{
+			MessageCid: last.ItemID,
+			Value:      last.Indexes[queryOptions.SortProperty],
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	messages := make([]GenericMessage, 0, len(results))
+	for _, result := range results {
+		message, err := msl.Get(tenant, result.ItemID, options)
+		if err != nil {
+			return nil, "", err
+		}
+		messages = append(messages, message)
 	}
 
 	return messages, cursor, nil
@@ -180,6 +210,9 @@ func (msl *MessageStoreLevel) Delete(tenant, cidString string, options *MessageS
 	if err := partition.Delete(context.Background(), c); err != nil {
 		return err
 	}
+	if err := partition.Delete(context.Background(), encodedDataCid(c)); err != nil {
+		return err
+	}
 
 	return msl.index.Delete(tenant, cidString, &IndexLevelOptions{})
 }
@@ -199,13 +232,25 @@ func (msl *MessageStoreLevel) Put(tenant string, message GenericMessage, indexes
 		return err
 	}
 
-	encodedMessage, err := cbornode.WrapObject(message, multihash.SHA2_256, -1)
+	messageCid, encodedMessage, err := dwncid.EncodeMessage(message)
 	if err != nil {
 		return err
 	}
 
-	messageCid := encodedMessage.Cid()
-	if err := partition.Put(context.Background(), messageCid, encodedMessage.RawData()); err != nil {
+	// The message block leaves out the inline data, as its CID does, so the
+	// data is kept under a key of its own, or dropped along with it
+	if encodedData, ok := messageEncodedData(message); ok {
+		err = partition.PutMany(context.Background(), map[cid.Cid][]byte{
+			messageCid:                 encodedMessage,
+			encodedDataCid(messageCid): []byte(encodedData),
+		})
+	} else {
+		err = partition.Put(context.Background(), messageCid, encodedMessage)
+		if err == nil {
+			err = partition.Delete(context.Background(), encodedDataCid(messageCid))
+		}
+	}
+	if err != nil {
 		return err
 	}
 
@@ -213,6 +258,26 @@ func (msl *MessageStoreLevel) Put(tenant string, message GenericMessage, indexes
 	return msl.index.Put(tenant, messageCidString, indexes, &IndexLevelOptions{})
 }
 
+// encodedDataCid returns the key the inline data of the message of
+// messageCid is kept under: the CID of the message with the raw codec, which
+// no message is stored under.
+func encodedDataCid(messageCid cid.Cid) cid.Cid {
+	return cid.NewCidV1(cid.Raw, messageCid.Hash())
+}
+
+// messageEncodedData returns the inline data of message, if it has any.
+func messageEncodedData(message GenericMessage) (string, bool) {
+	var encodedData interface{}
+	switch m := message.(type) {
+	case map[string]interface{}:
+		encodedData = m["encodedData"]
+	case map[interface{}]interface{}:
+		encodedData = m["encodedData"]
+	}
+	data, ok := encodedData.(string)
+	return data, ok
+}
+
 // Clear removes all messages from the store
 func (msl *MessageStoreLevel) Clear() error {
 	if err := msl.blockstore.Clear(); err != nil {
@@ -221,22 +286,31 @@ func (msl *MessageStoreLevel) Clear() error {
 	return msl.index.Clear()
 }
 
-func buildQueryOptions(messageSort *MessageSort, pagination *Pagination) QueryOptions {
+// buildQueryOptions returns the sort and pagination of a query in the form
+// IndexLevel.Query takes, decoding the cursor.
+func buildQueryOptions(messageSort *MessageSort, pagination *Pagination) (QueryOptions, error) {
 	queryOptions := QueryOptions{
-		SortDirection: string(SortAscending),
+		SortDirection: SortDirectionAscending,
 		SortProperty:  "messageTimestamp",
 	}
 
 	if messageSort != nil {
+		direction := SortAscending
 		if messageSort.DateCreated != nil {
 			queryOptions.SortProperty = "dateCreated"
-			queryOptions.SortDirection = string(*messageSort.DateCreated)
+			direction = *messageSort.DateCreated
 		} else if messageSort.DatePublished != nil {
 			queryOptions.SortProperty = "datePublished"
-			queryOptions.SortDirection = string(*messageSort.DatePublished)
+			direction = *messageSort.DatePublished
 		} else if messageSort.MessageTimestamp != nil {
 			queryOptions.SortProperty = "messageTimestamp"
-			queryOptions.SortDirection = string(*messageSort.MessageTimestamp)
+			direction = *messageSort.MessageTimestamp
+		} else if messageSort.Property != "" {
+			queryOptions.SortProperty = messageSort.Property
+			direction = SortDirection(strings.ToLower(messageSort.Direction))
+		}
+		if direction == SortDescending {
+			queryOptions.SortDirection = SortDirectionDescending
 		}
 	}
 
@@ -245,10 +319,16 @@ func buildQueryOptions(messageSort *MessageSort, pagination *Pagination) QueryOp
 		if queryOptions.Limit > 0 {
 			queryOptions.Limit++
 		}
-		queryOptions.Cursor = pagination.Cursor
+		if pagination.Cursor != "" {
+			cursor, err := DecodeCursor(pagination.Cursor)
+			if err != nil {
+				return QueryOptions{}, err
+			}
+			queryOptions.Cursor = cursor
+		}
 	}
 
-	return queryOptions
+	return queryOptions, nil
 }
 
 func createLevelDatabase(path string) *LevelWrapper {
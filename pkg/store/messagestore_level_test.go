@@ -0,0 +1,117 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	dwncid "github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageStoreLevel(t *testing.T) {
+	for _, prefixPartitions := range []bool{false, true} {
+		t.Run(fmt.Sprintf("prefix partitions %t", prefixPartitions), func(t *testing.T) {
+			dir := t.TempDir()
+			ms, err := NewMessageStoreLevel(MessageStoreLevelConfig{
+				BlockstoreLocation: filepath.Join(dir, "blocks"),
+				IndexLocation:      filepath.Join(dir, "index"),
+				PrefixPartitions:   prefixPartitions,
+			})
+			require.NoError(t, err)
+			defer ms.Close()
+
+			var messageCids []string
+			for i := 0; i < 3; i++ {
+				message := map[string]interface{}{
+					"descriptor": map[string]interface{}{"interface": "Records", "method": "Write", "index": i},
+				}
+				timestamp := fmt.Sprintf("2024-01-0%d", i+1)
+				require.NoError(t, ms.Put("did:example:alice", message, KeyValues{
+					"interface": "Records", "messageTimestamp": timestamp,
+				}, nil))
+				messageCid, err := dwncid.ComputeMessage(message)
+				require.NoError(t, err)
+				messageCids = append(messageCids, messageCid)
+			}
+
+			message, err := ms.Get("did:example:alice", messageCids[0], nil)
+			require.NoError(t, err)
+			assert.NotNil(t, message)
+			_, err = ms.Get("did:example:bob", messageCids[0], nil)
+			assert.Error(t, err)
+
+			descending := SortDescending
+			messages, cursor, err := ms.Query("did:example:alice", []Filter{{"interface": "Records"}},
+				&MessageSort{MessageTimestamp: &descending}, &Pagination{Limit: 2}, nil)
+			require.NoError(t, err)
+			assert.Len(t, messages, 2)
+			decoded, err := DecodeCursor(cursor)
+			require.NoError(t, err)
+			assert.Equal(t, &PaginationCursor{MessageCid: messageCids[1], Value: "2024-01-02"}, decoded)
+
+			messages, cursor, err = ms.Query("did:example:alice", []Filter{{"interface": "Records"}},
+				&MessageSort{MessageTimestamp: &descending}, &Pagination{Limit: 2, Cursor: cursor}, nil)
+			require.NoError(t, err)
+			assert.Len(t, messages, 1)
+			assert.Empty(t, cursor)
+
+			require.NoError(t, ms.Delete("did:example:alice", messageCids[0], nil))
+			messages, _, err = ms.Query("did:example:alice", []Filter{{}}, nil, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, messages, 2)
+			messages, _, err = ms.Query("did:example:alice", nil, nil, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, messages, 2)
+		})
+	}
+}
+
+func TestMessageStoreLevelEncodedData(t *testing.T) {
+	for _, prefixPartitions := range []bool{false, true} {
+		t.Run(fmt.Sprintf("prefix partitions %t", prefixPartitions), func(t *testing.T) {
+			dir := t.TempDir()
+			ms, err := NewMessageStoreLevel(MessageStoreLevelConfig{
+				BlockstoreLocation: filepath.Join(dir, "blocks"),
+				IndexLocation:      filepath.Join(dir, "index"),
+				PrefixPartitions:   prefixPartitions,
+			})
+			require.NoError(t, err)
+			defer ms.Close()
+
+			descriptor := map[string]interface{}{"interface": "Records", "method": "Write"}
+			indexes := KeyValues{"interface": "Records", "messageTimestamp": "2024-01-01"}
+			message := map[string]interface{}{"descriptor": descriptor, "encodedData": "aGVsbG8"}
+			require.NoError(t, ms.Put("did:example:alice", message, indexes, nil))
+			messageCid, err := dwncid.ComputeMessage(message)
+			require.NoError(t, err)
+			stripped, err := dwncid.ComputeMessage(map[string]interface{}{"descriptor": descriptor})
+			require.NoError(t, err)
+			assert.Equal(t, stripped, messageCid)
+
+			stored, err := ms.Get("did:example:alice", messageCid, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "aGVsbG8", stored.(map[string]interface{})["encodedData"])
+			messages, _, err := ms.Query("did:example:alice", []Filter{{"interface": "Records"}}, nil, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, messages, 1)
+			assert.Equal(t, "aGVsbG8", messages[0].(map[string]interface{})["encodedData"])
+
+			// Putting the message again without its data drops the data
+			require.NoError(t, ms.Put("did:example:alice", map[string]interface{}{"descriptor": descriptor},
+				indexes, nil))
+			stored, err = ms.Get("did:example:alice", messageCid, nil)
+			require.NoError(t, err)
+			assert.NotContains(t, stored, "encodedData")
+
+			require.NoError(t, ms.Put("did:example:alice", message, indexes, nil))
+			require.NoError(t, ms.Delete("did:example:alice", messageCid, nil))
+			require.NoError(t, ms.Put("did:example:alice", map[string]interface{}{"descriptor": descriptor},
+				indexes, nil))
+			stored, err = ms.Get("did:example:alice", messageCid, nil)
+			require.NoError(t, err)
+			assert.NotContains(t, stored, "encodedData")
+		})
+	}
+}
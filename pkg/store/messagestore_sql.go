@@ -4,26 +4,30 @@ import (
 	"errors"
 	"fmt"
 
+	dwncid "github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
 	"github.com/abaxxtech/abaxx-id-go/pkg/store/models"
 	"github.com/fxamacker/cbor/v2"
-	cbornode "github.com/ipfs/go-ipld-cbor"
-	"github.com/multiformats/go-multihash"
 	"gorm.io/gorm"
 )
 
 type GormMessageStore struct {
-	db     *gorm.DB
-	config MessageStoreSQLConfig
+	db       *gorm.DB
+	provider *models.DBProvider
+	config   MessageStoreSQLConfig
 }
 
 func NewMessageStoreSQL(config MessageStoreSQLConfig) (*GormMessageStore, error) {
 	return &GormMessageStore{
-		config: config,
+		provider: config.dbProvider(),
+		config:   config,
 	}, nil
 }
 
 func (mss *GormMessageStore) Open() error {
-	db, err := models.GetDB(mss.config.DBConfig)
+	if mss.db != nil {
+		return nil
+	}
+	db, err := mss.provider.Acquire()
 	if err != nil {
 		return fmt.Errorf("failed to get database connection: %w", err)
 	}
@@ -31,10 +35,14 @@ func (mss *GormMessageStore) Open() error {
 	return nil
 }
 
+// Close gives back the database connection, closing the database unless
+// other stores of its DBProvider still use it.
 func (mss *GormMessageStore) Close() error {
-	// Don't close the actual connection since it's managed by singleton
+	if mss.db == nil {
+		return nil
+	}
 	mss.db = nil
-	return nil
+	return mss.provider.Release()
 }
 
 func (mss *GormMessageStore) Get(tenant string, messageCid string) (interface{}, error) {
@@ -52,29 +60,27 @@ func (mss *GormMessageStore) Get(tenant string, messageCid string) (interface{},
 	if err != nil {
 		return nil, err
 	}
+	if messageStore.EncodedData != "" {
+		message["encodedData"] = messageStore.EncodedData
+	}
 
 	return message, nil
 }
 
 func getStringValue(m KeyValues, key string) string {
-	if v, ok := m[key]; ok && v != nil {
-		return v.(string)
-	}
-	return ""
+	return sqlText(m[key])
 }
 
 func (mss *GormMessageStore) Put(tenant string, message GenericMessage, indexes KeyValues, options *MessageStoreOptions) error {
-	encodedMessage, err := cbornode.WrapObject(message, multihash.SHA2_256, -1)
+	messageCid, encodedMessage, err := dwncid.EncodeMessage(message)
 	if err != nil {
 		return fmt.Errorf("failed to encode message: %w", err)
 	}
 
-	messageCid := encodedMessage.Cid()
-
 	messageStore := models.MessageStore{
 		Tenant:               tenant,
 		MessageCid:           messageCid.String(),
-		EncodedMessageBytes:  encodedMessage.RawData(),
+		EncodedMessageBytes:  encodedMessage,
 		EncodedData:          getStringValue(indexes, "encodedData"),
 		Interface:            getStringValue(indexes, "interface"),
 		Method:               getStringValue(indexes, "method"),
@@ -106,99 +112,138 @@ func (mss *GormMessageStore) Put(tenant string, message GenericMessage, indexes
 		PermissionsGrantId:   getStringValue(indexes, "permissionsGrantId"),
 	}
 
-	result := mss.db.Create(&messageStore)
-	if result.Error != nil {
-		return fmt.Errorf("failed to insert message: %w", result.Error)
-	}
+	// A message put again, as the initial write of an updated record is,
+	// replaces the row of its CID along with its tags
+	return mss.db.Transaction(func(tx *gorm.DB) error {
+		existing := tx.Unscoped().Model(&models.MessageStore{}).Select("id").
+			Where("tenant = ? AND message_cid = ?", tenant, messageStore.MessageCid)
+		if err := tx.Where("message_store_id IN (?)", existing).Delete(&models.MessageStoreTag{}).Error; err != nil {
+			return fmt.Errorf("failed to replace tags: %w", err)
+		}
+		if err := tx.Unscoped().Where("tenant = ? AND message_cid = ?", tenant, messageStore.MessageCid).
+			Delete(&models.MessageStore{}).Error; err != nil {
+			return fmt.Errorf("failed to replace message: %w", err)
+		}
+		if err := tx.Create(&messageStore).Error; err != nil {
+			return fmt.Errorf("failed to insert message: %w", err)
+		}
+		tags := []models.MessageStoreTag{}
+		for name, value := range sqlTags(indexes) {
+			tags = append(tags, models.MessageStoreTag{
+				MessageStoreID: messageStore.ID, Name: name, Value: sqlText(value), NumberValue: sqlNumber(value),
+			})
+		}
+		if len(tags) > 0 {
+			if err := tx.Create(&tags).Error; err != nil {
+				return fmt.Errorf("failed to insert tags: %w", err)
+			}
+		}
+		return nil
+	})
+}
 
-	return nil
+// sortedMessage is a message along with the value it is sorted by.
+type sortedMessage struct {
+	models.MessageStore
+	SortValue string
 }
 
-func (mss *GormMessageStore) Query(tenant string, filters []DataFilter, messageSort *MessageSort, pagination *Pagination, options *MessageStoreOptions) ([]GenericMessage, string, error) {
+// Query returns the messages matching any of filters, in the form
+// IndexLevel.Query accepts, sorted as messageSort says.  Filtering or sorting
+// on a property without a column fails with an UnknownPropertyError.  Pages
+// resume after the message of the cursor, which has the format of
+// MessageStoreLevel's.
+func (mss *GormMessageStore) Query(tenant string, filters []Filter, messageSort *MessageSort, pagination *Pagination, options *MessageStoreOptions) ([]GenericMessage, string, error) {
 	query := mss.db.Model(&models.MessageStore{}).Where("tenant = ?", tenant)
 
 	// Apply filters
-	for _, filter := range filters {
-		query = query.Where(fmt.Sprintf("%s %s ?", filter.Property, filter.Operator), filter.Value)
+	condition, vars, err := messageStoreTable.where(filters)
+	if err != nil {
+		return nil, "", err
+	}
+	if condition != "" {
+		query = query.Where(condition, vars...)
 	}
 
 	// Apply sorting
-	if messageSort != nil && messageSort.Property != "" {
-		direction := messageSort.Direction
-		if direction == "" {
-			direction = "ASC"
-		}
-		query = query.Order(fmt.Sprintf("%s %s", messageSort.Property, direction))
+	queryOptions, err := buildQueryOptions(messageSort, pagination)
+	if err != nil {
+		return nil, "", err
+	}
+	sortColumn, err := messageStoreTable.column(queryOptions.SortProperty)
+	if err != nil {
+		return nil, "", err
+	}
+	order, err := messageStoreTable.order(queryOptions)
+	if err != nil {
+		return nil, "", err
 	}
+	query = query.Select("message_store.*, " + sortColumn + " AS sort_value").Order(order)
 
-	// Apply pagination
-	if pagination != nil && pagination.Limit > 0 {
-		query = query.Limit(pagination.Limit)
-		if pagination.Cursor != "" {
-			offset, err := decodeCursor(pagination.Cursor)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid cursor: %w", err)
-			}
-			query = query.Offset(offset)
+	// Apply pagination, fetching one message more than the limit to learn
+	// whether another page follows
+	if queryOptions.Cursor != nil {
+		condition, vars, err := messageStoreTable.after(queryOptions)
+		if err != nil {
+			return nil, "", err
 		}
+		query = query.Where(condition, vars...)
+	}
+	if queryOptions.Limit > 0 {
+		query = query.Limit(queryOptions.Limit)
 	}
 
-	var messages []models.MessageStore
+	var messages []sortedMessage
 	if err := query.Find(&messages).Error; err != nil {
 		return nil, "", fmt.Errorf("failed to query messages: %w", err)
 	}
 
-	var genericMessages []GenericMessage
+	var nextCursor string
+	if pagination != nil && pagination.Limit > 0 && len(messages) > pagination.Limit {
+		messages = messages[:pagination.Limit]
+		last := messages[len(messages)-1]
+		nextCursor, err = EncodeCursor(PaginationCursor{MessageCid: last.MessageCid, Value: last.SortValue})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	genericMessages := make([]GenericMessage, 0, len(messages))
 	for _, msg := range messages {
-		var genericMessage GenericMessage
-		if err := cbor.Unmarshal(msg.EncodedMessageBytes, &genericMessage); err != nil {
+		var message map[string]interface{}
+		if err := cbor.Unmarshal(msg.EncodedMessageBytes, &message); err != nil {
 			return nil, "", fmt.Errorf("failed to unmarshal message: %w", err)
 		}
 		if msg.EncodedData != "" {
-			if messageMap, ok := genericMessage.(map[string]interface{}); ok {
-				messageMap["encodedData"] = msg.EncodedData
-			}
-		}
-		genericMessages = append(genericMessages, genericMessage)
-	}
-
-	var nextCursor string
-	if pagination != nil && len(messages) == pagination.Limit {
-		offset := 0
-		if pagination.Cursor != "" {
-			offset, _ = decodeCursor(pagination.Cursor)
+			message["encodedData"] = msg.EncodedData
 		}
-		nextCursor = encodeCursor(offset + len(messages))
+		genericMessages = append(genericMessages, message)
 	}
 
 	return genericMessages, nextCursor, nil
 }
 
 func (mss *GormMessageStore) Delete(tenant string, cidString string, options *MessageStoreOptions) error {
-	result := mss.db.Where("tenant = ? AND message_cid = ?", tenant, cidString).Delete(&models.MessageStore{})
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete message: %w", result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("message not found")
-	}
-	return nil
+	return mss.db.Transaction(func(tx *gorm.DB) error {
+		messages := tx.Model(&models.MessageStore{}).Select("id").Where("tenant = ? AND message_cid = ?", tenant, cidString)
+		if err := tx.Where("message_store_id IN (?)", messages).Delete(&models.MessageStoreTag{}).Error; err != nil {
+			return fmt.Errorf("failed to delete tags: %w", err)
+		}
+		result := tx.Where("tenant = ? AND message_cid = ?", tenant, cidString).Delete(&models.MessageStore{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete message: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("message not found")
+		}
+		return nil
+	})
 }
 
 func (mss *GormMessageStore) Clear() error {
-	return mss.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.MessageStore{}).Error
-}
-
-// Helper functions for cursor encoding/decoding
-func encodeCursor(offset int) string {
-	return fmt.Sprintf("%d", offset)
-}
-
-func decodeCursor(cursor string) (int, error) {
-	var offset int
-	_, err := fmt.Sscanf(cursor, "%d", &offset)
-	if err != nil {
-		return 0, err
+	session := mss.db.Session(&gorm.Session{AllowGlobalUpdate: true})
+	if err := session.Delete(&models.MessageStoreTag{}).Error; err != nil {
+		return err
 	}
-	return offset, nil
+	return session.Delete(&models.MessageStore{}).Error
 }
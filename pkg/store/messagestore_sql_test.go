@@ -1,16 +1,19 @@
 package store
 
 import (
+	"fmt"
 	"testing"
 
+	dwncid "github.com/abaxxtech/abaxx-id-go/pkg/dwn/cid"
 	"github.com/abaxxtech/abaxx-id-go/pkg/store/config"
 	"github.com/abaxxtech/abaxx-id-go/pkg/store/models"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func getTestConfig() MessageStoreSQLConfig {
 	return MessageStoreSQLConfig{
-		DBConfig: config.NewDefaultConfig(),
+		DBConfig: config.NewSQLiteConfig(":memory:"),
 	}
 }
 
@@ -19,14 +22,11 @@ func setupTestGormStore(t *testing.T) *GormMessageStore {
 	store, err := NewMessageStoreSQL(config)
 	require.NoError(t, err)
 
-	// Get the singleton DB instance
-	db, err := models.GetDB(config.DBConfig)
-	require.NoError(t, err)
-	store.db = db
+	require.NoError(t, store.Open())
+	t.Cleanup(func() { store.Close() })
 
 	// Clear existing data
-	err = db.Exec("DELETE FROM message_store").Error
-	require.NoError(t, err)
+	cleanupTestGormStore(t, store)
 
 	return store
 }
@@ -36,19 +36,204 @@ func setupTestGormStoreWithoutCleanup(t *testing.T) *GormMessageStore {
 	store, err := NewMessageStoreSQL(config)
 	require.NoError(t, err)
 
-	// Get the singleton DB instance
-	db, err := models.GetDB(config.DBConfig)
-	require.NoError(t, err)
-	store.db = db
+	require.NoError(t, store.Open())
+	t.Cleanup(func() { store.Close() })
 
 	return store
 }
 
 func cleanupTestGormStore(t *testing.T, store *GormMessageStore) {
 	if store != nil && store.db != nil {
-		err := store.db.Exec("DELETE FROM message_store").Error
+		require.NoError(t, store.db.Exec("DELETE FROM message_store_tags").Error)
+		require.NoError(t, store.db.Exec("DELETE FROM message_store").Error)
+	}
+}
+
+func TestGormMessageStore(t *testing.T) {
+	store := setupTestGormStore(t)
+	defer cleanupTestGormStore(t, store)
+
+	var messageCids []string
+	for i := 0; i < 3; i++ {
+		message := map[string]interface{}{
+			"descriptor": map[string]interface{}{"interface": "Records", "method": "Write", "index": i},
+		}
+		require.NoError(t, store.Put("did:example:alice", message, KeyValues{
+			"interface":        "Records",
+			"messageTimestamp": fmt.Sprintf("2024-01-0%d", i+1),
+			"tag.size":         i,
+		}, nil))
+		messageCid, err := dwncid.ComputeMessage(message)
+		require.NoError(t, err)
+		messageCids = append(messageCids, messageCid)
+	}
+
+	message, err := store.Get("did:example:alice", messageCids[0])
+	require.NoError(t, err)
+	assert.NotNil(t, message)
+	message, err = store.Get("did:example:bob", messageCids[0])
+	require.NoError(t, err)
+	assert.Nil(t, message)
+
+	descending := SortDescending
+	messages, cursor, err := store.Query("did:example:alice", []Filter{{"interface": "Records"}},
+		&MessageSort{MessageTimestamp: &descending}, &Pagination{Limit: 2}, nil)
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+	decoded, err := DecodeCursor(cursor)
+	require.NoError(t, err)
+	assert.Equal(t, &PaginationCursor{MessageCid: messageCids[1], Value: "2024-01-02"}, decoded)
+
+	messages, cursor, err = store.Query("did:example:alice", []Filter{{"interface": "Records"}},
+		&MessageSort{MessageTimestamp: &descending}, &Pagination{Limit: 2, Cursor: cursor}, nil)
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Empty(t, cursor)
+
+	messages, _, err = store.Query("did:example:alice", []Filter{{"tag.size": RangeFilter{"gte": 1}}}, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+
+	require.NoError(t, store.Delete("did:example:alice", messageCids[1], nil))
+	messages, _, err = store.Query("did:example:alice", []Filter{{"tag.size": RangeFilter{"gte": 1}}}, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+	messages, _, err = store.Query("did:example:alice", nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Error(t, store.Delete("did:example:alice", messageCids[1], nil))
+}
+
+func TestGormMessageStorePutAgain(t *testing.T) {
+	store := setupTestGormStore(t)
+	defer cleanupTestGormStore(t, store)
+
+	descriptor := map[string]interface{}{"interface": "Records", "method": "Write"}
+	message := map[string]interface{}{"descriptor": descriptor}
+	messageCid, err := dwncid.ComputeMessage(message)
+	require.NoError(t, err)
+	latest := []Filter{{"isLatestBaseState": true}}
+
+	require.NoError(t, store.Put("did:example:alice", message, KeyValues{
+		"interface": "Records", "isLatestBaseState": true, "encodedData": "aGVsbG8", "tag.draft": true,
+	}, nil))
+	messages, _, err := store.Query("did:example:alice", latest, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "aGVsbG8", messages[0].(map[string]interface{})["encodedData"])
+
+	// The initial write of an updated record is put again, no longer the
+	// latest and without its data
+	require.NoError(t, store.Put("did:example:alice", message, KeyValues{
+		"interface": "Records", "isLatestBaseState": false,
+	}, nil))
+	messages, _, err = store.Query("did:example:alice", latest, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+	messages, _, err = store.Query("did:example:alice", []Filter{{"tag.draft": true}}, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+	messages, _, err = store.Query("did:example:alice", nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.NotContains(t, messages[0], "encodedData")
+
+	require.NoError(t, store.Delete("did:example:alice", messageCid, nil))
+	messages, _, err = store.Query("did:example:alice", nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	require.NoError(t, store.Put("did:example:alice", message, KeyValues{"interface": "Records", "isLatestBaseState": true}, nil))
+	messages, _, err = store.Query("did:example:alice", latest, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+}
+
+func TestGormMessageStoreNumericRanges(t *testing.T) {
+	store := setupTestGormStore(t)
+	defer cleanupTestGormStore(t, store)
+
+	var messageCids []string
+	for _, size := range []int{9, 10, 200} {
+		message := map[string]interface{}{
+			"descriptor": map[string]interface{}{"interface": "Records", "method": "Write", "dataSize": size},
+		}
+		require.NoError(t, store.Put("did:example:alice", message, KeyValues{
+			"interface": "Records",
+			"dataSize":  size,
+			"tag.size":  size,
+		}, nil))
+		messageCid, err := dwncid.ComputeMessage(message)
 		require.NoError(t, err)
+		messageCids = append(messageCids, messageCid)
 	}
+	message := map[string]interface{}{"descriptor": map[string]interface{}{"interface": "Protocols"}}
+	require.NoError(t, store.Put("did:example:alice", message, KeyValues{"interface": "Protocols", "tag.size": "large"}, nil))
+
+	for _, test := range []struct {
+		rangeFilter RangeFilter
+		count       int
+	}{
+		{RangeFilter{"gte": 5}, 3},
+		{RangeFilter{"lt": 100}, 2},
+		{RangeFilter{"gt": 9, "lte": 200}, 2},
+		{RangeFilter{"gt": 9.5, "lt": 10.5}, 1},
+	} {
+		for _, property := range []string{"dataSize", "tag.size"} {
+			messages, _, err := store.Query("did:example:alice", []Filter{{property: test.rangeFilter}}, nil, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, messages, test.count, "%s %v", property, test.rangeFilter)
+		}
+	}
+
+	var sorted []string
+	messageSort := &MessageSort{Property: "dataSize", Direction: "DESC"}
+	pagination := &Pagination{Limit: 2}
+	for {
+		messages, cursor, err := store.Query("did:example:alice", []Filter{{"interface": "Records"}}, messageSort, pagination, nil)
+		require.NoError(t, err)
+		for _, message := range messages {
+			messageCid, err := dwncid.ComputeMessage(message)
+			require.NoError(t, err)
+			sorted = append(sorted, messageCid)
+		}
+		if cursor == "" {
+			break
+		}
+		pagination = &Pagination{Limit: 2, Cursor: cursor}
+	}
+	assert.Equal(t, []string{messageCids[2], messageCids[1], messageCids[0]}, sorted)
+}
+
+func TestSQLStoresShareDBProvider(t *testing.T) {
+	sqlConfig := MessageStoreSQLConfig{DBProvider: models.NewDBProvider(config.NewSQLiteConfig(":memory:"))}
+	messageStore, err := NewMessageStoreSQL(sqlConfig)
+	require.NoError(t, err)
+	eventLog, err := NewEventLogSQL(sqlConfig)
+	require.NoError(t, err)
+	require.NoError(t, messageStore.Open())
+	require.NoError(t, eventLog.Open())
+
+	message := map[string]interface{}{"descriptor": map[string]interface{}{"interface": "Records"}}
+	require.NoError(t, messageStore.Put("did:example:alice", message, KeyValues{"interface": "Records"}, nil))
+	require.NoError(t, messageStore.Close())
+	require.NoError(t, messageStore.Close())
+
+	// The event log keeps the database open
+	messageCid, err := dwncid.ComputeMessage(message)
+	require.NoError(t, err)
+	require.NoError(t, eventLog.Append("did:example:alice", messageCid, KeyValues{"interface": "Records"}))
+	var count int64
+	require.NoError(t, eventLog.db.Model(&models.MessageStore{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	require.NoError(t, eventLog.Close())
+
+	// Closing the last store closed the in-memory database
+	require.NoError(t, messageStore.Open())
+	defer messageStore.Close()
+	messages, _, err := messageStore.Query("did:example:alice", []Filter{{}}, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
 }
 
 // func TestDatabaseSetup(t *testing.T) {
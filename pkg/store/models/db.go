@@ -2,52 +2,185 @@ package models
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/abaxxtech/abaxx-id-go/pkg/store/config"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-var (
-	instance *gorm.DB
-	once     sync.Once
-)
+// OpenDB opens a new connection pool to the database of config and
+// migrates its schema to the latest version, or, with
+// config.ManualMigrations, checks that it is at the latest version.  The
+// caller owns the pool and closes it with CloseDB.
+func OpenDB(config config.DBConfig) (*gorm.DB, error) {
+	db, err := ConnectDB(config)
+	if err != nil {
+		return nil, err
+	}
 
-// GetDB returns a singleton instance of the database connection
-func GetDB(config config.DBConfig) (*gorm.DB, error) {
-	var err error
-	once.Do(func() {
-		dsn := fmt.Sprintf(
-			"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-			config.Host,
-			config.Port,
-			config.User,
-			config.Password,
-			config.DBName,
-			config.SSLMode,
-		)
+	if err := prepareSchema(db, config.ManualMigrations); err != nil {
+		CloseDB(db)
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
 
-		instance, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Silent),
-		})
-		if err != nil {
-			return
-		}
+	return db, nil
+}
 
-		// Auto-migrate all models in one place
-		err = instance.AutoMigrate(
-			&MessageStore{},
-			&DataStore{},
-			&DataStoreReference{},
-			&EventLog{},
-		)
+// prepareSchema migrates the schema of db to the latest version, or, if
+// migrations are manual, checks that it is at the latest version.
+func prepareSchema(db *gorm.DB, manual bool) error {
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if !manual {
+		_, err := Migrate(db, latest)
+		return err
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version != latest {
+		return fmt.Errorf("schema is at version %d rather than %d; run `abaxx-id store migrate`", version, latest)
+	}
+	return nil
+}
+
+// ConnectDB opens a new connection pool to the database of config, leaving
+// its schema as it is.  The caller owns the pool and closes it with CloseDB.
+func ConnectDB(config config.DBConfig) (*gorm.DB, error) {
+	dialector, err := openDialector(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
 
+	sqlDB, err := db.DB()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
+	maxOpenConns := config.MaxOpenConns
+	if maxOpenConns == 0 && dialector.Name() == "sqlite" {
+		// SQLite allows a single writer, and an in-memory database
+		// lives only as long as its connection, so share one
+		maxOpenConns = 1
+	}
+	sqlDB.SetMaxOpenConns(maxOpenConns)
+	if config.MaxIdleConns != 0 {
+		sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
 
-	return instance, nil
+	return db, nil
+}
+
+// CloseDB closes the connection pool of db.
+func CloseDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// DBProvider shares one connection pool to the database of a DBConfig
+// among the stores using it.  The pool is opened by the first Acquire and
+// closed by the Release matching the last, so that stores opened and closed
+// together share a database, even an in-memory one.
+type DBProvider struct {
+	config config.DBConfig
+
+	mu   sync.Mutex
+	db   *gorm.DB
+	refs int
+}
+
+// NewDBProvider returns a DBProvider for the database of config.
+func NewDBProvider(config config.DBConfig) *DBProvider {
+	return &DBProvider{config: config}
+}
+
+// Acquire returns the connection pool, opening it if no store holds it.  A
+// failed open is retried by the next Acquire.
+func (p *DBProvider) Acquire() (*gorm.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.db == nil {
+		db, err := OpenDB(p.config)
+		if err != nil {
+			return nil, err
+		}
+		p.db = db
+	}
+	p.refs++
+	return p.db, nil
+}
+
+// Release gives back a connection pool of Acquire, closing it once no store
+// holds it.
+func (p *DBProvider) Release() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.refs == 0 {
+		return nil
+	}
+	p.refs--
+	if p.refs > 0 {
+		return nil
+	}
+	db := p.db
+	p.db = nil
+	return CloseDB(db)
+}
+
+// openDialector returns the dialector of the database dbConfig.Driver names
+func openDialector(dbConfig config.DBConfig) (gorm.Dialector, error) {
+	switch dbConfig.Driver {
+	case "", config.DriverPostgres:
+		if dbConfig.DSN != "" {
+			return postgres.Open(dbConfig.DSN), nil
+		}
+		dsn := fmt.Sprintf(
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+			dbConfig.Host,
+			dbConfig.Port,
+			dbConfig.User,
+			dbConfig.Password,
+			dbConfig.DBName,
+			dbConfig.SSLMode,
+		)
+		return postgres.Open(dsn), nil
+	case config.DriverSQLite:
+		if dbConfig.DSN != "" {
+			return sqlite.Open(dbConfig.DSN), nil
+		}
+		if dbConfig.Path == "" {
+			return nil, fmt.Errorf("sqlite database path is required")
+		}
+		if dbConfig.Path != ":memory:" && !strings.HasPrefix(dbConfig.Path, "file:") {
+			if err := os.MkdirAll(filepath.Dir(dbConfig.Path), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create sqlite database directory: %w", err)
+			}
+		}
+		return sqlite.Open(dbConfig.Path), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", dbConfig.Driver)
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/abaxxtech/abaxx-id-go/pkg/store/config"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 )
@@ -19,11 +20,12 @@ type TestData struct {
 
 func setupTestDB(t *testing.T) (*gorm.DB, TestData) {
 	// Try to get DB connection with default config
-	db, err := GetDB(config.NewDefaultConfig())
+	db, err := OpenDB(config.NewSQLiteConfig(":memory:"))
 	if err != nil {
 		t.Logf("Warning: Could not connect to database: %v", err)
 		return nil, TestData{}
 	}
+	t.Cleanup(func() { CloseDB(db) })
 
 	// Create test data only if we have a valid connection
 	testData := TestData{
@@ -130,6 +132,50 @@ func cleanupTestDB(t *testing.T, db *gorm.DB) {
 	require.NoError(t, db.Exec("DELETE FROM message_store").Error)
 }
 
+func TestOpenDB(t *testing.T) {
+	db, testData := setupTestDB(t)
+	require.NotNil(t, db)
+
+	var count int64
+	require.NoError(t, db.Model(&MessageStore{}).Count(&count).Error)
+	assert.Equal(t, int64(len(testData.MessageStore)), count)
+
+	// Every OpenDB opens a database of its own
+	other, err := OpenDB(config.NewSQLiteConfig(":memory:"))
+	require.NoError(t, err)
+	defer CloseDB(other)
+	require.NoError(t, other.Model(&MessageStore{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	_, err = OpenDB(config.DBConfig{Driver: "oracle"})
+	assert.Error(t, err)
+}
+
+func TestDBProvider(t *testing.T) {
+	provider := NewDBProvider(config.NewSQLiteConfig(":memory:"))
+
+	first, err := provider.Acquire()
+	require.NoError(t, err)
+	second, err := provider.Acquire()
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	require.NoError(t, first.Create(&EventLog{Tenant: "did:example:alice", EventType: "test-event"}).Error)
+
+	require.NoError(t, provider.Release())
+	var count int64
+	require.NoError(t, second.Model(&EventLog{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	require.NoError(t, provider.Release())
+	assert.Error(t, second.Exec("SELECT 1").Error)
+
+	reopened, err := provider.Acquire()
+	require.NoError(t, err)
+	defer provider.Release()
+	require.NoError(t, reopened.Model(&EventLog{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
 // func TestGetDB_InvalidConfig(t *testing.T) {
 // 	// Skip if no database connection is available
 // 	if testing.Short() {
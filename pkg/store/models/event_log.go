@@ -47,19 +47,39 @@ func (EventLog) TableName() string {
 	return "event_logs"
 }
 
-// Indexes to be created
+// Indexes returns the indexes the migrations create on the table
 func (EventLog) Indexes() []string {
 	return []string{
 		"idx_tenant_event",
-		"idx_interface",
-		"idx_method",
-		"idx_author",
-		"idx_record_id",
-		"idx_protocol",
-		"idx_granted_to",
-		"idx_granted_by",
-		"idx_recipient",
-		"idx_parent_id",
-		"idx_date_created",
+		"idx_event_logs_deleted_at",
+		"idx_event_logs_event_type",
+		"idx_event_logs_message_cid",
+		"idx_event_logs_interface",
+		"idx_event_logs_method",
+		"idx_event_logs_data_cid",
+		"idx_event_logs_author",
+		"idx_event_logs_record_id",
+		"idx_event_logs_protocol",
+		"idx_event_logs_granted_to",
+		"idx_event_logs_granted_by",
+		"idx_event_logs_recipient",
+		"idx_event_logs_parent_id",
+		"idx_event_logs_date_created",
+		"idx_event_logs_timestamp",
 	}
 }
+
+// EventLogTag is a tag of the record an event is for.
+type EventLogTag struct {
+	ID         uint   `gorm:"primarykey"`
+	EventLogID uint   `gorm:"not null;index"`
+	Name       string `gorm:"not null;index:idx_event_log_tag;index:idx_event_log_tag_number"`
+	Value      string `gorm:"index:idx_event_log_tag"`
+	// NumberValue holds the value of a numeric tag as a number, for ranges
+	NumberValue *float64 `gorm:"index:idx_event_log_tag_number"`
+}
+
+// TableName overrides the table name
+func (EventLogTag) TableName() string {
+	return "event_log_tags"
+}
@@ -7,8 +7,8 @@ import (
 // MessageStoreModel represents a DWN message in the database
 type MessageStore struct {
 	gorm.Model
-	Tenant               string `gorm:"not null;index:idx_tenant_message"`
-	MessageCid           string `gorm:"size:60;not null;index:idx_tenant_message"`
+	Tenant               string `gorm:"not null;uniqueIndex:idx_tenant_message"`
+	MessageCid           string `gorm:"size:60;not null;uniqueIndex:idx_tenant_message"`
 	EncodedMessageBytes  []byte `gorm:"type:bytea;not null"`
 	EncodedData          string
 	Interface            string `gorm:"index"`
@@ -17,14 +17,14 @@ type MessageStore struct {
 	DataCid              string
 	DataSize             string
 	DateCreated          string `gorm:"index"`
-	MessageTimestamp     string
+	MessageTimestamp     string `gorm:"index"`
 	DataFormat           string
 	IsLatestBaseState    string
 	Published            string
 	Author               string `gorm:"index"`
 	RecordId             string `gorm:"index"`
 	EntryId              string
-	DatePublished        string
+	DatePublished        string `gorm:"index"`
 	Latest               string
 	Protocol             string `gorm:"index"`
 	DateExpires          string
@@ -46,19 +46,38 @@ func (MessageStore) TableName() string {
 	return "message_store"
 }
 
-// Indexes to be created
+// Indexes returns the indexes the migrations create on the table
 func (MessageStore) Indexes() []string {
 	return []string{
 		"idx_tenant_message",
-		"idx_interface",
-		"idx_method",
-		"idx_author",
-		"idx_record_id",
-		"idx_protocol",
-		"idx_granted_to",
-		"idx_granted_by",
-		"idx_recipient",
-		"idx_parent_id",
-		"idx_date_created",
+		"idx_message_store_deleted_at",
+		"idx_message_store_interface",
+		"idx_message_store_method",
+		"idx_message_store_author",
+		"idx_message_store_record_id",
+		"idx_message_store_protocol",
+		"idx_message_store_granted_to",
+		"idx_message_store_granted_by",
+		"idx_message_store_recipient",
+		"idx_message_store_parent_id",
+		"idx_message_store_date_created",
+		"idx_message_store_message_timestamp",
+		"idx_message_store_date_published",
 	}
 }
+
+// MessageStoreTag is a tag of a record, kept apart from its message so that
+// records can be filtered on any tag.
+type MessageStoreTag struct {
+	ID             uint   `gorm:"primarykey"`
+	MessageStoreID uint   `gorm:"not null;index"`
+	Name           string `gorm:"not null;index:idx_message_store_tag;index:idx_message_store_tag_number"`
+	Value          string `gorm:"index:idx_message_store_tag"`
+	// NumberValue holds the value of a numeric tag as a number, for ranges
+	NumberValue *float64 `gorm:"index:idx_message_store_tag_number"`
+}
+
+// TableName overrides the table name
+func (MessageStoreTag) TableName() string {
+	return "message_store_tags"
+}
@@ -0,0 +1,384 @@
+package models
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds the migrations of the SQL stores, a pair of files
+// per version named <version>_<name>.up.sql and <version>_<name>.down.sql.
+// Their statements end with a semicolon, which string literals, comments,
+// dollar-quoted strings and trigger bodies may hold as well, and may use
+// the column types
+// {{id}}, {{time}}, {{bytes}} and {{json}}, which migrationTypes spells for
+// each database.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationTypes spells the column types of migrations for each dialector.
+var migrationTypes = map[string]*strings.Replacer{
+	"postgres": strings.NewReplacer(
+		"{{id}}", "BIGSERIAL PRIMARY KEY",
+		"{{time}}", "TIMESTAMPTZ",
+		"{{bytes}}", "BYTEA",
+		"{{json}}", "JSONB",
+	),
+	"sqlite": strings.NewReplacer(
+		"{{id}}", "INTEGER PRIMARY KEY AUTOINCREMENT",
+		"{{time}}", "DATETIME",
+		"{{bytes}}", "BLOB",
+		"{{json}}", "BLOB",
+	),
+}
+
+// schemaMigrationsTable creates the table recording applied migrations.
+const schemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at {{time}}
+)`
+
+// Migration is a numbered, reversible change to the schema of the SQL
+// stores.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// SchemaMigration records a migration applied to a database, in the
+// schema_migrations table.
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+// TableName overrides the table name
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations returns the migrations of the SQL stores, by version.
+func Migrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	for _, file := range files {
+		base := strings.TrimSuffix(path.Base(file), ".up.sql")
+		number, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+		up, err := readMigration(file)
+		if err != nil {
+			return nil, err
+		}
+		down, err := readMigration(strings.TrimSuffix(file, ".up.sql") + ".down.sql")
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, Up: up, Down: down})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// readMigration returns the statements of a migration file, without
+// comments.
+func readMigration(file string) ([]string, error) {
+	content, err := migrationFiles.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration: %w", err)
+	}
+	statements, err := splitStatements(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+	}
+	return statements, nil
+}
+
+// dollarQuote matches the opening of a Postgres dollar-quoted string, such
+// as $$ or $body$.
+var dollarQuote = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// splitStatements splits sql into its statements, without comments.  A
+// semicolon ends a statement only outside string literals, quoted
+// identifiers, comments, dollar-quoted strings and the BEGIN ... END body
+// of a trigger.
+func splitStatements(sql string) ([]string, error) {
+	var statements []string
+	var statement strings.Builder
+	var words []string
+	trigger := false
+	depth := 0
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			i += end
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			statement.WriteByte(' ')
+			i += end + 4
+		case c == '\'' || c == '"':
+			end := i + 1
+			for {
+				next := strings.IndexByte(sql[end:], c)
+				if next < 0 {
+					return nil, fmt.Errorf("unterminated quote %c", c)
+				}
+				end += next + 1
+				// A doubled quote stands for itself
+				if end < len(sql) && sql[end] == c {
+					end++
+					continue
+				}
+				break
+			}
+			statement.WriteString(sql[i:end])
+			i = end
+		case c == '$' && dollarQuote.MatchString(sql[i:]):
+			tag := dollarQuote.FindString(sql[i:])
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated dollar quote %s", tag)
+			}
+			end = i + len(tag) + end + len(tag)
+			statement.WriteString(sql[i:end])
+			i = end
+		case isWordStart(c):
+			end := i + 1
+			for end < len(sql) && (isWordStart(sql[end]) || sql[end] >= '0' && sql[end] <= '9' || sql[end] == '$') {
+				end++
+			}
+			word := strings.ToUpper(sql[i:end])
+			if len(words) < 4 {
+				words = append(words, word)
+				// CREATE [TEMP] TRIGGER [IF NOT EXISTS] ...
+				trigger = trigger || words[0] == "CREATE" && word == "TRIGGER"
+			}
+			if trigger {
+				switch word {
+				case "BEGIN", "CASE":
+					depth++
+				case "END":
+					depth--
+				}
+			}
+			statement.WriteString(sql[i:end])
+			i = end
+		case c == ';' && depth <= 0:
+			if text := strings.TrimSpace(statement.String()); text != "" {
+				statements = append(statements, text)
+			}
+			statement.Reset()
+			words, trigger, depth = nil, false, 0
+			i++
+		default:
+			statement.WriteByte(c)
+			i++
+		}
+	}
+	if text := strings.TrimSpace(statement.String()); text != "" {
+		statements = append(statements, text)
+	}
+	return statements, nil
+}
+
+// isWordStart reports whether c may begin a keyword or identifier.
+func isWordStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+// LatestSchemaVersion returns the version of the last migration.
+func LatestSchemaVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+// SchemaVersion returns the version of the last migration applied to db, or
+// zero if none is.
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	if err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrationLockKey is the key of the Postgres advisory lock migrations
+// hold, an arbitrary number every node agrees on.
+const migrationLockKey int64 = 0x0aba2201d
+
+// migrationBusyTimeout is how long a migration waits for another to release
+// a SQLite database, unless its connection sets a timeout of its own.
+const migrationBusyTimeout = 30 * time.Second
+
+// Migrate migrates db up or down to version, applying each migration along
+// with its record in schema_migrations in a transaction of its own.  Each
+// transaction holds a lock on the schema, an advisory lock on Postgres or
+// the write lock on SQLite, and reads the schema version anew, so that
+// nodes migrating a database at once apply each migration once.  It
+// returns the migrations it applied, in the order it applied them.
+func Migrate(db *gorm.DB, version int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if version < 0 || version > len(migrations) {
+		return nil, fmt.Errorf("unknown schema version %d, the latest is %d", version, len(migrations))
+	}
+	types, ok := migrationTypes[db.Dialector.Name()]
+	if !ok {
+		return nil, fmt.Errorf("migrations do not support %s databases", db.Dialector.Name())
+	}
+
+	var applied []Migration
+	for {
+		var migration *Migration
+		err := lockedTransaction(db, func(tx *gorm.DB) error {
+			if err := tx.Exec(types.Replace(schemaMigrationsTable)).Error; err != nil {
+				return fmt.Errorf("failed to create schema_migrations: %w", err)
+			}
+			current, err := SchemaVersion(tx)
+			if err != nil {
+				return err
+			}
+			if current > len(migrations) {
+				return fmt.Errorf("schema version %d is newer than the latest known, %d", current, len(migrations))
+			}
+			if current == version {
+				return nil
+			}
+
+			up := current < version
+			if up {
+				migration = &migrations[current]
+			} else {
+				migration = &migrations[current-1]
+			}
+			if err := applyMigration(tx, types, *migration, up); err != nil {
+				direction := "up"
+				if !up {
+					direction = "down"
+				}
+				return fmt.Errorf("failed to migrate %s version %d (%s): %w", direction, migration.Version, migration.Name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return applied, err
+		}
+		if migration == nil {
+			return applied, nil
+		}
+		applied = append(applied, *migration)
+	}
+}
+
+// applyMigration applies the statements of migration, up or down, in tx,
+// and records it in schema_migrations.
+func applyMigration(tx *gorm.DB, types *strings.Replacer, migration Migration, up bool) error {
+	statements := migration.Up
+	if !up {
+		statements = migration.Down
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(types.Replace(statement)).Error; err != nil {
+			return err
+		}
+	}
+	if up {
+		return tx.Create(&SchemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now().UTC(),
+		}).Error
+	}
+	return tx.Delete(&SchemaMigration{}, migration.Version).Error
+}
+
+// lockedTransaction runs fn in a transaction holding the lock on the schema
+// of db, and commits it unless fn fails.  On SQLite, the transaction begins
+// IMMEDIATE, taking the write lock at once rather than at its first write.
+func lockedTransaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if db.Dialector.Name() != "sqlite" {
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+				return fmt.Errorf("failed to lock the schema: %w", err)
+			}
+			return fn(tx)
+		})
+	}
+
+	// GORM begins transactions DEFERRED, so begin one by hand on a
+	// connection of its own
+	return db.Connection(func(conn *gorm.DB) (err error) {
+		conn = conn.Session(&gorm.Session{SkipDefaultTransaction: true})
+		var busyTimeout int
+		if err := conn.Raw("PRAGMA busy_timeout").Scan(&busyTimeout).Error; err != nil {
+			return err
+		}
+		if busyTimeout == 0 {
+			if err := conn.Exec(fmt.Sprintf("PRAGMA busy_timeout = %d", migrationBusyTimeout.Milliseconds())).Error; err != nil {
+				return err
+			}
+			defer conn.Exec("PRAGMA busy_timeout = 0")
+		}
+
+		if err := conn.Exec("BEGIN IMMEDIATE").Error; err != nil {
+			return fmt.Errorf("failed to lock the schema: %w", err)
+		}
+		committed := false
+		defer func() {
+			if !committed {
+				conn.Exec("ROLLBACK")
+			}
+		}()
+		if err := fn(conn); err != nil {
+			return err
+		}
+		if err := conn.Exec("COMMIT").Error; err != nil {
+			return err
+		}
+		committed = true
+		return nil
+	})
+}
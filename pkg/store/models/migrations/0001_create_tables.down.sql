@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS event_log_tags;
+DROP TABLE IF EXISTS event_logs;
+DROP TABLE IF EXISTS data_store_references;
+DROP TABLE IF EXISTS data_stores;
+DROP TABLE IF EXISTS message_store_tags;
+DROP TABLE IF EXISTS message_store;
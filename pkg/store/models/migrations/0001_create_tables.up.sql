@@ -0,0 +1,163 @@
+-- The schema the SQL stores had under GORM AutoMigrate.  Every statement
+-- is conditional, so that databases created by AutoMigrate adopt it.
+
+CREATE TABLE IF NOT EXISTS message_store (
+	id {{id}},
+	created_at {{time}},
+	updated_at {{time}},
+	deleted_at {{time}},
+	tenant TEXT NOT NULL,
+	message_cid VARCHAR(60) NOT NULL,
+	encoded_message_bytes {{bytes}} NOT NULL,
+	encoded_data TEXT,
+	interface TEXT,
+	method TEXT,
+	schema TEXT,
+	data_cid TEXT,
+	data_size TEXT,
+	date_created TEXT,
+	message_timestamp TEXT,
+	data_format TEXT,
+	is_latest_base_state TEXT,
+	published TEXT,
+	author TEXT,
+	record_id TEXT,
+	entry_id TEXT,
+	date_published TEXT,
+	latest TEXT,
+	protocol TEXT,
+	date_expires TEXT,
+	description TEXT,
+	granted_to TEXT,
+	granted_by TEXT,
+	granted_for TEXT,
+	permissions_request_id TEXT,
+	attester TEXT,
+	protocol_path TEXT,
+	recipient TEXT,
+	context_id TEXT,
+	parent_id TEXT,
+	permissions_grant_id TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_tenant_message ON message_store (tenant, message_cid);
+CREATE INDEX IF NOT EXISTS idx_message_store_deleted_at ON message_store (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_message_store_interface ON message_store (interface);
+CREATE INDEX IF NOT EXISTS idx_message_store_method ON message_store (method);
+CREATE INDEX IF NOT EXISTS idx_message_store_date_created ON message_store (date_created);
+CREATE INDEX IF NOT EXISTS idx_message_store_author ON message_store (author);
+CREATE INDEX IF NOT EXISTS idx_message_store_record_id ON message_store (record_id);
+CREATE INDEX IF NOT EXISTS idx_message_store_protocol ON message_store (protocol);
+CREATE INDEX IF NOT EXISTS idx_message_store_granted_to ON message_store (granted_to);
+CREATE INDEX IF NOT EXISTS idx_message_store_granted_by ON message_store (granted_by);
+CREATE INDEX IF NOT EXISTS idx_message_store_recipient ON message_store (recipient);
+CREATE INDEX IF NOT EXISTS idx_message_store_parent_id ON message_store (parent_id);
+
+CREATE TABLE IF NOT EXISTS message_store_tags (
+	id {{id}},
+	message_store_id BIGINT NOT NULL,
+	name TEXT NOT NULL,
+	value TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_message_store_tags_message_store_id ON message_store_tags (message_store_id);
+CREATE INDEX IF NOT EXISTS idx_message_store_tag ON message_store_tags (name, value);
+
+CREATE TABLE IF NOT EXISTS data_stores (
+	id {{id}},
+	created_at {{time}},
+	updated_at {{time}},
+	deleted_at {{time}},
+	tenant TEXT NOT NULL,
+	data_cid VARCHAR(60) NOT NULL,
+	encoded_data {{bytes}} NOT NULL,
+	data_format TEXT,
+	schema TEXT,
+	data_size BIGINT,
+	date_created TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_tenant_data ON data_stores (tenant, data_cid);
+CREATE INDEX IF NOT EXISTS idx_data_stores_deleted_at ON data_stores (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_data_stores_data_format ON data_stores (data_format);
+CREATE INDEX IF NOT EXISTS idx_data_stores_schema ON data_stores (schema);
+CREATE INDEX IF NOT EXISTS idx_data_stores_data_size ON data_stores (data_size);
+CREATE INDEX IF NOT EXISTS idx_data_stores_date_created ON data_stores (date_created);
+
+CREATE TABLE IF NOT EXISTS data_store_references (
+	id {{id}},
+	created_at {{time}},
+	updated_at {{time}},
+	deleted_at {{time}},
+	tenant TEXT NOT NULL,
+	data_cid VARCHAR(60) NOT NULL,
+	message_cid VARCHAR(60) NOT NULL,
+	date_created TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_tenant_ref ON data_store_references (tenant);
+CREATE INDEX IF NOT EXISTS idx_data_cid ON data_store_references (data_cid);
+CREATE INDEX IF NOT EXISTS idx_message_cid ON data_store_references (message_cid);
+CREATE INDEX IF NOT EXISTS idx_data_store_references_deleted_at ON data_store_references (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_data_store_references_date_created ON data_store_references (date_created);
+
+CREATE TABLE IF NOT EXISTS event_logs (
+	id {{id}},
+	created_at {{time}},
+	updated_at {{time}},
+	deleted_at {{time}},
+	tenant TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	message_cid VARCHAR(60),
+	interface TEXT,
+	method TEXT,
+	schema TEXT,
+	data_cid VARCHAR(60),
+	data_size TEXT,
+	date_created TEXT,
+	message_timestamp TEXT,
+	data_format TEXT,
+	is_latest_base_state TEXT,
+	published TEXT,
+	author TEXT,
+	record_id TEXT,
+	entry_id TEXT,
+	date_published TEXT,
+	latest TEXT,
+	protocol TEXT,
+	date_expires TEXT,
+	description TEXT,
+	granted_to TEXT,
+	granted_by TEXT,
+	granted_for TEXT,
+	permissions_request_id TEXT,
+	attester TEXT,
+	protocol_path TEXT,
+	recipient TEXT,
+	context_id TEXT,
+	parent_id TEXT,
+	permissions_grant_id TEXT,
+	metadata {{json}},
+	timestamp TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_tenant_event ON event_logs (tenant);
+CREATE INDEX IF NOT EXISTS idx_event_logs_deleted_at ON event_logs (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_event_logs_event_type ON event_logs (event_type);
+CREATE INDEX IF NOT EXISTS idx_event_logs_message_cid ON event_logs (message_cid);
+CREATE INDEX IF NOT EXISTS idx_event_logs_interface ON event_logs (interface);
+CREATE INDEX IF NOT EXISTS idx_event_logs_method ON event_logs (method);
+CREATE INDEX IF NOT EXISTS idx_event_logs_data_cid ON event_logs (data_cid);
+CREATE INDEX IF NOT EXISTS idx_event_logs_date_created ON event_logs (date_created);
+CREATE INDEX IF NOT EXISTS idx_event_logs_author ON event_logs (author);
+CREATE INDEX IF NOT EXISTS idx_event_logs_record_id ON event_logs (record_id);
+CREATE INDEX IF NOT EXISTS idx_event_logs_protocol ON event_logs (protocol);
+CREATE INDEX IF NOT EXISTS idx_event_logs_granted_to ON event_logs (granted_to);
+CREATE INDEX IF NOT EXISTS idx_event_logs_granted_by ON event_logs (granted_by);
+CREATE INDEX IF NOT EXISTS idx_event_logs_recipient ON event_logs (recipient);
+CREATE INDEX IF NOT EXISTS idx_event_logs_parent_id ON event_logs (parent_id);
+CREATE INDEX IF NOT EXISTS idx_event_logs_timestamp ON event_logs (timestamp);
+
+CREATE TABLE IF NOT EXISTS event_log_tags (
+	id {{id}},
+	event_log_id BIGINT NOT NULL,
+	name TEXT NOT NULL,
+	value TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_event_log_tags_event_log_id ON event_log_tags (event_log_id);
+CREATE INDEX IF NOT EXISTS idx_event_log_tag ON event_log_tags (name, value);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_message_store_date_published;
+DROP INDEX IF EXISTS idx_message_store_message_timestamp;
@@ -0,0 +1,4 @@
+-- Index the columns messages are sorted and paged by, besides date_created.
+
+CREATE INDEX IF NOT EXISTS idx_message_store_message_timestamp ON message_store (message_timestamp);
+CREATE INDEX IF NOT EXISTS idx_message_store_date_published ON message_store (date_published);
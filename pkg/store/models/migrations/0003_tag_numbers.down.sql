@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_event_log_tag_number;
+ALTER TABLE event_log_tags DROP COLUMN number_value;
+
+DROP INDEX IF EXISTS idx_message_store_tag_number;
+ALTER TABLE message_store_tags DROP COLUMN number_value;
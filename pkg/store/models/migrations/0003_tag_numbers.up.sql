@@ -0,0 +1,13 @@
+-- Keep numeric tag values as numbers too, so that ranges on them compare
+-- numbers rather than text.  Tags kept before are taken to be numbers if
+-- they are whole numbers.
+
+ALTER TABLE message_store_tags ADD COLUMN number_value DOUBLE PRECISION;
+UPDATE message_store_tags SET number_value = CAST(value AS DOUBLE PRECISION)
+	WHERE value NOT IN ('', '-') AND LTRIM(CASE WHEN value LIKE '-%' THEN SUBSTR(value, 2) ELSE value END, '0123456789') = '';
+CREATE INDEX IF NOT EXISTS idx_message_store_tag_number ON message_store_tags (name, number_value);
+
+ALTER TABLE event_log_tags ADD COLUMN number_value DOUBLE PRECISION;
+UPDATE event_log_tags SET number_value = CAST(value AS DOUBLE PRECISION)
+	WHERE value NOT IN ('', '-') AND LTRIM(CASE WHEN value LIKE '-%' THEN SUBSTR(value, 2) ELSE value END, '0123456789') = '';
+CREATE INDEX IF NOT EXISTS idx_event_log_tag_number ON event_log_tags (name, number_value);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_tenant_message;
+CREATE INDEX IF NOT EXISTS idx_tenant_message ON message_store (tenant, message_cid);
@@ -0,0 +1,18 @@
+-- Keep one row per message of a tenant.  Rows a message was put again
+-- with, before the store replaced them, are dropped in favour of the last.
+
+DELETE FROM message_store_tags WHERE message_store_id IN (
+	SELECT id FROM message_store WHERE EXISTS (
+		SELECT 1 FROM message_store AS later
+		WHERE later.tenant = message_store.tenant AND later.message_cid = message_store.message_cid
+			AND later.id > message_store.id
+	)
+);
+DELETE FROM message_store WHERE EXISTS (
+	SELECT 1 FROM message_store AS later
+	WHERE later.tenant = message_store.tenant AND later.message_cid = message_store.message_cid
+		AND later.id > message_store.id
+);
+
+DROP INDEX IF EXISTS idx_tenant_message;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_message ON message_store (tenant, message_cid);
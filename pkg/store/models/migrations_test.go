@@ -0,0 +1,263 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/abaxxtech/abaxx-id-go/pkg/store/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var allModels = []interface{}{
+	&MessageStore{},
+	&MessageStoreTag{},
+	&DataStore{},
+	&DataStoreReference{},
+	&EventLog{},
+	&EventLogTag{},
+}
+
+// sqliteSchema describes the tables of a SQLite database other than
+// schema_migrations, as table name and columns, and index name and columns.
+func sqliteSchema(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	tables, err := db.Migrator().GetTables()
+	require.NoError(t, err)
+
+	var schema []string
+	for _, table := range tables {
+		if table == "schema_migrations" || strings.HasPrefix(table, "sqlite_") {
+			continue
+		}
+		columnTypes, err := db.Migrator().ColumnTypes(table)
+		require.NoError(t, err)
+		columns := make([]string, len(columnTypes))
+		for i, columnType := range columnTypes {
+			columns[i] = columnType.Name()
+		}
+		sort.Strings(columns)
+		schema = append(schema, "table "+table+" ("+strings.Join(columns, ", ")+")")
+
+		var indexes []string
+		require.NoError(t, db.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).
+			Scan(&indexes).Error)
+		for _, index := range indexes {
+			var indexColumns []string
+			require.NoError(t, db.Raw("SELECT name FROM pragma_index_info(?) ORDER BY seqno", index).Scan(&indexColumns).Error)
+			schema = append(schema, "index "+index+" on "+table+" ("+strings.Join(indexColumns, ", ")+")")
+		}
+	}
+	sort.Strings(schema)
+	return schema
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := ConnectDB(config.NewSQLiteConfig(":memory:"))
+	require.NoError(t, err)
+	defer CloseDB(db)
+
+	latest, err := LatestSchemaVersion()
+	require.NoError(t, err)
+	applied, err := Migrate(db, latest)
+	require.NoError(t, err)
+	assert.Len(t, applied, latest)
+	version, err := SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	for _, index := range (MessageStore{}).Indexes() {
+		assert.True(t, db.Migrator().HasIndex(&MessageStore{}, index), index)
+	}
+	for _, index := range (EventLog{}).Indexes() {
+		assert.True(t, db.Migrator().HasIndex(&EventLog{}, index), index)
+	}
+
+	applied, err = Migrate(db, latest)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	applied, err = Migrate(db, 1)
+	require.NoError(t, err)
+	require.Len(t, applied, latest-1)
+	assert.Equal(t, latest, applied[0].Version)
+	assert.False(t, db.Migrator().HasIndex(&MessageStore{}, "idx_message_store_message_timestamp"))
+	assert.True(t, db.Migrator().HasIndex(&MessageStore{}, "idx_message_store_date_created"))
+
+	_, err = Migrate(db, 0)
+	require.NoError(t, err)
+	for _, model := range allModels {
+		assert.False(t, db.Migrator().HasTable(model))
+	}
+	version, err = SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+
+	_, err = Migrate(db, latest+1)
+	assert.Error(t, err)
+}
+
+func TestMigrateDropsDuplicateMessages(t *testing.T) {
+	db, err := ConnectDB(config.NewSQLiteConfig(":memory:"))
+	require.NoError(t, err)
+	defer CloseDB(db)
+
+	_, err = Migrate(db, 3)
+	require.NoError(t, err)
+	for i, latest := range []string{"true", "false"} {
+		message := MessageStore{
+			Tenant: "did:example:alice", MessageCid: "bafy", EncodedMessageBytes: []byte{0xa0}, IsLatestBaseState: latest,
+		}
+		require.NoError(t, db.Create(&message).Error)
+		require.NoError(t, db.Create(&MessageStoreTag{MessageStoreID: message.ID, Name: "put", Value: fmt.Sprint(i)}).Error)
+	}
+
+	_, err = Migrate(db, 4)
+	require.NoError(t, err)
+	var messages []MessageStore
+	require.NoError(t, db.Find(&messages).Error)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "false", messages[0].IsLatestBaseState)
+	var tags []MessageStoreTag
+	require.NoError(t, db.Find(&tags).Error)
+	require.Len(t, tags, 1)
+	assert.Equal(t, "1", tags[0].Value)
+
+	duplicate := MessageStore{Tenant: "did:example:alice", MessageCid: "bafy", EncodedMessageBytes: []byte{0xa0}}
+	assert.Error(t, db.Create(&duplicate).Error)
+}
+
+func TestMigrateConcurrently(t *testing.T) {
+	dbConfig := config.NewSQLiteConfig(filepath.Join(t.TempDir(), "dwn.db"))
+	latest, err := LatestSchemaVersion()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	applied := make([][]Migration, 4)
+	errs := make([]error, len(applied))
+	for i := range applied {
+		db, err := ConnectDB(dbConfig)
+		require.NoError(t, err)
+		defer CloseDB(db)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied[i], errs[i] = Migrate(db, latest)
+		}()
+	}
+	wg.Wait()
+
+	versions := map[int]int{}
+	for i := range applied {
+		require.NoError(t, errs[i])
+		for _, migration := range applied[i] {
+			versions[migration.Version]++
+		}
+	}
+	assert.Len(t, versions, latest)
+	for version, count := range versions {
+		assert.Equal(t, 1, count, "migration %d applied %d times", version, count)
+	}
+}
+
+func TestLockedTransaction(t *testing.T) {
+	db, err := ConnectDB(config.NewSQLiteConfig(":memory:"))
+	require.NoError(t, err)
+	defer CloseDB(db)
+
+	failure := errors.New("failure")
+	err = lockedTransaction(db, func(tx *gorm.DB) error {
+		require.NoError(t, tx.Exec("CREATE TABLE rolled_back (id INTEGER)").Error)
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+	assert.False(t, db.Migrator().HasTable("rolled_back"))
+
+	require.NoError(t, lockedTransaction(db, func(tx *gorm.DB) error {
+		return tx.Exec("CREATE TABLE committed (id INTEGER)").Error
+	}))
+	assert.True(t, db.Migrator().HasTable("committed"))
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements, err := splitStatements(`-- A comment; with a semicolon
+CREATE TABLE a (b TEXT DEFAULT 'x;''y', "c;" TEXT); /* another; */
+INSERT INTO a (b) VALUES ('--not a comment');
+CREATE FUNCTION f() RETURNS trigger AS $body$ BEGIN RETURN NEW; END; $body$ LANGUAGE plpgsql;
+CREATE TRIGGER IF NOT EXISTS t AFTER INSERT ON a BEGIN
+	UPDATE a SET b = CASE WHEN b = '' THEN NULL ELSE b END;
+	DELETE FROM a WHERE b IS NULL;
+END;
+SELECT $1`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`CREATE TABLE a (b TEXT DEFAULT 'x;''y', "c;" TEXT)`,
+		`INSERT INTO a (b) VALUES ('--not a comment')`,
+		`CREATE FUNCTION f() RETURNS trigger AS $body$ BEGIN RETURN NEW; END; $body$ LANGUAGE plpgsql`,
+		`CREATE TRIGGER IF NOT EXISTS t AFTER INSERT ON a BEGIN
+	UPDATE a SET b = CASE WHEN b = '' THEN NULL ELSE b END;
+	DELETE FROM a WHERE b IS NULL;
+END`,
+		`SELECT $1`,
+	}, statements)
+
+	for _, sql := range []string{"SELECT 'a;", `SELECT "a`, "SELECT 1 /* a", "SELECT $$ a;"} {
+		_, err := splitStatements(sql)
+		assert.Error(t, err, sql)
+	}
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	migrated, err := OpenDB(config.NewSQLiteConfig(":memory:"))
+	require.NoError(t, err)
+	defer CloseDB(migrated)
+
+	autoMigrated, err := ConnectDB(config.NewSQLiteConfig(":memory:"))
+	require.NoError(t, err)
+	defer CloseDB(autoMigrated)
+	require.NoError(t, autoMigrated.AutoMigrate(allModels...))
+
+	assert.Contains(t, sqliteSchema(t, migrated), "index idx_message_store_tag on message_store_tags (name, value)")
+	assert.Equal(t, sqliteSchema(t, autoMigrated), sqliteSchema(t, migrated))
+
+	// Databases created by AutoMigrate, which had the schema of version 2,
+	// adopt the migrations as they are
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	for i := len(migrations) - 1; i >= 2; i-- {
+		for _, statement := range migrations[i].Down {
+			require.NoError(t, autoMigrated.Exec(migrationTypes["sqlite"].Replace(statement)).Error)
+		}
+	}
+	latest, err := LatestSchemaVersion()
+	require.NoError(t, err)
+	_, err = Migrate(autoMigrated, latest)
+	require.NoError(t, err)
+	assert.Equal(t, sqliteSchema(t, migrated), sqliteSchema(t, autoMigrated))
+}
+
+func TestOpenDBManualMigrations(t *testing.T) {
+	dbConfig := config.NewSQLiteConfig(filepath.Join(t.TempDir(), "dwn.db"))
+	dbConfig.ManualMigrations = true
+	_, err := OpenDB(dbConfig)
+	assert.ErrorContains(t, err, "store migrate")
+
+	db, err := ConnectDB(dbConfig)
+	require.NoError(t, err)
+	latest, err := LatestSchemaVersion()
+	require.NoError(t, err)
+	_, err = Migrate(db, latest)
+	require.NoError(t, err)
+	require.NoError(t, CloseDB(db))
+
+	db, err = OpenDB(dbConfig)
+	require.NoError(t, err)
+	require.NoError(t, CloseDB(db))
+}
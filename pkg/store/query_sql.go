@@ -0,0 +1,285 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UnknownPropertyError reports a filter or sort on a property the SQL stores
+// keep no column for.
+type UnknownPropertyError struct {
+	Property string
+}
+
+func (e *UnknownPropertyError) Error() string {
+	return fmt.Sprintf("property %q cannot be queried in the SQL stores", e.Property)
+}
+
+// sqlColumns maps the index properties the SQL stores keep to their columns,
+// which models.MessageStore and models.EventLog share.  Only these, and tags,
+// can be filtered and sorted on.
+var sqlColumns = map[string]string{
+	"interface":            "interface",
+	"method":               "method",
+	"schema":               "schema",
+	"dataCid":              "data_cid",
+	"dataSize":             "data_size",
+	"dateCreated":          "date_created",
+	"messageTimestamp":     "message_timestamp",
+	"dataFormat":           "data_format",
+	"isLatestBaseState":    "is_latest_base_state",
+	"published":            "published",
+	"author":               "author",
+	"recordId":             "record_id",
+	"entryId":              "entry_id",
+	"datePublished":        "date_published",
+	"latest":               "latest",
+	"protocol":             "protocol",
+	"dateExpires":          "date_expires",
+	"description":          "description",
+	"grantedTo":            "granted_to",
+	"grantedBy":            "granted_by",
+	"grantedFor":           "granted_for",
+	"permissionsRequestId": "permissions_request_id",
+	"attester":             "attester",
+	"protocolPath":         "protocol_path",
+	"recipient":            "recipient",
+	"contextId":            "context_id",
+	"parentId":             "parent_id",
+	"permissionsGrantId":   "permissions_grant_id",
+}
+
+// tagPrefix prefixes the index properties of record tags.
+const tagPrefix = "tag."
+
+// sqlRangeOperators maps the bounds of a RangeFilter to SQL operators.
+var sqlRangeOperators = map[string]string{
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+// sqlTable names a table the SQL query builder filters, and the table
+// holding its tags.
+type sqlTable struct {
+	name       string
+	tags       string
+	tagsParent string
+}
+
+var (
+	messageStoreTable = sqlTable{name: "message_store", tags: "message_store_tags", tagsParent: "message_store_id"}
+	eventLogTable     = sqlTable{name: "event_logs", tags: "event_log_tags", tagsParent: "event_log_id"}
+)
+
+// sqlNumericColumns lists the properties whose columns hold integers, as
+// text, or nothing.  They are compared with numbers, and sorted, as numbers.
+var sqlNumericColumns = map[string]bool{
+	"dataSize": true,
+}
+
+// sqlText returns an index value as the SQL stores keep it: every column is
+// text.
+func sqlText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sqlNumber returns value as a float64, if it is a number, or nil.
+func sqlNumber(value interface{}) *float64 {
+	var number float64
+	switch v := value.(type) {
+	case int:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case float64:
+		number = v
+	default:
+		return nil
+	}
+	return &number
+}
+
+// sqlNumeric returns column, a text column of sqlNumericColumns, as a
+// number.  Empty values become NULL, so that they match no range.
+func sqlNumeric(column string) string {
+	return "CAST(NULLIF(" + column + ", '') AS NUMERIC)"
+}
+
+// column returns the column of property on table, or an
+// UnknownPropertyError.
+func (t sqlTable) column(property string) (string, error) {
+	column, ok := sqlColumns[property]
+	if !ok {
+		return "", &UnknownPropertyError{Property: property}
+	}
+	return t.name + "." + column, nil
+}
+
+// where returns a parameterized condition matching any of filters, which
+// take the form IndexLevel.Query accepts.  Properties and operators come
+// only from sqlColumns and sqlRangeOperators; values are always parameters.
+// No filters match every row.
+func (t sqlTable) where(filters []Filter) (string, []interface{}, error) {
+	if len(filters) == 0 {
+		return "", nil, nil
+	}
+
+	alternatives := make([]string, 0, len(filters))
+	var vars []interface{}
+	for _, filter := range filters {
+		indexFilters, err := parseFilter(filter)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(indexFilters) == 0 {
+			return "", nil, nil
+		}
+
+		conditions := make([]string, 0, len(indexFilters))
+		for _, f := range indexFilters {
+			condition, conditionVars, err := t.condition(f)
+			if err != nil {
+				return "", nil, err
+			}
+			conditions = append(conditions, condition)
+			vars = append(vars, conditionVars...)
+		}
+		alternatives = append(alternatives, "("+strings.Join(conditions, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", vars, nil
+}
+
+// condition returns the condition of f.  Tags are matched by a subquery on
+// the tags table.  Ranges with numeric bounds compare numbers: the number
+// kept along with a numeric tag, or the numeric form of a column of
+// sqlNumericColumns.
+func (t sqlTable) condition(f indexFilter) (string, []interface{}, error) {
+	var column, numericColumn string
+	var vars []interface{}
+	tag, isTag := strings.CutPrefix(f.property, tagPrefix)
+	isTag = isTag && tag != ""
+	if isTag {
+		column = t.tags + ".value"
+		numericColumn = t.tags + ".number_value"
+		vars = append(vars, tag)
+	} else {
+		var err error
+		if column, err = t.column(f.property); err != nil {
+			return "", nil, err
+		}
+		if sqlNumericColumns[f.property] {
+			numericColumn = sqlNumeric(column)
+		}
+	}
+
+	var comparisons []string
+	if f.rangeFilter == nil {
+		values := make([]string, len(f.oneOf))
+		for i, value := range f.oneOf {
+			values[i] = sqlText(value)
+		}
+		if len(values) == 1 {
+			comparisons = append(comparisons, column+" = ?")
+			vars = append(vars, values[0])
+		} else {
+			comparisons = append(comparisons, column+" IN ?")
+			vars = append(vars, values)
+		}
+	} else {
+		for _, bound := range []string{"gt", "gte", "lt", "lte"} {
+			value, ok := f.rangeFilter[bound]
+			if !ok {
+				continue
+			}
+			if number := sqlNumber(value); number != nil && numericColumn != "" {
+				comparisons = append(comparisons, numericColumn+" "+sqlRangeOperators[bound]+" ?")
+				vars = append(vars, *number)
+			} else {
+				comparisons = append(comparisons, column+" "+sqlRangeOperators[bound]+" ?")
+				vars = append(vars, sqlText(value))
+			}
+		}
+	}
+
+	condition := strings.Join(comparisons, " AND ")
+	if isTag {
+		condition = fmt.Sprintf("EXISTS (SELECT 1 FROM %[1]s WHERE %[1]s.%[2]s = %[3]s.id AND %[1]s.name = ? AND %[4]s)",
+			t.tags, t.tagsParent, t.name, condition)
+	}
+	return condition, vars, nil
+}
+
+// sortColumn returns the column of property on table as it is sorted by:
+// columns of sqlNumericColumns are sorted as numbers.
+func (t sqlTable) sortColumn(property string) (string, error) {
+	column, err := t.column(property)
+	if err != nil {
+		return "", err
+	}
+	if sqlNumericColumns[property] {
+		column = sqlNumeric(column)
+	}
+	return column, nil
+}
+
+// order returns the ORDER BY clause of the sort queryOptions describe.  Ties
+// are broken by message CID, as IndexLevel.Query breaks them.
+func (t sqlTable) order(queryOptions QueryOptions) (string, error) {
+	column, err := t.sortColumn(queryOptions.SortProperty)
+	if err != nil {
+		return "", err
+	}
+	direction := " ASC"
+	if queryOptions.SortDirection == SortDirectionDescending {
+		direction = " DESC"
+	}
+	return column + direction + ", " + t.name + ".message_cid" + direction, nil
+}
+
+// after returns a parameterized condition matching the rows that come after
+// queryOptions.Cursor in the order of the sort queryOptions describe, so
+// that a page is found by seeking to it rather than by counting the rows
+// before it.
+func (t sqlTable) after(queryOptions QueryOptions) (string, []interface{}, error) {
+	column, err := t.sortColumn(queryOptions.SortProperty)
+	if err != nil {
+		return "", nil, err
+	}
+	operator := ">"
+	if queryOptions.SortDirection == SortDirectionDescending {
+		operator = "<"
+	}
+	value := sqlText(queryOptions.Cursor.Value)
+	condition := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND %[3]s.message_cid %[2]s ?))", column, operator, t.name)
+	return condition, []interface{}{value, value, queryOptions.Cursor.MessageCid}, nil
+}
+
+// sqlTags returns the tags among indexes, by name.  The tags tables keep
+// each as text, and numeric ones as a number too.
+func sqlTags(indexes KeyValues) map[string]interface{} {
+	tags := map[string]interface{}{}
+	for property, value := range indexes {
+		if tag, ok := strings.CutPrefix(property, tagPrefix); ok && tag != "" {
+			tags[tag] = value
+		}
+	}
+	return tags
+}
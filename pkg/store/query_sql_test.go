@@ -0,0 +1,116 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLTableWhere(t *testing.T) {
+	t.Run("builds parameterized conditions", func(t *testing.T) {
+		condition, vars, err := messageStoreTable.where([]Filter{
+			{
+				"recordId":          "a-record",
+				"isLatestBaseState": true,
+				"messageTimestamp":  RangeFilter{"gt": "2024", "lte": "2025"},
+			},
+			{
+				"schema":   []interface{}{"post", "reply"},
+				"tag.size": RangeFilter{"gte": 5},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "(("+
+			"message_store.is_latest_base_state = ? AND "+
+			"message_store.message_timestamp > ? AND message_store.message_timestamp <= ? AND "+
+			"message_store.record_id = ?"+
+			") OR ("+
+			"message_store.schema IN ? AND "+
+			"EXISTS (SELECT 1 FROM message_store_tags WHERE message_store_tags.message_store_id = message_store.id "+
+			"AND message_store_tags.name = ? AND message_store_tags.number_value >= ?)"+
+			"))", condition)
+		assert.Equal(t, []interface{}{
+			"true", "2024", "2025", "a-record",
+			[]string{"post", "reply"}, "size", float64(5),
+		}, vars)
+	})
+
+	t.Run("compares numeric columns as numbers with numbers", func(t *testing.T) {
+		condition, vars, err := messageStoreTable.where([]Filter{{"dataSize": RangeFilter{"gte": 5, "lt": "100"}}})
+		require.NoError(t, err)
+		assert.Equal(t, "((CAST(NULLIF(message_store.data_size, '') AS NUMERIC) >= ? AND message_store.data_size < ?))", condition)
+		assert.Equal(t, []interface{}{float64(5), "100"}, vars)
+	})
+
+	t.Run("matches everything without conditions", func(t *testing.T) {
+		for _, filters := range [][]Filter{nil, {{}}, {{"schema": "post"}, {}}} {
+			condition, vars, err := eventLogTable.where(filters)
+			require.NoError(t, err)
+			assert.Empty(t, condition)
+			assert.Empty(t, vars)
+		}
+	})
+
+	t.Run("keeps tag names out of the query", func(t *testing.T) {
+		condition, vars, err := eventLogTable.where([]Filter{{"tag.x; DROP TABLE event_logs": "y"}})
+		require.NoError(t, err)
+		assert.NotContains(t, condition, "DROP")
+		assert.Equal(t, []interface{}{"x; DROP TABLE event_logs", "y"}, vars)
+	})
+
+	t.Run("rejects unknown properties", func(t *testing.T) {
+		for _, property := range []string{"recordId; DROP TABLE message_store", "encodedData", "tag."} {
+			_, _, err := messageStoreTable.where([]Filter{{property: "y"}})
+			var unknown *UnknownPropertyError
+			require.ErrorAs(t, err, &unknown)
+			assert.Equal(t, property, unknown.Property)
+		}
+
+		_, err := messageStoreTable.order(QueryOptions{SortProperty: "id; DROP TABLE message_store"})
+		assert.ErrorAs(t, err, new(*UnknownPropertyError))
+	})
+
+	t.Run("rejects unknown range bounds", func(t *testing.T) {
+		_, _, err := messageStoreTable.where([]Filter{{"dataSize": RangeFilter{"ne": 1}}})
+		assert.Error(t, err)
+	})
+}
+
+func TestSQLTableOrder(t *testing.T) {
+	queryOptions, err := buildQueryOptions(&MessageSort{Property: "dateCreated", Direction: "DESC"}, nil)
+	require.NoError(t, err)
+	order, err := messageStoreTable.order(queryOptions)
+	require.NoError(t, err)
+	assert.Equal(t, "message_store.date_created DESC, message_store.message_cid DESC", order)
+
+	queryOptions, err = buildQueryOptions(nil, nil)
+	require.NoError(t, err)
+	order, err = messageStoreTable.order(queryOptions)
+	require.NoError(t, err)
+	assert.Equal(t, "message_store.message_timestamp ASC, message_store.message_cid ASC", order)
+
+	order, err = messageStoreTable.order(QueryOptions{SortProperty: "dataSize", SortDirection: SortDirectionAscending})
+	require.NoError(t, err)
+	assert.Equal(t, "CAST(NULLIF(message_store.data_size, '') AS NUMERIC) ASC, message_store.message_cid ASC", order)
+}
+
+func TestSQLTableAfter(t *testing.T) {
+	cursor, err := EncodeCursor(PaginationCursor{MessageCid: "bafy", Value: "2024-01-01"})
+	require.NoError(t, err)
+
+	for direction, operator := range map[SortDirection]string{SortAscending: ">", SortDescending: "<"} {
+		queryOptions, err := buildQueryOptions(&MessageSort{DateCreated: &direction}, &Pagination{Limit: 10, Cursor: cursor})
+		require.NoError(t, err)
+		assert.Equal(t, 11, queryOptions.Limit)
+
+		condition, vars, err := messageStoreTable.after(queryOptions)
+		require.NoError(t, err)
+		assert.Equal(t, "(message_store.date_created "+operator+" ? OR "+
+			"(message_store.date_created = ? AND message_store.message_cid "+operator+" ?))", condition)
+		assert.Equal(t, []interface{}{"2024-01-01", "2024-01-01", "bafy"}, vars)
+	}
+
+	_, err = buildQueryOptions(nil, &Pagination{Limit: 10, Cursor: "10"})
+	assert.Error(t, err)
+}
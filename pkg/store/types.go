@@ -4,25 +4,31 @@ import (
 	"database/sql"
 
 	"github.com/abaxxtech/abaxx-id-go/pkg/store/config"
+	"github.com/abaxxtech/abaxx-id-go/pkg/store/models"
 )
 
 type GenericMessage interface{}
 
-type DataFilter struct {
-	Property string
-	Operator string
-	Value    interface{}
-}
-
 // MessageStoreSQL represents a message store using SQL database
 type MessageStoreSQL struct {
 	db     *sql.DB
 	config MessageStoreSQLConfig
 }
 
-// MessageStoreSQLConfig holds configuration for MessageStoreSQL
+// MessageStoreSQLConfig holds configuration for the SQL stores
 type MessageStoreSQLConfig struct {
 	DBConfig config.DBConfig
+	// DBProvider, when set, shares its database among the stores given it;
+	// otherwise each store opens its own database of DBConfig
+	DBProvider *models.DBProvider
+}
+
+// dbProvider returns the DBProvider of the stores of config.
+func (config MessageStoreSQLConfig) dbProvider() *models.DBProvider {
+	if config.DBProvider != nil {
+		return config.DBProvider
+	}
+	return models.NewDBProvider(config.DBConfig)
 }
 
 // type KeyValues map[string]interface{}
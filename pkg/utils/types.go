@@ -15,6 +15,14 @@ type GenericMessage struct {
 type GenericSignaturePayload struct {
 	DescriptorCid      string `json:"descriptorCid"`
 	DelegatedGrantId   string `json:"delegatedGrantId,omitempty"`
-	PermissionsGrantId string `json:"permissionsGrantId,omitempty"`
+	PermissionGrantId  string `json:"permissionGrantId,omitempty"`
 	ProtocolRole       string `json:"protocolRole,omitempty"`
 }
+
+type RecordsWriteSignaturePayload struct {
+	GenericSignaturePayload
+	RecordId       string `json:"recordId"`
+	ContextId      string `json:"contextId,omitempty"`
+	AttestationCid string `json:"attestationCid,omitempty"`
+	EncryptionCid  string `json:"encryptionCid,omitempty"`
+}